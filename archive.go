@@ -0,0 +1,717 @@
+package fs
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// UnsafePathError is the error returned when an archive entry would
+// be written, or a link would point, outside the destination directory
+type UnsafePathError struct {
+	Path string
+}
+
+func (e UnsafePathError) Error() string {
+	return fmt.Sprintf("%s: path escapes the destination directory", e.Path)
+}
+
+// ErrArchiveLimit is returned when extracting an archive would exceed
+// one of the limits set in the ExtractOptions
+var ErrArchiveLimit = errors.New("archive extraction limit exceeded")
+
+// ErrNotPrivileged is returned when extracting an archive restoring
+// its owners, strictly, without running as root
+var ErrNotPrivileged = errors.New("restoring owners requires running as root")
+
+// xattrPAXPrefix prefixes the names of the PAX records storing the
+// extended attributes of tar entries, as GNU tar does
+const xattrPAXPrefix = "SCHILY.xattr."
+
+// ExtractOptions configures the extraction of an archive
+type ExtractOptions struct {
+	// MaxFiles is the maximum number of entries to extract, 0 for no limit
+	MaxFiles int
+
+	// MaxBytes is the maximum total uncompressed size, 0 for no limit
+	MaxBytes int64
+
+	// MaxFileBytes is the maximum size of a single entry, 0 for no limit
+	MaxFileBytes int64
+
+	// Progress, if set, is called after each entry is extracted with
+	// its name and the running totals of entries and bytes extracted
+	Progress func(name string, files int, bytes int64)
+
+	// Preserve restores the given attributes of tar entries: times,
+	// uid and gid, and the extended attributes stored when archiving
+	// with ArchiveOptions.Xattrs. Zip entries are not concerned.
+	// Unless running as root, owners are left as the extracting user,
+	// and attributes that cannot be set, e.g. trusted.* xattrs, are
+	// skipped, so that unprivileged extractions still succeed.
+	Preserve Preserve
+
+	// StrictPreserve makes the extraction fail, rather than skip, the
+	// attributes that cannot be restored, with ErrNotPrivileged for
+	// owners when not running as root
+	StrictPreserve bool
+}
+
+// Extract unpacks the tar, tar.gz (tgz), tar.zst (tzst) or zip archive, as given by its
+// file extension, into destDir, creating it if inexistant.
+// Entries that would be written outside of destDir, and symbolic or
+// hard links whose target is outside of destDir, are refused with an
+// UnsafePathError.
+func Extract(archivePath, destDir string, opts ExtractOptions) error {
+	if opts.Preserve&PreserveOwner != 0 && opts.StrictPreserve && os.Geteuid() != 0 {
+		return ErrNotPrivileged
+	}
+
+	if err := mkdirAll(OSFilesystem{}, destDir, 0755); err != nil {
+		return fmt.Errorf("unable to create extraction dir %s (%w)", destDir, err)
+	}
+
+	dest, err := filepath.Abs(destDir)
+	if err != nil {
+		return err
+	}
+
+	x := &extractor{dest: dest, opts: opts}
+
+	switch format := archiveFormat(archivePath); format {
+	case "zip":
+		return x.zip(archivePath)
+	case "tar", "tar.gz", "tar.zst":
+		fd, err := os.Open(archivePath)
+		if err != nil {
+			return err
+		}
+		defer fd.Close()
+
+		var r io.Reader = fd
+		switch format {
+		case "tar.gz":
+			gz, err := gzip.NewReader(fd)
+			if err != nil {
+				return fmt.Errorf("unable to read gzip archive %s (%w)", archivePath, err)
+			}
+			defer gz.Close()
+			r = gz
+		case "tar.zst":
+			zr, err := zstd.NewReader(fd)
+			if err != nil {
+				return fmt.Errorf("unable to read zstd archive %s (%w)", archivePath, err)
+			}
+			defer zr.Close()
+			r = zr
+		}
+
+		return x.tar(r)
+	}
+
+	return fmt.Errorf("unsupported archive format: %s", archivePath)
+}
+
+// ArchiveOptions configures the creation of an archive
+type ArchiveOptions struct {
+	// Reproducible makes the archive depend only on the tree's names,
+	// content and (normalised) modes: entries are sorted, timestamps,
+	// uid/gid and owner names are zeroed and modes are normalised to
+	// 0755 for directories and executables, 0644 otherwise. The same
+	// tree then always produces a byte-identical archive.
+	Reproducible bool
+
+	// Xattrs stores the extended attributes of tar entries, as PAX
+	// records, for Extract to restore with PreserveXattrs. Owners are
+	// always stored, unless Reproducible.
+	Xattrs bool
+}
+
+// epoch is the timestamp given to entries in reproducible zip archives,
+// which cannot represent dates before 1980
+var epoch = time.Date(1980, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+// CreateArchive packs the content of the srcDir tree into a tar,
+// tar.gz (tgz), tar.zst (tzst) or zip archive, as given by the archivePath extension.
+// Entry names are relative to srcDir.
+func CreateArchive(srcDir, archivePath string, opts ArchiveOptions) error {
+	format := archiveFormat(archivePath)
+	if format == "" {
+		return fmt.Errorf("unsupported archive format: %s", archivePath)
+	}
+
+	fd, err := os.Create(archivePath)
+	if err != nil {
+		return err
+	}
+
+	// comp compresses the archive, its trailer written once closed
+	var comp io.WriteCloser
+	var w io.Writer = fd
+	switch format {
+	case "tar.gz":
+		comp = gzip.NewWriter(fd)
+	case "tar.zst":
+		if comp, err = zstd.NewWriter(fd); err != nil {
+			fd.Close()
+			return err
+		}
+	}
+
+	if comp != nil {
+		w = comp
+	}
+
+	a := &archiver{root: srcDir, opts: opts}
+	if format == "zip" {
+		zw := zip.NewWriter(w)
+		a.zw = zw
+		err = a.walk()
+		if cerr := zw.Close(); err == nil {
+			err = cerr
+		}
+	} else {
+		tw := tar.NewWriter(w)
+		a.tw = tw
+		err = a.walk()
+		if cerr := tw.Close(); err == nil {
+			err = cerr
+		}
+	}
+
+	if comp != nil {
+		if cerr := comp.Close(); err == nil {
+			err = cerr
+		}
+	}
+
+	// The file system may only store the content once closed
+	if cerr := fd.Close(); err == nil {
+		err = cerr
+	}
+
+	if err != nil {
+		return fmt.Errorf("unable to create archive %s (%w)", archivePath, err)
+	}
+
+	return nil
+}
+
+// Archive packs the directory content into the archive at the given path.
+// See CreateArchive.
+func (d *Directory) Archive(archivePath string, opts ArchiveOptions) error {
+	return CreateArchive(d.Path, archivePath, opts)
+}
+
+// TarZst packs the directory content into a zstd compressed tar archive
+// at the given path, to which a .tar.zst suffix is added if missing
+func (d *Directory) TarZst(archivePath string, opts ArchiveOptions) error {
+	if archiveFormat(archivePath) != "tar.zst" {
+		archivePath += ".tar.zst"
+	}
+
+	return CreateArchive(d.Path, archivePath, opts)
+}
+
+type archiver struct {
+	root string
+	opts ArchiveOptions
+	tw   *tar.Writer
+	zw   *zip.Writer
+}
+
+func (a *archiver) walk() error {
+	var paths []string
+	err := filepath.Walk(
+		a.root,
+		func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+
+			if path != a.root {
+				paths = append(paths, path)
+			}
+
+			return nil
+		},
+	)
+
+	if err != nil {
+		return err
+	}
+
+	// filepath.Walk is already lexically ordered, but make no assumption
+	if a.opts.Reproducible {
+		sort.Strings(paths)
+	}
+
+	for _, path := range paths {
+		if err := a.add(path); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (a *archiver) add(path string) error {
+	info, err := os.Lstat(path)
+	if err != nil {
+		return err
+	}
+
+	rel, err := filepath.Rel(a.root, path)
+	if err != nil {
+		return err
+	}
+
+	name := filepath.ToSlash(rel)
+	if info.IsDir() {
+		name += "/"
+	}
+
+	var link string
+	if info.Mode()&os.ModeSymlink != 0 {
+		if link, err = os.Readlink(path); err != nil {
+			return err
+		}
+	}
+
+	if a.zw != nil {
+		return a.addZip(path, name, link, info)
+	}
+
+	return a.addTar(path, name, link, info)
+}
+
+// normMode returns the normalised mode for reproducible archives
+func normMode(mode os.FileMode) os.FileMode {
+	switch {
+	case mode&os.ModeSymlink != 0:
+		return os.ModeSymlink | 0777
+	case mode.IsDir():
+		return os.ModeDir | 0755
+	case mode&0111 != 0:
+		return 0755
+	}
+
+	return 0644
+}
+
+func (a *archiver) addTar(path, name, link string, info os.FileInfo) error {
+	hdr, err := tar.FileInfoHeader(info, link)
+	if err != nil {
+		return err
+	}
+
+	hdr.Name = name
+	if a.opts.Reproducible {
+		hdr.Mode = int64(normMode(info.Mode()).Perm())
+		hdr.ModTime = time.Unix(0, 0)
+		hdr.AccessTime = time.Time{}
+		hdr.ChangeTime = time.Time{}
+		hdr.Uid, hdr.Gid = 0, 0
+		hdr.Uname, hdr.Gname = "", ""
+		hdr.Format = tar.FormatPAX
+	}
+
+	if a.opts.Xattrs {
+		attrs, err := readXattrs(path)
+		if err != nil {
+			return err
+		}
+
+		for name, value := range attrs {
+			if hdr.PAXRecords == nil {
+				hdr.PAXRecords = map[string]string{}
+			}
+			hdr.PAXRecords[xattrPAXPrefix+name] = string(value)
+			hdr.Format = tar.FormatPAX
+		}
+	}
+
+	if err := a.tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+
+	if !info.Mode().IsRegular() {
+		return nil
+	}
+
+	return copyFrom(a.tw, path)
+}
+
+func (a *archiver) addZip(path, name, link string, info os.FileInfo) error {
+	hdr, err := zip.FileInfoHeader(info)
+	if err != nil {
+		return err
+	}
+
+	hdr.Name = name
+	if info.Mode().IsRegular() {
+		hdr.Method = zip.Deflate
+	}
+
+	if a.opts.Reproducible {
+		hdr.SetMode(normMode(info.Mode()))
+		hdr.Modified = epoch
+	}
+
+	w, err := a.zw.CreateHeader(hdr)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case link != "":
+		_, err = io.WriteString(w, link)
+		return err
+	case info.Mode().IsRegular():
+		return copyFrom(w, path)
+	}
+
+	return nil
+}
+
+// copyFrom copies the content of the file at path into w
+func copyFrom(w io.Writer, path string) error {
+	fd, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer fd.Close()
+
+	_, err = io.Copy(w, fd)
+	return err
+}
+
+// archiveFormat returns the archive format given the file name extension
+func archiveFormat(path string) string {
+	name := strings.ToLower(filepath.Base(path))
+	switch {
+	case strings.HasSuffix(name, ".zip"):
+		return "zip"
+	case strings.HasSuffix(name, ".tar.gz"), strings.HasSuffix(name, ".tgz"):
+		return "tar.gz"
+	case strings.HasSuffix(name, ".tar.zst"), strings.HasSuffix(name, ".tzst"):
+		return "tar.zst"
+	case strings.HasSuffix(name, ".tar"):
+		return "tar"
+	}
+
+	return ""
+}
+
+type extractor struct {
+	dest  string
+	opts  ExtractOptions
+	files int
+	bytes int64
+
+	// dirTimes restore the times of the extracted directories,
+	// once their content is extracted
+	dirTimes []func() error
+
+	// links are the paths of the extracted symlinks
+	links []string
+}
+
+// target returns the absolute path at which the archive entry
+// name should be extracted, if it lies within the destination. The
+// path is resolved with IsWithin, as symlinks extracted earlier could
+// otherwise redirect the entry outside of the destination.
+func (x *extractor) target(name string) (string, error) {
+	path := filepath.Join(x.dest, name)
+	ok, err := IsWithin(x.dest, path)
+	if err != nil {
+		return "", err
+	}
+
+	if !ok {
+		return "", UnsafePathError{name}
+	}
+
+	return path, nil
+}
+
+func (x *extractor) count() error {
+	x.files++
+	if x.opts.MaxFiles > 0 && x.files > x.opts.MaxFiles {
+		return fmt.Errorf("more than %d entries (%w)", x.opts.MaxFiles, ErrArchiveLimit)
+	}
+
+	return nil
+}
+
+func (x *extractor) progress(name string) {
+	if x.opts.Progress != nil {
+		x.opts.Progress(name, x.files, x.bytes)
+	}
+}
+
+func (x *extractor) writeFile(path string, r io.Reader, mode os.FileMode) error {
+	if err := mkdirAll(OSFilesystem{}, filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+
+	fd, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, mode.Perm())
+	if err != nil {
+		return err
+	}
+	defer fd.Close()
+
+	// Never trust the sizes declared in the archive headers
+	limit := int64(-1)
+	if x.opts.MaxFileBytes > 0 {
+		limit = x.opts.MaxFileBytes
+	}
+
+	if x.opts.MaxBytes > 0 && (limit < 0 || x.opts.MaxBytes-x.bytes < limit) {
+		limit = x.opts.MaxBytes - x.bytes
+	}
+
+	if limit >= 0 {
+		r = io.LimitReader(r, limit+1)
+	}
+
+	n, err := io.Copy(fd, r)
+	x.bytes += n
+	if err != nil {
+		return err
+	}
+
+	if limit >= 0 && n > limit {
+		return fmt.Errorf("%s: size limit reached (%w)", path, ErrArchiveLimit)
+	}
+
+	return nil
+}
+
+func (x *extractor) symlink(path, linkname string) error {
+	// Not Join, which would clean ".." lexically, before links
+	tgt := linkname
+	if !filepath.IsAbs(tgt) {
+		tgt = filepath.Dir(path) + string(filepath.Separator) + tgt
+	}
+
+	ok, err := IsWithin(x.dest, tgt)
+	if err != nil {
+		return err
+	}
+
+	if !ok {
+		return UnsafePathError{linkname}
+	}
+
+	if err := mkdirAll(OSFilesystem{}, filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+
+	if err := os.Symlink(linkname, path); err != nil {
+		return err
+	}
+
+	x.links = append(x.links, path)
+	return nil
+}
+
+// checkLinks checks again that the extracted symlinks lead within the
+// destination, now that all entries are. Their targets are resolved
+// lexically below a missing component, which later entries can create,
+// e.g. as a link, leading them out. Those links are removed.
+func (x *extractor) checkLinks() error {
+	for _, path := range x.links {
+		ok, err := IsWithin(x.dest, path)
+		if err != nil {
+			return err
+		}
+
+		if !ok {
+			linkname, _ := os.Readlink(path)
+			os.Remove(path)
+			return UnsafePathError{linkname}
+		}
+	}
+
+	return nil
+}
+
+func (x *extractor) tar(r io.Reader) error {
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			if err := x.checkLinks(); err != nil {
+				return err
+			}
+
+			// Deepest directories first, as setting the
+			// times of the others would change them
+			for i := len(x.dirTimes) - 1; i >= 0; i-- {
+				if err := x.dirTimes[i](); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+
+		if err != nil {
+			return fmt.Errorf("unable to read tar archive (%w)", err)
+		}
+
+		if err := x.count(); err != nil {
+			return err
+		}
+
+		path, err := x.target(hdr.Name)
+		if err != nil {
+			return err
+		}
+
+		mode := hdr.FileInfo().Mode()
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			err = mkdirAll(OSFilesystem{}, path, mode.Perm()|0700)
+		case tar.TypeReg:
+			err = x.writeFile(path, tr, mode)
+		case tar.TypeSymlink:
+			err = x.symlink(path, hdr.Linkname)
+		case tar.TypeLink:
+			var tgt string
+			if tgt, err = x.target(hdr.Linkname); err == nil {
+				err = os.Link(tgt, path)
+			}
+		default:
+			// devices, fifos etc. are silently skipped
+		}
+
+		if err == nil && x.opts.Preserve != 0 {
+			switch hdr.Typeflag {
+			case tar.TypeDir, tar.TypeReg, tar.TypeSymlink:
+				err = x.restore(path, hdr)
+			}
+		}
+
+		if err != nil {
+			return err
+		}
+
+		x.progress(hdr.Name)
+	}
+}
+
+// restore gives the extracted entry at path the attributes of its
+// header selected by the options. The owners are restored first,
+// changing them clearing some of the other attributes.
+func (x *extractor) restore(path string, hdr *tar.Header) error {
+	if x.opts.Preserve&PreserveOwner != 0 && os.Geteuid() == 0 {
+		if err := os.Lchown(path, hdr.Uid, hdr.Gid); err != nil {
+			return err
+		}
+
+		// Changing the owner clears the setuid and setgid bits
+		mode := hdr.FileInfo().Mode()
+		if mode&(os.ModeSetuid|os.ModeSetgid) != 0 && hdr.Typeflag != tar.TypeSymlink {
+			if err := os.Chmod(path, mode); err != nil {
+				return err
+			}
+		}
+	}
+
+	if x.opts.Preserve&PreserveXattrs != 0 {
+		for key, value := range hdr.PAXRecords {
+			if !strings.HasPrefix(key, xattrPAXPrefix) {
+				continue
+			}
+
+			name := strings.TrimPrefix(key, xattrPAXPrefix)
+			if err := writeXattr(path, name, []byte(value)); err != nil && x.opts.StrictPreserve {
+				return err
+			}
+		}
+	}
+
+	// Symlink times cannot be set portably
+	if x.opts.Preserve&PreserveTimes == 0 || hdr.Typeflag == tar.TypeSymlink {
+		return nil
+	}
+
+	atime := hdr.AccessTime
+	if atime.IsZero() {
+		atime = hdr.ModTime
+	}
+
+	setTimes := func() error {
+		return os.Chtimes(path, atime, hdr.ModTime)
+	}
+
+	if hdr.Typeflag == tar.TypeDir {
+		x.dirTimes = append(x.dirTimes, setTimes)
+		return nil
+	}
+
+	return setTimes()
+}
+
+func (x *extractor) zip(archivePath string) error {
+	zr, err := zip.OpenReader(archivePath)
+	if err != nil {
+		return fmt.Errorf("unable to read zip archive %s (%w)", archivePath, err)
+	}
+	defer zr.Close()
+
+	for _, zf := range zr.File {
+		if err := x.count(); err != nil {
+			return err
+		}
+
+		path, err := x.target(zf.Name)
+		if err != nil {
+			return err
+		}
+
+		if err := x.zipEntry(zf, path); err != nil {
+			return err
+		}
+
+		x.progress(zf.Name)
+	}
+
+	return x.checkLinks()
+}
+
+func (x *extractor) zipEntry(zf *zip.File, path string) error {
+	mode := zf.Mode()
+	if mode.IsDir() {
+		return mkdirAll(OSFilesystem{}, path, mode.Perm()|0700)
+	}
+
+	rc, err := zf.Open()
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+
+	if mode&os.ModeSymlink != 0 {
+		linkname, err := ioutil.ReadAll(io.LimitReader(rc, 4096))
+		if err != nil {
+			return err
+		}
+
+		return x.symlink(path, string(linkname))
+	}
+
+	return x.writeFile(path, rc, mode)
+}
@@ -0,0 +1,253 @@
+package fs_test
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/brinick/fs"
+)
+
+type archiveEntry struct {
+	name     string
+	body     string
+	linkname string
+}
+
+func writeTarGz(t *testing.T, path string, entries []archiveEntry) {
+	fd, err := os.Create(path)
+	if err != nil {
+		t.Fatalf("unable to create archive: %v", err)
+	}
+	defer fd.Close()
+
+	gz := gzip.NewWriter(fd)
+	defer gz.Close()
+
+	tw := tar.NewWriter(gz)
+	defer tw.Close()
+
+	for _, e := range entries {
+		hdr := &tar.Header{Name: e.name, Mode: 0644, Size: int64(len(e.body)), Typeflag: tar.TypeReg}
+		if e.linkname != "" {
+			hdr.Typeflag = tar.TypeSymlink
+			hdr.Linkname = e.linkname
+			hdr.Size = 0
+		}
+
+		if err := tw.WriteHeader(hdr); err != nil {
+			t.Fatalf("unable to write tar header: %v", err)
+		}
+
+		if _, err := tw.Write([]byte(e.body)); err != nil {
+			t.Fatalf("unable to write tar entry: %v", err)
+		}
+	}
+}
+
+func writeZip(t *testing.T, path string, entries []archiveEntry) {
+	fd, err := os.Create(path)
+	if err != nil {
+		t.Fatalf("unable to create archive: %v", err)
+	}
+	defer fd.Close()
+
+	zw := zip.NewWriter(fd)
+	defer zw.Close()
+
+	for _, e := range entries {
+		w, err := zw.Create(e.name)
+		if err != nil {
+			t.Fatalf("unable to create zip entry: %v", err)
+		}
+
+		if _, err := w.Write([]byte(e.body)); err != nil {
+			t.Fatalf("unable to write zip entry: %v", err)
+		}
+	}
+}
+
+func TestExtract(t *testing.T) {
+	dir, clean := tempDir()
+	defer clean()
+
+	tests := []struct {
+		name      string
+		archive   string
+		entries   []archiveEntry
+		opts      fs.ExtractOptions
+		expectErr error
+	}{
+		{
+			"tar.gz ok", "ok.tar.gz",
+			[]archiveEntry{{name: "a/b.txt", body: "hello"}, {name: "a/link", linkname: "b.txt"}},
+			fs.ExtractOptions{}, nil,
+		},
+		{
+			"zip ok", "ok.zip",
+			[]archiveEntry{{name: "a/b.txt", body: "hello"}},
+			fs.ExtractOptions{}, nil,
+		},
+		{
+			"tar path traversal", "slip.tar.gz",
+			[]archiveEntry{{name: "../evil.txt", body: "x"}},
+			fs.ExtractOptions{}, fs.UnsafePathError{"../evil.txt"},
+		},
+		{
+			"zip path traversal", "slip.zip",
+			[]archiveEntry{{name: "a/../../evil.txt", body: "x"}},
+			fs.ExtractOptions{}, fs.UnsafePathError{"a/../../evil.txt"},
+		},
+		{
+			"symlink escape", "link.tar.gz",
+			[]archiveEntry{{name: "link", linkname: "/etc"}},
+			fs.ExtractOptions{}, fs.UnsafePathError{"/etc"},
+		},
+		{
+			"symlink chain escape", "chain.tar.gz",
+			[]archiveEntry{
+				{name: "a", linkname: "."},
+				{name: "a/esc", linkname: ".."},
+				{name: "a/esc/pwned", body: "x"},
+			},
+			fs.ExtractOptions{}, fs.UnsafePathError{".."},
+		},
+		{
+			"symlink escape once created", "later.tar.gz",
+			[]archiveEntry{
+				{name: "sub/a", body: "x"},
+				{name: "sub/L", linkname: "m/../../x"},
+				{name: "sub/m", linkname: "."},
+			},
+			fs.ExtractOptions{}, fs.UnsafePathError{"m/../../x"},
+		},
+		{
+			"too many files", "many.zip",
+			[]archiveEntry{{name: "a"}, {name: "b"}},
+			fs.ExtractOptions{MaxFiles: 1}, fs.ErrArchiveLimit,
+		},
+		{
+			"too many bytes", "big.tar.gz",
+			[]archiveEntry{{name: "a", body: "12345"}},
+			fs.ExtractOptions{MaxBytes: 4}, fs.ErrArchiveLimit,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			archive := filepath.Join(dir, tt.archive)
+			if filepath.Ext(archive) == ".zip" {
+				writeZip(t, archive, tt.entries)
+			} else {
+				writeTarGz(t, archive, tt.entries)
+			}
+
+			dest := filepath.Join(dir, "out", tt.name)
+			err := fs.Extract(archive, dest, tt.opts)
+			if !errors.Is(err, tt.expectErr) {
+				t.Fatalf("expected error %v, got %v", tt.expectErr, err)
+			}
+
+			if tt.expectErr != nil {
+				return
+			}
+
+			text, err := fs.NewFile(filepath.Join(dest, "a/b.txt")).Text()
+			if err != nil {
+				t.Fatalf("unable to read extracted file: %v", err)
+			}
+
+			if text != "hello" {
+				t.Errorf("expected extracted content hello, got %s", text)
+			}
+		})
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, "out", "evil.txt")); !os.IsNotExist(err) {
+		t.Error("path traversal entry was written outside of the destination")
+	}
+
+	if _, err := os.Lstat(filepath.Join(dir, "out", "pwned")); !os.IsNotExist(err) {
+		t.Error("symlink chain entry was written outside of the destination")
+	}
+
+	if _, err := os.Lstat(filepath.Join(dir, "out", "symlink escape once created", "sub", "L")); !os.IsNotExist(err) {
+		t.Error("symlink leading outside of the destination was left")
+	}
+}
+
+func TestCreateArchiveReproducible(t *testing.T) {
+	dir, clean := tempDir()
+	defer clean()
+
+	tree := map[string]string{"a.txt": "a", "sub/b.txt": "b"}
+	one, two := filepath.Join(dir, "one"), filepath.Join(dir, "two")
+	makeTree(t, one, tree)
+	makeTree(t, two, tree)
+
+	old := time.Now().Add(-time.Hour)
+	if err := os.Chtimes(filepath.Join(two, "a.txt"), old, old); err != nil {
+		t.Fatalf("unable to change file times: %v", err)
+	}
+
+	for _, ext := range []string{".tar", ".tar.gz", ".zip"} {
+		t.Run(ext, func(t *testing.T) {
+			var hashes []string
+			for _, src := range []string{one, two} {
+				archive := src + ext
+				if err := fs.CreateArchive(src, archive, fs.ArchiveOptions{Reproducible: true}); err != nil {
+					t.Fatalf("unable to create archive: %v", err)
+				}
+
+				h, err := fs.NewFile(archive).Hash(fs.SHA256)
+				if err != nil {
+					t.Fatalf("unable to hash archive: %v", err)
+				}
+				hashes = append(hashes, h)
+			}
+
+			if hashes[0] != hashes[1] {
+				t.Error("same tree content produced different archives")
+			}
+
+			dest := filepath.Join(dir, "out"+ext)
+			if err := fs.Extract(one+ext, dest, fs.ExtractOptions{}); err != nil {
+				t.Fatalf("unable to extract created archive: %v", err)
+			}
+
+			text, err := fs.NewFile(filepath.Join(dest, "sub/b.txt")).Text()
+			if err != nil || text != "b" {
+				t.Errorf("unexpected extracted content %q (%v)", text, err)
+			}
+		})
+	}
+}
+
+func TestCreateArchiveCloseError(t *testing.T) {
+	if _, err := os.Stat("/dev/full"); err != nil {
+		t.Skip("no /dev/full to fail writes")
+	}
+
+	dir, clean := tempDir()
+	defer clean()
+
+	src := filepath.Join(dir, "src")
+	makeTree(t, src, map[string]string{"a.txt": "hello"})
+
+	// The compressors buffer small archives, only writing them once closed
+	for _, name := range []string{"full.tar.gz", "full.tar.zst"} {
+		archive := filepath.Join(dir, name)
+		if err := os.Symlink("/dev/full", archive); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := fs.CreateArchive(src, archive, fs.ArchiveOptions{}); err == nil {
+			t.Errorf("%s: expected an error writing the archive to a full device", name)
+		}
+	}
+}
@@ -0,0 +1,56 @@
+package fs
+
+import "sync"
+
+// fdBudget caps the number of file descriptors held at once
+type fdBudget struct {
+	mu   sync.Mutex
+	cond *sync.Cond
+	max  int
+	used int
+}
+
+// openFiles is the budget of the walks, copies, hashes and greps
+var openFiles = newFDBudget()
+
+func newFDBudget() *fdBudget {
+	b := &fdBudget{}
+	b.cond = sync.NewCond(&b.mu)
+	return b
+}
+
+// SetMaxOpenFiles caps at n the number of files, and directories, the
+// package's walks, copies, hashes and greps hold open at once, across
+// all goroutines, so that large parallel runs stay within the open
+// files limit. Operations over the cap wait for others to close their
+// files. A cap <= 0, the default, means no cap.
+func SetMaxOpenFiles(n int) {
+	openFiles.mu.Lock()
+	openFiles.max = n
+	openFiles.mu.Unlock()
+
+	// Those waiting may now fit
+	openFiles.cond.Broadcast()
+}
+
+// acquire waits until n more descriptors fit in the budget, and takes
+// them. More than the whole budget is taken once nothing else is held.
+func (b *fdBudget) acquire(n int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for b.max > 0 && b.used > 0 && b.used+n > b.max {
+		b.cond.Wait()
+	}
+
+	b.used += n
+}
+
+// release returns n descriptors to the budget
+func (b *fdBudget) release(n int) {
+	b.mu.Lock()
+	b.used -= n
+	b.mu.Unlock()
+
+	b.cond.Broadcast()
+}
@@ -0,0 +1,118 @@
+package fs_test
+
+import (
+	"fmt"
+	iofs "io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/brinick/fs"
+)
+
+// countingFS is the OS file system, recording the
+// maximum number of files open at once through it
+type countingFS struct {
+	fs.OSFilesystem
+	mu   sync.Mutex
+	open int
+	max  int
+}
+
+func (c *countingFS) opened() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.open++
+	if c.open > c.max {
+		c.max = c.open
+	}
+}
+
+// slowly gives other copies the time to open their files
+func (c *countingFS) slowly() {
+	time.Sleep(time.Millisecond)
+}
+
+func (c *countingFS) closed() {
+	c.mu.Lock()
+	c.open--
+	c.mu.Unlock()
+}
+
+func (c *countingFS) Open(name string) (iofs.File, error) {
+	f, err := c.OSFilesystem.Open(name)
+	if err != nil {
+		return nil, err
+	}
+
+	c.opened()
+	c.slowly()
+	return &countedFile{File: f.(*os.File), fs: c}, nil
+}
+
+func (c *countingFS) OpenFile(name string, flag int, perm os.FileMode) (fs.FileHandle, error) {
+	f, err := c.OSFilesystem.OpenFile(name, flag, perm)
+	if err != nil {
+		return nil, err
+	}
+
+	c.opened()
+	c.slowly()
+	return &countedFile{File: f.(*os.File), fs: c}, nil
+}
+
+type countedFile struct {
+	*os.File
+	fs *countingFS
+}
+
+func (f *countedFile) Close() error {
+	f.fs.closed()
+	return f.File.Close()
+}
+
+func TestSetMaxOpenFiles(t *testing.T) {
+	sizes := map[string]int{}
+	for i := 0; i < 50; i++ {
+		sizes[fmt.Sprintf("f%02d", i)] = 100000
+	}
+
+	root := newTree(t, sizes)
+	defer fs.SetMaxOpenFiles(0)
+
+	for _, max := range []int{0, 1, 4} {
+		t.Run(fmt.Sprintf("max %d", max), func(t *testing.T) {
+			fs.SetMaxOpenFiles(max)
+
+			sys := &countingFS{}
+			src := fs.NewDirOn(sys, root, "src")
+			dst := fs.NewDirOn(sys, root, fmt.Sprintf("dst%d", max))
+			if err := src.CopyToDir(dst, fs.WithConcurrency(8)); err != nil {
+				t.Fatalf("unable to copy: %v", err)
+			}
+
+			// A copy holds its source and destination open,
+			// even with a cap of 1
+			limit := max
+			if limit < 2 {
+				limit = 2
+			}
+
+			if max > 0 && sys.max > limit {
+				t.Errorf("expected at most %d files open at once, got %d", limit, sys.max)
+			}
+
+			if max == 0 && sys.max <= 2 {
+				t.Errorf("expected concurrent copies without a cap")
+			}
+
+			names, err := filepath.Glob(filepath.Join(dst.Path, "*"))
+			if err != nil || len(names) != len(sizes) {
+				t.Errorf("expected %d files copied, got %d (%v)", len(sizes), len(names), err)
+			}
+		})
+	}
+}
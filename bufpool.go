@@ -0,0 +1,162 @@
+package fs
+
+import (
+	"io"
+	"sync"
+	"sync/atomic"
+)
+
+// defaultBufferSize is the initial size of the pooled IO buffers
+const defaultBufferSize = 64 * 1024
+
+var (
+	bufSize = int64(defaultBufferSize)
+	bufPool sync.Pool
+)
+
+// SetBufferSize sets the size in bytes of the pooled buffers used
+// to copy, hash and stream file content. Buffers of the previous
+// size are dropped as they are returned to the pool.
+// Sizes below 512 bytes are ignored.
+func SetBufferSize(size int) {
+	if size < 512 {
+		return
+	}
+
+	atomic.StoreInt64(&bufSize, int64(size))
+}
+
+// BufferSize returns the size in bytes of the pooled IO buffers
+func BufferSize() int {
+	return int(atomic.LoadInt64(&bufSize))
+}
+
+// getBuf returns a buffer from the pool, of the current size.
+// It should be returned with putBuf once no longer used.
+func getBuf() *[]byte {
+	size := BufferSize()
+	if b, ok := bufPool.Get().(*[]byte); ok && len(*b) == size {
+		return b
+	}
+
+	b := make([]byte, size)
+	return &b
+}
+
+func putBuf(b *[]byte) {
+	if len(*b) == BufferSize() {
+		bufPool.Put(b)
+	}
+}
+
+// copyBuffer is io.Copy using a pooled buffer
+func copyBuffer(dst io.Writer, src io.Reader) (int64, error) {
+	buf := getBuf()
+	defer putBuf(buf)
+
+	// Hide any ReaderFrom/WriterTo, which would bypass the buffer
+	return io.CopyBuffer(struct{ io.Writer }{dst}, struct{ io.Reader }{src}, *buf)
+}
+
+// ------------------------------------------------------------------
+
+// bufferedReader reads an open file through a pooled buffer
+type bufferedReader struct {
+	fd   io.ReadCloser
+	buf  *[]byte
+	r, w int
+}
+
+func newBufferedReader(fd io.ReadCloser) *bufferedReader {
+	return &bufferedReader{fd: fd, buf: getBuf()}
+}
+
+func (br *bufferedReader) Read(p []byte) (int, error) {
+	if br.r == br.w {
+		// Large reads gain nothing from the buffer
+		if len(p) >= len(*br.buf) {
+			return br.fd.Read(p)
+		}
+
+		n, err := br.fd.Read(*br.buf)
+		if n == 0 {
+			return 0, err
+		}
+		br.r, br.w = 0, n
+	}
+
+	n := copy(p, (*br.buf)[br.r:br.w])
+	br.r += n
+	return n, nil
+}
+
+func (br *bufferedReader) Close() error {
+	if br.buf != nil {
+		putBuf(br.buf)
+		br.buf = nil
+	}
+
+	return br.fd.Close()
+}
+
+// bufferedWriter writes to an open file through a pooled buffer,
+// which is flushed when full and on Close
+type bufferedWriter struct {
+	fd  io.WriteCloser
+	buf *[]byte
+	n   int
+}
+
+func newBufferedWriter(fd io.WriteCloser) *bufferedWriter {
+	return &bufferedWriter{fd: fd, buf: getBuf()}
+}
+
+func (bw *bufferedWriter) Write(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 {
+		if bw.n == 0 && len(p) >= len(*bw.buf) {
+			// Large writes gain nothing from the buffer
+			n, err := bw.fd.Write(p)
+			return written + n, err
+		}
+
+		n := copy((*bw.buf)[bw.n:], p)
+		bw.n += n
+		written += n
+		p = p[n:]
+
+		if bw.n == len(*bw.buf) {
+			if err := bw.flush(); err != nil {
+				return written, err
+			}
+		}
+	}
+
+	return written, nil
+}
+
+func (bw *bufferedWriter) flush() error {
+	if bw.n == 0 {
+		return nil
+	}
+
+	_, err := bw.fd.Write((*bw.buf)[:bw.n])
+	bw.n = 0
+	return err
+}
+
+func (bw *bufferedWriter) Close() error {
+	if bw.buf == nil {
+		return bw.fd.Close()
+	}
+
+	err := bw.flush()
+	putBuf(bw.buf)
+	bw.buf = nil
+
+	if cerr := bw.fd.Close(); err == nil {
+		err = cerr
+	}
+
+	return err
+}
@@ -0,0 +1,79 @@
+package fs_test
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/brinick/fs"
+)
+
+func TestBufferedStreams(t *testing.T) {
+	defer fs.SetBufferSize(fs.BufferSize())
+	fs.SetBufferSize(512)
+
+	if fs.BufferSize() != 512 {
+		t.Fatalf("expected buffer size 512, got %d", fs.BufferSize())
+	}
+
+	f, clean := newFile()
+	defer clean()
+
+	data := bytes.Repeat([]byte("0123456789abcdef"), 1000)
+
+	w, err := f.Writer()
+	if err != nil {
+		t.Fatalf("unable to open file for writing: %v", err)
+	}
+
+	// Mix small (buffered) and large (direct) writes
+	for _, chunk := range [][]byte{data[:10], data[10:2000], data[2000:2100], data[2100:]} {
+		if _, err := w.Write(chunk); err != nil {
+			t.Fatalf("unable to write chunk: %v", err)
+		}
+	}
+
+	if err := w.Close(); err != nil {
+		t.Fatalf("unable to close file: %v", err)
+	}
+
+	r, err := f.Reader()
+	if err != nil {
+		t.Fatalf("unable to open file for reading: %v", err)
+	}
+	defer r.Close()
+
+	var got bytes.Buffer
+	small := make([]byte, 100)
+	if _, err := io.ReadFull(r, small); err != nil {
+		t.Fatalf("unable to read: %v", err)
+	}
+	got.Write(small)
+
+	rest, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatalf("unable to read: %v", err)
+	}
+	got.Write(rest)
+
+	if !bytes.Equal(got.Bytes(), data) {
+		t.Error("streamed content differs from written content")
+	}
+
+	dst := filepath.Join(f.DirPath(), "copy")
+	if err := newDir(t, dst).Create(0755); err != nil {
+		t.Fatalf("unable to create copy dir: %v", err)
+	}
+
+	if err := f.CopyTo(dst); err != nil {
+		t.Fatalf("unable to copy file: %v", err)
+	}
+
+	h1, _ := f.Hash(fs.SHA256)
+	h2, _ := fs.NewFile(filepath.Join(dst, f.Name())).Hash(fs.SHA256)
+	if h1 != h2 {
+		t.Error("copied file content differs from original")
+	}
+}
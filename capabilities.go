@@ -0,0 +1,145 @@
+package fs
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Capability lists the features that a file system supports
+type Capability int
+
+const (
+	// CapSymlink is the support of symbolic links
+	CapSymlink Capability = 1 << iota
+
+	// CapHardlink is the support of hard links
+	CapHardlink
+
+	// CapXattr is the support of user extended attributes
+	CapXattr
+
+	// CapReflink is the support of copy-on-write clones of files
+	CapReflink
+
+	// CapSparse is the support of sparse files, whose holes
+	// take no space
+	CapSparse
+
+	// CapLock is the support of advisory file locks
+	CapLock
+)
+
+// capNames are the names of the capabilities, in bit order
+var capNames = []string{"symlink", "hardlink", "xattr", "reflink", "sparse", "lock"}
+
+// sparseProbeSize is the size of the hole of the sparse file probe
+const sparseProbeSize = 1 << 20
+
+// Has checks if all of the capabilities c are supported
+func (caps Capability) Has(c Capability) bool {
+	return caps&c == c
+}
+
+func (caps Capability) String() string {
+	var names []string
+	for i, name := range capNames {
+		if caps&(1<<i) != 0 {
+			names = append(names, name)
+		}
+	}
+
+	if len(names) == 0 {
+		return "none"
+	}
+
+	return strings.Join(names, "|")
+}
+
+// Capabilities probes the file system of the directory path for the
+// features it supports, so that callers can choose how to go about
+// their work rather than fail half way through it. The probes are run
+// in a temporary directory created, then removed, below path, which
+// must therefore be writable.
+func Capabilities(path string) (Capability, error) {
+	dir, err := ioutil.TempDir(path, ".fs-probe")
+	if err != nil {
+		return 0, fmt.Errorf("unable to probe the capabilities of %s (%w)", path, err)
+	}
+	defer os.RemoveAll(dir)
+
+	probe := filepath.Join(dir, "probe")
+	f, err := os.Create(probe)
+	if err != nil {
+		return 0, fmt.Errorf("unable to probe the capabilities of %s (%w)", path, err)
+	}
+	defer f.Close()
+
+	var caps Capability
+	if os.Symlink(probe, filepath.Join(dir, "symlink")) == nil {
+		caps |= CapSymlink
+	}
+
+	if os.Link(probe, filepath.Join(dir, "hardlink")) == nil {
+		caps |= CapHardlink
+	}
+
+	if probeXattr(probe) {
+		caps |= CapXattr
+	}
+
+	if probeSparse(f) {
+		caps |= CapSparse
+	}
+
+	if clone, err := os.Create(filepath.Join(dir, "clone")); err == nil {
+		if probeReflink(clone, f) {
+			caps |= CapReflink
+		}
+		clone.Close()
+	}
+
+	if ok, err := lockFile(f, false, false); ok && err == nil {
+		caps |= CapLock
+		unlockFile(f)
+	}
+
+	return caps, nil
+}
+
+// probeSparse checks if a file written past a hole in f
+// takes less space than its size
+func probeSparse(f *os.File) bool {
+	if _, err := f.WriteAt([]byte{1}, sparseProbeSize); err != nil {
+		return false
+	}
+
+	if err := f.Sync(); err != nil {
+		return false
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		return false
+	}
+
+	allocated, ok := infoAllocated(info)
+	return ok && allocated < sparseProbeSize
+}
+
+// destCapabilities returns the capabilities of the file system of the
+// destination directory dir, probed once per copy. Should they not be
+// probed, all are assumed, leaving the copy to fail as it would have.
+func (c *copyConfig) destCapabilities(dir string) Capability {
+	c.capsOnce.Do(func() {
+		caps, err := Capabilities(dir)
+		if err != nil {
+			caps = 1<<len(capNames) - 1
+		}
+		c.caps = caps
+	})
+
+	return c.caps
+}
@@ -0,0 +1,53 @@
+package fs_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/brinick/fs"
+)
+
+func TestCapabilities(t *testing.T) {
+	dir, err := ioutil.TempDir("", "fs-caps")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	caps, err := fs.Capabilities(dir)
+	if err != nil {
+		t.Fatalf("unable to probe capabilities: %v", err)
+	}
+
+	if runtime.GOOS != "windows" && !caps.Has(fs.CapSymlink|fs.CapHardlink|fs.CapLock) {
+		t.Errorf("expected symlinks, hardlinks and locks supported, got %v", caps)
+	}
+
+	if infos, _ := ioutil.ReadDir(dir); len(infos) != 0 {
+		t.Errorf("expected the probes removed, got %d entries", len(infos))
+	}
+
+	if _, err := fs.Capabilities(filepath.Join(dir, "missing")); err == nil {
+		t.Error("expected an error probing a missing directory")
+	}
+}
+
+func TestCapabilityString(t *testing.T) {
+	tests := []struct {
+		caps fs.Capability
+		want string
+	}{
+		{0, "none"},
+		{fs.CapSymlink, "symlink"},
+		{fs.CapHardlink | fs.CapSparse | fs.CapLock, "hardlink|sparse|lock"},
+	}
+
+	for _, tt := range tests {
+		if got := tt.caps.String(); got != tt.want {
+			t.Errorf("expected %q, got %q", tt.want, got)
+		}
+	}
+}
@@ -0,0 +1,82 @@
+//go:build linux
+
+package fs
+
+import (
+	"context"
+	"errors"
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// cloneChunk is the size of the in kernel copies
+const cloneChunk = 8 << 20
+
+// cloneFile clones the content of src to dst, both OS files, with the
+// FICLONE ioctl, or failing that has the kernel copy it with
+// copy_file_range. It returns false if neither is supported, the
+// content being left to copy in user space.
+func cloneFile(ctx context.Context, dst FileHandle, src interface{}, size int64, cfg *copyConfig) (bool, error) {
+	d, ok := dst.(*os.File)
+	if !ok {
+		return false, nil
+	}
+
+	s, ok := src.(*os.File)
+	if !ok {
+		return false, nil
+	}
+
+	if err := unix.IoctlFileClone(int(d.Fd()), int(s.Fd())); err == nil {
+		cfg.report(size)
+		return true, nil
+	}
+
+	var copied int64
+	for {
+		if err := ctx.Err(); err != nil {
+			return true, err
+		}
+
+		chunk := int64(cloneChunk)
+		if cfg.limiter != nil {
+			chunk = int64(BufferSize())
+			if err := cfg.limiter.wait(ctx, int(chunk)); err != nil {
+				return true, err
+			}
+		}
+
+		n, err := unix.CopyFileRange(int(s.Fd()), nil, int(d.Fd()), nil, int(chunk), 0)
+		if err != nil {
+			if copied == 0 && unsupportedCopy(err) {
+				return false, nil
+			}
+			return true, &os.PathError{Op: "copy_file_range", Path: d.Name(), Err: err}
+		}
+
+		if n == 0 {
+			return true, nil
+		}
+
+		copied += int64(n)
+		cfg.report(int64(n))
+	}
+}
+
+// unsupportedCopy checks if the copy_file_range error means
+// it cannot be used between the files
+func unsupportedCopy(err error) bool {
+	for _, errno := range []error{unix.ENOSYS, unix.EXDEV, unix.EOPNOTSUPP, unix.EINVAL, unix.EPERM} {
+		if errors.Is(err, errno) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// probeReflink checks if dst can be cloned from src
+func probeReflink(dst, src *os.File) bool {
+	return unix.IoctlFileClone(int(dst.Fd()), int(src.Fd())) == nil
+}
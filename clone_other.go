@@ -0,0 +1,19 @@
+//go:build !linux
+
+package fs
+
+import (
+	"context"
+	"os"
+)
+
+// cloneFile does nothing, cloning being unsupported: the
+// content is left to copy in user space
+func cloneFile(ctx context.Context, dst FileHandle, src interface{}, size int64, cfg *copyConfig) (bool, error) {
+	return false, nil
+}
+
+// probeReflink returns false, cloning being unsupported
+func probeReflink(dst, src *os.File) bool {
+	return false
+}
@@ -0,0 +1,256 @@
+package fs
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// magic numbers of common compressed formats, with their offset in the file
+var compressedMagic = []struct {
+	format string
+	offset int
+	magic  []byte
+}{
+	{"gzip", 0, []byte{0x1f, 0x8b}},
+	{"zstd", 0, []byte{0x28, 0xb5, 0x2f, 0xfd}},
+	{"xz", 0, []byte{0xfd, '7', 'z', 'X', 'Z', 0x00}},
+	{"bzip2", 0, []byte("BZh")},
+	{"lz4", 0, []byte{0x04, 0x22, 0x4d, 0x18}},
+	{"7z", 0, []byte{'7', 'z', 0xbc, 0xaf, 0x27, 0x1c}},
+	{"zip", 0, []byte("PK\x03\x04")},
+	{"jpeg", 0, []byte{0xff, 0xd8, 0xff}},
+	{"png", 0, []byte{0x89, 'P', 'N', 'G'}},
+	{"mp4", 4, []byte("ftyp")},
+}
+
+// CompressedFormat returns the name of the compressed format of the file
+// content (e.g. gzip, zstd, xz, jpeg, mp4), as given by its magic number,
+// or an empty string if it is not a known compressed format.
+func CompressedFormat(f *File) (string, error) {
+	fd, err := f.sys().Open(f.Path)
+	if err != nil {
+		return "", err
+	}
+	defer fd.Close()
+
+	head := make([]byte, 16)
+	n, err := io.ReadFull(fd, head)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return "", err
+	}
+
+	head = head[:n]
+	for _, m := range compressedMagic {
+		end := m.offset + len(m.magic)
+		if end <= len(head) && bytes.Equal(head[m.offset:end], m.magic) {
+			return m.format, nil
+		}
+	}
+
+	return "", nil
+}
+
+// IsCompressed reports if the file content is already compressed,
+// in which case compressing it again is pointless
+func IsCompressed(f *File) (bool, error) {
+	format, err := CompressedFormat(f)
+	return format != "", err
+}
+
+// Zstd compresses the file with zstandard into a new file with
+// an added .zst suffix, which is returned. The original file is kept.
+func (f *File) Zstd() (*File, error) {
+	dst := NewFile(f.Path + ".zst")
+	err := f.transcode(dst, func(w io.Writer, r io.Reader) error {
+		zw, err := zstd.NewWriter(w)
+		if err != nil {
+			return err
+		}
+
+		if _, err := io.Copy(zw, r); err != nil {
+			zw.Close()
+			return err
+		}
+
+		return zw.Close()
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return dst, nil
+}
+
+// Unzstd decompresses the zstandard compressed file into a new file,
+// which is returned, named without the .zst suffix. The compressed
+// file is kept. An error is returned if the file has no .zst suffix.
+func (f *File) Unzstd() (*File, error) {
+	if !strings.HasSuffix(f.Path, ".zst") {
+		return nil, fmt.Errorf("%s: no .zst suffix", f.Path)
+	}
+
+	dst := NewFile(strings.TrimSuffix(f.Path, ".zst"))
+	err := f.transcode(dst, func(w io.Writer, r io.Reader) error {
+		zr, err := zstd.NewReader(r)
+		if err != nil {
+			return err
+		}
+		defer zr.Close()
+
+		_, err = io.Copy(w, zr)
+		return err
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return dst, nil
+}
+
+// transcode streams the file content through fn into dst,
+// which is given the same file mode as the file
+func (f *File) transcode(dst *File, fn func(io.Writer, io.Reader) error) error {
+	mode, err := f.FileMode()
+	if err != nil {
+		return err
+	}
+
+	src, err := os.Open(f.Path)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	out, err := os.OpenFile(dst.Path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, mode.Perm())
+	if err != nil {
+		return err
+	}
+
+	if err := fn(out, src); err != nil {
+		out.Close()
+		os.Remove(dst.Path)
+		return fmt.Errorf("unable to transcode %s to %s (%w)", f.Path, dst.Path, err)
+	}
+
+	return out.Close()
+}
+
+// ------------------------------------------------------------------
+
+// compressSample is the number of leading bytes of each
+// file compressed to estimate the compressibility of a tree
+const compressSample = 64 * 1024
+
+// Compressibility summarises how much a tree would gain from compression
+type Compressibility struct {
+	// Files and Bytes are the number and total size of files
+	Files int
+	Bytes int64
+
+	// CompressedFiles and CompressedBytes are the number and total size
+	// of the files whose content is already compressed
+	CompressedFiles int
+	CompressedBytes int64
+
+	// EstimatedBytes is the estimated total size of the files
+	// once compressed. Already compressed files count as is.
+	EstimatedBytes int64
+}
+
+// Ratio returns the estimated compressed to original size ratio
+func (c *Compressibility) Ratio() float64 {
+	if c.Bytes == 0 {
+		return 1
+	}
+
+	return float64(c.EstimatedBytes) / float64(c.Bytes)
+}
+
+// Compressibility walks the directory tree estimating how much its files
+// would shrink with compression. The estimate for each file not already
+// compressed is made by gzip compressing its first 64KiB.
+func (d *Directory) Compressibility() (*Compressibility, error) {
+	var c Compressibility
+	err := filepath.Walk(
+		d.Path,
+		func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+
+			if !info.Mode().IsRegular() {
+				return nil
+			}
+
+			c.Files++
+			c.Bytes += info.Size()
+
+			f := NewFile(path)
+			compressed, err := IsCompressed(f)
+			if err != nil {
+				return err
+			}
+
+			if compressed {
+				c.CompressedFiles++
+				c.CompressedBytes += info.Size()
+				c.EstimatedBytes += info.Size()
+				return nil
+			}
+
+			ratio, err := sampleRatio(path)
+			if err != nil {
+				return err
+			}
+
+			c.EstimatedBytes += int64(ratio * float64(info.Size()))
+			return nil
+		},
+	)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &c, nil
+}
+
+// sampleRatio returns the gzip compression ratio of the file's first bytes
+func sampleRatio(path string) (float64, error) {
+	fd, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer fd.Close()
+
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	n, err := io.Copy(gz, io.LimitReader(fd, compressSample))
+	if err != nil {
+		return 0, err
+	}
+
+	if err := gz.Close(); err != nil {
+		return 0, err
+	}
+
+	if n == 0 {
+		return 1, nil
+	}
+
+	ratio := float64(buf.Len()) / float64(n)
+	if ratio > 1 {
+		ratio = 1
+	}
+
+	return ratio, nil
+}
@@ -0,0 +1,113 @@
+package fs_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/brinick/fs"
+)
+
+func TestIsCompressed(t *testing.T) {
+	dir, clean := tempDir()
+	defer clean()
+
+	var gz bytes.Buffer
+	w := gzip.NewWriter(&gz)
+	w.Write([]byte(strings.Repeat("hello ", 1000)))
+	w.Close()
+
+	tests := []struct {
+		name    string
+		content []byte
+		format  string
+	}{
+		{"plain.txt", []byte(strings.Repeat("hello ", 1000)), ""},
+		{"empty.txt", []byte{}, ""},
+		{"data.gz", gz.Bytes(), "gzip"},
+		{"data.zst", []byte{0x28, 0xb5, 0x2f, 0xfd, 0x00}, "zstd"},
+		{"movie.mp4", []byte("\x00\x00\x00\x18ftypmp42"), "mp4"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(dir, tt.name)
+			if err := ioutil.WriteFile(path, tt.content, 0644); err != nil {
+				t.Fatalf("unable to write file: %v", err)
+			}
+
+			format, err := fs.CompressedFormat(fs.NewFile(path))
+			if err != nil {
+				t.Fatalf("unable to get compressed format: %v", err)
+			}
+
+			if format != tt.format {
+				t.Errorf("expected format %q, got %q", tt.format, format)
+			}
+		})
+	}
+
+	c, err := newDir(t, dir).Compressibility()
+	if err != nil {
+		t.Fatalf("unable to estimate compressibility: %v", err)
+	}
+
+	if c.Files != len(tests) || c.CompressedFiles != 3 {
+		t.Errorf("expected %d files, 3 compressed, got %d files, %d compressed", len(tests), c.Files, c.CompressedFiles)
+	}
+
+	if c.Ratio() >= 1 {
+		t.Errorf("expected a compressible tree, got ratio %f", c.Ratio())
+	}
+}
+
+func TestZstd(t *testing.T) {
+	f, clean := newFile()
+	defer clean()
+
+	content := strings.Repeat("hello zstd\n", 100)
+	if err := f.Write([]byte(content)); err != nil {
+		t.Fatalf("unable to write file: %v", err)
+	}
+
+	zf, err := f.Zstd()
+	if err != nil {
+		t.Fatalf("unable to zstd compress file: %v", err)
+	}
+
+	if format, _ := fs.CompressedFormat(zf); format != "zstd" {
+		t.Errorf("expected zstd compressed file, got format %q", format)
+	}
+
+	if err := os.Remove(f.Path); err != nil {
+		t.Fatalf("unable to remove original file: %v", err)
+	}
+
+	uf, err := zf.Unzstd()
+	if err != nil {
+		t.Fatalf("unable to zstd decompress file: %v", err)
+	}
+
+	data, err := uf.Bytes()
+	if err != nil || string(data) != content {
+		t.Errorf("decompressed content differs from original (%v)", err)
+	}
+
+	archive := filepath.Join(f.DirPath(), "tree")
+	if err := newDir(t, f.DirPath()).TarZst(archive, fs.ArchiveOptions{}); err != nil {
+		t.Fatalf("unable to create tar.zst archive: %v", err)
+	}
+
+	dest := filepath.Join(f.DirPath(), "out")
+	if err := fs.Extract(archive+".tar.zst", dest, fs.ExtractOptions{}); err != nil {
+		t.Fatalf("unable to extract tar.zst archive: %v", err)
+	}
+
+	if ok, _ := fs.Exists(filepath.Join(dest, f.Name())); !ok {
+		t.Error("file missing from extracted tar.zst archive")
+	}
+}
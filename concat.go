@@ -0,0 +1,91 @@
+package fs
+
+import (
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+)
+
+// ConcatOptions configures ConcatWithOptions
+type ConcatOptions struct {
+	// Separator is written between the parts
+	Separator []byte
+
+	// Checksum returns the hex encoded digest of the result,
+	// computed with Algo, SHA256 if empty, as it is written
+	Checksum bool
+	Algo     HashAlgo
+
+	// EnsureDir creates the parent directories of the destination
+	EnsureDir bool
+}
+
+// Concat streams the parts, in order, into dst, e.g. to assemble the
+// shards written by parallel jobs. The content of dst is replaced
+// atomically, as with WriteAtomic, so that dst may be one of the parts.
+func Concat(dst *File, parts ...*File) error {
+	_, err := ConcatWithOptions(dst, ConcatOptions{}, parts...)
+	return err
+}
+
+// ConcatWithOptions is like Concat, configured by opts. It returns the
+// digest of the result if opts.Checksum is set, else "".
+func ConcatWithOptions(dst *File, opts ConcatOptions, parts ...*File) (string, error) {
+	var h hash.Hash
+	if opts.Checksum {
+		var err error
+		if h, err = opts.Algo.New(); err != nil {
+			return "", err
+		}
+	}
+
+	var wopts []WriteOption
+	if opts.EnsureDir {
+		wopts = append(wopts, EnsureDir(0))
+	}
+
+	if err := dst.prepare(wopts, false); err != nil {
+		return "", err
+	}
+
+	err := dst.writeAtomic(func(w io.Writer) error {
+		if h != nil {
+			w = io.MultiWriter(w, h)
+		}
+
+		for i, part := range parts {
+			if i > 0 && len(opts.Separator) > 0 {
+				if _, err := w.Write(opts.Separator); err != nil {
+					return err
+				}
+			}
+
+			if err := concatPart(w, part); err != nil {
+				return fmt.Errorf("unable to concatenate %s to %s (%w)", part.Path, dst.Path, err)
+			}
+		}
+
+		return nil
+	})
+	if err != nil || h == nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// concatPart copies the content of part to w
+func concatPart(w io.Writer, part *File) error {
+	openFiles.acquire(1)
+	defer openFiles.release(1)
+
+	fd, err := part.sys().Open(part.Path)
+	if err != nil {
+		return err
+	}
+	defer fd.Close()
+
+	_, err = copyBuffer(w, fd)
+	return err
+}
@@ -0,0 +1,81 @@
+package fs_test
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/brinick/fs"
+)
+
+func TestConcat(t *testing.T) {
+	root, err := ioutil.TempDir("", "fs-concat")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	shards := map[string]string{"part-0": "a\nb\n", "part-1": "c\n", "part-2": ""}
+	var parts []*fs.File
+	for _, name := range []string{"part-0", "part-1", "part-2"} {
+		path := filepath.Join(root, name)
+		if err := ioutil.WriteFile(path, []byte(shards[name]), 0644); err != nil {
+			t.Fatal(err)
+		}
+		parts = append(parts, fs.NewFile(path))
+	}
+
+	tests := []struct {
+		name string
+		opts fs.ConcatOptions
+		want string
+	}{
+		{"plain", fs.ConcatOptions{}, "a\nb\nc\n"},
+		{"separator", fs.ConcatOptions{Separator: []byte("--\n")}, "a\nb\n--\nc\n--\n"},
+		{"checksum", fs.ConcatOptions{Checksum: true, EnsureDir: true}, "a\nb\nc\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dst := fs.NewFile(filepath.Join(root, tt.name, "all"))
+			if !tt.opts.EnsureDir {
+				dst = fs.NewFile(filepath.Join(root, tt.name))
+			}
+
+			digest, err := fs.ConcatWithOptions(dst, tt.opts, parts...)
+			if err != nil {
+				t.Fatalf("unable to concatenate: %v", err)
+			}
+
+			data, _ := ioutil.ReadFile(dst.Path)
+			if string(data) != tt.want {
+				t.Errorf("expected %q, got %q", tt.want, data)
+			}
+
+			want := ""
+			if tt.opts.Checksum {
+				sum := sha256.Sum256([]byte(tt.want))
+				want = hex.EncodeToString(sum[:])
+			}
+			if digest != want {
+				t.Errorf("expected digest %q, got %q", want, digest)
+			}
+		})
+	}
+
+	// Appending to the first part
+	if err := fs.Concat(parts[0], parts[0], parts[1]); err != nil {
+		t.Fatalf("unable to concatenate onto a part: %v", err)
+	}
+
+	if data, _ := ioutil.ReadFile(parts[0].Path); string(data) != "a\nb\nc\n" {
+		t.Errorf("expected the first part extended, got %q", data)
+	}
+
+	if err := fs.Concat(fs.NewFile(filepath.Join(root, "out")), fs.NewFile(filepath.Join(root, "missing"))); err == nil {
+		t.Error("expected an error concatenating a missing part")
+	}
+}
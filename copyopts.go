@@ -0,0 +1,283 @@
+package fs
+
+import (
+	"context"
+	"hash"
+	"io"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// CopyOption configures the file and directory copies and syncs
+type CopyOption func(*copyConfig)
+
+type copyConfig struct {
+	progress func(copied, total int64)
+	limiter  *rateLimiter
+
+	// createDest creates the missing destination directories
+	createDest bool
+
+	preserve Preserve
+	owners   *OwnerMap
+
+	// hardlink and reflink share the source data where possible
+	hardlink bool
+	reflink  bool
+
+	// skipIdentical leaves destination files with the same content
+	// as their source, and copiedAny is set if any file is copied
+	skipIdentical bool
+	copiedAny     *bool
+
+	// workers is the number of files copied at once, and priority
+	// their order. Scheduled copies are collected as jobs, then run,
+	// and dirAttrs are run after them to set the directory attributes.
+	workers  int
+	priority CopyPriority
+	jobs     []copyJob
+	dirAttrs []func() error
+
+	// stats collects the I/O statistics, if set
+	stats *IOStats
+
+	// sum hashes the content read from the source of a single
+	// file copy, summed bytes so far, if set
+	sum    hash.Hash
+	summed int64
+
+	// fsync commits the content of each copied file to storage
+	fsync bool
+
+	// linkRewrite rewrites the links from the srcRoot tree
+	// to the dstRoot tree
+	linkRewrite LinkRewrite
+	srcRoot     string
+	dstRoot     string
+
+	// caps are the capabilities of the destination file system,
+	// probed once when needed
+	caps     Capability
+	capsOnce sync.Once
+
+	// mu guards the progress, copiedAny and stats of concurrent copies
+	mu sync.Mutex
+
+	// copied is the number of bytes copied so far, of the total
+	// expected, which is -1 if unknown, or 0 if still to be set from
+	// the size of a single copied file
+	copied int64
+	total  int64
+}
+
+func newCopyConfig(opts []CopyOption) *copyConfig {
+	c := &copyConfig{}
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	return c
+}
+
+// WithProgress makes a copy call fn as the content is copied, with the
+// number of bytes copied so far and the total number of bytes to copy.
+// For directory copies the total is that of the whole tree; for syncs,
+// where it is only known as the tree is walked, it is -1.
+func WithProgress(fn func(copied, total int64)) CopyOption {
+	return func(c *copyConfig) {
+		c.progress = fn
+	}
+}
+
+// WithRateLimit limits the rate at which a copy writes to at most
+// bytesPerSec bytes per second, on average, across all of the files
+// it copies. Bursts of up to a second's worth are allowed.
+// Limits <= 0 mean no limit.
+func WithRateLimit(bytesPerSec int64) CopyOption {
+	return func(c *copyConfig) {
+		c.limiter = nil
+		if bytesPerSec > 0 {
+			c.limiter = &rateLimiter{rate: float64(bytesPerSec)}
+		}
+	}
+}
+
+// WithCreateDest makes a file copy create the destination directory,
+// and its parents, if missing, rather than fail with an InexistantError
+func WithCreateDest() CopyOption {
+	return func(c *copyConfig) {
+		c.createDest = true
+	}
+}
+
+// WithHardlink makes a copy between paths of the same OS file system
+// hard link each destination file to its source, replacing any existing
+// one, rather than copy its content. As they are then the same file,
+// changes to either are seen by both. Where linking fails, e.g. across
+// devices, the content is copied.
+func WithHardlink() CopyOption {
+	return func(c *copyConfig) {
+		c.hardlink = true
+	}
+}
+
+// WithReflink makes a copy between OS files clone the source content,
+// sharing its blocks copy-on-write on file systems supporting it, such
+// as btrfs and XFS, else have the kernel copy it. Where neither is
+// possible, the content is copied as usual. Only Linux supports it.
+func WithReflink() CopyOption {
+	return func(c *copyConfig) {
+		c.reflink = true
+	}
+}
+
+// WithSkipIdentical makes a copy leave the destination files that
+// already have the same size and content as their source, as checked
+// with their SHA256 digests, e.g. for idempotent re-runs of publish
+// scripts.
+// If copied is not nil, it is set to whether any file was copied.
+func WithSkipIdentical(copied *bool) CopyOption {
+	return func(c *copyConfig) {
+		c.skipIdentical = true
+		c.copiedAny = copied
+		if copied != nil {
+			*copied = false
+		}
+	}
+}
+
+// report adds n bytes to the progress of the copy
+func (c *copyConfig) report(n int64) {
+	if c.progress == nil || n <= 0 {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.copied += n
+	c.progress(c.copied, c.total)
+}
+
+// setCopied records that a file is copied
+func (c *copyConfig) setCopied() {
+	if c.copiedAny == nil {
+		return
+	}
+
+	c.mu.Lock()
+	*c.copiedAny = true
+	c.mu.Unlock()
+}
+
+// writer wraps the destination of a copy to report its
+// progress, count its writes and limit its rate, as configured
+func (c *copyConfig) writer(ctx context.Context, w io.Writer) io.Writer {
+	if c.stats != nil {
+		w = &statsWriter{w: w, c: c}
+	}
+
+	if c.progress != nil {
+		w = &progressWriter{w: w, c: c}
+	}
+
+	if c.limiter != nil {
+		w = &limitedWriter{ctx: ctx, w: w, l: c.limiter}
+	}
+
+	return w
+}
+
+// progressWriter reports the bytes written through it
+type progressWriter struct {
+	w io.Writer
+	c *copyConfig
+}
+
+func (pw *progressWriter) Write(p []byte) (int, error) {
+	n, err := pw.w.Write(p)
+	pw.c.report(int64(n))
+	return n, err
+}
+
+// rateLimiter is a token bucket, filled at rate tokens (bytes) per
+// second, holding at most a second's worth
+type rateLimiter struct {
+	mu     sync.Mutex
+	rate   float64
+	tokens float64
+	last   time.Time
+}
+
+// wait takes n tokens, waiting until the bucket is no longer in debt
+func (l *rateLimiter) wait(ctx context.Context, n int) error {
+	l.mu.Lock()
+	now := time.Now()
+	if l.last.IsZero() {
+		l.tokens = l.rate
+	} else {
+		l.tokens += now.Sub(l.last).Seconds() * l.rate
+		if l.tokens > l.rate {
+			l.tokens = l.rate
+		}
+	}
+
+	l.last = now
+	l.tokens -= float64(n)
+	debt := -l.tokens
+	l.mu.Unlock()
+
+	if debt <= 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(time.Duration(debt / l.rate * float64(time.Second)))
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// limitedWriter writes at the rate of its limiter
+type limitedWriter struct {
+	ctx context.Context
+	w   io.Writer
+	l   *rateLimiter
+}
+
+func (lw *limitedWriter) Write(p []byte) (int, error) {
+	if err := lw.l.wait(lw.ctx, len(p)); err != nil {
+		return 0, err
+	}
+
+	return lw.w.Write(p)
+}
+
+// treeBytes returns the total size of the files below path on sys
+func treeBytes(sys Filesystem, path string) (int64, error) {
+	infos, err := sys.ReadDir(path)
+	if err != nil {
+		return 0, err
+	}
+
+	var total int64
+	for _, info := range infos {
+		if !info.IsDir() {
+			total += info.Size()
+			continue
+		}
+
+		size, err := treeBytes(sys, filepath.Join(path, info.Name()))
+		if err != nil {
+			return 0, err
+		}
+		total += size
+	}
+
+	return total, nil
+}
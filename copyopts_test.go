@@ -0,0 +1,219 @@
+package fs_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/brinick/fs"
+)
+
+// newTree creates a temporary tree with files of the given sizes
+func newTree(t *testing.T, sizes map[string]int) string {
+	root, err := ioutil.TempDir("", "fs-copy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(root) })
+
+	for name, size := range sizes {
+		path := filepath.Join(root, "src", name)
+		os.MkdirAll(filepath.Dir(path), 0755)
+		if err := ioutil.WriteFile(path, bytes.Repeat([]byte("x"), size), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return root
+}
+
+func TestCopyProgress(t *testing.T) {
+	root := newTree(t, map[string]int{"a": 200000, "sub/b": 100000})
+	src := filepath.Join(root, "src")
+
+	tests := []struct {
+		name  string
+		total int64
+		copy  func(fs.CopyOption) error
+	}{
+		{"file", 200000, func(opt fs.CopyOption) error {
+			return fs.CopyFile(filepath.Join(src, "a"), root, opt)
+		}},
+		{"dir", 300000, func(opt fs.CopyOption) error {
+			d, _ := fs.NewDir(src)
+			return d.CopyTo(filepath.Join(root, "dst"), opt)
+		}},
+		{"sync", -1, func(opt fs.CopyOption) error {
+			_, err := fs.Sync(src, filepath.Join(root, "synced"), fs.SyncOptions{}, opt)
+			return err
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var calls, last int64
+			progress := fs.WithProgress(func(copied, total int64) {
+				calls++
+				if copied <= last {
+					t.Errorf("progress went from %d to %d", last, copied)
+				}
+				if total != tt.total {
+					t.Errorf("expected total %d, got %d", tt.total, total)
+				}
+				last = copied
+			})
+
+			if err := tt.copy(progress); err != nil {
+				t.Fatalf("unable to copy: %v", err)
+			}
+
+			if calls < 2 {
+				t.Errorf("expected progress reported while copying, got %d calls", calls)
+			}
+
+			want := tt.total
+			if want < 0 {
+				want = 300000
+			}
+			if last != want {
+				t.Errorf("expected %d bytes copied, got %d", want, last)
+			}
+		})
+	}
+}
+
+func TestCopyRateLimit(t *testing.T) {
+	root := newTree(t, map[string]int{"a": 100000, "b": 100000, "sub/c": 100000})
+	d, _ := fs.NewDir(root, "src")
+
+	// A second's worth goes at once, the rest at the rate
+	start := time.Now()
+	if err := d.CopyTo(filepath.Join(root, "dst"), fs.WithRateLimit(200000)); err != nil {
+		t.Fatalf("unable to copy: %v", err)
+	}
+
+	if elapsed := time.Since(start); elapsed < 400*time.Millisecond {
+		t.Errorf("expected copy limited to 200kB/s, took %v", elapsed)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	err := d.CopyToContext(ctx, filepath.Join(root, "cancelled"), fs.WithRateLimit(1000))
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected deadline exceeded while rate limited, got %v", err)
+	}
+}
+
+func TestCopyLinks(t *testing.T) {
+	root := newTree(t, map[string]int{"a": 100, "sub/b": 300000})
+	d, _ := fs.NewDir(root, "src")
+
+	tests := []struct {
+		name   string
+		opt    fs.CopyOption
+		linked bool
+	}{
+		{"hardlink", fs.WithHardlink(), true},
+		{"reflink", fs.WithReflink(), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var copied int64
+			progress := fs.WithProgress(func(n, total int64) { copied = n })
+
+			dst := filepath.Join(root, tt.name)
+			if err := d.CopyTo(dst, tt.opt, progress); err != nil {
+				t.Fatalf("unable to copy: %v", err)
+			}
+
+			if copied != 300100 {
+				t.Errorf("expected 300100 bytes reported, got %d", copied)
+			}
+
+			for _, name := range []string{"a", "sub/b"} {
+				src, _ := os.Stat(filepath.Join(root, "src", name))
+				got, err := os.Stat(filepath.Join(dst, name))
+				if err != nil {
+					t.Fatalf("%s not copied: %v", name, err)
+				}
+
+				if linked := os.SameFile(src, got); linked != tt.linked {
+					t.Errorf("%s: expected linked %v, got %v", name, tt.linked, linked)
+				}
+
+				if got.Size() != src.Size() {
+					t.Errorf("%s: expected size %d, got %d", name, src.Size(), got.Size())
+				}
+			}
+		})
+	}
+
+	// Hard linking a file to itself leaves it alone
+	a := filepath.Join(root, "src", "a")
+	if err := fs.NewFile(a).ExportTo(a, fs.WithHardlink()); err != nil {
+		t.Fatalf("unable to export file to itself: %v", err)
+	}
+
+	if info, err := os.Stat(a); err != nil || info.Size() != 100 {
+		t.Errorf("expected file left alone, got %v", err)
+	}
+}
+
+func TestCopySkipIdentical(t *testing.T) {
+	root := newTree(t, map[string]int{"a": 100, "sub/b": 200})
+	a := fs.NewFile(filepath.Join(root, "src", "a"))
+	export := filepath.Join(root, "a.copy")
+
+	// Same size, different content
+	if err := ioutil.WriteFile(export, bytes.Repeat([]byte("y"), 100), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var copied bool
+	for i, want := range []bool{true, false} {
+		if err := a.ExportTo(export, fs.WithSkipIdentical(&copied)); err != nil {
+			t.Fatalf("unable to export: %v", err)
+		}
+
+		if copied != want {
+			t.Errorf("export %d: expected copied %v, got %v", i, want, copied)
+		}
+	}
+
+	if content, _ := ioutil.ReadFile(export); !bytes.Equal(content, bytes.Repeat([]byte("x"), 100)) {
+		t.Errorf("expected the export updated")
+	}
+
+	for i, want := range []bool{true, false} {
+		if err := a.Backup(fs.WithSkipIdentical(&copied)); err != nil {
+			t.Fatalf("unable to back up: %v", err)
+		}
+
+		if copied != want {
+			t.Errorf("backup %d: expected copied %v, got %v", i, want, copied)
+		}
+	}
+
+	b := fs.NewFile(filepath.Join(root, "src", "sub", "b"))
+	for i, want := range []bool{true, false} {
+		if err := b.CopyTo(root, fs.WithSkipIdentical(&copied)); err != nil {
+			t.Fatalf("unable to copy: %v", err)
+		}
+
+		if copied != want {
+			t.Errorf("copy %d: expected copied %v, got %v", i, want, copied)
+		}
+	}
+
+	// Without the option, the copy is redone
+	if err := a.ExportTo(export, fs.WithProgress(func(n, total int64) { copied = n == 100 })); err != nil || !copied {
+		t.Errorf("expected the export redone, got %v", err)
+	}
+}
@@ -0,0 +1,109 @@
+package fs
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// ErrUnknownFormat is the error returned when no decoder is known
+// for the extension of a file read into a value
+var ErrUnknownFormat = errors.New("unknown file format")
+
+// Decoder decodes data into the value pointed to by v
+type Decoder func(data []byte, v interface{}) error
+
+// decoders are the decoders of the known formats, by name
+var decoders = map[string]Decoder{
+	"json": json.Unmarshal,
+	"yaml": yaml.Unmarshal,
+	"yml":  yaml.Unmarshal,
+	"toml": toml.Unmarshal,
+}
+
+// ReadOption configures how a file is decoded by ReadInto
+type ReadOption func(*readConfig)
+
+type readConfig struct {
+	format  string
+	decoder Decoder
+}
+
+// WithFormat decodes the file as the given format, one of json, yaml
+// or toml, whatever its extension
+func WithFormat(format string) ReadOption {
+	return func(c *readConfig) {
+		c.format = format
+	}
+}
+
+// WithDecoder decodes the file with the given decoder, whatever its extension
+func WithDecoder(d Decoder) ReadOption {
+	return func(c *readConfig) {
+		c.decoder = d
+	}
+}
+
+// decoderFor returns the decoder of the file at path
+func (c *readConfig) decoderFor(path string) (Decoder, error) {
+	if c.decoder != nil {
+		return c.decoder, nil
+	}
+
+	format := c.format
+	if format == "" {
+		format = strings.TrimPrefix(filepath.Ext(path), ".")
+	}
+
+	d, ok := decoders[strings.ToLower(format)]
+	if !ok {
+		return nil, fmt.Errorf("%w: %q for %s", ErrUnknownFormat, format, path)
+	}
+
+	return d, nil
+}
+
+// ReadInto decodes the file content into the value pointed to by v,
+// as JSON, YAML or TOML depending on the file extension, unless
+// overridden by the options
+func (f *File) ReadInto(v interface{}, opts ...ReadOption) error {
+	cfg := &readConfig{}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+
+	decode, err := cfg.decoderFor(f.Path)
+	if err != nil {
+		return err
+	}
+
+	data, err := f.Bytes()
+	if err != nil {
+		return err
+	}
+
+	if err := decode(data, v); err != nil {
+		return fmt.Errorf("unable to decode %s (%w)", f.Path, err)
+	}
+
+	return nil
+}
+
+// ReadAllInto decodes each of the files, in turn, into the value
+// pointed to by v, so that the fields set by a file override those
+// set by the files before it. This loads a set of config fragments
+// into a single struct.
+func (f *Files) ReadAllInto(v interface{}, opts ...ReadOption) error {
+	for _, file := range *f {
+		if err := file.ReadInto(v, opts...); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
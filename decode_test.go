@@ -0,0 +1,101 @@
+package fs_test
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/brinick/fs"
+)
+
+type config struct {
+	Name    string   `json:"name" yaml:"name" toml:"name"`
+	Workers int      `json:"workers" yaml:"workers" toml:"workers"`
+	Tags    []string `json:"tags" yaml:"tags" toml:"tags"`
+}
+
+func TestReadInto(t *testing.T) {
+	dir, clean := tempDir()
+	defer clean()
+
+	tests := []struct {
+		name    string
+		file    string
+		content string
+		opts    []fs.ReadOption
+		want    config
+		wantErr error
+	}{
+		{"json", "c.json", `{"name": "nightly", "workers": 4}`, nil, config{Name: "nightly", Workers: 4}, nil},
+		{"yaml", "c.yaml", "name: nightly\ntags: [a, b]\n", nil, config{Name: "nightly", Tags: []string{"a", "b"}}, nil},
+		{"yml", "c.YML", "workers: 2\n", nil, config{Workers: 2}, nil},
+		{"toml", "c.toml", "name = \"nightly\"\nworkers = 8\n", nil, config{Name: "nightly", Workers: 8}, nil},
+		{"format override", "c.conf", `{"workers": 3}`, []fs.ReadOption{fs.WithFormat("json")}, config{Workers: 3}, nil},
+		{"decoder override", "d.json", "ignored", []fs.ReadOption{fs.WithDecoder(func(data []byte, v interface{}) error {
+			v.(*config).Name = string(data)
+			return nil
+		})}, config{Name: "ignored"}, nil},
+		{"unknown format", "c.ini", "name=nightly", nil, config{}, fs.ErrUnknownFormat},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := fs.NewFile(filepath.Join(dir, tt.file))
+			if err := f.Write([]byte(tt.content), fs.EnsureDir(0)); err != nil {
+				t.Fatalf("unable to write %s: %v", f.Path, err)
+			}
+
+			var got config
+			err := f.ReadInto(&got, tt.opts...)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Errorf("expected error %v, got %v", tt.wantErr, err)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("unable to read into: %v", err)
+			}
+
+			if got.Name != tt.want.Name || got.Workers != tt.want.Workers || len(got.Tags) != len(tt.want.Tags) {
+				t.Errorf("expected %+v, got %+v", tt.want, got)
+			}
+		})
+	}
+
+	f := fs.NewFile(filepath.Join(dir, "bad.json"))
+	f.Write([]byte("{"), fs.EnsureDir(0))
+	if err := f.ReadInto(&config{}); err == nil {
+		t.Errorf("expected error decoding invalid content")
+	}
+}
+
+func TestReadAllInto(t *testing.T) {
+	dir, clean := tempDir()
+	defer clean()
+
+	fragments := map[string]string{
+		"00-base.yaml":  "name: base\nworkers: 1\n",
+		"10-site.toml":  "workers = 4\n",
+		"20-local.json": `{"tags": ["local"]}`,
+	}
+
+	var files fs.Files
+	for _, name := range []string{"00-base.yaml", "10-site.toml", "20-local.json"} {
+		f := fs.NewFile(filepath.Join(dir, name))
+		if err := f.Write([]byte(fragments[name]), fs.EnsureDir(0)); err != nil {
+			t.Fatalf("unable to write %s: %v", name, err)
+		}
+		files = append(files, f)
+	}
+
+	var got config
+	if err := files.ReadAllInto(&got); err != nil {
+		t.Fatalf("unable to read fragments: %v", err)
+	}
+
+	if got.Name != "base" || got.Workers != 4 || len(got.Tags) != 1 {
+		t.Errorf("expected merged fragments, got %+v", got)
+	}
+}
@@ -0,0 +1,152 @@
+package fs
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// CompareMode selects how files present in two trees are compared
+type CompareMode int
+
+// The ways of comparing files
+const (
+	// CompareModTime compares size and modification time
+	CompareModTime CompareMode = iota
+
+	// CompareSize compares size only
+	CompareSize
+
+	// CompareChecksum compares size and, if equal, content hash
+	CompareChecksum
+)
+
+// DiffOptions configures Directory.Diff
+type DiffOptions struct {
+	// Compare is how files present in both trees are compared
+	Compare CompareMode
+
+	// Exclude lists glob patterns matched against entry base names.
+	// Matching files, and directories' content, are not compared.
+	Exclude []string
+}
+
+// TreeDiff lists the differences between two trees, as paths relative
+// to the tree roots. Only files and symlinks are listed.
+type TreeDiff struct {
+	// Added are files in the other tree only
+	Added []string
+
+	// Removed are files in this tree only
+	Removed []string
+
+	// Modified are files in both trees that differ
+	Modified []string
+}
+
+// Empty reports if the trees have no differences
+func (td *TreeDiff) Empty() bool {
+	return len(td.Added)+len(td.Removed)+len(td.Modified) == 0
+}
+
+// Diff compares the directory tree with that of other, returning the files
+// added, removed and modified in other with respect to this directory.
+// Files are compared as set by opts.Compare. A file and symlink with the
+// same path, or two symlinks with different targets, are modified.
+func (d *Directory) Diff(other *Directory, opts DiffOptions) (*TreeDiff, error) {
+	this, err := treeFiles(d.Path, opts.Exclude)
+	if err != nil {
+		return nil, err
+	}
+
+	that, err := treeFiles(other.Path, opts.Exclude)
+	if err != nil {
+		return nil, err
+	}
+
+	var diff TreeDiff
+	for rel, info := range this {
+		oinfo, ok := that[rel]
+		if !ok {
+			diff.Removed = append(diff.Removed, rel)
+			continue
+		}
+
+		same, err := opts.Compare.same(
+			filepath.Join(d.Path, rel),
+			filepath.Join(other.Path, rel),
+			info,
+			oinfo,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		if !same {
+			diff.Modified = append(diff.Modified, rel)
+		}
+	}
+
+	for rel := range that {
+		if _, ok := this[rel]; !ok {
+			diff.Added = append(diff.Added, rel)
+		}
+	}
+
+	sort.Strings(diff.Added)
+	sort.Strings(diff.Removed)
+	sort.Strings(diff.Modified)
+	return &diff, nil
+}
+
+func (m CompareMode) same(a, b string, ainfo, binfo os.FileInfo) (bool, error) {
+	if ainfo.Mode().Type() != binfo.Mode().Type() {
+		return false, nil
+	}
+
+	if m == CompareSize && ainfo.Mode().IsRegular() {
+		return ainfo.Size() == binfo.Size(), nil
+	}
+
+	return sameFile(a, b, ainfo, binfo, m == CompareChecksum)
+}
+
+// treeFiles returns the infos of the non directory entries
+// below root, keyed by their path relative to root
+func treeFiles(root string, exclude []string) (map[string]os.FileInfo, error) {
+	files := map[string]os.FileInfo{}
+	err := filepath.Walk(
+		root,
+		func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+
+			if path == root {
+				return nil
+			}
+
+			excluded, err := matchAny(info.Name(), exclude)
+			if err != nil || excluded {
+				if err == nil && info.IsDir() {
+					err = filepath.SkipDir
+				}
+				return err
+			}
+
+			if info.IsDir() {
+				return nil
+			}
+
+			rel, err := filepath.Rel(root, path)
+			if err != nil {
+				return err
+			}
+
+			files[rel] = info
+			return nil
+		},
+	)
+
+	return files, err
+}
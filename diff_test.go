@@ -0,0 +1,77 @@
+package fs_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/brinick/fs"
+)
+
+func TestDirectoryDiff(t *testing.T) {
+	tests := []struct {
+		name     string
+		opts     fs.DiffOptions
+		added    []string
+		removed  []string
+		modified []string
+	}{
+		// changed.txt has the same size and mtime, only its content differs
+		{"modtime", fs.DiffOptions{}, []string{"sub/new"}, []string{"sub/gone"}, []string{"resized.txt", "touched.txt"}},
+		{"size", fs.DiffOptions{Compare: fs.CompareSize}, []string{"sub/new"}, []string{"sub/gone"}, []string{"resized.txt"}},
+		{"checksum", fs.DiffOptions{Compare: fs.CompareChecksum}, []string{"sub/new"}, []string{"sub/gone"}, []string{"changed.txt", "resized.txt"}},
+		{"exclude", fs.DiffOptions{Compare: fs.CompareSize, Exclude: []string{"resized*", "sub"}}, nil, nil, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root, clean := tempDir()
+			defer clean()
+
+			a, b := filepath.Join(root, "a"), filepath.Join(root, "b")
+			makeTree(t, a, map[string]string{
+				"same.txt":    "same",
+				"changed.txt": "aaaa",
+				"touched.txt": "touched",
+				"resized.txt": "short",
+				"sub/gone":    "gone",
+			})
+			makeTree(t, b, map[string]string{
+				"same.txt":    "same",
+				"changed.txt": "bbbb",
+				"touched.txt": "touched",
+				"resized.txt": "much longer",
+				"sub/new":     "new",
+			})
+
+			// Give all files the same mtime, except touched.txt
+			mtime := time.Now().Add(-time.Hour)
+			for _, dir := range []string{a, b} {
+				for _, name := range []string{"same.txt", "changed.txt", "touched.txt", "resized.txt"} {
+					if dir == b && name == "touched.txt" {
+						continue
+					}
+
+					if err := os.Chtimes(filepath.Join(dir, name), mtime, mtime); err != nil {
+						t.Fatal(err)
+					}
+				}
+			}
+
+			diff, err := (&fs.Directory{Path: a}).Diff(&fs.Directory{Path: b}, tt.opts)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			checkPaths(t, "added", tt.added, diff.Added)
+			checkPaths(t, "removed", tt.removed, diff.Removed)
+			checkPaths(t, "modified", tt.modified, diff.Modified)
+
+			empty := len(tt.added)+len(tt.removed)+len(tt.modified) == 0
+			if diff.Empty() != empty {
+				t.Errorf("unexpected Empty() %t", diff.Empty())
+			}
+		})
+	}
+}
@@ -1,8 +1,9 @@
 package fs
 
 import (
+	"context"
+	"errors"
 	"fmt"
-	"io/ioutil"
 	"os"
 	"path/filepath"
 	"regexp"
@@ -18,7 +19,7 @@ func NewDir(paths ...string) (*Directory, error) {
 		if err != nil {
 			return nil, fmt.Errorf("unable to get pwd: %v", err)
 		}
-		return &Directory{d}, nil
+		return &Directory{Path: d}, nil
 	}
 
 	return &Directory{
@@ -29,6 +30,9 @@ func NewDir(paths ...string) (*Directory, error) {
 // Directory represents a particular directory
 type Directory struct {
 	Path string
+
+	// fsys is the file system of the directory, the OS one if nil
+	fsys Filesystem
 }
 
 // Match returns a boolean to indicate if any of the provided patterns
@@ -49,6 +53,25 @@ func (d *Directory) Match(patterns ...string) (bool, error) {
 	return false, nil
 }
 
+// MatchRegexp returns a boolean to indicate if any of the provided
+// regular expressions match against the directory's base name.
+// MatchAny matches them against the whole path.
+func (d *Directory) MatchRegexp(patterns ...string) (bool, error) {
+	res, err := compileRegexps(patterns)
+	if err != nil {
+		return false, err
+	}
+
+	return matchRegexps(d.Name(), res), nil
+}
+
+// NotMatchRegexp returns a boolean to indicate if none of the provided
+// regular expressions match against the directory's base name
+func (d *Directory) NotMatchRegexp(patterns ...string) (bool, error) {
+	ok, err := d.MatchRegexp(patterns...)
+	return !ok && err == nil, err
+}
+
 // MatchAny tries to match one of the patterns against any portion of the
 // Directory path
 func (d *Directory) MatchAny(patterns ...string) (bool, error) {
@@ -71,7 +94,16 @@ func (d *Directory) MatchAny(patterns ...string) (bool, error) {
 // Returning false, without an error, does not imply the path does not
 // exist, only that it is not a directory.
 func (d *Directory) Exists() (bool, error) {
-	return IsDir(d.Path)
+	info, err := d.sys().Stat(d.Path)
+	if errors.Is(err, os.ErrNotExist) {
+		return false, InexistantError{d.Path}
+	}
+
+	if err != nil {
+		return false, err
+	}
+
+	return info.IsDir(), nil
 }
 
 // Dir returns the parent path of the current directory
@@ -91,9 +123,10 @@ func (d *Directory) Name() string {
 func (d *Directory) Join(frags ...string) *Directory {
 	path := filepath.Join(d.Path, strings.Join(frags, "/"))
 	var cd *Directory
-	if ok, _ := Exists(path); ok {
+	if _, err := d.sys().Stat(path); err == nil {
 		cd = &Directory{
 			Path: path,
+			fsys: d.fsys,
 		}
 	}
 	return cd
@@ -105,28 +138,135 @@ func (d *Directory) Append(frags ...string) *Directory {
 	path := filepath.Join(d.Path, strings.Join(frags, "/"))
 	return &Directory{
 		Path: path,
+		fsys: d.fsys,
 	}
 }
 
 // Create will create the given directory path, including
-// missing intermediate dirs, if inexistant.
+// missing intermediate dirs, if inexistant. A mode of 0
+// is that of the mode policy, else 0755.
 func (d *Directory) Create(mode os.FileMode) error {
 	exists, err := d.Exists()
-	if err != nil {
+	if err != nil && !errors.As(err, &InexistantError{}) {
 		return err
 	}
 
 	if !exists {
-		return os.MkdirAll(d.Path, mode)
+		return mkdirAll(d.sys(), d.Path, dirPerm(mode))
+	}
+
+	return nil
+}
+
+// MoveTo moves the directory tree to the dst path, which must not
+// exist, and updates its path. The directory is renamed if possible,
+// else, e.g. across mount points, copied with the attributes of its
+// entries, committed to storage, then removed.
+func (d *Directory) MoveTo(dst string) error {
+	_, err := d.sys().Lstat(dst)
+	if err == nil {
+		return fmt.Errorf("cannot move to an existing destination (%s)", dst)
 	}
 
+	if !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	if err := movePath(d.sys(), d.Path, dst); err != nil {
+		return err
+	}
+
+	d.Path = dst
 	return nil
 }
 
+// EnsureSubdirs creates the named sub directories, and their parents,
+// with the given mode, where missing. Names may have several components
+// but must stay below the directory. All names are tried, the errors
+// of those that could not be created being returned together in
+// a MultiError of *os.PathError, with the others.
+func (d *Directory) EnsureSubdirs(mode os.FileMode, names ...string) (*Directories, error) {
+	var (
+		dirs Directories
+		errs MultiError
+	)
+
+	for _, name := range names {
+		path := filepath.Join(d.Path, name)
+		if rel, ok := relBelow(d.Path, path); !ok || rel == "." || filepath.IsAbs(name) {
+			errs = append(errs, asPathError("mkdir", path, errors.New("not a sub directory")))
+			continue
+		}
+
+		sub := &Directory{Path: path, fsys: d.fsys}
+		if err := sub.Create(mode); err != nil {
+			errs = append(errs, asPathError("mkdir", path, err))
+			continue
+		}
+
+		dirs = append(dirs, sub)
+	}
+
+	return &dirs, errs.errOrNil()
+}
+
 // CopyTo recursively copies the content of the directory
 // to the path rooted at the given directory. If the destination
 // already exists, an error is returned and no copy is performed.
-func (d *Directory) CopyTo(dst string) error {
+func (d *Directory) CopyTo(dst string, opts ...CopyOption) error {
+	return d.CopyToContext(context.Background(), dst, opts...)
+}
+
+// CopyToContext is like CopyTo, but abandons the copy and
+// returns the context error as soon as ctx is done.
+func (d *Directory) CopyToContext(ctx context.Context, dst string, opts ...CopyOption) error {
+	return d.copyTreeWith(ctx, &Directory{Path: dst, fsys: d.fsys}, opts)
+}
+
+// CopyToDir is like CopyTo, but copies to the given directory, which
+// may be on another file system, e.g. to push a local tree to a remote one
+func (d *Directory) CopyToDir(dst *Directory, opts ...CopyOption) error {
+	return d.copyTreeWith(context.Background(), dst, opts)
+}
+
+// copyTreeWith sets up the copy options, then copies the tree
+func (d *Directory) copyTreeWith(ctx context.Context, dst *Directory, opts []CopyOption) error {
+	cfg := newCopyConfig(opts)
+	if err := cfg.setRoots(d.Path, dst.Path); err != nil {
+		return err
+	}
+
+	if cfg.progress != nil {
+		total, err := treeBytes(d.sys(), d.Path)
+		if err != nil {
+			return err
+		}
+
+		// Never 0, so not reset by each file copy
+		cfg.total = total
+		if total == 0 {
+			cfg.total = -1
+		}
+	}
+
+	if err := d.copyTree(ctx, dst, cfg); err != nil || !cfg.scheduled() {
+		return err
+	}
+
+	if err := cfg.runJobs(ctx); err != nil {
+		return err
+	}
+
+	for _, setAttrs := range cfg.dirAttrs {
+		if err := setAttrs(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (d *Directory) copyTree(ctx context.Context, dst *Directory, cfg *copyConfig) error {
 	var (
 		err     error
 		fds     []os.FileInfo
@@ -134,64 +274,84 @@ func (d *Directory) CopyTo(dst string) error {
 		exists  bool
 	)
 
-	dstDir := Directory{dst}
-	exists, err = dstDir.Exists()
-	if err != nil {
+	exists, err = dst.Exists()
+	if err != nil && !errors.As(err, &InexistantError{}) {
 		return fmt.Errorf(
 			"unable to check if CopyTo destination dir (%s) exists already (%w)",
-			dst,
+			dst.Path,
 			err,
 		)
 	}
 
 	if exists {
-		return fmt.Errorf("cannot copy to an existing destination dir (%s)", dst)
+		return fmt.Errorf("cannot copy to an existing destination dir (%s)", dst.Path)
 	}
 
-	if srcinfo, err = os.Stat(d.Path); err != nil {
+	sys, dstSys := d.sys(), dst.sys()
+	if srcinfo, err = sys.Stat(d.Path); err != nil {
 		return err
 	}
 
-	if err = os.MkdirAll(dst, srcinfo.Mode()); err != nil {
+	if err = mkdirAll(dstSys, dst.Path, srcinfo.Mode()); err != nil {
 		return err
 	}
 
-	if fds, err = ioutil.ReadDir(d.Path); err != nil {
+	if fds, err = sys.ReadDir(d.Path); err != nil {
 		return err
 	}
 
+	// Links can only be created on the OS file system, and only where
+	// supported, their target content being copied otherwise
+	_, dstOS := dstSys.(OSFilesystem)
+	copyLinks := dstOS && cfg.linkRewrite != KeepLinks && cfg.destCapabilities(dst.Path).Has(CapSymlink)
+
 	for _, fd := range fds {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
 		srcfp := filepath.Join(d.Path, fd.Name())
-		dstfp := filepath.Join(dst, fd.Name())
+		dstfp := filepath.Join(dst.Path, fd.Name())
 
 		if fd.IsDir() {
-			d, err := NewDir(srcfp)
-			if err != nil {
-				return fmt.Errorf(
-					"failed to create Directory instance for %s (%v)",
-					srcfp,
-					err,
-				)
-			}
-
-			if err = d.CopyTo(dstfp); err != nil {
+			d := &Directory{Path: srcfp, fsys: d.fsys}
+			if err = d.copyTree(ctx, &Directory{Path: dstfp, fsys: dst.fsys}, cfg); err != nil {
 				return fmt.Errorf("cannot copy dir %s to %s: %w", srcfp, dstfp, err)
 			}
+		} else if fd.Mode()&os.ModeSymlink != 0 && copyLinks {
+			if err = copyLink(ctx, sys, srcfp, fd, dstfp, cfg); err != nil {
+				return fmt.Errorf("cannot copy link %s to dir %s (%w)", srcfp, dst.Path, err)
+			}
+		} else if cfg.scheduled() {
+			cfg.schedule(srcfp, fd, func(ctx context.Context) error {
+				if err := copyBetween(ctx, sys, srcfp, dstSys, dstfp, cfg); err != nil {
+					return fmt.Errorf("cannot copy file %s to dir %s (%w)", srcfp, dst.Path, err)
+				}
+				return nil
+			})
 		} else {
-			if err = CopyFile(srcfp, dst); err != nil {
-				return fmt.Errorf("cannot copy file %s to dir %s (%w)", srcfp, dst, err)
+			if err = copyBetween(ctx, sys, srcfp, dstSys, dstfp, cfg); err != nil {
+				return fmt.Errorf("cannot copy file %s to dir %s (%w)", srcfp, dst.Path, err)
 			}
 		}
 	}
 
-	return nil
+	// Once its content is copied, so as to keep its times
+	if cfg.scheduled() {
+		cfg.dirAttrs = append(cfg.dirAttrs, func() error {
+			return preserveAttrs(sys, d.Path, srcinfo, dstSys, dst.Path, cfg)
+		})
+		return nil
+	}
+
+	return preserveAttrs(sys, d.Path, srcinfo, dstSys, dst.Path, cfg)
 }
 
 // SubDirs returns a list of Directory instances for all directories
 // within the current directory that match at least one of the
 // provided glob patterns. If no patterns are provided, match all.
 func (d *Directory) SubDirs(patterns ...string) (*Directories, error) {
-	list, err := dirLister(d.Path)
+	list, err := dirLister(d)
 	if err != nil {
 		return nil, err
 	}
@@ -209,7 +369,7 @@ func (d *Directory) SubDirs(patterns ...string) (*Directories, error) {
 // one of the provided glob patterns. If no patterns are
 // provided, all files are matched.
 func (d *Directory) Files(patterns ...string) (*Files, error) {
-	entries, err := dirLister(d.Path)
+	entries, err := dirLister(d)
 	if err != nil {
 		return nil, err
 	}
@@ -230,7 +390,7 @@ func (d *Directory) Files(patterns ...string) (*Files, error) {
 // FilesAll is the same as Files(), except that the
 // returned list includes symbolic links.
 func (d *Directory) FilesAll(patterns ...string) (*Files, error) {
-	entries, err := dirLister(d.Path)
+	entries, err := dirLister(d)
 	if err != nil {
 		return nil, err
 	}
@@ -247,14 +407,84 @@ func (d *Directory) FilesAll(patterns ...string) (*Files, error) {
 	return matches, nil
 }
 
+// FilesRecursive is like Files, but also returns the files in the sub
+// directories, at most maxDepth levels below the directory, such that
+// 1 is the same as Files. A maxDepth <= 0 means no limit.
+func (d *Directory) FilesRecursive(maxDepth int, patterns ...string) (*Files, error) {
+	var files Files
+	err := d.Walk(func(e Entry) error {
+		if e.Type != FileEntry {
+			return nil
+		}
+
+		ok, err := matchAny(e.Name, patterns)
+		if ok || len(patterns) == 0 {
+			files = append(files, e.File())
+		}
+		return err
+	}, WalkIncludeHidden(), WalkMaxDepth(maxDepth))
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &files, nil
+}
+
 // Symlinks returns the symbolic links in the directory
 func (d *Directory) Symlinks(patterns ...string) (*Files, error) {
 	return nil, nil
 }
 
+// Entries returns the entries of the directory, sorted by name, that
+// match at least one of the provided glob patterns, or all if none
+// are provided. They are listed and described in a single pass, the
+// symlink targets included.
+func (d *Directory) Entries(patterns ...string) ([]Entry, error) {
+	infos, err := d.sys().ReadDir(d.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []Entry
+	for _, info := range infos {
+		ok, err := matchAny(info.Name(), patterns)
+		if err != nil {
+			return nil, err
+		}
+
+		if !ok && len(patterns) > 0 {
+			continue
+		}
+
+		entry := newEntry(filepath.Join(d.Path, info.Name()), info, 1)
+		entry.fsys = d.fsys
+
+		if entry.Type == SymlinkEntry {
+			if entry.LinkTarget, err = d.sys().Readlink(entry.Path); err != nil {
+				return nil, err
+			}
+		}
+
+		entries = append(entries, entry)
+	}
+
+	return entries, nil
+}
+
 // Remove will delete the directory
 func (d *Directory) Remove() error {
-	return os.RemoveAll(d.Path)
+	return d.RemoveContext(context.Background())
+}
+
+// RemoveContext is like Remove, but only records the removal
+// if ctx is that of a dry run. See DryRun.
+func (d *Directory) RemoveContext(ctx context.Context) error {
+	if dryRunAction(ctx, ActionRemove, d.Path) {
+		return nil
+	}
+
+	return d.sys().RemoveAll(d.Path)
 }
 
 // ------------------------------------------------------------------
@@ -284,6 +514,16 @@ func (d *Directories) Names() []string {
 	return names
 }
 
+// Paths returns the list of directory paths
+func (d *Directories) Paths() []string {
+	var paths []string
+	for _, dd := range *d {
+		paths = append(paths, dd.Path)
+	}
+
+	return paths
+}
+
 // Match returns the subset of directories whose base name matches
 // against any of the given glob patterns. If no patterns are supplied,
 // the operation is a no-op and the same Directories instance is returned.
@@ -323,10 +563,28 @@ func (d *Directories) NotMatch(patterns ...string) *Directories {
 	return &newD
 }
 
+// MatchRegexp returns the subset of Directories whose base name
+// matches against any of the given regular expressions
+func (d *Directories) MatchRegexp(patterns ...string) (*Directories, error) {
+	return dirsRegexpMatcher(d, true, patterns...)
+}
+
+// NotMatchRegexp returns the subset of Directories whose base name
+// does not match against any of the given regular expressions
+func (d *Directories) NotMatchRegexp(patterns ...string) (*Directories, error) {
+	return dirsRegexpMatcher(d, false, patterns...)
+}
+
 // Remove will delete the directories
 func (d *Directories) Remove() error {
+	return d.RemoveContext(context.Background())
+}
+
+// RemoveContext is like Remove, but only records the removals
+// if ctx is that of a dry run. See DryRun.
+func (d *Directories) RemoveContext(ctx context.Context) error {
 	for _, dir := range *d {
-		if err := dir.Remove(); err != nil {
+		if err := dir.RemoveContext(ctx); err != nil {
 			return err
 		}
 	}
@@ -1,6 +1,9 @@
 package fs_test
 
 import (
+	"errors"
+	"fmt"
+	"os"
 	"path/filepath"
 	"strings"
 	"testing"
@@ -101,3 +104,157 @@ func TestMatchDir(t *testing.T) {
 		})
 	}
 }
+
+func TestFilesRecursive(t *testing.T) {
+	tests := []struct {
+		name     string
+		maxDepth int
+		patterns []string
+		expect   []string
+	}{
+		{"all", 0, nil, []string{".hidden.so", "a.so", "b.txt", "sub/c.so", "sub/deep/d.so"}},
+		{"pattern", 0, []string{"*.so"}, []string{".hidden.so", "a.so", "sub/c.so", "sub/deep/d.so"}},
+		{"depth 1", 1, []string{"*.so"}, []string{".hidden.so", "a.so"}},
+		{"depth 2", 2, []string{"*.so", "*.txt"}, []string{".hidden.so", "a.so", "b.txt", "sub/c.so"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root, clean := tempDir()
+			defer clean()
+
+			makeTree(t, root, map[string]string{
+				".hidden.so":    "h",
+				"a.so":          "a",
+				"b.txt":         "b",
+				"sub/c.so":      "c",
+				"sub/deep/d.so": "d",
+			})
+
+			files, err := newDir(t, root).FilesRecursive(tt.maxDepth, tt.patterns...)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			checkPaths(t, tt.name, tt.expect, relPaths(t, root, files.Paths()))
+		})
+	}
+}
+
+func TestMatchRegexpDir(t *testing.T) {
+	dirs := fs.Dirs("/opt/gcc-11.2", "/opt/gcc-12.1", "/opt/clang-14", "/opt/gcc-latest")
+
+	tests := []struct {
+		name     string
+		patterns []string
+		expect   []string
+	}{
+		{"versioned", []string{`^gcc-\d+\.\d+$`}, []string{"gcc-11.2", "gcc-12.1"}},
+		{"alternation", []string{`^(clang|gcc)-1[24]`}, []string{"gcc-12.1", "clang-14"}},
+		{"no match", []string{`^icc`}, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			matched, err := dirs.MatchRegexp(tt.patterns...)
+			if err != nil {
+				t.Fatalf("unable to match: %v", err)
+			}
+
+			if got := strings.Join(matched.Names(), ","); got != strings.Join(tt.expect, ",") {
+				t.Errorf("expected %v, got %s", tt.expect, got)
+			}
+
+			notMatched, _ := dirs.NotMatchRegexp(tt.patterns...)
+			if len(*matched)+len(*notMatched) != len(*dirs) {
+				t.Errorf("expected matched and not matched dirs to cover all")
+			}
+		})
+	}
+
+	d := (*dirs)[0]
+	if ok, err := d.NotMatchRegexp(`^clang`); !ok || err != nil {
+		t.Errorf("expected %s not to match, got %t (%v)", d.Name(), ok, err)
+	}
+}
+
+func TestEntries(t *testing.T) {
+	root, clean := tempDir()
+	defer clean()
+
+	makeTree(t, root, map[string]string{"a.so": "aaa", "b.txt": "b", "sub/c.so": "c"})
+	if err := os.Symlink("a.so", filepath.Join(root, "link.so")); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		patterns []string
+		expect   []string
+	}{
+		{"all", nil, []string{"a.so:file:3", "b.txt:file:1", "link.so:symlink:a.so", "sub:dir"}},
+		{"pattern", []string{"*.so"}, []string{"a.so:file:3", "link.so:symlink:a.so"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			entries, err := newDir(t, root).Entries(tt.patterns...)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			var got []string
+			for _, e := range entries {
+				desc := e.Name + ":" + e.Type.String()
+				switch e.Type {
+				case fs.FileEntry:
+					desc += fmt.Sprintf(":%d", e.Size)
+				case fs.SymlinkEntry:
+					desc += ":" + e.LinkTarget
+				}
+
+				if e.Path != filepath.Join(root, e.Name) || e.ModTime.IsZero() {
+					t.Errorf("%s: unexpected path %s or mtime %v", e.Name, e.Path, e.ModTime)
+				}
+				got = append(got, desc)
+			}
+
+			if strings.Join(got, ",") != strings.Join(tt.expect, ",") {
+				t.Errorf("expected %v, got %v", tt.expect, got)
+			}
+		})
+	}
+
+	if _, err := newDir(t, root, "missing").Entries(); err == nil {
+		t.Errorf("expected an error listing a missing directory")
+	}
+}
+
+func TestEnsureSubdirs(t *testing.T) {
+	root, clean := tempDir()
+	defer clean()
+
+	makeTree(t, root, map[string]string{"existing/.keep": "", "file": "x"})
+
+	dirs, err := newDir(t, root).EnsureSubdirs(0750, "logs", "existing", "build/x86_64", "file/sub", "../escape", "")
+
+	var merr fs.MultiError
+	if !errors.As(err, &merr) || len(merr) != 3 {
+		t.Fatalf("expected 3 errors, got %v", err)
+	}
+
+	var pe *os.PathError
+	if !errors.As(merr[0], &pe) || pe.Path != filepath.Join(root, "file", "sub") {
+		t.Errorf("expected the file/sub error first, got %v", merr[0])
+	}
+
+	checkPaths(t, "ensured", []string{"build/x86_64", "existing", "logs"}, relPaths(t, root, dirs.Paths()))
+
+	if info, err := os.Stat(filepath.Join(root, "logs")); err != nil || info.Mode().Perm() != 0750 {
+		t.Errorf("expected logs created with mode 0750, got %v", err)
+	}
+
+	if _, err := os.Stat(filepath.Join(filepath.Dir(root), "escape")); err == nil {
+		t.Errorf("expected nothing created outside the directory")
+	}
+}
@@ -0,0 +1,102 @@
+package fs
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+// ActionOp is the operation of a planned action
+type ActionOp string
+
+const (
+	// ActionRemove is the removal of a file or directory tree
+	ActionRemove ActionOp = "remove"
+
+	// ActionOverwrite is the overwriting of a file by a copy
+	ActionOverwrite ActionOp = "overwrite"
+)
+
+// Action is a destructive operation, recorded rather than performed
+// during a dry run
+type Action struct {
+	Op   ActionOp
+	Path string
+}
+
+func (a Action) String() string {
+	return fmt.Sprintf("%s %s", a.Op, a.Path)
+}
+
+// ActionPlan lists the actions recorded during a dry run,
+// in the order they would have been performed
+type ActionPlan struct {
+	Actions []Action
+
+	// mu guards the actions recorded by concurrent operations
+	mu sync.Mutex
+}
+
+// Paths returns the paths of the actions of the given operation
+func (p *ActionPlan) Paths(op ActionOp) []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var paths []string
+	for _, a := range p.Actions {
+		if a.Op == op {
+			paths = append(paths, a.Path)
+		}
+	}
+
+	return paths
+}
+
+// dryRunKey is the context key of the plan of a dry run
+type dryRunKey struct{}
+
+// WithDryRun returns a copy of ctx in which the destructive operations
+// given it record their actions to plan, rather than perform them.
+// See DryRun.
+func WithDryRun(ctx context.Context, plan *ActionPlan) context.Context {
+	return context.WithValue(ctx, dryRunKey{}, plan)
+}
+
+// DryRun calls fn with a context in which the package's destructive
+// operations are recorded, rather than performed, and returns the plan
+// of what they would have done, e.g. to validate cleanup policies
+// against production trees. Only the operations given the context are
+// dry run, so that other calls, e.g. from other goroutines, are not.
+// Recorded are the removals of Directory.RemoveContext,
+// Directories.RemoveContext, Files.RemoveContext, RemoveFilesContext
+// and the deletions of SyncContext, as well as the copies overwriting
+// existing files of CopyFileContext, Directory.CopyToContext and
+// SyncContext. Other operations are performed, including the copies
+// creating new files, and moves, renames, trashing, whiteouts and the
+// cleanup of temporary directories, which are not recorded.
+func DryRun(ctx context.Context, fn func(ctx context.Context) error) (*ActionPlan, error) {
+	plan := &ActionPlan{}
+	err := fn(WithDryRun(ctx, plan))
+	return plan, err
+}
+
+// dryRunPlan returns the plan of the dry run of ctx, if any
+func dryRunPlan(ctx context.Context) *ActionPlan {
+	plan, _ := ctx.Value(dryRunKey{}).(*ActionPlan)
+	return plan
+}
+
+// dryRunAction records the action on path if ctx is that of a
+// dry run, in which case it must not be performed
+func dryRunAction(ctx context.Context, op ActionOp, path string) bool {
+	plan := dryRunPlan(ctx)
+	if plan == nil {
+		return false
+	}
+
+	plan.mu.Lock()
+	defer plan.mu.Unlock()
+
+	plan.Actions = append(plan.Actions, Action{Op: op, Path: path})
+	return true
+}
@@ -0,0 +1,96 @@
+package fs_test
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/brinick/fs"
+)
+
+func TestDryRun(t *testing.T) {
+	root := newTree(t, map[string]int{"a.log": 10, "b.txt": 20, "sub/c.log": 30, "old/d": 40})
+	src := filepath.Join(root, "src")
+	dst := filepath.Join(root, "dst")
+
+	if _, err := fs.Sync(src, dst, fs.SyncOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Changes to sync, and a stale destination file to delete
+	if err := ioutil.WriteFile(filepath.Join(src, "b.txt"), []byte("changed"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(src, "new"), []byte("new"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dst, "stale"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(root, "scratch"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	plan, err := fs.DryRun(context.Background(), func(ctx context.Context) error {
+		if err := fs.RemoveFilesContext(ctx, src, "*.log", 0, nil); err != nil {
+			return err
+		}
+
+		d, _ := fs.NewDir(src, "old")
+		if err := d.RemoveContext(ctx); err != nil {
+			return err
+		}
+
+		// Not given the context, so performed
+		if err := fs.RemoveFiles(root, "scratch", 0, nil); err != nil {
+			return err
+		}
+
+		_, err := fs.SyncContext(ctx, src, dst, fs.SyncOptions{Delete: true})
+		return err
+	})
+	if err != nil {
+		t.Fatalf("dry run failed: %v", err)
+	}
+
+	removed := relPaths(t, root, plan.Paths(fs.ActionRemove))
+	want := []string{"dst/stale", "src/a.log", "src/old", "src/sub/c.log"}
+	if strings.Join(removed, ",") != strings.Join(want, ",") {
+		t.Errorf("expected removals %v, got %v", want, removed)
+	}
+
+	overwritten := relPaths(t, root, plan.Paths(fs.ActionOverwrite))
+	if strings.Join(overwritten, ",") != "dst/b.txt" {
+		t.Errorf("expected dst/b.txt overwritten, got %v", overwritten)
+	}
+
+	for _, path := range []string{"src/a.log", "src/sub/c.log", "src/old/d", "dst/stale"} {
+		if _, err := os.Stat(filepath.Join(root, path)); err != nil {
+			t.Errorf("expected %s kept: %v", path, err)
+		}
+	}
+
+	if data, _ := ioutil.ReadFile(filepath.Join(dst, "b.txt")); len(data) != 20 {
+		t.Errorf("expected dst/b.txt left as is, got %q", data)
+	}
+
+	if _, err := os.Stat(filepath.Join(root, "scratch")); !os.IsNotExist(err) {
+		t.Errorf("expected the scratch file removed out of the dry run, got %v", err)
+	}
+
+	// Creations are not destructive
+	if _, err := os.Stat(filepath.Join(dst, "new")); err != nil {
+		t.Errorf("expected the new file copied: %v", err)
+	}
+
+	// Out of the dry run, removals are performed
+	if err := fs.RemoveFiles(src, "*.log", 0, nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(src, "a.log")); !os.IsNotExist(err) {
+		t.Errorf("expected a.log removed, got %v", err)
+	}
+}
@@ -0,0 +1,53 @@
+package fs
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// MultiError collects the errors of an operation that carried on
+// past individual failures. Per path failures are *os.PathError values.
+type MultiError []error
+
+func (m MultiError) Error() string {
+	switch len(m) {
+	case 0:
+		return "no errors"
+	case 1:
+		return m[0].Error()
+	}
+
+	msgs := make([]string, len(m))
+	for i, err := range m {
+		msgs[i] = err.Error()
+	}
+
+	return fmt.Sprintf("%d errors: %s", len(m), strings.Join(msgs, "; "))
+}
+
+// Unwrap returns the collected errors
+func (m MultiError) Unwrap() []error {
+	return m
+}
+
+// Is reports if any of the collected errors matches target
+func (m MultiError) Is(target error) bool {
+	for _, err := range m {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// errOrNil returns nil for an empty MultiError, which
+// must not be returned as a non-nil error
+func (m MultiError) errOrNil() error {
+	if len(m) == 0 {
+		return nil
+	}
+
+	return m
+}
@@ -0,0 +1,9 @@
+package fs
+
+// SetNewNativeWatcher replaces the creation of the native watchers of
+// NewWatcher, returning a function restoring it
+func SetNewNativeWatcher(fn func(root string) (*NativeWatcher, error)) func() {
+	prev := newNativeWatcher
+	newNativeWatcher = fn
+	return func() { newNativeWatcher = prev }
+}
@@ -2,11 +2,21 @@ package fs
 
 import (
 	"bufio"
+	"bytes"
+	"context"
+	"errors"
 	"fmt"
+	"io"
+	"io/fs"
 	"io/ioutil"
+	"math/rand"
 	"os"
 	"path/filepath"
+	"regexp"
+	"runtime"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 )
 
@@ -20,11 +30,17 @@ func NewFile(path string) *File {
 // File represents a file or symlink
 type File struct {
 	Path string
+
+	// lockFd is the open file on which a lock is held
+	lockFd *os.File
+
+	// fsys is the file system of the file, the OS one if nil
+	fsys Filesystem
 }
 
 // Dir returns the file's parent Directory
 func (f *File) Dir() *Directory {
-	return &Directory{filepath.Dir(f.Path)}
+	return &Directory{Path: filepath.Dir(f.Path), fsys: f.fsys}
 }
 
 // DirPath returns the file's parent Directory path
@@ -32,9 +48,25 @@ func (f *File) DirPath() string {
 	return f.Dir().Path
 }
 
+// Sibling returns the file with the given name in the same directory
+func (f *File) Sibling(name string) *File {
+	return &File{Path: filepath.Join(f.DirPath(), name), fsys: f.fsys}
+}
+
+// WithSuffix returns the file whose path is that of this file with the
+// given suffix appended, e.g. foo.txt.bck for the suffix .bck
+func (f *File) WithSuffix(suffix string) *File {
+	return &File{Path: f.Path + suffix, fsys: f.fsys}
+}
+
+// InDir returns the file with the same name in the given directory
+func (f *File) InDir(dir *Directory) *File {
+	return &File{Path: filepath.Join(dir.Path, f.Name()), fsys: dir.fsys}
+}
+
 // ModTime returns the last modification time of this file
 func (f *File) ModTime() (*time.Time, error) {
-	info, err := os.Stat(f.Path)
+	info, err := f.sys().Stat(f.Path)
 	if err != nil {
 		return nil, err
 	}
@@ -61,15 +93,33 @@ func (f *File) Match(patterns ...string) (bool, error) {
 	return false, nil
 }
 
+// MatchRegexp returns a boolean to indicate if any of the provided
+// regular expressions match against the file's name
+func (f *File) MatchRegexp(patterns ...string) (bool, error) {
+	res, err := compileRegexps(patterns)
+	if err != nil {
+		return false, err
+	}
+
+	return matchRegexps(f.Name(), res), nil
+}
+
+// NotMatchRegexp returns a boolean to indicate if none of the provided
+// regular expressions match against the file's name
+func (f *File) NotMatchRegexp(patterns ...string) (bool, error) {
+	ok, err := f.MatchRegexp(patterns...)
+	return !ok && err == nil, err
+}
+
 // SetFileMode changes the mode of the file
 func (f *File) SetFileMode(perm os.FileMode) error {
-	return os.Chmod(f.Path, perm)
+	return f.sys().Chmod(f.Path, perm)
 }
 
 // FileMode gets the file mode if it exists, else returns an error
 func (f *File) FileMode() (os.FileMode, error) {
 	var mode os.FileMode
-	fi, err := os.Stat(f.Path)
+	fi, err := f.sys().Stat(f.Path)
 	if err != nil {
 		return mode, err
 	}
@@ -77,8 +127,8 @@ func (f *File) FileMode() (os.FileMode, error) {
 	return fi.Mode(), nil
 }
 
-// Create will create the file with default file permission.
-// It will truncate the file if it already exists.
+// Create will create the file with default file permission, that of
+// the mode policy if set. It will truncate the file if it already exists.
 func (f *File) Create() error {
 	return f.CreateWithPerm(0000) // set the default mode
 }
@@ -86,44 +136,203 @@ func (f *File) Create() error {
 // CreateWithPerm will create the file with the given permission.
 // It will truncate the file if it already exists.
 func (f *File) CreateWithPerm(perm os.FileMode) error {
-	fd, err := os.Create(f.Path)
+	fd, err := f.sys().OpenFile(f.Path, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0666)
 	if err != nil {
-		return fmt.Errorf("unable to create file: %v", err)
+		return fmt.Errorf("unable to create file (%w)", err)
 	}
 	defer fd.Close()
 
+	p := policy()
+	if perm == 0000 {
+		perm = p.FileMode
+	}
+
 	if perm != 0000 {
-		if err = fd.Chmod(perm); err != nil {
-			return fmt.Errorf("unable to change file mode: %v", err)
+		if err = f.sys().Chmod(f.Path, perm); err != nil {
+			return fmt.Errorf("unable to change file mode (%w)", err)
 		}
 	}
+
+	if err := applyPolicy(f.sys(), f.Path, p); err != nil {
+		return fmt.Errorf("unable to apply the mode policy (%w)", err)
+	}
+	return nil
+}
+
+// CreateWithParents is like CreateWithPerm, but first creates
+// any missing parent directories
+func (f *File) CreateWithParents(perm os.FileMode) error {
+	if err := mkdirAll(f.sys(), f.DirPath(), dirPerm(0)); err != nil {
+		return fmt.Errorf("unable to create parent dirs (%w)", err)
+	}
+
+	return f.CreateWithPerm(perm)
+}
+
+// defaultDirPerm is the mode of parent directories created on demand
+const defaultDirPerm = 0755
+
+// WriteOption configures the file write operations
+type WriteOption func(*writeConfig)
+
+type writeConfig struct {
+	ensureDir bool
+	dirPerm   os.FileMode
+}
+
+// EnsureDir makes a write first create the file's missing parent
+// directories, with the given mode (that of the mode policy, else 0755,
+// if 0), and then the file itself if it does not exist, rather than failing
+func EnsureDir(perm os.FileMode) WriteOption {
+	return func(c *writeConfig) {
+		c.ensureDir = true
+		c.dirPerm = perm
+	}
+}
+
+// prepare applies the write options before a write. If create is
+// set, an inexistant file is created when parent dirs are ensured.
+func (f *File) prepare(opts []WriteOption, create bool) error {
+	c := &writeConfig{}
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	if !c.ensureDir {
+		return nil
+	}
+
+	if err := mkdirAll(f.sys(), f.DirPath(), dirPerm(c.dirPerm)); err != nil {
+		return fmt.Errorf("unable to create parent dirs (%w)", err)
+	}
+
+	if create && f.isInexistant() {
+		return f.Create()
+	}
+
 	return nil
 }
 
 // AppendLines appends the given lines to the file contents.
-// If the file does not exist, an error is returned.
-func (f *File) AppendLines(lines []string) error {
+// If the file does not exist, an error is returned, unless EnsureDir is given.
+func (f *File) AppendLines(lines []string, opts ...WriteOption) error {
+	if err := f.prepare(opts, true); err != nil {
+		return err
+	}
+
 	return f.writeLines(lines, true)
 }
 
 // WriteLines writes the given lines to the file.
-// If the file does not exist, an error is returned.
-func (f *File) WriteLines(lines []string) error {
+// If the file does not exist, an error is returned, unless EnsureDir is given.
+func (f *File) WriteLines(lines []string, opts ...WriteOption) error {
+	if err := f.prepare(opts, true); err != nil {
+		return err
+	}
+
 	return f.writeLines(lines, false)
 }
 
 // Write writes the given data bytes to the file.
-// If the file does not exist, an error is returned.
-func (f *File) Write(data []byte) error {
+// If the file does not exist, an error is returned, unless EnsureDir is given.
+func (f *File) Write(data []byte, opts ...WriteOption) error {
+	if err := f.prepare(opts, true); err != nil {
+		return err
+	}
+
 	return f.writeBytes(data, false)
 }
 
 // Append writes the given data bytes to the end of the file.
-// If the file does not exist, an error is returned.
-func (f *File) Append(data []byte) error {
+// If the file does not exist, an error is returned, unless EnsureDir is given.
+func (f *File) Append(data []byte, opts ...WriteOption) error {
+	if err := f.prepare(opts, true); err != nil {
+		return err
+	}
+
 	return f.writeBytes(data, true)
 }
 
+// WriteAtomic replaces the file content with the given data bytes,
+// such that readers see either the old or the new content, never a
+// partially written file. The data is written and synced to a temporary
+// file in the same directory, which is then renamed over the file.
+// The file is created if it does not exist, else its mode is kept.
+// Its parent directories are created too if EnsureDir is given.
+func (f *File) WriteAtomic(data []byte, opts ...WriteOption) error {
+	if err := f.prepare(opts, false); err != nil {
+		return err
+	}
+
+	return f.writeAtomic(func(w io.Writer) error {
+		_, err := w.Write(data)
+		return err
+	})
+}
+
+// WriteLinesAtomic is like WriteAtomic, writing the given lines
+func (f *File) WriteLinesAtomic(lines []string, opts ...WriteOption) error {
+	if err := f.prepare(opts, false); err != nil {
+		return err
+	}
+
+	return f.writeAtomic(func(w io.Writer) error {
+		for _, line := range lines {
+			if _, err := io.WriteString(w, line+"\n"); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Replace substitutes all occurrences of old in the file content with
+// new, returning the number of substitutions made. The file is rewritten,
+// atomically as with WriteAtomic, only if there was something to replace.
+func (f *File) Replace(old, new string) (int, error) {
+	return f.replace(func(data []byte) ([]byte, int) {
+		n := bytes.Count(data, []byte(old))
+		if n == 0 || old == "" {
+			return data, 0
+		}
+		return bytes.ReplaceAll(data, []byte(old), []byte(new)), n
+	})
+}
+
+// ReplaceRegexp substitutes all matches of the regular expression pattern
+// in the file content with repl, which may refer to submatches as in
+// regexp.Regexp.ReplaceAll, returning the number of substitutions made.
+// The file is rewritten, atomically as with WriteAtomic, only if there
+// was something to replace.
+func (f *File) ReplaceRegexp(pattern, repl string) (int, error) {
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return 0, err
+	}
+
+	return f.replace(func(data []byte) ([]byte, int) {
+		n := len(re.FindAllIndex(data, -1))
+		if n == 0 {
+			return data, 0
+		}
+		return re.ReplaceAll(data, []byte(repl)), n
+	})
+}
+
+func (f *File) replace(fn func([]byte) ([]byte, int)) (int, error) {
+	data, err := f.Bytes()
+	if err != nil {
+		return 0, err
+	}
+
+	data, n := fn(data)
+	if n == 0 {
+		return 0, nil
+	}
+
+	return n, f.WriteAtomic(data)
+}
+
 // Bytes returns the file content as a slice of bytes
 func (f *File) Bytes() ([]byte, error) {
 	exists, err := f.Exists()
@@ -133,7 +342,53 @@ func (f *File) Bytes() ([]byte, error) {
 	if !exists {
 		return []byte{}, InexistantError{f.Path}
 	}
-	return ioutil.ReadFile(f.Path)
+
+	fd, err := f.sys().Open(f.Path)
+	if err != nil {
+		return []byte{}, err
+	}
+	defer fd.Close()
+
+	return ioutil.ReadAll(fd)
+}
+
+// Reader returns the file opened for reading, so that its content can be
+// streamed rather than loaded into memory. Reads are buffered with a
+// pooled buffer (see SetBufferSize). The caller must Close it.
+// If the file does not exist, an error is returned.
+func (f *File) Reader() (io.ReadCloser, error) {
+	fd, err := f.open(os.O_RDONLY)
+	if err != nil {
+		return nil, err
+	}
+
+	return newBufferedReader(fd), nil
+}
+
+// Writer returns the file opened for writing, truncating any existing
+// content. Writes are buffered with a pooled buffer (see SetBufferSize)
+// and only guaranteed to reach the file once it is closed.
+// The caller must Close it.
+// If the file does not exist, an error is returned.
+func (f *File) Writer() (io.WriteCloser, error) {
+	fd, err := f.open(os.O_WRONLY | os.O_TRUNC)
+	if err != nil {
+		return nil, err
+	}
+
+	return newBufferedWriter(fd), nil
+}
+
+// AppendWriter returns the file opened for writing at its end.
+// The caller must Close it.
+// If the file does not exist, an error is returned.
+func (f *File) AppendWriter() (io.WriteCloser, error) {
+	fd, err := f.open(os.O_WRONLY | os.O_APPEND)
+	if err != nil {
+		return nil, err
+	}
+
+	return newBufferedWriter(fd), nil
 }
 
 // Lines returns the file contents as a slice of lines/strings
@@ -148,7 +403,7 @@ func (f *File) Lines() ([]string, error) {
 		return lines, InexistantError{f.Path}
 	}
 
-	fd, err := os.Open(f.Path)
+	fd, err := f.sys().Open(f.Path)
 	if err != nil {
 		return lines, err
 	}
@@ -163,6 +418,139 @@ func (f *File) Lines() ([]string, error) {
 
 }
 
+// Head returns the first n lines of the file, reading no further
+func (f *File) Head(n int) ([]string, error) {
+	return f.LinesRange(0, n)
+}
+
+// LinesRange returns the lines of the file from index from up to, but
+// excluding, index to, as Lines()[from:to] would, but reading no
+// further than needed. If to < 0, or beyond the end of the file, the
+// lines up to the end of the file are returned.
+func (f *File) LinesRange(from, to int) ([]string, error) {
+	var lines = []string{}
+
+	if from < 0 {
+		from = 0
+	}
+
+	fd, err := f.openLines()
+	if err != nil {
+		return lines, err
+	}
+	defer fd.Close()
+
+	if to >= 0 && to <= from {
+		return lines, nil
+	}
+
+	s := bufio.NewScanner(fd)
+	for i := 0; (to < 0 || i < to) && s.Scan(); i++ {
+		if i >= from {
+			lines = append(lines, s.Text())
+		}
+	}
+
+	return lines, s.Err()
+}
+
+// Tail returns the last n lines of the file. Where the file system
+// allows it, the file is read backwards from its end, so that only
+// the last lines are read.
+func (f *File) Tail(n int) ([]string, error) {
+	var lines = []string{}
+
+	fd, err := f.openLines()
+	if err != nil {
+		return lines, err
+	}
+	defer fd.Close()
+
+	if n <= 0 {
+		return lines, nil
+	}
+
+	ra, ok := fd.(io.ReaderAt)
+	info, err := fd.Stat()
+	if err != nil {
+		return lines, err
+	}
+
+	if !ok {
+		// Keep the last n lines while reading through the file
+		s := bufio.NewScanner(fd)
+		for s.Scan() {
+			if len(lines) == n {
+				lines = lines[1:]
+			}
+			lines = append(lines, s.Text())
+		}
+		return lines, s.Err()
+	}
+
+	offset, err := tailOffset(ra, info.Size(), n)
+	if err != nil {
+		return lines, err
+	}
+
+	s := bufio.NewScanner(io.NewSectionReader(ra, offset, info.Size()-offset))
+	for s.Scan() {
+		lines = append(lines, s.Text())
+	}
+
+	return lines, s.Err()
+}
+
+// tailOffset returns the offset of the start of the last n lines of
+// the content of r, of the given size, scanning it backwards
+func tailOffset(r io.ReaderAt, size int64, n int) (int64, error) {
+	buf := getBuf()
+	defer putBuf(buf)
+
+	newlines := 0
+	for end := size; end > 0; {
+		start := end - int64(len(*buf))
+		if start < 0 {
+			start = 0
+		}
+
+		chunk := (*buf)[:end-start]
+		if _, err := r.ReadAt(chunk, start); err != nil && err != io.EOF {
+			return 0, err
+		}
+
+		for i := len(chunk) - 1; i >= 0; i-- {
+			// The newline ending the last line does not start a line
+			if chunk[i] != '\n' || start+int64(i) == size-1 {
+				continue
+			}
+
+			if newlines++; newlines == n {
+				return start + int64(i) + 1, nil
+			}
+		}
+
+		end = start
+	}
+
+	return 0, nil
+}
+
+// openLines opens the file for reading its lines,
+// returning an InexistantError if it does not exist
+func (f *File) openLines() (fs.File, error) {
+	exists, err := f.Exists()
+	if err != nil {
+		return nil, err
+	}
+
+	if !exists {
+		return nil, InexistantError{f.Path}
+	}
+
+	return f.sys().Open(f.Path)
+}
+
 // Touch will create an empty file if it is inexistant, else will update
 // the last modified and access times. If ignoreIfExists is True, then
 // this update will not occur.
@@ -189,7 +577,7 @@ func (f *File) Touch(ignoreIfExists bool) error {
 
 	// touch the existing file, update access/mod times
 	now := time.Now().Local()
-	return os.Chtimes(f.Path, now, now)
+	return f.sys().Chtimes(f.Path, now, now)
 }
 
 // Text returns the file contents as a string
@@ -224,13 +612,33 @@ func (f *File) NameExt() (string, string) {
 
 // Exists checks if the given file path exists
 func (f *File) Exists() (bool, error) {
-	return Exists(f.Path)
+	_, err := f.sys().Stat(f.Path)
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	}
+
+	return err == nil, err
+}
+
+// ExistsAsLink checks if the file path exists as a symlink, whether
+// or not its target exists. Exists reports broken symlinks as inexistant.
+func (f *File) ExistsAsLink() (bool, error) {
+	fi, err := f.sys().Lstat(f.Path)
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+
+	if err != nil {
+		return false, err
+	}
+
+	return fi.Mode()&os.ModeSymlink != 0, nil
 }
 
 // Size returns the size in bytes of the file
 func (f *File) Size() int64 {
 	if exists, _ := f.Exists(); exists {
-		if info, err := os.Stat(f.Path); err == nil {
+		if info, err := f.sys().Stat(f.Path); err == nil {
 			return info.Size()
 		}
 	}
@@ -241,44 +649,88 @@ func (f *File) Size() int64 {
 // CopyTo copies the file to the given destination directory.
 // If the destination and the file directory are the same, nothing happens
 // and no error is returned.
-func (f *File) CopyTo(dstDir string) error {
-	return CopyFile(f.Path, dstDir)
+func (f *File) CopyTo(dstDir string, opts ...CopyOption) error {
+	return copyFile(context.Background(), f.sys(), f.Path, dstDir, newCopyConfig(opts))
 }
 
-// MoveTo moves the file to the given directory
+// CopyToDir copies the file into the given directory, which may be
+// on another file system, e.g. to push a local file to a remote tree.
+// If the destination file exists, it is overwritten.
+func (f *File) CopyToDir(dst *Directory, opts ...CopyOption) error {
+	dstPath := filepath.Join(dst.Path, f.Name())
+	return copyBetween(context.Background(), f.sys(), f.Path, dst.sys(), dstPath, newCopyConfig(opts))
+}
+
+// MoveTo moves the file to the given directory, and updates its path.
+// The file is renamed if possible, else, e.g. across mount points,
+// copied with its attributes, committed to storage, then removed.
 func (f *File) MoveTo(dir string) error {
-	if err := f.CopyTo(dir); err != nil {
+	dst := filepath.Join(dir, f.Name())
+	if err := movePath(f.sys(), f.Path, dst); err != nil {
 		return err
 	}
 
-	// Now remove the original
-	return os.Remove(f.Path)
+	f.Path = dst
+	return nil
 }
 
-// ExportTo creates a copy of the file at the given path.
-func (f *File) ExportTo(copypath string) error {
-	var err error
-	copyDir := filepath.Dir(copypath)
-	if copyDir == f.DirPath() {
-		// Need to use a tempdir if the parent dirs are the same
-		copyDir, err = ioutil.TempDir("", "")
-		if err != nil {
-			return fmt.Errorf("unable to create temp dir: %v", err)
+// movePath renames src to dst on sys, else, if they are on different
+// devices, copies it, with its attributes and committed to storage,
+// then removes it. A partial copy is removed if the copy fails.
+func movePath(sys Filesystem, src, dst string) error {
+	if rel, ok := relBelow(src, dst); ok && rel != "." {
+		return fmt.Errorf("unable to move %s into itself, to %s", src, dst)
+	}
+
+	err := sys.Rename(src, dst)
+	if err == nil || !crossDevice(err) {
+		return err
+	}
+
+	info, err := sys.Lstat(src)
+	if err != nil {
+		return err
+	}
+
+	_, err = sys.Lstat(dst)
+	existed := err == nil
+
+	cfg := &copyConfig{preserve: PreserveAll, fsync: true}
+	if info.IsDir() {
+		d := &Directory{Path: src, fsys: sys}
+		err = d.copyTree(context.Background(), &Directory{Path: dst, fsys: sys}, cfg)
+	} else {
+		err = copyPath(context.Background(), sys, src, dst, cfg)
+	}
+
+	if err != nil {
+		if !existed {
+			sys.RemoveAll(dst)
 		}
+		return err
 	}
-	// 1. Copy the current file to the copyDir
-	if err := CopyFile(f.Path, copyDir); err != nil {
+
+	// Now remove the original
+	return sys.RemoveAll(src)
+}
+
+// ExportTo creates a copy of the file at the given path. With the
+// WithSkipIdentical option, an identical existing copy is left as is.
+func (f *File) ExportTo(copypath string, opts ...CopyOption) error {
+	if ok, err := f.Exists(); err != nil || !ok {
+		if err == nil {
+			err = InexistantError{f.Path}
+		}
 		return err
 	}
 
-	// 2. Rename the file to the Base(copypath)
-	return os.Rename(filepath.Join(copyDir, f.Name()), copypath)
+	return copyPath(context.Background(), f.sys(), f.Path, copypath, newCopyConfig(opts))
 }
 
 // RenameTo renames the current file to the new path. If the destination
 // directory does not exist an error is returned.
 func (f *File) RenameTo(newpath string) error {
-	err := os.Rename(f.Path, newpath)
+	err := f.sys().Rename(f.Path, newpath)
 	if err == nil {
 		// update this File struct if no error occured
 		f.Path = newpath
@@ -287,25 +739,24 @@ func (f *File) RenameTo(newpath string) error {
 }
 
 // Backup copies the file to the same directory and adds a .bck suffix.
-func (f *File) Backup() error {
-	bckup := f.Name() + ".bck"
-	return f.ExportTo(filepath.Join(f.DirPath(), bckup))
+// Options are those of ExportTo.
+func (f *File) Backup(opts ...CopyOption) error {
+	return f.ExportTo(f.WithSuffix(".bck").Path, opts...)
 }
 
 // Recover looks for a file in the same directory with .bck suffix
 // and overwrites the file with this backup file.
 func (f *File) Recover() error {
-	bckup := f.Name() + ".bck"
-	bckup = filepath.Join(f.DirPath(), bckup)
-	ok, err := Exists(bckup)
+	bckup := f.WithSuffix(".bck")
+	ok, err := bckup.Exists()
 	if err != nil {
 		return fmt.Errorf("unable to check if backup file exists: %v", err)
 	}
 	if !ok {
-		return fmt.Errorf("backup file %s does not exist, nothing to recover", bckup)
+		return fmt.Errorf("backup file %s does not exist, nothing to recover", bckup.Path)
 	}
 
-	return os.Rename(bckup, f.Path)
+	return f.sys().Rename(bckup.Path, f.Path)
 }
 
 // Resolve will resolve the symbolic link, if it is one.
@@ -320,7 +771,7 @@ func (f *File) Resolve() (string, error) {
 		return f.Path, nil
 	}
 
-	tgt, err := os.Readlink(f.Path)
+	tgt, err := f.sys().Readlink(f.Path)
 	if err != nil {
 		return "", err
 	}
@@ -330,15 +781,24 @@ func (f *File) Resolve() (string, error) {
 
 // IsSymLink checks if the file is a symlink
 func (f *File) IsSymLink() (bool, error) {
-	return IsSymLink(f.Path)
+	fi, err := f.sys().Lstat(f.Path)
+	if errors.Is(err, os.ErrNotExist) {
+		return false, InexistantError{f.Path}
+	}
+
+	if err != nil {
+		return false, err
+	}
+
+	return fi.Mode()&os.ModeSymlink != 0, nil
 }
 
 func (f *File) isInexistant() bool {
-	_, err := os.Stat(f.Path)
-	return os.IsNotExist(err)
+	_, err := f.sys().Stat(f.Path)
+	return errors.Is(err, os.ErrNotExist)
 }
 
-func (f *File) open(flag int) (*os.File, error) {
+func (f *File) open(flag int) (FileHandle, error) {
 	// Stop if the file does not exist
 	if f.isInexistant() {
 		return nil, InexistantError{f.Path}
@@ -350,7 +810,7 @@ func (f *File) open(flag int) (*os.File, error) {
 		return nil, fmt.Errorf("unable to get file mode: %v", err)
 	}
 
-	return os.OpenFile(f.Path, flag, perm)
+	return f.sys().OpenFile(f.Path, flag, perm)
 }
 
 func (f *File) writeBytes(data []byte, append bool) error {
@@ -364,8 +824,85 @@ func (f *File) writeBytes(data []byte, append bool) error {
 		return err
 	}
 
-	_, err = fd.Write(data)
-	return err
+	if _, err = fd.Write(data); err != nil {
+		fd.Close()
+		return err
+	}
+
+	return fd.Close()
+}
+
+func (f *File) writeAtomic(write func(io.Writer) error) error {
+	perm := os.FileMode(0644)
+	if mode, err := f.FileMode(); err == nil {
+		perm = mode.Perm()
+	}
+
+	sys := f.sys()
+	tmp, tmpPath, err := createTemp(sys, f.DirPath(), "."+f.Name()+".tmp")
+	if err != nil {
+		return fmt.Errorf("unable to create temp file (%w)", err)
+	}
+
+	// Once renamed, removing the temp path is a harmless no-op
+	defer sys.Remove(tmpPath)
+
+	if err := write(tmp); err != nil {
+		tmp.Close()
+		return err
+	}
+
+	if err := sys.Chmod(tmpPath, perm); err != nil {
+		tmp.Close()
+		return fmt.Errorf("unable to change file mode: %v", err)
+	}
+
+	if err := syncHandle(tmp); err != nil {
+		tmp.Close()
+		return fmt.Errorf("unable to sync temp file: %v", err)
+	}
+
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	if err := sys.Rename(tmpPath, f.Path); err != nil {
+		return err
+	}
+
+	// Persist the rename itself, on a best effort basis
+	if dir, err := sys.Open(f.DirPath()); err == nil {
+		syncHandle(dir)
+		dir.Close()
+	}
+
+	return nil
+}
+
+// createTemp creates a new file in dir, on the given file system, whose
+// name starts with prefix, returning it opened for writing and its path
+func createTemp(sys Filesystem, dir, prefix string) (FileHandle, string, error) {
+	for i := 0; i < 10000; i++ {
+		path := filepath.Join(dir, prefix+strconv.FormatUint(uint64(rand.Uint32()), 10))
+		fd, err := sys.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0600)
+		if errors.Is(err, os.ErrExist) {
+			continue
+		}
+
+		return fd, path, err
+	}
+
+	return nil, "", &os.PathError{Op: "createtemp", Path: filepath.Join(dir, prefix+"*"), Err: os.ErrExist}
+}
+
+// syncHandle commits the content of the file handle to storage,
+// if its file system supports it
+func syncHandle(h interface{}) error {
+	if s, ok := h.(interface{ Sync() error }); ok {
+		return s.Sync()
+	}
+
+	return nil
 }
 
 func (f *File) writeLines(lines []string, append bool) error {
@@ -382,7 +919,7 @@ func (f *File) writeLines(lines []string, append bool) error {
 	defer fd.Close()
 
 	for _, line := range lines {
-		if _, err := fd.WriteString(line + "\n"); err != nil {
+		if _, err := io.WriteString(fd, line+"\n"); err != nil {
 			return err
 		}
 	}
@@ -466,15 +1003,37 @@ func (f *Files) NotMatch(patterns ...string) (*Files, error) {
 	return filesMatcher(f, false, patterns...)
 }
 
+// MatchRegexp returns the subset of Files whose name matches
+// against one or more of the given regular expressions
+func (f *Files) MatchRegexp(patterns ...string) (*Files, error) {
+	return filesRegexpMatcher(f, true, patterns...)
+}
+
+// NotMatchRegexp returns the subset of Files whose name does
+// not match against any of the given regular expressions
+func (f *Files) NotMatchRegexp(patterns ...string) (*Files, error) {
+	return filesRegexpMatcher(f, false, patterns...)
+}
+
 // Remove will delete files matching the given glob patterns
 func (f *Files) Remove(patterns ...string) error {
+	return f.RemoveContext(context.Background(), patterns...)
+}
+
+// RemoveContext is like Remove, but only records the removals
+// if ctx is that of a dry run. See DryRun.
+func (f *Files) RemoveContext(ctx context.Context, patterns ...string) error {
 	matches, err := f.Match(patterns...)
 	if err != nil {
 		return err
 	}
 
 	for _, m := range *matches {
-		if err := os.RemoveAll(m.Path); err != nil {
+		if dryRunAction(ctx, ActionRemove, m.Path) {
+			continue
+		}
+
+		if err := m.sys().RemoveAll(m.Path); err != nil {
 			return fmt.Errorf("unable to delete dir tree at %s (%w)", m.Path, err)
 		}
 	}
@@ -482,29 +1041,344 @@ func (f *Files) Remove(patterns ...string) error {
 	return nil
 }
 
+// Filter returns the subset of Files accepted by the predicate. Files
+// for which it fails are left out, and their errors are returned
+// together in a MultiError of *os.PathError, with the accepted files.
+func (f *Files) Filter(accept func(*File) (bool, error)) (*Files, error) {
+	var (
+		accepted Files
+		errs     MultiError
+	)
+
+	for _, file := range *f {
+		ok, err := accept(file)
+		if err != nil {
+			errs = append(errs, asPathError("filter", file.Path, err))
+			continue
+		}
+
+		if ok {
+			accepted = append(accepted, file)
+		}
+	}
+
+	return &accepted, errs.errOrNil()
+}
+
+// Each calls fn for each of the files, in turn. All files are tried,
+// and the errors returned by fn are returned together in a MultiError
+// of *os.PathError.
+func (f *Files) Each(fn func(*File) error) error {
+	var errs MultiError
+	for _, file := range *f {
+		if err := fn(file); err != nil {
+			errs = append(errs, asPathError("each", file.Path, err))
+		}
+	}
+
+	return errs.errOrNil()
+}
+
+// EachParallel is like Each, but calls fn for the files from a pool of
+// workers goroutines, the number of CPUs if workers <= 0, so fn must
+// be safe for concurrent use. Errors are in the order of the files.
+func (f *Files) EachParallel(workers int, fn func(*File) error) error {
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+
+	var (
+		wg      sync.WaitGroup
+		errs    = make([]error, len(*f))
+		indexes = make(chan int)
+	)
+
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				file := (*f)[i]
+				if err := fn(file); err != nil {
+					errs[i] = asPathError("each", file.Path, err)
+				}
+			}
+		}()
+	}
+
+	for i := range *f {
+		indexes <- i
+	}
+
+	close(indexes)
+	wg.Wait()
+
+	var merr MultiError
+	for _, err := range errs {
+		if err != nil {
+			merr = append(merr, err)
+		}
+	}
+
+	return merr.errOrNil()
+}
+
+// TotalSize returns the summed size of the files. Files that cannot be
+// stat'ed are left out, and their errors returned together in a
+// MultiError of *os.PathError, with the size of the others.
+func (f *Files) TotalSize() (int64, error) {
+	var (
+		total int64
+		errs  MultiError
+	)
+
+	for _, file := range *f {
+		info, err := file.sys().Stat(file.Path)
+		if err != nil {
+			errs = append(errs, asPathError("stat", file.Path, err))
+			continue
+		}
+
+		total += info.Size()
+	}
+
+	return total, errs.errOrNil()
+}
+
+// OldestNewest returns the oldest and newest modification times of
+// the files, zero times if there are none. Files that cannot be
+// stat'ed are left out, as with TotalSize.
+func (f *Files) OldestNewest() (time.Time, time.Time, error) {
+	var (
+		oldest, newest time.Time
+		errs           MultiError
+	)
+
+	for _, file := range *f {
+		info, err := file.sys().Stat(file.Path)
+		if err != nil {
+			errs = append(errs, asPathError("stat", file.Path, err))
+			continue
+		}
+
+		mt := info.ModTime()
+		if oldest.IsZero() || mt.Before(oldest) {
+			oldest = mt
+		}
+
+		if newest.IsZero() || mt.After(newest) {
+			newest = mt
+		}
+	}
+
+	return oldest, newest, errs.errOrNil()
+}
+
+// CountByExtension returns the number of files per extension, as
+// given by NameExt, without the dot. Files without one are counted
+// under the empty string.
+func (f *Files) CountByExtension() map[string]int {
+	counts := map[string]int{}
+	for _, file := range *f {
+		_, ext := file.NameExt()
+		counts[ext]++
+	}
+
+	return counts
+}
+
 // RemoveFiles will delete files matching the given file name glob,
-// found at most maxDepth directories below startDir
+// found at most maxDepth directories below startDir. All matching files
+// are tried, and those that could not be removed are reported together
+// in a MultiError of *os.PathError.
 func RemoveFiles(startDir, fileNameGlob string, maxDepth int, ignore []string) error {
-	files, err := FindFiles(startDir, fileNameGlob, maxDepth, ignore)
+	return RemoveFilesContext(context.Background(), startDir, fileNameGlob, maxDepth, ignore)
+}
+
+// RemoveFilesContext is like RemoveFiles, but stops the search as soon
+// as ctx is done, and only records the removals if ctx is that of a dry
+// run. See DryRun.
+func RemoveFilesContext(ctx context.Context, startDir, fileNameGlob string, maxDepth int, ignore []string) error {
+	files, err := FindFilesContext(ctx, startDir, fileNameGlob, maxDepth, ignore)
 	if err != nil {
 		return err
 	}
 
+	_, errs := removeAll(ctx, files, true)
+	return errs.errOrNil()
+}
+
+// removeAll removes the files, or records their removal for a dry run
+// of ctx, returning those removed and the errors of those that were
+// not. Unless bestEffort is set, it stops at the first file that
+// cannot be removed.
+func removeAll(ctx context.Context, files []string, bestEffort bool) ([]string, MultiError) {
+	var (
+		removed []string
+		errs    MultiError
+	)
+
 	for _, file := range files {
-		os.Remove(file)
+		if dryRunAction(ctx, ActionRemove, file) {
+			removed = append(removed, file)
+			continue
+		}
+
+		if err := (OSFilesystem{}).Remove(file); err != nil {
+			errs = append(errs, asPathError("remove", file, err))
+			if !bestEffort {
+				break
+			}
+			continue
+		}
+
+		removed = append(removed, file)
 	}
 
-	return nil
+	return removed, errs
+}
+
+// ErrTooManyRemovals is returned when a removal would delete
+// more files than allowed by RemoveOptions.MaxRemovals
+var ErrTooManyRemovals = errors.New("too many files to remove")
+
+// RemoveOptions configures RemoveFilesWithOptions
+type RemoveOptions struct {
+	// MaxDepth is the maximum number of directories below the start
+	// directory that are searched, 0 for no limit
+	MaxDepth int
+
+	// MinDepth is the minimum number of directories below the start
+	// directory in which a file must be to be removed, so that 1
+	// keeps the files directly in the start directory
+	MinDepth int
+
+	// Ignore lists directory names that are not searched
+	Ignore []string
+
+	// MaxRemovals, if > 0, is the maximum number of files to remove.
+	// If more files match, ErrTooManyRemovals is returned
+	// and no file is removed.
+	MaxRemovals int
+
+	// DryRun returns the files that would be removed, without removing them
+	DryRun bool
+
+	// BestEffort carries on past unreadable directories and files
+	// that cannot be removed, whose errors are then returned
+	// together in a MultiError of *os.PathError
+	BestEffort bool
+}
+
+// RemoveFilesWithOptions deletes the files matching the given file name
+// glob below startDir, within the depth limits of the options, and
+// returns the list of files removed (or that would be, for a dry run).
+// Unless opts.BestEffort is set, it stops at the first error.
+func RemoveFilesWithOptions(startDir, fileNameGlob string, opts RemoveOptions) ([]string, error) {
+	var walkErrs MultiError
+	found, err := findFiles(context.Background(), startDir, fileNameGlob, opts.MaxDepth, opts.Ignore, opts.BestEffort)
+	if err != nil {
+		if !opts.BestEffort || !errors.As(err, &walkErrs) {
+			return nil, err
+		}
+	}
+
+	var matches []string
+	for _, file := range found {
+		if dirDepth(startDir, filepath.Dir(file)) >= opts.MinDepth {
+			matches = append(matches, file)
+		}
+	}
+
+	if opts.MaxRemovals > 0 && len(matches) > opts.MaxRemovals {
+		return matches, fmt.Errorf(
+			"%d files match %s below %s, limit is %d (%w)",
+			len(matches),
+			fileNameGlob,
+			startDir,
+			opts.MaxRemovals,
+			ErrTooManyRemovals,
+		)
+	}
+
+	if opts.DryRun {
+		return matches, walkErrs.errOrNil()
+	}
+
+	removed, errs := removeAll(context.Background(), matches, opts.BestEffort)
+	if !opts.BestEffort && len(errs) > 0 {
+		return removed, errs[0]
+	}
+
+	errs = append(walkErrs, errs...)
+	return removed, errs.errOrNil()
+}
+
+// dirDepth returns the number of directories that dir is below root
+func dirDepth(root, dir string) int {
+	rel, err := filepath.Rel(root, dir)
+	if err != nil || rel == "." {
+		return 0
+	}
+
+	return strings.Count(rel, string(filepath.Separator)) + 1
 }
 
 // FindFiles finds all files matching a given file name glob, or exact name,
 // below the given start directory. The search goes at most max depth
 // directories down.
 func FindFiles(startDir, fileNameGlob string, maxDepth int, ignore []string) ([]string, error) {
-	_, files, err := WalkTree(startDir, ignore, maxDepth)
+	return FindFilesContext(context.Background(), startDir, fileNameGlob, maxDepth, ignore)
+}
+
+// FindFilesContext is like FindFiles, but stops the search and
+// returns the context error as soon as ctx is done.
+// An invalid glob is reported as an error wrapping filepath.ErrBadPattern.
+func FindFilesContext(ctx context.Context, startDir, fileNameGlob string, maxDepth int, ignore []string) ([]string, error) {
+	return findFiles(ctx, startDir, fileNameGlob, maxDepth, ignore, false)
+}
+
+// FindFilesBestEffort is like FindFiles, but carries on past directories
+// that cannot be read. It returns the files found together with a
+// MultiError of *os.PathError for the paths that were skipped.
+func FindFilesBestEffort(startDir, fileNameGlob string, maxDepth int, ignore []string) ([]string, error) {
+	return findFiles(context.Background(), startDir, fileNameGlob, maxDepth, ignore, true)
+}
+
+func findFiles(ctx context.Context, startDir, fileNameGlob string, maxDepth int, ignore []string, bestEffort bool) ([]string, error) {
+	// Match only checks the pattern as far as it needs to, so check it all first
+	if _, err := filepath.Match(fileNameGlob, ""); err != nil {
+		return nil, fmt.Errorf("invalid file name glob %q (%w)", fileNameGlob, err)
+	}
+
+	return findMatching(ctx, startDir, func(name string) (bool, error) {
+		return filepath.Match(fileNameGlob, name)
+	}, maxDepth, ignore, bestEffort)
+}
+
+// FindFilesRegexp is like FindFiles, but selects the files whose
+// name matches the regular expression rather than a glob
+func FindFilesRegexp(startDir, fileNameRegexp string, maxDepth int, ignore []string) ([]string, error) {
+	re, err := regexp.Compile(fileNameRegexp)
+	if err != nil {
+		return nil, fmt.Errorf("invalid file name regular expression %q (%w)", fileNameRegexp, err)
+	}
+
+	return findMatching(context.Background(), startDir, func(name string) (bool, error) {
+		return re.MatchString(name), nil
+	}, maxDepth, ignore, false)
+}
+
+// findMatching returns the files below startDir whose name is matched
+func findMatching(ctx context.Context, startDir string, match func(string) (bool, error), maxDepth int, ignore []string, bestEffort bool) ([]string, error) {
+	_, files, err := walkTree(ctx, startDir, ignore, maxDepth, bestEffort)
 	var matches []string
 	for _, f := range files {
-		matched, _ := filepath.Match(fileNameGlob, filepath.Base(f))
+		matched, merr := match(filepath.Base(f))
+		if merr != nil {
+			return nil, merr
+		}
+
 		if matched {
 			matches = append(matches, f)
 		}
@@ -512,11 +1386,12 @@ func FindFiles(startDir, fileNameGlob string, maxDepth int, ignore []string) ([]
 	return matches, err
 }
 
-type acceptFunc func(string) (bool, error)
+// AcceptFunc decides if the file at the given path should be accepted
+type AcceptFunc func(string) (bool, error)
 
 // FindIf has the same signature as Find but returns only files
 // that return true from the accept function
-func FindIf(startDir, fileNameGlob string, maxDepth int, ignore []string, accept acceptFunc) ([]string, error) {
+func FindIf(startDir, fileNameGlob string, maxDepth int, ignore []string, accept AcceptFunc) ([]string, error) {
 	matches, err := FindFiles(startDir, fileNameGlob, maxDepth, ignore)
 
 	if err != nil {
@@ -1,12 +1,15 @@
 package fs_test
 
 import (
+	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -346,6 +349,115 @@ func TestRenameFile(t *testing.T) {
 	}
 }
 
+func TestStreamFile(t *testing.T) {
+	f, clean := newFile()
+	defer clean()
+
+	for _, w := range []func() (io.WriteCloser, error){f.Writer, f.AppendWriter} {
+		wc, err := w()
+		if err != nil {
+			t.Fatalf("unable to open file for writing: %v", err)
+		}
+
+		if _, err := io.Copy(wc, strings.NewReader("hello\n")); err != nil {
+			t.Fatalf("unable to stream to file: %v", err)
+		}
+
+		if err := wc.Close(); err != nil {
+			t.Fatalf("unable to close file: %v", err)
+		}
+	}
+
+	rc, err := f.Reader()
+	if err != nil {
+		t.Fatalf("unable to open file for reading: %v", err)
+	}
+	defer rc.Close()
+
+	data, err := ioutil.ReadAll(rc)
+	if err != nil {
+		t.Fatalf("unable to stream from file: %v", err)
+	}
+
+	if string(data) != "hello\nhello\n" {
+		t.Errorf("unexpected streamed content %q", data)
+	}
+
+	if _, err := fs.NewFile("/missing/file.txt").Reader(); err == nil {
+		t.Error("expected an error opening an inexistant file, got none")
+	}
+}
+
+func TestWriteAtomic(t *testing.T) {
+	f, clean := newFile()
+	defer clean()
+
+	if err := f.SetFileMode(0640); err != nil {
+		t.Fatalf("unable to set file mode: %v", err)
+	}
+
+	if err := f.WriteLinesAtomic([]string{"hello", "world"}); err != nil {
+		t.Fatalf("unable to atomically write lines: %v", err)
+	}
+
+	checkFileHasLines(t, f, []string{"hello", "world"})
+
+	mode, err := f.FileMode()
+	if err != nil {
+		t.Fatalf("unable to get file mode: %v", err)
+	}
+
+	if mode.Perm() != 0640 {
+		t.Errorf("atomic write changed file mode, expected 0640, got %v", mode)
+	}
+
+	created := fs.NewFile(filepath.Join(f.DirPath(), "created.txt"))
+	if err := created.WriteAtomic([]byte("new\n")); err != nil {
+		t.Fatalf("unable to atomically write new file: %v", err)
+	}
+
+	checkFileHasLines(t, created, []string{"new"})
+
+	entries, err := ioutil.ReadDir(f.DirPath())
+	if err != nil {
+		t.Fatalf("unable to list dir: %v", err)
+	}
+
+	if len(entries) != 2 {
+		t.Errorf("expected no leftover temp files, found %d entries", len(entries))
+	}
+}
+
+func TestReplace(t *testing.T) {
+	f, clean := newFile()
+	defer clean()
+
+	if err := f.WriteLines([]string{"version=1.0", "name=foo", "other_version=1.0"}); err != nil {
+		t.Fatalf("unable to write lines: %v", err)
+	}
+
+	n, err := f.Replace("1.0", "2.0")
+	if err != nil || n != 2 {
+		t.Fatalf("expected 2 substitutions, got %d (%v)", n, err)
+	}
+
+	n, err = f.ReplaceRegexp(`(?m)^name=(\w+)$`, "name=${1}bar")
+	if err != nil || n != 1 {
+		t.Fatalf("expected 1 regexp substitution, got %d (%v)", n, err)
+	}
+
+	n, err = f.Replace("missing", "x")
+	if err != nil || n != 0 {
+		t.Fatalf("expected no substitutions, got %d (%v)", n, err)
+	}
+
+	checkFileHasLines(t, f, []string{"version=2.0", "name=foobar", "other_version=2.0"})
+
+	if _, err := f.ReplaceRegexp("(", ""); err == nil {
+		t.Error("expected an error for an invalid regexp, got none")
+	}
+}
+
 func checkFileHasLines(t *testing.T, f *fs.File, expect []string) {
 	lines, err := f.Lines()
 	if err != nil {
@@ -362,3 +474,455 @@ func checkFileHasLines(t *testing.T, f *fs.File, expect []string) {
 		}
 	}
 }
+
+func TestRemoveFilesWithOptions(t *testing.T) {
+	tests := []struct {
+		name      string
+		opts      fs.RemoveOptions
+		expect    []string
+		expectErr error
+		removed   bool
+	}{
+		{"dry run", fs.RemoveOptions{DryRun: true}, []string{"a.log", "sub/b.log", "sub/deep/c.log"}, nil, false},
+		{"min depth", fs.RemoveOptions{MinDepth: 1}, []string{"sub/b.log", "sub/deep/c.log"}, nil, true},
+		{"min and max depth", fs.RemoveOptions{MinDepth: 1, MaxDepth: 1}, []string{"sub/b.log"}, nil, true},
+		{"too many", fs.RemoveOptions{MaxRemovals: 2}, []string{"a.log", "sub/b.log", "sub/deep/c.log"}, fs.ErrTooManyRemovals, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root, clean := tempDir()
+			defer clean()
+
+			makeTree(t, root, map[string]string{
+				"a.log":          "a",
+				"keep.txt":       "k",
+				"sub/b.log":      "b",
+				"sub/deep/c.log": "c",
+			})
+
+			got, err := fs.RemoveFilesWithOptions(root, "*.log", tt.opts)
+			if !errors.Is(err, tt.expectErr) {
+				t.Fatalf("expected error %v, got %v", tt.expectErr, err)
+			}
+
+			checkPaths(t, tt.name, tt.expect, relPaths(t, root, got))
+
+			for _, path := range got {
+				exists, _ := fs.Exists(path)
+				if exists == tt.removed {
+					t.Errorf("%s: expected removed=%t", path, tt.removed)
+				}
+			}
+		})
+	}
+}
+
+func TestFindFilesBadPattern(t *testing.T) {
+	root, clean := tempDir()
+	defer clean()
+
+	makeTree(t, root, map[string]string{"a.log": "a"})
+
+	if _, err := fs.FindFiles(root, "[a-", 0, nil); !errors.Is(err, filepath.ErrBadPattern) {
+		t.Errorf("FindFiles: expected ErrBadPattern, got %v", err)
+	}
+
+	if err := fs.RemoveFiles(root, "[a-", 0, nil); !errors.Is(err, filepath.ErrBadPattern) {
+		t.Errorf("RemoveFiles: expected ErrBadPattern, got %v", err)
+	}
+}
+
+func TestRemoveFilesBestEffort(t *testing.T) {
+	if os.Getuid() == 0 {
+		t.Skip("permissions are not enforced for root")
+	}
+
+	root, clean := tempDir()
+	defer clean()
+
+	makeTree(t, root, map[string]string{
+		"a.log":        "a",
+		"locked/b.log": "b",
+		"closed/c.log": "c",
+	})
+
+	// Files in locked can be listed but not removed, closed cannot be read
+	locked, closed := filepath.Join(root, "locked"), filepath.Join(root, "closed")
+	for _, dir := range []string{locked, closed} {
+		mode := os.FileMode(0500)
+		if dir == closed {
+			mode = 0
+		}
+
+		if err := os.Chmod(dir, mode); err != nil {
+			t.Fatal(err)
+		}
+		defer os.Chmod(dir, 0755)
+	}
+
+	got, err := fs.RemoveFilesWithOptions(root, "*.log", fs.RemoveOptions{BestEffort: true})
+	checkPaths(t, "removed", []string{"a.log"}, relPaths(t, root, got))
+
+	var errs fs.MultiError
+	if !errors.As(err, &errs) {
+		t.Fatalf("expected a MultiError, got %v", err)
+	}
+
+	var failed []string
+	for _, e := range errs {
+		var pe *os.PathError
+		if !errors.As(e, &pe) {
+			t.Fatalf("expected a PathError, got %v", e)
+		}
+		failed = append(failed, pe.Path)
+	}
+
+	checkPaths(t, "failed", []string{"closed", "locked/b.log"}, relPaths(t, root, failed))
+}
+
+func TestEnsureDir(t *testing.T) {
+	tests := []struct {
+		name  string
+		write func(f *fs.File) error
+	}{
+		{"create", func(f *fs.File) error { return f.CreateWithParents(0600) }},
+		{"write", func(f *fs.File) error { return f.Write([]byte("data"), fs.EnsureDir(0)) }},
+		{"append lines", func(f *fs.File) error { return f.AppendLines([]string{"data"}, fs.EnsureDir(0700)) }},
+		{"write atomic", func(f *fs.File) error { return f.WriteAtomic([]byte("data"), fs.EnsureDir(0)) }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root, clean := tempDir()
+			defer clean()
+
+			f := fs.NewFile(filepath.Join(root, "a", "b", "file.txt"))
+			if err := tt.write(f); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if ok, _ := f.Exists(); !ok {
+				t.Errorf("%s: file not created", f.Path)
+			}
+		})
+	}
+
+	root, clean := tempDir()
+	defer clean()
+
+	f := fs.NewFile(filepath.Join(root, "missing", "file.txt"))
+	if err := f.Write([]byte("data")); err == nil {
+		t.Errorf("expected an error writing without EnsureDir")
+	}
+}
+
+func TestDerivedPaths(t *testing.T) {
+	f := fs.NewFile("/some/dir/foo.txt")
+	other := newDir(t, "/other")
+
+	tests := []struct {
+		name   string
+		got    *fs.File
+		expect string
+	}{
+		{"sibling", f.Sibling("bar.txt"), "/some/dir/bar.txt"},
+		{"with suffix", f.WithSuffix(".tmp"), "/some/dir/foo.txt.tmp"},
+		{"chained suffix", f.WithSuffix(".tmp").WithSuffix(".bck"), "/some/dir/foo.txt.tmp.bck"},
+		{"in dir", f.InDir(other), "/other/foo.txt"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.got.Path != tt.expect {
+				t.Errorf("expected %s, got %s", tt.expect, tt.got.Path)
+			}
+		})
+	}
+}
+
+func TestLineReads(t *testing.T) {
+	dir, clean := tempDir()
+	defer clean()
+
+	var content []string
+	for i := 0; i < 20000; i++ {
+		content = append(content, fmt.Sprintf("line %d", i))
+	}
+
+	f := fs.NewFile(filepath.Join(dir, "big.log"))
+	if err := f.WriteLines(content, fs.EnsureDir(0)); err != nil {
+		t.Fatal(err)
+	}
+
+	noNewline := fs.NewFile(filepath.Join(dir, "short.log"))
+	if err := noNewline.Write([]byte("a\nb\nc"), fs.EnsureDir(0)); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		read func() ([]string, error)
+		want []string
+	}{
+		{"head", func() ([]string, error) { return f.Head(2) }, content[:2]},
+		{"head beyond end", func() ([]string, error) { return noNewline.Head(5) }, []string{"a", "b", "c"}},
+		{"tail", func() ([]string, error) { return f.Tail(3) }, content[19997:]},
+		{"tail across buffers", func() ([]string, error) { return f.Tail(15000) }, content[5000:]},
+		{"tail beyond start", func() ([]string, error) { return noNewline.Tail(5) }, []string{"a", "b", "c"}},
+		{"tail without newline", func() ([]string, error) { return noNewline.Tail(1) }, []string{"c"}},
+		{"tail none", func() ([]string, error) { return f.Tail(0) }, []string{}},
+		{"range", func() ([]string, error) { return f.LinesRange(100, 103) }, content[100:103]},
+		{"range to end", func() ([]string, error) { return f.LinesRange(19999, -1) }, content[19999:]},
+		{"empty range", func() ([]string, error) { return f.LinesRange(5, 5) }, []string{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.read()
+			if err != nil {
+				t.Fatalf("unable to read lines: %v", err)
+			}
+
+			if strings.Join(got, "|") != strings.Join(tt.want, "|") || len(got) != len(tt.want) {
+				t.Errorf("expected %d lines %.40q..., got %d lines %.40q...", len(tt.want), tt.want, len(got), got)
+			}
+		})
+	}
+
+	if _, err := fs.NewFile(filepath.Join(dir, "missing")).Tail(1); !errors.As(err, &fs.InexistantError{}) {
+		t.Errorf("expected InexistantError, got %v", err)
+	}
+}
+
+func TestLineReadsEmpty(t *testing.T) {
+	dir, clean := tempDir()
+	defer clean()
+
+	sys := &countingFS{}
+	f := fs.NewFileOn(sys, filepath.Join(dir, "a.log"))
+	if err := f.WriteLines([]string{"a", "b", "c"}, fs.EnsureDir(0)); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		read func() ([]string, error)
+	}{
+		{"empty range", func() ([]string, error) { return f.LinesRange(1, 1) }},
+		{"reversed range", func() ([]string, error) { return f.LinesRange(2, 1) }},
+		{"tail none", func() ([]string, error) { return f.Tail(0) }},
+		{"tail negative", func() ([]string, error) { return f.Tail(-1) }},
+	}
+
+	for _, tt := range tests {
+		lines, err := tt.read()
+		if err != nil || len(lines) != 0 {
+			t.Errorf("%s: expected no lines, got %v (%v)", tt.name, lines, err)
+		}
+	}
+
+	if sys.open != 0 {
+		t.Errorf("expected all files closed, %d left open", sys.open)
+	}
+}
+
+func TestMatchRegexp(t *testing.T) {
+	root, clean := tempDir()
+	defer clean()
+
+	makeTree(t, root, map[string]string{"libA.so": "a", "libB.so.1": "b", "libC.a": "c", "sub/libD.so": "d"})
+
+	files := fs.Files{
+		fs.NewFile(filepath.Join(root, "libA.so")),
+		fs.NewFile(filepath.Join(root, "libB.so.1")),
+		fs.NewFile(filepath.Join(root, "libC.a")),
+	}
+
+	tests := []struct {
+		name     string
+		patterns []string
+		match    []string
+		notMatch []string
+	}{
+		{"anchored", []string{`\.so$`}, []string{"libA.so"}, []string{"libB.so.1", "libC.a"}},
+		{"alternation", []string{`^lib(A|C)\.`}, []string{"libA.so", "libC.a"}, []string{"libB.so.1"}},
+		{"several", []string{`\.a$`, `\.so\.\d+$`}, []string{"libB.so.1", "libC.a"}, []string{"libA.so"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			matched, err := files.MatchRegexp(tt.patterns...)
+			if err != nil {
+				t.Fatalf("unable to match: %v", err)
+			}
+
+			notMatched, err := files.NotMatchRegexp(tt.patterns...)
+			if err != nil {
+				t.Fatalf("unable to match: %v", err)
+			}
+
+			if got := strings.Join(matched.Names(), ","); got != strings.Join(tt.match, ",") {
+				t.Errorf("expected match %v, got %s", tt.match, got)
+			}
+
+			if got := strings.Join(notMatched.Names(), ","); got != strings.Join(tt.notMatch, ",") {
+				t.Errorf("expected no match %v, got %s", tt.notMatch, got)
+			}
+
+			if ok, _ := files[0].MatchRegexp(tt.patterns...); ok != (tt.match[0] == "libA.so") {
+				t.Errorf("unexpected File.MatchRegexp %t", ok)
+			}
+		})
+	}
+
+	if _, err := files.MatchRegexp("("); err == nil {
+		t.Errorf("expected error for invalid regexp")
+	}
+
+	found, err := fs.FindFilesRegexp(root, `^lib[A-D]\.so$`, 0, nil)
+	if err != nil || len(found) != 2 {
+		t.Errorf("expected 2 files found, got %v (%v)", found, err)
+	}
+}
+
+func TestFilesFilterEach(t *testing.T) {
+	root, clean := tempDir()
+	defer clean()
+
+	makeTree(t, root, map[string]string{"big": strings.Repeat("x", 100), "small": "x", "mid": strings.Repeat("x", 50)})
+
+	files := fs.Files{
+		fs.NewFile(filepath.Join(root, "big")),
+		fs.NewFile(filepath.Join(root, "missing")),
+		fs.NewFile(filepath.Join(root, "small")),
+		fs.NewFile(filepath.Join(root, "mid")),
+	}
+
+	large, err := files.Filter(func(f *fs.File) (bool, error) {
+		info, err := os.Stat(f.Path)
+		if err != nil {
+			return false, err
+		}
+		return info.Size() >= 50, nil
+	})
+
+	var merr fs.MultiError
+	if !errors.As(err, &merr) || len(merr) != 1 || !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("expected the missing file error, got %v", err)
+	}
+
+	if got := strings.Join(large.Names(), ","); got != "big,mid" {
+		t.Errorf("expected big,mid accepted, got %s", got)
+	}
+
+	var seen []string
+	err = files.Each(func(f *fs.File) error {
+		seen = append(seen, f.Name())
+		if f.Name() == "small" || f.Name() == "missing" {
+			return fmt.Errorf("unwanted %s", f.Name())
+		}
+		return nil
+	})
+
+	if !errors.As(err, &merr) || len(merr) != 2 || len(seen) != 4 {
+		t.Errorf("expected all files tried and 2 errors, got %v after %v", err, seen)
+	}
+
+	if err := large.Each(func(*fs.File) error { return nil }); err != nil {
+		t.Errorf("expected no error, got %v", err)
+	}
+}
+
+func TestFilesEachParallel(t *testing.T) {
+	var files fs.Files
+	for i := 0; i < 100; i++ {
+		files = append(files, fs.NewFile(fmt.Sprintf("/tmp/f%03d", i)))
+	}
+
+	for _, workers := range []int{0, 1, 7} {
+		t.Run(fmt.Sprintf("%d workers", workers), func(t *testing.T) {
+			var (
+				mu   sync.Mutex
+				seen = map[string]bool{}
+			)
+
+			err := files.EachParallel(workers, func(f *fs.File) error {
+				mu.Lock()
+				seen[f.Path] = true
+				mu.Unlock()
+
+				if strings.HasSuffix(f.Path, "7") {
+					return errors.New("unlucky")
+				}
+				return nil
+			})
+
+			if len(seen) != len(files) {
+				t.Errorf("expected all %d files processed, got %d", len(files), len(seen))
+			}
+
+			var merr fs.MultiError
+			if !errors.As(err, &merr) || len(merr) != 10 {
+				t.Fatalf("expected 10 errors, got %v", err)
+			}
+
+			var pe *os.PathError
+			if !errors.As(merr[0], &pe) || pe.Path != "/tmp/f007" {
+				t.Errorf("expected errors in file order, got %v first", merr[0])
+			}
+		})
+	}
+}
+
+func TestFilesStats(t *testing.T) {
+	root, clean := tempDir()
+	defer clean()
+
+	makeTree(t, root, map[string]string{"a.txt": "12345", "b.txt": "123", "c.tar.gz": "1", "README": ""})
+
+	base := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i, name := range []string{"a.txt", "b.txt", "c.tar.gz", "README"} {
+		mt := base.Add(time.Duration(i) * time.Hour)
+		if err := os.Chtimes(filepath.Join(root, name), mt, mt); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	files := fs.Files{
+		fs.NewFile(filepath.Join(root, "b.txt")),
+		fs.NewFile(filepath.Join(root, "README")),
+		fs.NewFile(filepath.Join(root, "a.txt")),
+		fs.NewFile(filepath.Join(root, "c.tar.gz")),
+	}
+
+	size, err := files.TotalSize()
+	if err != nil || size != 9 {
+		t.Errorf("expected size 9, got %d (%v)", size, err)
+	}
+
+	oldest, newest, err := files.OldestNewest()
+	if err != nil || !oldest.Equal(base) || !newest.Equal(base.Add(3*time.Hour)) {
+		t.Errorf("unexpected oldest/newest %v/%v (%v)", oldest, newest, err)
+	}
+
+	counts := files.CountByExtension()
+	if len(counts) != 3 || counts["txt"] != 2 || counts["gz"] != 1 || counts[""] != 1 {
+		t.Errorf("unexpected extension counts %v", counts)
+	}
+
+	files = append(files, fs.NewFile(filepath.Join(root, "missing")))
+	size, err = files.TotalSize()
+	if !errors.Is(err, os.ErrNotExist) || size != 9 {
+		t.Errorf("expected the missing file error and size 9, got %d (%v)", size, err)
+	}
+
+	if _, _, err := files.OldestNewest(); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("expected the missing file error, got %v", err)
+	}
+
+	var empty fs.Files
+	if oldest, newest, err := empty.OldestNewest(); err != nil || !oldest.IsZero() || !newest.IsZero() {
+		t.Errorf("expected zero times, got %v/%v (%v)", oldest, newest, err)
+	}
+}
@@ -0,0 +1,203 @@
+package fs
+
+import (
+	"io"
+	"io/fs"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Filesystem is the file system on which File and Directory operate.
+// Names are paths as understood by the implementation. The default is
+// OSFilesystem, other implementations allow the same code to work on
+// in memory, remote or read only trees.
+//
+// Locking, ownership, links, archives, compression, whiteouts and
+// watches always work on the OS file system.
+type Filesystem interface {
+	// Open opens the named file or directory for reading
+	Open(name string) (fs.File, error)
+
+	// OpenFile opens the named file with the given os.O_* flags,
+	// creating it with mode perm if os.O_CREATE is given
+	OpenFile(name string, flag int, perm os.FileMode) (FileHandle, error)
+
+	Stat(name string) (os.FileInfo, error)
+	Lstat(name string) (os.FileInfo, error)
+
+	// ReadDir returns the entries of the named directory, sorted by name
+	ReadDir(name string) ([]os.FileInfo, error)
+
+	Readlink(name string) (string, error)
+	MkdirAll(name string, perm os.FileMode) error
+	Rename(oldname, newname string) error
+	Remove(name string) error
+	RemoveAll(name string) error
+	Chmod(name string, mode os.FileMode) error
+	Chtimes(name string, atime, mtime time.Time) error
+}
+
+// FileHandle is a file opened on a Filesystem. Handles that also
+// have a Sync method are synced by the atomic writes.
+type FileHandle interface {
+	fs.File
+	io.Writer
+}
+
+// NewFileOn returns a new file instance for the given path on fsys
+func NewFileOn(fsys Filesystem, path string) *File {
+	return &File{Path: path, fsys: fsys}
+}
+
+// NewDirOn returns a new directory instance on fsys, for the
+// path made of the joined paths, or "." if none are provided
+func NewDirOn(fsys Filesystem, paths ...string) *Directory {
+	path := filepath.Join(paths...)
+	if path == "" {
+		path = "."
+	}
+
+	return &Directory{Path: path, fsys: fsys}
+}
+
+// Filesystem returns the file system of the file
+func (f *File) Filesystem() Filesystem {
+	return f.sys()
+}
+
+// Filesystem returns the file system of the directory
+func (d *Directory) Filesystem() Filesystem {
+	return d.sys()
+}
+
+// sys returns the file system of the file
+func (f *File) sys() Filesystem {
+	if f.fsys == nil {
+		return OSFilesystem{}
+	}
+
+	return f.fsys
+}
+
+// sys returns the file system of the directory
+func (d *Directory) sys() Filesystem {
+	if d.fsys == nil {
+		return OSFilesystem{}
+	}
+
+	return d.fsys
+}
+
+// ------------------------------------------------------------------
+
+// OSFilesystem is the Filesystem of the operating system
+type OSFilesystem struct{}
+
+// Open opens the named file or directory for reading
+func (OSFilesystem) Open(name string) (fs.File, error) {
+	return os.Open(name)
+}
+
+// OpenFile opens the named file with the given flags and mode
+func (OSFilesystem) OpenFile(name string, flag int, perm os.FileMode) (FileHandle, error) {
+	fd, err := os.OpenFile(name, flag, perm)
+	if op := openOp(flag); op != "" {
+		journaled(err, op, name)
+	}
+
+	if err != nil {
+		// Avoid returning a non nil interface holding a nil *os.File
+		return nil, err
+	}
+
+	return fd, nil
+}
+
+// Stat returns the info of the named file, following symlinks
+func (OSFilesystem) Stat(name string) (os.FileInfo, error) {
+	return os.Stat(name)
+}
+
+// Lstat returns the info of the named file, not following symlinks
+func (OSFilesystem) Lstat(name string) (os.FileInfo, error) {
+	return os.Lstat(name)
+}
+
+// ReadDir returns the entries of the named directory, sorted by name
+func (OSFilesystem) ReadDir(name string) ([]os.FileInfo, error) {
+	return ioutil.ReadDir(name)
+}
+
+// Readlink returns the target of the named symlink
+func (OSFilesystem) Readlink(name string) (string, error) {
+	return os.Readlink(name)
+}
+
+// MkdirAll creates the named directory and any missing parents
+func (OSFilesystem) MkdirAll(name string, perm os.FileMode) error {
+	return journaled(os.MkdirAll(name, perm), "mkdir", name)
+}
+
+// Rename renames oldname to newname
+func (OSFilesystem) Rename(oldname, newname string) error {
+	return journaled(os.Rename(oldname, newname), "rename", oldname, newname)
+}
+
+// Remove removes the named file or empty directory
+func (OSFilesystem) Remove(name string) error {
+	return journaled(os.Remove(name), "remove", name)
+}
+
+// RemoveAll removes the named path and its content
+func (OSFilesystem) RemoveAll(name string) error {
+	return journaled(os.RemoveAll(name), "remove", name)
+}
+
+// Chmod changes the mode of the named file
+func (OSFilesystem) Chmod(name string, mode os.FileMode) error {
+	return journaled(os.Chmod(name, mode), "chmod", name)
+}
+
+// Chtimes changes the access and modification times of the named file
+func (OSFilesystem) Chtimes(name string, atime, mtime time.Time) error {
+	return journaled(os.Chtimes(name, atime, mtime), "chtimes", name)
+}
+
+// walkOn is filepath.Walk on the given file system
+func walkOn(sys Filesystem, root string, fn filepath.WalkFunc) error {
+	info, err := sys.Lstat(root)
+	if err != nil {
+		err = fn(root, nil, err)
+	} else {
+		err = walkPath(sys, root, info, fn)
+	}
+
+	if err == filepath.SkipDir {
+		return nil
+	}
+
+	return err
+}
+
+// walkPath walks the tree at path, of info, for walkOn
+func walkPath(sys Filesystem, path string, info os.FileInfo, fn filepath.WalkFunc) error {
+	if !info.IsDir() {
+		return fn(path, info, nil)
+	}
+
+	infos, err := sys.ReadDir(path)
+	if ferr := fn(path, info, err); err != nil || ferr != nil {
+		return ferr
+	}
+
+	for _, child := range infos {
+		err := walkPath(sys, filepath.Join(path, child.Name()), child, fn)
+		if err != nil && (!child.IsDir() || err != filepath.SkipDir) {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,98 @@
+package fs_test
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"github.com/brinick/fs"
+)
+
+// recordingFS is the OS file system, recording the operations
+// made through it
+type recordingFS struct {
+	fs.OSFilesystem
+	ops map[string]bool
+}
+
+func (r *recordingFS) OpenFile(name string, flag int, perm os.FileMode) (fs.FileHandle, error) {
+	r.ops["openfile"] = true
+	return r.OSFilesystem.OpenFile(name, flag, perm)
+}
+
+func (r *recordingFS) Rename(oldname, newname string) error {
+	r.ops["rename"] = true
+	return r.OSFilesystem.Rename(oldname, newname)
+}
+
+func (r *recordingFS) MkdirAll(name string, perm os.FileMode) error {
+	r.ops["mkdir"] = true
+	return r.OSFilesystem.MkdirAll(name, perm)
+}
+
+func (r *recordingFS) RemoveAll(name string) error {
+	r.ops["removeall"] = true
+	return r.OSFilesystem.RemoveAll(name)
+}
+
+func (r *recordingFS) ReadDir(name string) ([]os.FileInfo, error) {
+	r.ops["readdir"] = true
+	return r.OSFilesystem.ReadDir(name)
+}
+
+func TestFilesystem(t *testing.T) {
+	tests := []struct {
+		name   string
+		run    func(t *testing.T, fsys fs.Filesystem, root string) error
+		expect []string
+	}{
+		{
+			"write",
+			func(t *testing.T, fsys fs.Filesystem, root string) error {
+				return fs.NewFileOn(fsys, filepath.Join(root, "a", "f.txt")).Write([]byte("f"), fs.EnsureDir(0))
+			},
+			[]string{"mkdir", "openfile"},
+		},
+		{
+			"write atomic",
+			func(t *testing.T, fsys fs.Filesystem, root string) error {
+				return fs.NewFileOn(fsys, filepath.Join(root, "f.txt")).WriteAtomic([]byte("f"))
+			},
+			[]string{"openfile", "rename"},
+		},
+		{
+			"copy dir",
+			func(t *testing.T, fsys fs.Filesystem, root string) error {
+				makeTree(t, root, map[string]string{"src/a.txt": "a", "src/sub/b.txt": "b"})
+				src := fs.NewDirOn(fsys, root, "src")
+				if err := src.CopyTo(filepath.Join(root, "dst")); err != nil {
+					return err
+				}
+
+				return src.Remove()
+			},
+			[]string{"mkdir", "openfile", "readdir", "removeall"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root, clean := tempDir()
+			defer clean()
+
+			fsys := &recordingFS{ops: map[string]bool{}}
+			if err := tt.run(t, fsys, root); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			var ops []string
+			for op := range fsys.ops {
+				ops = append(ops, op)
+			}
+			sort.Strings(ops)
+
+			checkPaths(t, "operations", tt.expect, ops)
+		})
+	}
+}
@@ -0,0 +1,350 @@
+package fs
+
+import (
+	"context"
+	"os"
+	"os/user"
+	"strconv"
+	"time"
+)
+
+// All returns an AcceptFunc accepting paths accepted by all the filters
+func All(filters ...AcceptFunc) AcceptFunc {
+	return func(path string) (bool, error) {
+		for _, accept := range filters {
+			ok, err := accept(path)
+			if err != nil || !ok {
+				return false, err
+			}
+		}
+
+		return true, nil
+	}
+}
+
+// Not returns an AcceptFunc accepting paths rejected by the filter.
+// Paths for which the filter errors are not accepted.
+func Not(filter AcceptFunc) AcceptFunc {
+	return func(path string) (bool, error) {
+		ok, err := filter(path)
+		return !ok && err == nil, err
+	}
+}
+
+// ByUser returns an AcceptFunc accepting paths owned by the named user,
+// which may also be given as a numeric uid. Symlinks are not followed.
+func ByUser(name string) AcceptFunc {
+	return byOwner(func() (string, error) {
+		u, err := user.Lookup(name)
+		if err != nil {
+			return "", err
+		}
+		return u.Uid, nil
+	}, name, func(uid, _ int) int { return uid })
+}
+
+// ByGroup returns an AcceptFunc accepting paths owned by the named group,
+// which may also be given as a numeric gid. Symlinks are not followed.
+func ByGroup(name string) AcceptFunc {
+	return byOwner(func() (string, error) {
+		g, err := user.LookupGroup(name)
+		if err != nil {
+			return "", err
+		}
+		return g.Gid, nil
+	}, name, func(_, gid int) int { return gid })
+}
+
+// byOwner returns an AcceptFunc comparing the id selected from a path's
+// uid and gid to that looked up, once, for the given user or group name
+func byOwner(lookup func() (string, error), name string, pick func(uid, gid int) int) AcceptFunc {
+	var (
+		want      = -1
+		lookupErr error
+	)
+
+	if id, err := strconv.Atoi(name); err == nil {
+		want = id
+	} else if sid, err := lookup(); err != nil {
+		lookupErr = err
+	} else {
+		want, lookupErr = strconv.Atoi(sid)
+	}
+
+	return func(path string) (bool, error) {
+		if lookupErr != nil {
+			return false, lookupErr
+		}
+
+		uid, gid, err := ownerIDs(path)
+		if err != nil {
+			return false, err
+		}
+
+		return pick(uid, gid) == want, nil
+	}
+}
+
+// byMode returns an AcceptFunc accepting paths whose mode, symlinks not
+// followed, has any of the given bits set
+func byMode(bits os.FileMode) AcceptFunc {
+	return func(path string) (bool, error) {
+		info, err := os.Lstat(path)
+		if err != nil {
+			return false, err
+		}
+
+		return info.Mode()&bits != 0, nil
+	}
+}
+
+// WorldWritable returns an AcceptFunc accepting paths writable by anyone.
+// Symlinks, whose own mode is meaningless, are never accepted.
+func WorldWritable() AcceptFunc {
+	return func(path string) (bool, error) {
+		info, err := os.Lstat(path)
+		if err != nil || info.Mode()&os.ModeSymlink != 0 {
+			return false, err
+		}
+
+		return info.Mode().Perm()&0002 != 0, nil
+	}
+}
+
+// Setuid returns an AcceptFunc accepting paths with the setuid bit set
+func Setuid() AcceptFunc {
+	return byMode(os.ModeSetuid)
+}
+
+// Setgid returns an AcceptFunc accepting paths with the setgid bit set
+func Setgid() AcceptFunc {
+	return byMode(os.ModeSetgid)
+}
+
+// ReadableBy returns an AcceptFunc accepting paths that the named user,
+// which may also be given as a numeric uid, may read according to the
+// path's permission bits and owners. Only the path itself is checked,
+// not the directories leading to it. Root can read anything.
+func ReadableBy(name string) AcceptFunc {
+	u, err := user.Lookup(name)
+	if err != nil {
+		if _, nerr := strconv.Atoi(name); nerr == nil {
+			u, err = user.LookupId(name)
+		}
+	}
+
+	var (
+		uid    = -1
+		groups = map[int]bool{}
+	)
+
+	if err == nil {
+		uid, err = strconv.Atoi(u.Uid)
+	}
+
+	if err == nil {
+		var gids []string
+		if gids, err = u.GroupIds(); err == nil {
+			for _, g := range gids {
+				if gid, gerr := strconv.Atoi(g); gerr == nil {
+					groups[gid] = true
+				}
+			}
+		}
+	}
+
+	lookupErr := err
+	return func(path string) (bool, error) {
+		if lookupErr != nil {
+			return false, lookupErr
+		}
+
+		if uid == 0 {
+			return true, nil
+		}
+
+		info, err := os.Stat(path)
+		if err != nil {
+			return false, err
+		}
+
+		// The owners of the target, with its mode, rather than those of a link
+		fuid, fgid, ok := infoOwner(info)
+		if !ok {
+			return false, ErrOwnershipUnsupported
+		}
+
+		perm := info.Mode().Perm()
+		switch {
+		case fuid == uid:
+			return perm&0400 != 0, nil
+		case groups[fgid]:
+			return perm&0040 != 0, nil
+		}
+
+		return perm&0004 != 0, nil
+	}
+}
+
+// NotReadableBy returns an AcceptFunc accepting paths that the named
+// user may not read. See ReadableBy.
+func NotReadableBy(name string) AcceptFunc {
+	return Not(ReadableBy(name))
+}
+
+// ------------------------------------------------------------------
+
+// Query selects the files found by Find with predicates on their
+// metadata. The predicates are combined: a file must satisfy them all.
+// Name, size, age and mode predicates use the entry read while
+// walking, so no further Stat is needed for them.
+type Query struct {
+	preds    []func(Entry) (bool, error)
+	maxDepth int
+	exclude  []string
+}
+
+// Where returns an empty Query, selecting all files
+func Where() *Query {
+	return &Query{}
+}
+
+func (q *Query) where(pred func(Entry) (bool, error)) *Query {
+	q.preds = append(q.preds, pred)
+	return q
+}
+
+// NameGlob selects files whose base name matches any of the glob patterns
+func (q *Query) NameGlob(patterns ...string) *Query {
+	return q.where(func(e Entry) (bool, error) {
+		return matchAny(e.Name, patterns)
+	})
+}
+
+// NameRegexp selects files whose base name matches any of the
+// regular expressions. An invalid one fails the search.
+func (q *Query) NameRegexp(patterns ...string) *Query {
+	res, err := compileRegexps(patterns)
+	return q.where(func(e Entry) (bool, error) {
+		if err != nil {
+			return false, err
+		}
+		return matchRegexps(e.Name, res), nil
+	})
+}
+
+// OlderThan selects files last modified more than age ago
+func (q *Query) OlderThan(age time.Duration) *Query {
+	return q.where(func(e Entry) (bool, error) {
+		return time.Since(e.ModTime) > age, nil
+	})
+}
+
+// NewerThan selects files last modified less than age ago
+func (q *Query) NewerThan(age time.Duration) *Query {
+	return q.where(func(e Entry) (bool, error) {
+		return time.Since(e.ModTime) < age, nil
+	})
+}
+
+// LargerThan selects files of more than size bytes
+func (q *Query) LargerThan(size int64) *Query {
+	return q.where(func(e Entry) (bool, error) {
+		return e.Size > size, nil
+	})
+}
+
+// SmallerThan selects files of less than size bytes
+func (q *Query) SmallerThan(size int64) *Query {
+	return q.where(func(e Entry) (bool, error) {
+		return e.Size < size, nil
+	})
+}
+
+// ModeAny selects files whose mode has any of the given bits set,
+// e.g. 0111 for files executable by someone, or os.ModeSetuid
+func (q *Query) ModeAny(bits os.FileMode) *Query {
+	return q.where(func(e Entry) (bool, error) {
+		return e.Mode&bits != 0, nil
+	})
+}
+
+// OwnedBy selects files owned by the named user, or numeric uid
+func (q *Query) OwnedBy(name string) *Query {
+	return q.Accept(ByUser(name))
+}
+
+// InGroup selects files owned by the named group, or numeric gid
+func (q *Query) InGroup(name string) *Query {
+	return q.Accept(ByGroup(name))
+}
+
+// Accept selects files accepted by the filter, given their path
+func (q *Query) Accept(filter AcceptFunc) *Query {
+	return q.where(func(e Entry) (bool, error) {
+		return filter(e.Path)
+	})
+}
+
+// MaxDepth limits the search to depth levels below the root,
+// as for WalkMaxDepth, with no limit if <= 0
+func (q *Query) MaxDepth(depth int) *Query {
+	q.maxDepth = depth
+	return q
+}
+
+// Exclude skips entries, and directories' content, whose base
+// name matches any of the glob patterns
+func (q *Query) Exclude(patterns ...string) *Query {
+	q.exclude = append(q.exclude, patterns...)
+	return q
+}
+
+func (q *Query) match(e Entry) (bool, error) {
+	for _, pred := range q.preds {
+		ok, err := pred(e)
+		if err != nil || !ok {
+			return false, err
+		}
+	}
+
+	return true, nil
+}
+
+// Find returns the files, hidden ones and symlinks included, below
+// root selected by the query, in lexical order. A nil query selects
+// all files.
+func Find(root string, q *Query) (*Files, error) {
+	return FindContext(context.Background(), root, q)
+}
+
+// FindContext is like Find, but stops the search and returns the
+// context error as soon as ctx is done
+func FindContext(ctx context.Context, root string, q *Query) (*Files, error) {
+	if q == nil {
+		q = Where()
+	}
+
+	var found Files
+	err := NewDirOn(nil, root).Walk(func(e Entry) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		if e.IsDir() {
+			return nil
+		}
+
+		ok, err := q.match(e)
+		if ok {
+			found = append(found, e.File())
+		}
+		return err
+	}, WalkIncludeHidden(), WalkMaxDepth(q.maxDepth), WalkExclude(q.exclude...))
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &found, nil
+}
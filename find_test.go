@@ -0,0 +1,204 @@
+package fs_test
+
+import (
+	"os"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/brinick/fs"
+)
+
+func TestFindByOwner(t *testing.T) {
+	root, clean := tempDir()
+	defer clean()
+
+	makeTree(t, root, map[string]string{"a.txt": "a", "sub/b.txt": "b"})
+
+	me, err := user.Current()
+	if err != nil {
+		t.Fatalf("unable to get current user: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		accept fs.AcceptFunc
+		expect int
+	}{
+		{"by user name", fs.ByUser(me.Username), 2},
+		{"by uid", fs.ByUser(me.Uid), 2},
+		{"by gid", fs.ByGroup(strconv.Itoa(os.Getgid())), 2},
+		{"other uid", fs.ByUser(strconv.Itoa(os.Getuid() + 1)), 0},
+		{"all", fs.All(fs.ByUser(me.Uid), fs.ByGroup(strconv.Itoa(os.Getgid()))), 2},
+		{"unknown user", fs.ByUser("no-such-user-here"), 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			found, err := fs.FindIf(root, "*.txt", 0, nil, tt.accept)
+			if err != nil {
+				t.Fatalf("unable to find files: %v", err)
+			}
+
+			if len(found) != tt.expect {
+				t.Errorf("expected %d files, got %d", tt.expect, len(found))
+			}
+		})
+	}
+}
+
+func TestFindByPermission(t *testing.T) {
+	root, clean := tempDir()
+	defer clean()
+
+	makeTree(t, root, map[string]string{"open.txt": "o", "private.txt": "p", "suid.txt": "s"})
+
+	chmod := func(name string, mode os.FileMode) {
+		if err := os.Chmod(filepath.Join(root, name), mode); err != nil {
+			t.Fatalf("unable to chmod %s: %v", name, err)
+		}
+	}
+
+	chmod("open.txt", 0666)
+	chmod("private.txt", 0200)
+	chmod("suid.txt", 0755|os.ModeSetuid)
+
+	me, err := user.Current()
+	if err != nil {
+		t.Fatalf("unable to get current user: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		accept fs.AcceptFunc
+		expect []string
+	}{
+		{"world writable", fs.WorldWritable(), []string{"open.txt"}},
+		{"setuid", fs.Setuid(), []string{"suid.txt"}},
+		{"not world writable", fs.Not(fs.WorldWritable()), []string{"private.txt", "suid.txt"}},
+	}
+
+	if me.Uid != "0" {
+		tests = append(tests, struct {
+			name   string
+			accept fs.AcceptFunc
+			expect []string
+		}{"not readable by me", fs.NotReadableBy(me.Username), []string{"private.txt"}})
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			found, err := fs.FindIf(root, "*.txt", 0, nil, tt.accept)
+			if err != nil {
+				t.Fatalf("unable to find files: %v", err)
+			}
+
+			checkPaths(t, tt.name, tt.expect, relPaths(t, root, found))
+		})
+	}
+}
+
+func TestReadableByLink(t *testing.T) {
+	if os.Geteuid() != 0 {
+		t.Skip("changing owners needs root")
+	}
+
+	nobody, err := user.Lookup("nobody")
+	if err != nil {
+		t.Skip("no nobody user")
+	}
+
+	root, clean := tempDir()
+	defer clean()
+
+	makeTree(t, root, map[string]string{"theirs.txt": "t", "mine.txt": "m"})
+	uid, _ := strconv.Atoi(nobody.Uid)
+	gid, _ := strconv.Atoi(nobody.Gid)
+	for _, name := range []string{"theirs.txt", "mine.txt"} {
+		path := filepath.Join(root, name)
+		if err := os.Chmod(path, 0400); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := os.Symlink(path, path+".link"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := os.Chown(filepath.Join(root, "theirs.txt"), uid, gid); err != nil {
+		t.Fatal(err)
+	}
+
+	// The links are owned by root, and readable by the target owners only
+	readable := fs.ReadableBy("nobody")
+	for name, expect := range map[string]bool{"theirs.txt.link": true, "mine.txt.link": false} {
+		ok, err := readable(filepath.Join(root, name))
+		if err != nil || ok != expect {
+			t.Errorf("%s: expected readable %v, got %v (%v)", name, expect, ok, err)
+		}
+	}
+}
+
+func TestFindWhere(t *testing.T) {
+	root, clean := tempDir()
+	defer clean()
+
+	makeTree(t, root, map[string]string{
+		"old.log":        strings.Repeat("x", 2048),
+		"new.log":        strings.Repeat("x", 2048),
+		"small.log":      "x",
+		"run.sh":         "#!/bin/sh",
+		"sub/old.log":    strings.Repeat("x", 4096),
+		".cache/old.log": strings.Repeat("x", 4096),
+		"vendor/old.log": strings.Repeat("x", 4096),
+	})
+
+	month := time.Now().Add(-31 * 24 * time.Hour)
+	for _, name := range []string{"old.log", "small.log", "sub/old.log", ".cache/old.log", "vendor/old.log"} {
+		if err := os.Chtimes(filepath.Join(root, name), month, month); err != nil {
+			t.Fatalf("unable to age %s: %v", name, err)
+		}
+	}
+	os.Chmod(filepath.Join(root, "run.sh"), 0755)
+
+	me, err := user.Current()
+	if err != nil {
+		t.Fatalf("unable to get current user: %v", err)
+	}
+
+	tests := []struct {
+		name  string
+		query *fs.Query
+		want  []string
+	}{
+		{"all", nil, []string{".cache/old.log", "new.log", "old.log", "run.sh", "small.log", "sub/old.log", "vendor/old.log"}},
+		{"old large logs", fs.Where().NameGlob("*.log").OlderThan(30*24*time.Hour).LargerThan(1<<10).Exclude("vendor", ".*"),
+			[]string{"old.log", "sub/old.log"}},
+		{"new", fs.Where().NewerThan(time.Hour).SmallerThan(4096), []string{"new.log", "run.sh"}},
+		{"executable", fs.Where().ModeAny(0111).OwnedBy(me.Uid), []string{"run.sh"}},
+		{"depth", fs.Where().NameGlob("old.*").MaxDepth(1), []string{"old.log"}},
+		{"accept", fs.Where().Accept(fs.Not(fs.ByUser(me.Uid))), nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			files, err := fs.Find(root, tt.query)
+			if err != nil {
+				t.Fatalf("unable to find files: %v", err)
+			}
+
+			var got []string
+			for _, path := range files.Paths() {
+				rel, _ := filepath.Rel(root, path)
+				got = append(got, rel)
+			}
+
+			if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("expected %q, got %q", tt.want, got)
+			}
+		})
+	}
+}
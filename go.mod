@@ -3,20 +3,22 @@ module github.com/brinick/fs
 go 1.18
 
 require (
+	github.com/BurntSushi/toml v1.2.1
 	github.com/brinick/logging v0.0.0-20200403102718-8616abdde0f8
-	github.com/brinick/shell v0.0.0-20210603084650-684185a43983
+	github.com/fsnotify/fsnotify v1.6.0
+	github.com/klauspost/compress v1.15.15
+	github.com/pkg/sftp v1.13.5
 	github.com/shirou/gopsutil/v3 v3.22.2
+	golang.org/x/crypto v0.1.0
+	golang.org/x/sys v0.1.0
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
-	github.com/go-cmd/cmd v1.2.0 // indirect
 	github.com/go-ole/go-ole v1.2.6 // indirect
 	github.com/konsorten/go-windows-terminal-sequences v1.0.1 // indirect
-	github.com/lufia/plan9stats v0.0.0-20211012122336-39d0f177ccd0 // indirect
+	github.com/kr/fs v0.1.0 // indirect
 	github.com/power-devops/perfstat v0.0.0-20210106213030-5aafc221ea8c // indirect
 	github.com/sirupsen/logrus v1.4.2 // indirect
-	github.com/tklauser/go-sysconf v0.3.9 // indirect
-	github.com/tklauser/numcpus v0.3.0 // indirect
 	github.com/yusufpapurcu/wmi v1.2.2 // indirect
-	golang.org/x/sys v0.0.0-20220111092808-5a964db01320 // indirect
 )
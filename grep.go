@@ -0,0 +1,210 @@
+package fs
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"regexp"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// GrepOptions configures the content search of Grep
+type GrepOptions struct {
+	// Include lists glob patterns matched against file base names.
+	// If not empty, only matching files are searched.
+	Include []string
+
+	// Exclude lists glob patterns matched against entry base names.
+	// Matching files, and directories' content, are not searched.
+	Exclude []string
+
+	// MaxDepth is the number of directory levels searched below
+	// the root, as for WalkMaxDepth, with no limit if <= 0
+	MaxDepth int
+
+	// IncludeHidden searches hidden files and directories too
+	IncludeHidden bool
+
+	// Concurrency is the number of files scanned at the same time,
+	// the number of CPUs if <= 0
+	Concurrency int
+}
+
+// Match is a line matching the pattern searched by Grep
+type Match struct {
+	Path string
+
+	// Line is the line number, from 1
+	Line int
+
+	// Text is the line, without its line ending
+	Text string
+}
+
+func (m Match) String() string {
+	return fmt.Sprintf("%s:%d:%s", m.Path, m.Line, m.Text)
+}
+
+// Grep returns the lines of the files below root matching the regular
+// expression pattern, ordered by path and line number. Binary files,
+// those with a NUL byte in their first 8000 bytes, are not searched.
+func Grep(root, pattern string, opts GrepOptions) ([]Match, error) {
+	return GrepContext(context.Background(), root, pattern, opts)
+}
+
+// GrepContext is like Grep, but stops the search and returns the
+// context error as soon as ctx is done
+func GrepContext(ctx context.Context, root, pattern string, opts GrepOptions) ([]Match, error) {
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("invalid pattern %q (%w)", pattern, err)
+	}
+
+	files, err := grepFiles(ctx, root, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	concurrency := opts.Concurrency
+	if concurrency <= 0 {
+		concurrency = runtime.NumCPU()
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		firstErr error
+		matches  []Match
+		queue    = make(chan *File)
+	)
+
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for f := range queue {
+				found, err := grepFile(ctx, f, re)
+
+				mu.Lock()
+				if err != nil && firstErr == nil {
+					firstErr = err
+					cancel()
+				}
+				matches = append(matches, found...)
+				mu.Unlock()
+			}
+		}()
+	}
+
+feed:
+	for _, f := range files {
+		select {
+		case queue <- f:
+		case <-ctx.Done():
+			break feed
+		}
+	}
+
+	close(queue)
+	wg.Wait()
+
+	if firstErr != nil {
+		return nil, firstErr
+	}
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	sort.Slice(matches, func(i, j int) bool {
+		if matches[i].Path != matches[j].Path {
+			return matches[i].Path < matches[j].Path
+		}
+		return matches[i].Line < matches[j].Line
+	})
+
+	return matches, nil
+}
+
+// grepFiles returns the files below root selected by the options
+func grepFiles(ctx context.Context, root string, opts GrepOptions) ([]*File, error) {
+	walkOpts := []WalkOption{WalkExclude(opts.Exclude...), WalkMaxDepth(opts.MaxDepth)}
+	if opts.IncludeHidden {
+		walkOpts = append(walkOpts, WalkIncludeHidden())
+	}
+
+	var files []*File
+	err := NewDirOn(nil, root).Walk(func(e Entry) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		if e.Type != FileEntry {
+			return nil
+		}
+
+		if len(opts.Include) > 0 {
+			ok, err := matchAny(e.Name, opts.Include)
+			if err != nil || !ok {
+				return err
+			}
+		}
+
+		files = append(files, e.File())
+		return nil
+	}, walkOpts...)
+
+	return files, err
+}
+
+// binaryHead is the number of bytes at the start of files in
+// which a NUL byte marks them as binary, as for git
+const binaryHead = 8000
+
+// grepFile returns the lines of the file matching re
+func grepFile(ctx context.Context, f *File, re *regexp.Regexp) ([]Match, error) {
+	openFiles.acquire(1)
+	defer openFiles.release(1)
+
+	fd, err := f.sys().Open(f.Path)
+	if err != nil {
+		return nil, err
+	}
+	defer fd.Close()
+
+	r := bufio.NewReaderSize(fd, binaryHead)
+	if head, _ := r.Peek(binaryHead); bytes.IndexByte(head, 0) >= 0 {
+		return nil, nil
+	}
+
+	var matches []Match
+	for n := 1; ; n++ {
+		if n%1000 == 0 && ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+
+		line, err := r.ReadString('\n')
+		if line != "" {
+			line = strings.TrimRight(line, "\r\n")
+			if re.MatchString(line) {
+				matches = append(matches, Match{Path: f.Path, Line: n, Text: line})
+			}
+		}
+
+		if err == io.EOF {
+			return matches, nil
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("unable to read %s (%w)", f.Path, err)
+		}
+	}
+}
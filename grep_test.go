@@ -0,0 +1,89 @@
+package fs_test
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/brinick/fs"
+)
+
+func TestGrep(t *testing.T) {
+	root, clean := tempDir()
+	defer clean()
+
+	files := map[string]string{
+		"a.log":          "ok\nERROR disk full\nok\r\n",
+		"b.txt":          "ERROR in txt\n",
+		"sub/c.log":      "fine\nfine\nERROR timeout",
+		"sub/deep/d.log": "ERROR deep\n",
+		"vendor/e.log":   "ERROR vendored\n",
+		".hidden/f.log":  "ERROR hidden\n",
+		"bin.log":        "ERROR\x00binary\n",
+		"late-bin.log":   "ERROR late\n" + strings.Repeat("x", 5000) + "\x00",
+	}
+
+	for name, content := range files {
+		path := filepath.Join(root, name)
+		os.MkdirAll(filepath.Dir(path), 0755)
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("unable to write %s: %v", name, err)
+		}
+	}
+
+	tests := []struct {
+		name string
+		opts fs.GrepOptions
+		want []string
+	}{
+		{"all", fs.GrepOptions{}, []string{
+			"a.log:2:ERROR disk full", "b.txt:1:ERROR in txt", "sub/c.log:3:ERROR timeout",
+			"sub/deep/d.log:1:ERROR deep", "vendor/e.log:1:ERROR vendored",
+		}},
+		{"include", fs.GrepOptions{Include: []string{"*.log"}, Exclude: []string{"vendor"}, Concurrency: 1}, []string{
+			"a.log:2:ERROR disk full", "sub/c.log:3:ERROR timeout", "sub/deep/d.log:1:ERROR deep",
+		}},
+		{"depth", fs.GrepOptions{MaxDepth: 2, Include: []string{"*.log"}, IncludeHidden: true}, []string{
+			".hidden/f.log:1:ERROR hidden", "a.log:2:ERROR disk full", "sub/c.log:3:ERROR timeout",
+			"vendor/e.log:1:ERROR vendored",
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			matches, err := fs.Grep(root, "^ERROR", tt.opts)
+			if err != nil {
+				t.Fatalf("unable to grep: %v", err)
+			}
+
+			var got []string
+			for _, m := range matches {
+				m.Path, _ = filepath.Rel(root, m.Path)
+				got = append(got, m.String())
+			}
+
+			if len(got) != len(tt.want) {
+				t.Fatalf("expected matches %q, got %q", tt.want, got)
+			}
+
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("expected match %q, got %q", tt.want[i], got[i])
+				}
+			}
+		})
+	}
+
+	if _, err := fs.Grep(root, "(", fs.GrepOptions{}); err == nil {
+		t.Errorf("expected error for invalid pattern")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := fs.GrepContext(ctx, root, "ERROR", fs.GrepOptions{}); err != context.Canceled {
+		t.Errorf("expected cancelled error, got %v", err)
+	}
+}
@@ -0,0 +1,352 @@
+package fs
+
+import (
+	"context"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+)
+
+// HashAlgo names a supported hash algorithm
+type HashAlgo string
+
+// The supported hash algorithms
+const (
+	MD5    HashAlgo = "md5"
+	SHA1   HashAlgo = "sha1"
+	SHA256 HashAlgo = "sha256"
+	SHA512 HashAlgo = "sha512"
+)
+
+// New returns a new hash.Hash for the algorithm
+func (a HashAlgo) New() (hash.Hash, error) {
+	switch a {
+	case MD5:
+		return md5.New(), nil
+	case SHA1:
+		return sha1.New(), nil
+	case SHA256, "":
+		return sha256.New(), nil
+	case SHA512:
+		return sha512.New(), nil
+	}
+
+	return nil, fmt.Errorf("unsupported hash algorithm %q", string(a))
+}
+
+// Hash returns the hex encoded digest of the file content
+// using the given algorithm. An empty algo means SHA256.
+func (f *File) Hash(algo HashAlgo) (string, error) {
+	return hashIn(f.sys(), f.Path, algo)
+}
+
+func hashFile(path string, algo HashAlgo) (string, error) {
+	return hashIn(OSFilesystem{}, path, algo)
+}
+
+// hashIn hashes the file at path on the given file system
+func hashIn(sys Filesystem, path string, algo HashAlgo) (string, error) {
+	openFiles.acquire(1)
+	defer openFiles.release(1)
+
+	return hashContent(sys, path, algo)
+}
+
+// hashContent is hashIn, for callers that already
+// hold the open files budget
+func hashContent(sys Filesystem, path string, algo HashAlgo) (string, error) {
+	h, err := algo.New()
+	if err != nil {
+		return "", err
+	}
+
+	fd, err := sys.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer fd.Close()
+
+	if _, err := copyBuffer(h, fd); err != nil {
+		return "", fmt.Errorf("unable to hash file %s (%w)", path, err)
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// Hashes returns the map of file path to hex encoded content digest,
+// for all files, computed with the given algorithm by a pool of
+// concurrency workers (the number of CPUs if concurrency <= 0).
+// Hashing stops at the first error, or once ctx is done.
+func (f *Files) Hashes(ctx context.Context, algo HashAlgo, concurrency int) (map[string]string, error) {
+	if _, err := algo.New(); err != nil {
+		return nil, err
+	}
+
+	if concurrency <= 0 {
+		concurrency = runtime.NumCPU()
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		firstErr error
+		hashes   = make(map[string]string, len(*f))
+		paths    = make(chan string)
+	)
+
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for path := range paths {
+				digest, err := hashFile(path, algo)
+
+				mu.Lock()
+				if err != nil && firstErr == nil {
+					firstErr = err
+					cancel()
+				}
+				hashes[path] = digest
+				mu.Unlock()
+			}
+		}()
+	}
+
+feed:
+	for _, file := range *f {
+		select {
+		case paths <- file.Path:
+		case <-ctx.Done():
+			break feed
+		}
+	}
+
+	close(paths)
+	wg.Wait()
+
+	if firstErr != nil {
+		return nil, firstErr
+	}
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	return hashes, nil
+}
+
+// ------------------------------------------------------------------
+
+// HashOptions configures the Directory tree hash
+type HashOptions struct {
+	// Algo is the hash algorithm to use, SHA256 if empty
+	Algo HashAlgo
+
+	// Exclude lists glob patterns matched against entry base names.
+	// Matching files, symlinks and directories are left out of the hash.
+	Exclude []string
+}
+
+// Hash computes a deterministic hash of the directory tree. Each directory
+// is hashed over the sorted list of its entries' names, modes and hashes,
+// where a file's hash is that of its content, a symlink's that of its
+// target and a sub directory's is computed recursively (a Merkle tree).
+// Two trees with the same content, names and modes thus have the same hash,
+// whatever their location or modification times.
+func (d *Directory) Hash(opts HashOptions) (string, error) {
+	digest, err := hashTree(d.sys(), d.Path, opts)
+	if err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(digest), nil
+}
+
+func hashTree(sys Filesystem, dir string, opts HashOptions) ([]byte, error) {
+	h, err := opts.Algo.New()
+	if err != nil {
+		return nil, err
+	}
+
+	entries, err := sys.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, entry := range entries {
+		excluded, err := matchAny(entry.Name(), opts.Exclude)
+		if err != nil {
+			return nil, err
+		}
+
+		if excluded {
+			continue
+		}
+
+		var (
+			path   = filepath.Join(dir, entry.Name())
+			digest []byte
+		)
+
+		switch mode := entry.Mode(); {
+		case mode.IsDir():
+			digest, err = hashTree(sys, path, opts)
+		case mode&os.ModeSymlink != 0:
+			digest, err = hashLink(sys, path, opts.Algo)
+		default:
+			var hexDigest string
+			if hexDigest, err = hashIn(sys, path, opts.Algo); err == nil {
+				digest, err = hex.DecodeString(hexDigest)
+			}
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		fmt.Fprintf(h, "%s %s %x\n", entry.Mode(), entry.Name(), digest)
+	}
+
+	return h.Sum(nil), nil
+}
+
+func hashLink(sys Filesystem, path string, algo HashAlgo) ([]byte, error) {
+	tgt, err := sys.Readlink(path)
+	if err != nil {
+		return nil, err
+	}
+
+	h, err := algo.New()
+	if err != nil {
+		return nil, err
+	}
+
+	io.WriteString(h, tgt)
+	return h.Sum(nil), nil
+}
+
+// matchAny reports if name matches any of the glob patterns
+func matchAny(name string, patterns []string) (bool, error) {
+	for _, patt := range patterns {
+		ok, err := filepath.Match(patt, name)
+		if err != nil {
+			return false, err
+		}
+
+		if ok {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// ------------------------------------------------------------------
+
+// WriteChecksumFile writes, to the file at path, the content digest of
+// each regular file below the directory, computed with algo (SHA256 if
+// empty), in the format of the sha256sum/md5sum family of tools: one
+// "<hex digest>  <path>" line per file, with paths relative to the
+// directory and in lexical order. The output can thus be checked with
+// e.g. `cd dir && sha256sum -c path`, or with VerifyChecksumFile.
+// If path is within the tree, it is itself left out.
+func (d *Directory) WriteChecksumFile(algo HashAlgo, path string) error {
+	if _, err := algo.New(); err != nil {
+		return err
+	}
+
+	self, _ := filepath.Abs(path)
+
+	var lines []string
+	err := d.Walk(func(e Entry) error {
+		if e.Type != FileEntry {
+			return nil
+		}
+
+		if abs, _ := filepath.Abs(e.Path); abs == self {
+			return nil
+		}
+
+		digest, err := hashIn(d.sys(), e.Path, algo)
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(d.Path, e.Path)
+		if err != nil {
+			return err
+		}
+
+		lines = append(lines, digest+"  "+filepath.ToSlash(rel))
+		return nil
+	}, WalkIncludeHidden())
+
+	if err != nil {
+		return err
+	}
+
+	return (&File{Path: path, fsys: d.fsys}).WriteLinesAtomic(lines)
+}
+
+// VerifyChecksumFile checks the digests listed in the checksum file at
+// path, in the format written by WriteChecksumFile and the sha256sum
+// family of tools, against the files they name relative to dir (the
+// checksum file's directory if empty), using algo (SHA256 if empty).
+// It returns the files that are missing or whose content differs.
+// An error is returned if the checksum file is malformed or a file
+// cannot be read.
+func VerifyChecksumFile(path, dir string, algo HashAlgo) ([]string, error) {
+	if dir == "" {
+		dir = filepath.Dir(path)
+	}
+
+	lines, err := NewFile(path).Lines()
+	if err != nil {
+		return nil, err
+	}
+
+	var failed []string
+	for i, line := range lines {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+
+		// The digest is followed by a space, then a space
+		// for text mode or a * for binary mode
+		toks := strings.SplitN(line, " ", 2)
+		if len(toks) != 2 || len(toks[1]) < 2 || (toks[1][0] != ' ' && toks[1][0] != '*') {
+			return nil, fmt.Errorf("%s:%d: malformed checksum line", path, i+1)
+		}
+
+		name := toks[1][1:]
+		target := filepath.Join(dir, filepath.FromSlash(name))
+		digest, err := hashFile(target, algo)
+		if os.IsNotExist(err) {
+			failed = append(failed, name)
+			continue
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		if !strings.EqualFold(digest, toks[0]) {
+			failed = append(failed, name)
+		}
+	}
+
+	return failed, nil
+}
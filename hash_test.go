@@ -0,0 +1,181 @@
+package fs_test
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/brinick/fs"
+)
+
+func TestFileHash(t *testing.T) {
+	f, clean := newFile()
+	defer clean()
+
+	if err := f.Write([]byte("hello")); err != nil {
+		t.Fatalf("unable to write file: %v", err)
+	}
+
+	tests := []struct {
+		algo   fs.HashAlgo
+		expect string
+	}{
+		{fs.MD5, "5d41402abc4b2a76b9719d911017c592"},
+		{fs.SHA1, "aaf4c61ddcc5e8a2dabede0f3b482cd9aea9434d"},
+		{fs.SHA256, "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824"},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.algo), func(t *testing.T) {
+			got, err := f.Hash(tt.algo)
+			if err != nil {
+				t.Fatalf("unable to hash file: %v", err)
+			}
+
+			if got != tt.expect {
+				t.Errorf("expected digest %s, got %s", tt.expect, got)
+			}
+		})
+	}
+
+	if _, err := f.Hash("crc"); err == nil {
+		t.Error("expected an error for an unsupported algorithm, got none")
+	}
+}
+
+func makeTree(t *testing.T, root string, files map[string]string) {
+	for name, content := range files {
+		path := filepath.Join(root, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("unable to create dir for %s: %v", path, err)
+		}
+
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("unable to write %s: %v", path, err)
+		}
+	}
+}
+
+func TestDirectoryHash(t *testing.T) {
+	root, clean := tempDir()
+	defer clean()
+
+	tree := map[string]string{
+		"a.txt":       "a",
+		"sub/b.txt":   "b",
+		"sub/c/d.txt": "d",
+	}
+
+	makeTree(t, filepath.Join(root, "one"), tree)
+	makeTree(t, filepath.Join(root, "two"), tree)
+
+	hash := func(name string, opts fs.HashOptions) string {
+		h, err := newDir(t, root, name).Hash(opts)
+		if err != nil {
+			t.Fatalf("unable to hash tree %s: %v", name, err)
+		}
+		return h
+	}
+
+	if hash("one", fs.HashOptions{}) != hash("two", fs.HashOptions{}) {
+		t.Error("identical trees have different hashes")
+	}
+
+	makeTree(t, filepath.Join(root, "two"), map[string]string{"sub/c/d.txt": "changed"})
+	if hash("one", fs.HashOptions{}) == hash("two", fs.HashOptions{}) {
+		t.Error("different trees have the same hash")
+	}
+
+	opts := fs.HashOptions{Algo: fs.MD5, Exclude: []string{"c"}}
+	if hash("one", opts) != hash("two", opts) {
+		t.Error("trees differing only in excluded dirs have different hashes")
+	}
+}
+
+func TestFilesHashes(t *testing.T) {
+	root, clean := tempDir()
+	defer clean()
+
+	makeTree(t, root, map[string]string{"a": "hello", "b": "hello", "c": "world"})
+
+	files, err := newDir(t, root).Files()
+	if err != nil {
+		t.Fatalf("unable to list files: %v", err)
+	}
+
+	hashes, err := files.Hashes(context.Background(), fs.SHA256, 2)
+	if err != nil {
+		t.Fatalf("unable to hash files: %v", err)
+	}
+
+	if len(hashes) != 3 {
+		t.Fatalf("expected 3 hashes, got %d", len(hashes))
+	}
+
+	a, b, c := hashes[filepath.Join(root, "a")], hashes[filepath.Join(root, "b")], hashes[filepath.Join(root, "c")]
+	if a != b || a == c {
+		t.Errorf("unexpected hashes: a=%s b=%s c=%s", a, b, c)
+	}
+
+	*files = append(*files, fs.NewFile(filepath.Join(root, "missing")))
+	if _, err := files.Hashes(context.Background(), fs.SHA256, 2); err == nil {
+		t.Error("expected an error hashing a missing file, got none")
+	}
+}
+
+func TestChecksumFile(t *testing.T) {
+	for _, algo := range []fs.HashAlgo{fs.MD5, fs.SHA256} {
+		t.Run(string(algo), func(t *testing.T) {
+			root, clean := tempDir()
+			defer clean()
+
+			makeTree(t, root, map[string]string{
+				"a.txt":         "a",
+				".hidden":       "h",
+				"sub/b.txt":     "b",
+				"sub/deep/c.so": "c",
+			})
+
+			sumFile := filepath.Join(root, "SUMS")
+			if err := newDir(t, root).WriteChecksumFile(algo, sumFile); err != nil {
+				t.Fatalf("unable to write checksum file: %v", err)
+			}
+
+			lines, err := fs.NewFile(sumFile).Lines()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if len(lines) != 4 {
+				t.Errorf("expected 4 checksums, got %v", lines)
+			}
+
+			// Check with the standard tool, if available
+			if tool, err := exec.LookPath(string(algo) + "sum"); err == nil {
+				cmd := exec.Command(tool, "-c", "--quiet", "SUMS")
+				cmd.Dir = root
+				if out, err := cmd.CombinedOutput(); err != nil {
+					t.Errorf("%s -c failed: %v\n%s", tool, err, out)
+				}
+			}
+
+			failed, err := fs.VerifyChecksumFile(sumFile, "", algo)
+			if err != nil {
+				t.Fatalf("unable to verify checksum file: %v", err)
+			}
+			checkPaths(t, "failed", nil, failed)
+
+			ioutil.WriteFile(filepath.Join(root, "a.txt"), []byte("changed"), 0644)
+			os.Remove(filepath.Join(root, "sub", "b.txt"))
+
+			failed, err = fs.VerifyChecksumFile(sumFile, root, algo)
+			if err != nil {
+				t.Fatalf("unable to verify checksum file: %v", err)
+			}
+			checkPaths(t, "failed", []string{"a.txt", "sub/b.txt"}, failed)
+		})
+	}
+}
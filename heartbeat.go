@@ -0,0 +1,167 @@
+package fs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// HeartbeatStatus is the content of a heartbeat file
+type HeartbeatStatus struct {
+	// Time is when the heartbeat was last written
+	Time time.Time `json:"time"`
+
+	// Started is when the heartbeat was started
+	Started time.Time `json:"started"`
+
+	Host string `json:"host"`
+	PID  int    `json:"pid"`
+
+	// Status is the status last set by the operation, if any
+	Status interface{} `json:"status,omitempty"`
+}
+
+// Heartbeat keeps a heartbeat file up to date while a long operation
+// runs, so that supervisors can tell, with IsStale, if it is still alive
+type Heartbeat struct {
+	file     *File
+	interval time.Duration
+	beat     HeartbeatStatus
+
+	mu   sync.Mutex
+	err  error
+	stop chan struct{}
+	done chan struct{}
+	once sync.Once
+}
+
+// StartHeartbeat writes the heartbeat file, creating its parent
+// directories if needed, then rewrites it every interval, with the
+// current time and status, until stopped or ctx is done. Each write
+// is atomic, so readers never see a partial status.
+func StartHeartbeat(ctx context.Context, f *File, interval time.Duration) (*Heartbeat, error) {
+	if interval <= 0 {
+		return nil, fmt.Errorf("invalid heartbeat interval %v", interval)
+	}
+
+	host, _ := os.Hostname()
+	hb := &Heartbeat{
+		file:     f,
+		interval: interval,
+		beat: HeartbeatStatus{
+			Started: time.Now(),
+			Host:    host,
+			PID:     os.Getpid(),
+		},
+		stop: make(chan struct{}),
+		done: make(chan struct{}),
+	}
+
+	if err := hb.Beat(); err != nil {
+		return nil, err
+	}
+
+	go hb.run(ctx)
+	return hb, nil
+}
+
+func (hb *Heartbeat) run(ctx context.Context) {
+	defer close(hb.done)
+
+	ticker := time.NewTicker(hb.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if err := hb.Beat(); err != nil {
+				hb.mu.Lock()
+				if hb.err == nil {
+					hb.err = err
+				}
+				hb.mu.Unlock()
+			}
+		case <-hb.stop:
+			return
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// SetStatus sets the status, which must be JSON encodable,
+// written with the next beats
+func (hb *Heartbeat) SetStatus(status interface{}) {
+	hb.mu.Lock()
+	defer hb.mu.Unlock()
+	hb.beat.Status = status
+}
+
+// Beat writes the heartbeat file now
+func (hb *Heartbeat) Beat() error {
+	hb.mu.Lock()
+	defer hb.mu.Unlock()
+
+	hb.beat.Time = time.Now()
+	data, err := json.Marshal(hb.beat)
+	if err != nil {
+		return fmt.Errorf("unable to encode heartbeat status (%w)", err)
+	}
+
+	return hb.file.WriteAtomic(data, EnsureDir(0))
+}
+
+// Stop stops the heartbeat and removes its file, as the operation is
+// over. It returns the first error writing the file in the background.
+func (hb *Heartbeat) Stop() error {
+	hb.once.Do(func() { close(hb.stop) })
+	<-hb.done
+
+	err := hb.file.sys().Remove(hb.file.Path)
+	if errors.Is(err, os.ErrNotExist) {
+		err = nil
+	}
+
+	hb.mu.Lock()
+	defer hb.mu.Unlock()
+	if hb.err != nil {
+		return hb.err
+	}
+
+	return err
+}
+
+// IsStale reports if the heartbeat file was last written more than
+// timeout ago, in which case the operation it belongs to is likely
+// dead. If the file does not exist, an InexistantError is returned.
+func IsStale(heartbeat *File, timeout time.Duration) (bool, error) {
+	info, err := heartbeat.sys().Stat(heartbeat.Path)
+	if errors.Is(err, os.ErrNotExist) {
+		return false, InexistantError{heartbeat.Path}
+	}
+
+	if err != nil {
+		return false, err
+	}
+
+	return time.Since(info.ModTime()) > timeout, nil
+}
+
+// ReadHeartbeat returns the status written in the heartbeat file
+func ReadHeartbeat(heartbeat *File) (*HeartbeatStatus, error) {
+	data, err := heartbeat.Bytes()
+	if err != nil {
+		return nil, err
+	}
+
+	var status HeartbeatStatus
+	if err := json.Unmarshal(data, &status); err != nil {
+		return nil, fmt.Errorf("unable to decode heartbeat %s (%w)", heartbeat.Path, err)
+	}
+
+	return &status, nil
+}
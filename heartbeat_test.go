@@ -0,0 +1,62 @@
+package fs_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/brinick/fs"
+)
+
+func TestHeartbeat(t *testing.T) {
+	root, clean := tempDir()
+	defer clean()
+
+	f := fs.NewFile(filepath.Join(root, "run", "sync.heartbeat"))
+	hb, err := fs.StartHeartbeat(context.Background(), f, 10*time.Millisecond)
+	if err != nil {
+		t.Fatalf("unable to start heartbeat: %v", err)
+	}
+
+	hb.SetStatus(map[string]int{"copied": 42})
+	time.Sleep(50 * time.Millisecond)
+
+	status, err := fs.ReadHeartbeat(f)
+	if err != nil {
+		t.Fatalf("unable to read heartbeat: %v", err)
+	}
+
+	if status.PID != os.Getpid() || !status.Time.After(status.Started) {
+		t.Errorf("unexpected heartbeat %+v", status)
+	}
+
+	if s, ok := status.Status.(map[string]interface{}); !ok || s["copied"] != float64(42) {
+		t.Errorf("expected status written, got %v", status.Status)
+	}
+
+	if stale, err := fs.IsStale(f, time.Second); err != nil || stale {
+		t.Errorf("expected live heartbeat, got stale %v (%v)", stale, err)
+	}
+
+	old := time.Now().Add(-time.Hour)
+	if err := hb.Stop(); err != nil {
+		t.Fatalf("unable to stop heartbeat: %v", err)
+	}
+
+	if _, err := fs.IsStale(f, time.Second); !errors.As(err, &fs.InexistantError{}) {
+		t.Errorf("expected heartbeat removed once stopped, got %v", err)
+	}
+
+	// A dead job leaves its heartbeat behind, no longer updated
+	if err := f.WriteAtomic([]byte("{}")); err != nil {
+		t.Fatal(err)
+	}
+	os.Chtimes(f.Path, old, old)
+
+	if stale, err := fs.IsStale(f, time.Minute); err != nil || !stale {
+		t.Errorf("expected stale heartbeat, got %v (%v)", stale, err)
+	}
+}
@@ -0,0 +1,130 @@
+package fs
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// ErrReadOnly is returned when modifying a File or Directory
+// whose file system, such as one from FromFS, is read only
+var ErrReadOnly = errors.New("read only file system")
+
+// FromFS returns the root directory of the given io/fs file system,
+// such as an embed.FS, fstest.MapFS or zip.Reader, so that the
+// package's read operations (listing, walking, reading and hashing
+// files) can be used on it. Paths within it are relative to its root,
+// which is ".". Operations that would modify it return ErrReadOnly.
+func FromFS(fsys fs.FS) *Directory {
+	return &Directory{Path: ".", fsys: ioFS{fsys}}
+}
+
+// ioFS is the read only Filesystem of an io/fs file system,
+// which has no notion of symlinks
+type ioFS struct {
+	fsys fs.FS
+}
+
+// fsName converts a path to the slash separated, unrooted form of io/fs
+func fsName(name string) string {
+	return filepath.ToSlash(filepath.Clean(name))
+}
+
+func readOnly(op, name string) error {
+	return &os.PathError{Op: op, Path: name, Err: ErrReadOnly}
+}
+
+func (i ioFS) Open(name string) (fs.File, error) {
+	return i.fsys.Open(fsName(name))
+}
+
+func (i ioFS) OpenFile(name string, flag int, perm os.FileMode) (FileHandle, error) {
+	if flag&(os.O_WRONLY|os.O_RDWR|os.O_CREATE|os.O_TRUNC|os.O_APPEND) != 0 {
+		return nil, readOnly("open", name)
+	}
+
+	fd, err := i.Open(name)
+	if err != nil {
+		return nil, err
+	}
+
+	return readOnlyHandle{fd}, nil
+}
+
+func (i ioFS) Stat(name string) (os.FileInfo, error) {
+	return fs.Stat(i.fsys, fsName(name))
+}
+
+func (i ioFS) Lstat(name string) (os.FileInfo, error) {
+	return i.Stat(name)
+}
+
+func (i ioFS) ReadDir(name string) ([]os.FileInfo, error) {
+	entries, err := fs.ReadDir(i.fsys, fsName(name))
+	if err != nil {
+		return nil, err
+	}
+
+	infos := make([]os.FileInfo, 0, len(entries))
+	for _, e := range entries {
+		info, err := e.Info()
+		if err != nil {
+			return nil, err
+		}
+		infos = append(infos, info)
+	}
+
+	return infos, nil
+}
+
+func (i ioFS) Readlink(name string) (string, error) {
+	return "", &os.PathError{Op: "readlink", Path: name, Err: errors.New("symlinks not supported")}
+}
+
+func (i ioFS) MkdirAll(name string, perm os.FileMode) error {
+	return readOnly("mkdir", name)
+}
+
+func (i ioFS) Rename(oldname, newname string) error {
+	return readOnly("rename", oldname)
+}
+
+func (i ioFS) Remove(name string) error {
+	return readOnly("remove", name)
+}
+
+func (i ioFS) RemoveAll(name string) error {
+	return readOnly("remove", name)
+}
+
+func (i ioFS) Chmod(name string, mode os.FileMode) error {
+	return readOnly("chmod", name)
+}
+
+func (i ioFS) Chtimes(name string, atime, mtime time.Time) error {
+	return readOnly("chtimes", name)
+}
+
+// readOnlyHandle is a FileHandle that cannot be written
+type readOnlyHandle struct {
+	fs.File
+}
+
+func (h readOnlyHandle) Write(p []byte) (int, error) {
+	return 0, ErrReadOnly
+}
+
+// ------------------------------------------------------------------
+
+// Open opens the named file below the directory, implementing io/fs.FS
+// so that the directory tree can be passed to standard library consumers
+// such as http.FS or fs.WalkDir. The name must be a valid io/fs path.
+func (d *Directory) Open(name string) (fs.File, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+
+	return d.sys().Open(filepath.Join(d.Path, filepath.FromSlash(name)))
+}
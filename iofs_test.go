@@ -0,0 +1,87 @@
+package fs_test
+
+import (
+	"errors"
+	iofs "io/fs"
+	"testing"
+	"testing/fstest"
+
+	"github.com/brinick/fs"
+)
+
+func TestFromFS(t *testing.T) {
+	root := fs.FromFS(fstest.MapFS{
+		"a.txt":         {Data: []byte("a\nb\n")},
+		"b.so":          {Data: []byte("b")},
+		"sub/c.so":      {Data: []byte("c")},
+		"sub/deep/d.so": {Data: []byte("d")},
+	})
+
+	files, err := root.Files("*.txt")
+	if err != nil {
+		t.Fatalf("Files: %v", err)
+	}
+	checkPaths(t, "files", []string{"a.txt"}, files.Paths())
+
+	lines, err := (*files)[0].Lines()
+	if err != nil {
+		t.Fatalf("Lines: %v", err)
+	}
+	checkPaths(t, "lines", []string{"a", "b"}, lines)
+
+	all, err := root.FilesRecursive(0, "*.so")
+	if err != nil {
+		t.Fatalf("FilesRecursive: %v", err)
+	}
+	checkPaths(t, "recursive", []string{"b.so", "sub/c.so", "sub/deep/d.so"}, all.Paths())
+
+	data, err := (*all)[1].Bytes()
+	if err != nil || string(data) != "c" {
+		t.Errorf("Bytes: expected c, got %q (%v)", data, err)
+	}
+
+	sub := root.Join("sub")
+	if sub == nil {
+		t.Fatalf("Join: sub dir not found")
+	}
+
+	if ok, err := sub.Exists(); !ok || err != nil {
+		t.Errorf("Exists: expected true, got %t (%v)", ok, err)
+	}
+
+	if _, err := sub.Hash(fs.HashOptions{}); err != nil {
+		t.Errorf("Hash: %v", err)
+	}
+
+	if err := (*all)[0].Write([]byte("x")); !errors.Is(err, fs.ErrReadOnly) {
+		t.Errorf("Write: expected ErrReadOnly, got %v", err)
+	}
+
+	if err := sub.Remove(); !errors.Is(err, fs.ErrReadOnly) {
+		t.Errorf("Remove: expected ErrReadOnly, got %v", err)
+	}
+}
+
+func TestDirectoryIsFS(t *testing.T) {
+	root, clean := tempDir()
+	defer clean()
+
+	makeTree(t, root, map[string]string{
+		"a.txt":     "a",
+		"sub/b.txt": "b",
+	})
+
+	var fsys iofs.FS = newDir(t, root)
+	if err := fstest.TestFS(fsys, "a.txt", "sub/b.txt"); err != nil {
+		t.Error(err)
+	}
+
+	data, err := iofs.ReadFile(fsys, "sub/b.txt")
+	if err != nil || string(data) != "b" {
+		t.Errorf("ReadFile: expected b, got %q (%v)", data, err)
+	}
+
+	if _, err := fsys.Open("../escape"); err == nil {
+		t.Errorf("expected an error opening an invalid path")
+	}
+}
@@ -0,0 +1,99 @@
+package fs
+
+import (
+	"context"
+	"io"
+	"time"
+)
+
+// IOStats are the I/O statistics of copies and syncs, e.g. to quantify
+// performance regressions of publish pipelines
+type IOStats struct {
+	// Files is the number of files whose content was copied
+	Files int64
+
+	// BytesRead and BytesWritten are the bytes read from the
+	// sources and written to the destinations
+	BytesRead    int64
+	BytesWritten int64
+
+	// Reads and Writes are the number of read and write calls,
+	// each usually a system call
+	Reads  int64
+	Writes int64
+
+	// Duration is the time spent copying file contents, summed
+	// over the files, even those copied concurrently
+	Duration time.Duration
+}
+
+// WithStats makes a copy or sync add its I/O statistics to stats,
+// which must not be read before it returns. Counting the reads and
+// writes disables the copy fast paths of some platforms.
+func WithStats(stats *IOStats) CopyOption {
+	return func(c *copyConfig) {
+		c.stats = stats
+	}
+}
+
+// reader wraps the source of a copy to count and hash its reads,
+// if configured, failing once ctx is done
+func (c *copyConfig) reader(ctx context.Context, r io.Reader) io.Reader {
+	r = &ctxReader{ctx: ctx, r: r}
+	if c.stats != nil {
+		r = &statsReader{r: r, c: c}
+	}
+
+	if c.sum != nil {
+		r = &sumReader{r: r, c: c}
+	}
+
+	return r
+}
+
+// fileCopied adds a copied file, copied in d, to the statistics
+func (c *copyConfig) fileCopied(d time.Duration) {
+	if c.stats == nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.stats.Files++
+	c.stats.Duration += d
+}
+
+// statsReader counts the reads through it
+type statsReader struct {
+	r io.Reader
+	c *copyConfig
+}
+
+func (sr *statsReader) Read(p []byte) (int, error) {
+	n, err := sr.r.Read(p)
+
+	sr.c.mu.Lock()
+	sr.c.stats.Reads++
+	sr.c.stats.BytesRead += int64(n)
+	sr.c.mu.Unlock()
+
+	return n, err
+}
+
+// statsWriter counts the writes through it
+type statsWriter struct {
+	w io.Writer
+	c *copyConfig
+}
+
+func (sw *statsWriter) Write(p []byte) (int, error) {
+	n, err := sw.w.Write(p)
+
+	sw.c.mu.Lock()
+	sw.c.stats.Writes++
+	sw.c.stats.BytesWritten += int64(n)
+	sw.c.mu.Unlock()
+
+	return n, err
+}
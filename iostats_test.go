@@ -0,0 +1,55 @@
+package fs_test
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/brinick/fs"
+)
+
+func TestCopyStats(t *testing.T) {
+	root := newTree(t, map[string]int{"a": 200000, "sub/b": 100000, "empty": 0})
+	src := filepath.Join(root, "src")
+
+	tests := []struct {
+		name  string
+		files int64
+		bytes int64
+		copy  func(fs.CopyOption) error
+	}{
+		{"file", 1, 200000, func(opt fs.CopyOption) error {
+			return fs.CopyFile(filepath.Join(src, "a"), root, opt)
+		}},
+		{"dir", 3, 300000, func(opt fs.CopyOption) error {
+			d, _ := fs.NewDir(src)
+			return d.CopyTo(filepath.Join(root, "dst"), opt, fs.WithConcurrency(2))
+		}},
+		{"sync", 3, 300000, func(opt fs.CopyOption) error {
+			_, err := fs.Sync(src, filepath.Join(root, "synced"), fs.SyncOptions{}, opt)
+			return err
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var stats fs.IOStats
+			if err := tt.copy(fs.WithStats(&stats)); err != nil {
+				t.Fatalf("unable to copy: %v", err)
+			}
+
+			if stats.Files != tt.files {
+				t.Errorf("expected %d files, got %d", tt.files, stats.Files)
+			}
+			if stats.BytesRead != tt.bytes || stats.BytesWritten != tt.bytes {
+				t.Errorf("expected %d bytes read and written, got %d and %d",
+					tt.bytes, stats.BytesRead, stats.BytesWritten)
+			}
+			if stats.Reads < tt.files || stats.Writes < 2 {
+				t.Errorf("expected reads and writes counted, got %d and %d", stats.Reads, stats.Writes)
+			}
+			if stats.Duration <= 0 {
+				t.Errorf("expected copy duration, got %v", stats.Duration)
+			}
+		})
+	}
+}
@@ -0,0 +1,104 @@
+package fs
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// JournalRecord is the record of a mutation in a journal
+type JournalRecord struct {
+	// Op is the mutation: create, write, mkdir, chmod, chtimes,
+	// rename, remove or copy
+	Op string `json:"op"`
+
+	// Paths are those mutated, the source first for
+	// renames and copies
+	Paths []string `json:"paths"`
+
+	Time time.Time `json:"time"`
+
+	// Err is the error of the mutation, empty if it succeeded
+	Err string `json:"error,omitempty"`
+}
+
+// Journal records the mutations done by the package, e.g. for a post
+// mortem trail of what a failed publish did
+type Journal struct {
+	mu     sync.Mutex
+	record func(JournalRecord) error
+}
+
+// NewJournal returns a journal writing its records
+// to w, as JSON, one per line
+func NewJournal(w io.Writer) *Journal {
+	enc := json.NewEncoder(w)
+	return &Journal{record: func(r JournalRecord) error {
+		return enc.Encode(r)
+	}}
+}
+
+// NewJournalFunc returns a journal passing its records to fn,
+// e.g. to log them, one at a time
+func NewJournalFunc(fn func(JournalRecord)) *Journal {
+	return &Journal{record: func(r JournalRecord) error {
+		fn(r)
+		return nil
+	}}
+}
+
+// journal is the journal set with SetJournal
+var journal struct {
+	mu sync.Mutex
+	j  *Journal
+}
+
+// SetJournal sets the journal to which the package records its
+// mutations, nil to record none, the default. Recorded are those of
+// the OS file system made through its Filesystem, including opening
+// files for writing, which is recorded as create when os.O_CREATE is
+// given, the file copies and the sync changes. Failing to write to
+// the journal does not fail the mutations.
+func SetJournal(j *Journal) {
+	journal.mu.Lock()
+	journal.j = j
+	journal.mu.Unlock()
+}
+
+// journaled records the mutation op of paths, with its result err,
+// to the journal, if any, and returns err
+func journaled(err error, op string, paths ...string) error {
+	journal.mu.Lock()
+	j := journal.j
+	journal.mu.Unlock()
+
+	if j == nil {
+		return err
+	}
+
+	r := JournalRecord{Op: op, Paths: paths, Time: time.Now()}
+	if err != nil {
+		r.Err = err.Error()
+	}
+
+	j.mu.Lock()
+	j.record(r)
+	j.mu.Unlock()
+
+	return err
+}
+
+// openOp returns the journal operation of opening a file with flag,
+// or "" if it is opened read only
+func openOp(flag int) string {
+	switch {
+	case flag&os.O_CREATE != 0:
+		return "create"
+	case flag&(os.O_WRONLY|os.O_RDWR|os.O_APPEND|os.O_TRUNC) != 0:
+		return "write"
+	default:
+		return ""
+	}
+}
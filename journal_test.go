@@ -0,0 +1,71 @@
+package fs_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/brinick/fs"
+)
+
+func TestJournal(t *testing.T) {
+	root := newTree(t, map[string]int{"a": 10})
+	src := filepath.Join(root, "src")
+
+	var buf bytes.Buffer
+	fs.SetJournal(fs.NewJournal(&buf))
+	defer fs.SetJournal(nil)
+
+	f := fs.NewFile(filepath.Join(src, "a"))
+	if err := f.CopyTo(root); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := f.RenameTo(filepath.Join(src, "b")); err != nil {
+		t.Fatal(err)
+	}
+
+	d, _ := fs.NewDir(root, "missing")
+	d.Remove()
+
+	if err := fs.NewFile(filepath.Join(root, "missing", "c")).RenameTo(filepath.Join(root, "d")); err == nil {
+		t.Fatal("expected an error renaming a missing file")
+	}
+
+	var got []string
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		var r fs.JournalRecord
+		if err := json.Unmarshal([]byte(line), &r); err != nil {
+			t.Fatalf("bad journal record %q: %v", line, err)
+		}
+
+		if r.Time.IsZero() {
+			t.Errorf("%s: expected a time", r.Op)
+		}
+
+		rec := r.Op
+		for _, path := range r.Paths {
+			rel, _ := filepath.Rel(root, path)
+			rec += " " + rel
+		}
+		if r.Err != "" {
+			rec += " failed"
+		}
+		got = append(got, rec)
+	}
+
+	want := []string{
+		"create a",
+		"chmod a",
+		"copy src/a a",
+		"rename src/a src/b",
+		"remove missing",
+		"rename missing/c d failed",
+	}
+
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("expected records\n%s\ngot\n%s", strings.Join(want, "\n"), strings.Join(got, "\n"))
+	}
+}
@@ -0,0 +1,218 @@
+package fs
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"path/filepath"
+)
+
+// lazyBuffer is the number of files a walk may produce
+// ahead of their consumption by a LazyFiles
+const lazyBuffer = 256
+
+// LazyFiles is a collection of files produced on demand, typically by
+// a background walk, so that very large trees can be streamed through
+// a pipeline with bounded memory. It is iterated with Next and File:
+//
+//	files := d.LazyFiles(ctx).Match("*.so")
+//	defer files.Close()
+//	for files.Next() {
+//		f := files.File()
+//		...
+//	}
+//	if err := files.Err(); err != nil {
+//		...
+//	}
+type LazyFiles struct {
+	next  func() (*File, error)
+	close func()
+	curr  *File
+	err   error
+}
+
+// NewLazyFiles returns a LazyFiles pulling its files from next, which
+// should return io.EOF once there are no more. The optional stop
+// function is called by Close to release the generator's resources.
+func NewLazyFiles(next func() (*File, error), stop func()) *LazyFiles {
+	if stop == nil {
+		stop = func() {}
+	}
+
+	return &LazyFiles{next: next, close: stop}
+}
+
+// LazyFiles returns the files, including symlinks, below the directory
+// as a LazyFiles fed by a background walk configured by the options.
+// The walk stops when the LazyFiles is closed or ctx is done.
+func (d *Directory) LazyFiles(ctx context.Context, opts ...WalkOption) *LazyFiles {
+	return d.lazyFiles(ctx, nil, opts)
+}
+
+// lazyFiles is LazyFiles, only producing the files of the entries
+// accepted by accept, if not nil. An error from accept stops the walk.
+func (d *Directory) lazyFiles(ctx context.Context, accept func(Entry) (bool, error), opts []WalkOption) *LazyFiles {
+	ctx, cancel := context.WithCancel(ctx)
+
+	type result struct {
+		file *File
+		err  error
+	}
+
+	results := make(chan result, lazyBuffer)
+	go func() {
+		defer close(results)
+		err := d.Walk(func(e Entry) error {
+			if e.IsDir() {
+				return nil
+			}
+
+			if accept != nil {
+				if ok, err := accept(e); err != nil || !ok {
+					return err
+				}
+			}
+
+			select {
+			case results <- result{file: e.File()}:
+				return nil
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}, opts...)
+
+		if err != nil {
+			select {
+			case results <- result{err: err}:
+			case <-ctx.Done():
+			}
+		}
+	}()
+
+	next := func() (*File, error) {
+		r, ok := <-results
+		if !ok {
+			return nil, io.EOF
+		}
+
+		return r.file, r.err
+	}
+
+	return NewLazyFiles(next, cancel)
+}
+
+// FindFilesLazy is like FindFiles, but returns the files as they are
+// found, as a LazyFiles, so that they can be processed while the search
+// goes on, and the search stopped early by closing it. Any error,
+// including that of an invalid glob, is reported by its Err method.
+func FindFilesLazy(ctx context.Context, startDir, fileNameGlob string, maxDepth int, ignore []string) *LazyFiles {
+	if _, err := filepath.Match(fileNameGlob, ""); err != nil {
+		err = fmt.Errorf("invalid file name glob %q (%w)", fileNameGlob, err)
+		return NewLazyFiles(func() (*File, error) { return nil, err }, nil)
+	}
+
+	// FindFiles' max depth counts the directories walked below the
+	// start dir, the walk's that of the entries, files included
+	if maxDepth > 0 {
+		maxDepth++
+	}
+
+	return NewDirOn(nil, startDir).lazyFiles(ctx, func(e Entry) (bool, error) {
+		if e.Type == DirEntry {
+			return false, nil
+		}
+		return filepath.Match(fileNameGlob, e.Name)
+	}, []WalkOption{WalkIncludeHidden(), WalkMaxDepth(maxDepth), walkExcludeDirs(ignore)})
+}
+
+// FindLazy is like Find, but returns the files as they are found,
+// as a LazyFiles. See FindFilesLazy.
+func FindLazy(ctx context.Context, root string, q *Query) *LazyFiles {
+	if q == nil {
+		q = Where()
+	}
+
+	return NewDirOn(nil, root).lazyFiles(ctx, q.match,
+		[]WalkOption{WalkIncludeHidden(), WalkMaxDepth(q.maxDepth), WalkExclude(q.exclude...)})
+}
+
+// Next advances to the next file, which is then available with File.
+// It returns false once there are no more files or an error occurred,
+// which is then available from Err.
+func (lf *LazyFiles) Next() bool {
+	if lf.err != nil {
+		return false
+	}
+
+	lf.curr, lf.err = lf.next()
+	return lf.err == nil
+}
+
+// File returns the current file
+func (lf *LazyFiles) File() *File {
+	return lf.curr
+}
+
+// Err returns the error that stopped the iteration, if any
+func (lf *LazyFiles) Err() error {
+	if lf.err == io.EOF {
+		return nil
+	}
+
+	return lf.err
+}
+
+// Close stops the underlying generator. It should always be called
+// once the LazyFiles is no longer needed.
+func (lf *LazyFiles) Close() {
+	lf.close()
+}
+
+// Filter returns a LazyFiles producing only those files for which
+// accept returns true. An error from accept stops the iteration.
+func (lf *LazyFiles) Filter(accept func(*File) (bool, error)) *LazyFiles {
+	next := func() (*File, error) {
+		for {
+			f, err := lf.next()
+			if err != nil {
+				return nil, err
+			}
+
+			ok, err := accept(f)
+			if err != nil {
+				return nil, err
+			}
+
+			if ok {
+				return f, nil
+			}
+		}
+	}
+
+	return NewLazyFiles(next, lf.close)
+}
+
+// Match returns a LazyFiles producing only those files whose
+// name matches against one or more of the given glob patterns
+func (lf *LazyFiles) Match(patterns ...string) *LazyFiles {
+	if len(patterns) == 0 {
+		return lf
+	}
+
+	return lf.Filter(func(f *File) (bool, error) {
+		return f.Match(patterns...)
+	})
+}
+
+// Collect drains the remaining files into a Files collection,
+// and closes the LazyFiles
+func (lf *LazyFiles) Collect() (*Files, error) {
+	defer lf.Close()
+
+	var files Files
+	for lf.Next() {
+		files = append(files, lf.File())
+	}
+
+	return &files, lf.Err()
+}
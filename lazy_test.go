@@ -0,0 +1,99 @@
+package fs_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/brinick/fs"
+)
+
+func TestLazyFiles(t *testing.T) {
+	root, clean := tempDir()
+	defer clean()
+
+	tree := map[string]string{}
+	for i := 0; i < 1000; i++ {
+		tree[fmt.Sprintf("d%d/f%03d.txt", i%10, i)] = "x"
+	}
+	tree["other.so"] = "so"
+	makeTree(t, root, tree)
+
+	files, err := newDir(t, root).LazyFiles(context.Background()).Match("*.txt").Collect()
+	if err != nil {
+		t.Fatalf("unable to collect lazy files: %v", err)
+	}
+
+	if len(*files) != 1000 {
+		t.Errorf("expected 1000 matching files, got %d", len(*files))
+	}
+
+	// Stopping early must not block the walker
+	lazy := newDir(t, root).LazyFiles(context.Background())
+	count := 0
+	for lazy.Next() && count < 5 {
+		count++
+	}
+	lazy.Close()
+
+	if err := lazy.Err(); err != nil {
+		t.Errorf("unexpected error stopping early: %v", err)
+	}
+
+	lazy = newDir(t, root, "missing").LazyFiles(context.Background())
+	defer lazy.Close()
+	if lazy.Next() || lazy.Err() == nil {
+		t.Error("expected an error lazily walking a missing dir")
+	}
+}
+
+func TestFindFilesLazy(t *testing.T) {
+	root, clean := tempDir()
+	defer clean()
+
+	makeTree(t, root, map[string]string{
+		"a.txt":             "a",
+		".hidden.txt":       "h",
+		"sub/b.txt":         "b",
+		"sub/c.log":         "c",
+		"sub/deep/d.txt":    "d",
+		"skip/e.txt":        "e",
+		"sub/skip.txt":      "s",
+		"sub/deep/er/f.txt": "f",
+	})
+
+	for _, depth := range []int{0, 1, 2, 3} {
+		t.Run(fmt.Sprintf("depth %d", depth), func(t *testing.T) {
+			want, err := fs.FindFiles(root, "*.txt", depth, []string{"skip"})
+			if err != nil {
+				t.Fatalf("unable to find files: %v", err)
+			}
+
+			files, err := fs.FindFilesLazy(context.Background(), root, "*.txt", depth, []string{"skip"}).Collect()
+			if err != nil {
+				t.Fatalf("unable to find files lazily: %v", err)
+			}
+
+			got := files.Paths()
+			sort.Strings(got)
+			sort.Strings(want)
+			if strings.Join(got, ",") != strings.Join(want, ",") {
+				t.Errorf("expected %q, got %q", want, got)
+			}
+		})
+	}
+
+	lazy := fs.FindFilesLazy(context.Background(), root, "[", 0, nil)
+	if lazy.Next() || !errors.Is(lazy.Err(), filepath.ErrBadPattern) {
+		t.Errorf("expected bad pattern error, got %v", lazy.Err())
+	}
+
+	files, err := fs.FindLazy(context.Background(), root, fs.Where().NameGlob("*.log")).Collect()
+	if err != nil || len(*files) != 1 {
+		t.Errorf("expected a single log file, got %v (%v)", files.Paths(), err)
+	}
+}
@@ -0,0 +1,157 @@
+package fs
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// SymlinkTo creates a symlink at linkPath to the file, by its absolute
+// path. Like other links, it is created on the OS file system.
+func (f *File) SymlinkTo(linkPath string) error {
+	return symlinkAbs(f.Path, linkPath)
+}
+
+// HardlinkTo creates a hard link to the file at path, which must be
+// on the same device
+func (f *File) HardlinkTo(path string) error {
+	return os.Link(f.Path, path)
+}
+
+// SymlinkTo creates a symlink at linkPath to the directory,
+// by its absolute path
+func (d *Directory) SymlinkTo(linkPath string) error {
+	return symlinkAbs(d.Path, linkPath)
+}
+
+// RelativeSymlink creates a symlink at link to target, with the target
+// given relative to the link directory, so that the link still
+// resolves if the tree containing both is moved
+func RelativeSymlink(target, link string) error {
+	absTarget, err := filepath.Abs(target)
+	if err != nil {
+		return err
+	}
+
+	absLink, err := filepath.Abs(link)
+	if err != nil {
+		return err
+	}
+
+	rel, err := filepath.Rel(filepath.Dir(absLink), absTarget)
+	if err != nil {
+		return fmt.Errorf("unable to make %s relative to %s (%w)", target, link, err)
+	}
+
+	return os.Symlink(rel, link)
+}
+
+// symlinkAbs creates a symlink at link to the absolute path of target
+func symlinkAbs(target, link string) error {
+	abs, err := filepath.Abs(target)
+	if err != nil {
+		return err
+	}
+
+	return os.Symlink(abs, link)
+}
+
+// ------------------------------------------------------------------
+
+// LinkRewrite tells how directory copies and syncs rewrite the
+// absolute symlinks pointing inside the source tree
+type LinkRewrite int
+
+// The symlink rewrites
+const (
+	// KeepLinks leaves symlink targets as they are. Directory copies
+	// then copy the content of the symlinked files.
+	KeepLinks LinkRewrite = iota
+
+	// RewriteLinksAbsolute points the links to the corresponding
+	// absolute destination path
+	RewriteLinksAbsolute
+
+	// RewriteLinksRelative points the links to the corresponding
+	// destination path, relative to the link
+	RewriteLinksRelative
+)
+
+// WithLinkRewrite makes directory copies and syncs rewrite the absolute
+// symlinks pointing inside the source tree, so that the copied tree has
+// no links back into the source. Other symlinks are kept as they are.
+// Directory copies then copy symlinks as symlinks, when copying to
+// the OS file system, rather than the content of their target.
+func WithLinkRewrite(rewrite LinkRewrite) CopyOption {
+	return func(c *copyConfig) {
+		c.linkRewrite = rewrite
+	}
+}
+
+// setRoots sets the source and destination trees of the copy,
+// against which links are rewritten
+func (c *copyConfig) setRoots(src, dst string) error {
+	if c.linkRewrite == KeepLinks {
+		return nil
+	}
+
+	var err error
+	if c.srcRoot, err = filepath.Abs(src); err != nil {
+		return err
+	}
+
+	c.dstRoot, err = filepath.Abs(dst)
+	return err
+}
+
+// linkTarget returns the target of the copy at dst of a symlink to
+// target, rewritten as configured
+func (c *copyConfig) linkTarget(target, dst string) (string, error) {
+	if c.linkRewrite == KeepLinks || !filepath.IsAbs(target) {
+		return target, nil
+	}
+
+	rel, ok := relBelow(c.srcRoot, target)
+	if !ok {
+		return target, nil
+	}
+
+	newTarget := filepath.Join(c.dstRoot, rel)
+	if c.linkRewrite == RewriteLinksAbsolute {
+		return newTarget, nil
+	}
+
+	absDst, err := filepath.Abs(dst)
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Rel(filepath.Dir(absDst), newTarget)
+}
+
+// copyLink creates a symlink at dst, on the OS file system, to the
+// possibly rewritten target of the src symlink, of info, on sys
+func copyLink(ctx context.Context, sys Filesystem, src string, info os.FileInfo, dst string, cfg *copyConfig) error {
+	target, err := sys.Readlink(src)
+	if err != nil {
+		return err
+	}
+
+	if target, err = cfg.linkTarget(target, dst); err != nil {
+		return err
+	}
+
+	if _, err := os.Lstat(dst); err == nil {
+		if dryRunAction(ctx, ActionOverwrite, dst) {
+			return nil
+		}
+		os.Remove(dst)
+	}
+
+	if err := os.Symlink(target, dst); err != nil {
+		return err
+	}
+
+	return cfg.chown(info, dst)
+}
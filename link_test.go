@@ -0,0 +1,136 @@
+package fs_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/brinick/fs"
+)
+
+func TestLinks(t *testing.T) {
+	root, clean := tempDir()
+	defer clean()
+
+	makeTree(t, root, map[string]string{"data/a.txt": "a", "links/.keep": ""})
+	a := fs.NewFile(filepath.Join(root, "data", "a.txt"))
+	data := newDir(t, root, "data")
+
+	tests := []struct {
+		name   string
+		link   func(path string) error
+		target string
+	}{
+		{"file symlink", a.SymlinkTo, a.Path},
+		{"dir symlink", data.SymlinkTo, data.Path},
+		{"relative symlink", func(path string) error { return fs.RelativeSymlink(a.Path, path) }, "../data/a.txt"},
+		{"hard link", a.HardlinkTo, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(root, "links", strings.ReplaceAll(tt.name, " ", "_"))
+			if err := tt.link(path); err != nil {
+				t.Fatalf("unable to link: %v", err)
+			}
+
+			if tt.target == "" {
+				src, _ := os.Stat(a.Path)
+				if info, err := os.Lstat(path); err != nil || !os.SameFile(src, info) {
+					t.Errorf("expected a hard link, got %v", err)
+				}
+				return
+			}
+
+			if target, err := os.Readlink(path); err != nil || target != tt.target {
+				t.Errorf("expected link to %s, got %s (%v)", tt.target, target, err)
+			}
+
+			if _, err := os.Stat(path); err != nil {
+				t.Errorf("expected link to resolve, got %v", err)
+			}
+		})
+	}
+
+	// Relative links survive moving the tree
+	moved := root + ".moved"
+	if err := os.Rename(root, moved); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Rename(moved, root)
+
+	if content, err := ioutil.ReadFile(filepath.Join(moved, "links", "relative_symlink")); err != nil || string(content) != "a" {
+		t.Errorf("expected relative link to resolve once moved, got %q (%v)", content, err)
+	}
+
+	if err := a.SymlinkTo(filepath.Join(moved, "links", "relative_symlink")); err == nil {
+		t.Errorf("expected an error for an existing link")
+	}
+}
+
+func TestCopyLinkRewrite(t *testing.T) {
+	root := newTree(t, map[string]int{"data/x": 10, "other": 5})
+	src := filepath.Join(root, "src")
+	outside := filepath.Join(root, "outside")
+
+	for link, target := range map[string]string{
+		"data/abs":     filepath.Join(src, "other"),
+		"data/rel":     "x",
+		"data/outside": outside,
+	} {
+		if err := os.Symlink(target, filepath.Join(src, link)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	copyTo := func(dst string, opts ...fs.CopyOption) error {
+		d, _ := fs.NewDir(src)
+		return d.CopyTo(dst, opts...)
+	}
+
+	syncTo := func(dst string, opts ...fs.CopyOption) error {
+		_, err := fs.Sync(src, dst, fs.SyncOptions{}, opts...)
+		return err
+	}
+
+	tests := []struct {
+		name    string
+		copy    func(dst string, opts ...fs.CopyOption) error
+		rewrite fs.LinkRewrite
+		abs     string
+	}{
+		{"copy absolute", copyTo, fs.RewriteLinksAbsolute, "copy absolute/other"},
+		{"copy relative", copyTo, fs.RewriteLinksRelative, "../other"},
+		{"sync absolute", syncTo, fs.RewriteLinksAbsolute, "sync absolute/other"},
+		{"sync relative", syncTo, fs.RewriteLinksRelative, "../other"},
+		{"sync kept", syncTo, fs.KeepLinks, "src/other"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dst := filepath.Join(root, tt.name)
+			if err := tt.copy(dst, fs.WithLinkRewrite(tt.rewrite)); err != nil {
+				t.Fatalf("unable to copy: %v", err)
+			}
+
+			abs := tt.abs
+			if !strings.HasPrefix(abs, "..") {
+				abs = filepath.Join(root, abs)
+			}
+
+			expect := map[string]string{"abs": abs, "rel": "x", "outside": outside}
+			for name, want := range expect {
+				got, err := os.Readlink(filepath.Join(dst, "data", name))
+				if err != nil || got != want {
+					t.Errorf("%s: expected link to %s, got %s (%v)", name, want, got, err)
+				}
+			}
+
+			if _, err := os.Stat(filepath.Join(dst, "data", "abs")); err != nil {
+				t.Errorf("expected the rewritten link to resolve, got %v", err)
+			}
+		})
+	}
+}
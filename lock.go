@@ -0,0 +1,102 @@
+package fs
+
+import (
+	"errors"
+	"fmt"
+	"os"
+)
+
+// ErrLockUnsupported is returned when file locking is
+// not supported on the current platform
+var ErrLockUnsupported = errors.New("file locking is not supported on this platform")
+
+// Lock acquires an exclusive advisory lock on the file, blocking until
+// it is available. The file is created if it does not exist. Advisory
+// locks only coordinate processes that themselves use locking, they
+// do not prevent others from reading or writing the file.
+// A File holds at most one lock, which is not safe for concurrent use.
+func (f *File) Lock() error {
+	_, err := f.lock(false, true)
+	return err
+}
+
+// RLock acquires a shared advisory lock on the file, blocking until
+// it is available. Any number of processes may hold a shared lock,
+// while none holds the exclusive lock.
+func (f *File) RLock() error {
+	_, err := f.lock(true, true)
+	return err
+}
+
+// TryLock tries to acquire an exclusive advisory lock on the file,
+// without blocking. It returns false if the lock is held elsewhere.
+func (f *File) TryLock() (bool, error) {
+	return f.lock(false, false)
+}
+
+// Unlock releases the lock held on the file, if any
+func (f *File) Unlock() error {
+	if f.lockFd == nil {
+		return nil
+	}
+
+	fd := f.lockFd
+	f.lockFd = nil
+
+	err := unlockFile(fd)
+	if cerr := fd.Close(); err == nil {
+		err = cerr
+	}
+
+	return err
+}
+
+func (f *File) lock(shared, block bool) (bool, error) {
+	if f.lockFd != nil {
+		return false, fmt.Errorf("%s: lock already held", f.Path)
+	}
+
+	fd, err := os.OpenFile(f.Path, os.O_RDWR|os.O_CREATE, 0644)
+	if os.IsPermission(err) {
+		fd, err = os.Open(f.Path)
+	}
+
+	if err != nil {
+		return false, fmt.Errorf("unable to open file to lock: %v", err)
+	}
+
+	ok, err := lockFile(fd, shared, block)
+	if err != nil || !ok {
+		fd.Close()
+		return false, err
+	}
+
+	f.lockFd = fd
+	return true, nil
+}
+
+// ------------------------------------------------------------------
+
+// LockedFile is an open file on which an advisory lock is held
+// until it is closed
+type LockedFile struct {
+	*os.File
+	file *File
+}
+
+// OpenLocked opens the file, creating it if inexistant, for reading and
+// writing once an exclusive lock on it is acquired. Closing the
+// returned LockedFile releases the lock.
+func (f *File) OpenLocked() (*LockedFile, error) {
+	lf := &File{Path: f.Path}
+	if err := lf.Lock(); err != nil {
+		return nil, err
+	}
+
+	return &LockedFile{File: lf.lockFd, file: lf}, nil
+}
+
+// Close releases the lock and closes the file
+func (lf *LockedFile) Close() error {
+	return lf.file.Unlock()
+}
@@ -0,0 +1,13 @@
+//go:build !(linux || darwin || freebsd || openbsd || netbsd || dragonfly || windows)
+
+package fs
+
+import "os"
+
+func lockFile(fd *os.File, shared, block bool) (bool, error) {
+	return false, ErrLockUnsupported
+}
+
+func unlockFile(fd *os.File) error {
+	return ErrLockUnsupported
+}
@@ -0,0 +1,59 @@
+package fs_test
+
+import (
+	"testing"
+
+	"github.com/brinick/fs"
+)
+
+func TestFileLock(t *testing.T) {
+	f, clean := newFile()
+	defer clean()
+
+	if err := f.Lock(); err != nil {
+		t.Fatalf("unable to lock file: %v", err)
+	}
+
+	other := fs.NewFile(f.Path)
+	ok, err := other.TryLock()
+	if err != nil {
+		t.Fatalf("unable to try to lock file: %v", err)
+	}
+
+	if ok {
+		t.Fatal("acquired a lock already held elsewhere")
+	}
+
+	if err := f.Unlock(); err != nil {
+		t.Fatalf("unable to unlock file: %v", err)
+	}
+
+	lf, err := other.OpenLocked()
+	if err != nil {
+		t.Fatalf("unable to open locked file: %v", err)
+	}
+
+	if _, err := lf.WriteString("locked\n"); err != nil {
+		t.Errorf("unable to write to locked file: %v", err)
+	}
+
+	if ok, _ := f.TryLock(); ok {
+		t.Error("acquired a lock held by a LockedFile")
+	}
+
+	if err := lf.Close(); err != nil {
+		t.Fatalf("unable to close locked file: %v", err)
+	}
+
+	if err := f.RLock(); err != nil {
+		t.Fatalf("unable to share lock file: %v", err)
+	}
+	defer f.Unlock()
+
+	if err := other.RLock(); err != nil {
+		t.Fatalf("unable to share lock file twice: %v", err)
+	}
+	defer other.Unlock()
+
+	checkFileHasLines(t, f, []string{"locked"})
+}
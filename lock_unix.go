@@ -0,0 +1,37 @@
+//go:build linux || darwin || freebsd || openbsd || netbsd || dragonfly
+
+package fs
+
+import (
+	"os"
+	"syscall"
+)
+
+func lockFile(fd *os.File, shared, block bool) (bool, error) {
+	how := syscall.LOCK_EX
+	if shared {
+		how = syscall.LOCK_SH
+	}
+
+	if !block {
+		how |= syscall.LOCK_NB
+	}
+
+	for {
+		err := syscall.Flock(int(fd.Fd()), how)
+		switch err {
+		case nil:
+			return true, nil
+		case syscall.EINTR:
+			continue
+		case syscall.EWOULDBLOCK:
+			return false, nil
+		}
+
+		return false, &os.PathError{Op: "flock", Path: fd.Name(), Err: err}
+	}
+}
+
+func unlockFile(fd *os.File) error {
+	return syscall.Flock(int(fd.Fd()), syscall.LOCK_UN)
+}
@@ -0,0 +1,39 @@
+//go:build windows
+
+package fs
+
+import (
+	"os"
+
+	"golang.org/x/sys/windows"
+)
+
+// lock the whole file, whatever its size
+const allBytes = ^uint32(0)
+
+func lockFile(fd *os.File, shared, block bool) (bool, error) {
+	var flags uint32
+	if !shared {
+		flags |= windows.LOCKFILE_EXCLUSIVE_LOCK
+	}
+
+	if !block {
+		flags |= windows.LOCKFILE_FAIL_IMMEDIATELY
+	}
+
+	ol := new(windows.Overlapped)
+	err := windows.LockFileEx(windows.Handle(fd.Fd()), flags, 0, allBytes, allBytes, ol)
+	switch err {
+	case nil:
+		return true, nil
+	case windows.ERROR_LOCK_VIOLATION:
+		return false, nil
+	}
+
+	return false, &os.PathError{Op: "LockFileEx", Path: fd.Name(), Err: err}
+}
+
+func unlockFile(fd *os.File) error {
+	ol := new(windows.Overlapped)
+	return windows.UnlockFileEx(windows.Handle(fd.Fd()), 0, allBytes, allBytes, ol)
+}
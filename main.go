@@ -2,12 +2,17 @@
 package fs
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"io"
-	"io/ioutil"
 	"os"
 	"path/filepath"
+	"regexp"
 	"strings"
+	"time"
+
+	"github.com/shirou/gopsutil/v3/disk"
 )
 
 // InexistantError is the error returned when a path does not exist
@@ -37,6 +42,21 @@ func Exists(path string) (bool, error) {
 	return false, err
 }
 
+// ExistsNoFollow is like Exists, but does not follow a final symlink,
+// such that a broken symlink is reported as existing
+func ExistsNoFollow(path string) (bool, error) {
+	_, err := os.Lstat(path)
+	if err == nil {
+		return true, nil
+	}
+
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+
+	return false, err
+}
+
 // IsSymLink checks if the given path is a symlink
 func IsSymLink(path string) (bool, error) {
 	fi, err := os.Lstat(path)
@@ -76,37 +96,67 @@ func IsFile(path string) (bool, error) {
 	return true, nil
 }
 
+// FSType returns the type of the file system (e.g. ext4, nfs4, fuse)
+// on which the given path resides, as given by the mount point
+// that is the longest prefix of the path.
+func FSType(path string) (string, error) {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+
+	partitions, err := disk.Partitions(true)
+	if err != nil {
+		return "", fmt.Errorf("unable to list mounted partitions (%w)", err)
+	}
+
+	var (
+		fstype  string
+		longest = -1
+	)
+
+	for _, p := range partitions {
+		mnt := p.Mountpoint
+		within := path == mnt || mnt == "/" || strings.HasPrefix(path, mnt+"/")
+		if within && len(mnt) > longest {
+			longest = len(mnt)
+			fstype = p.Fstype
+		}
+	}
+
+	if longest < 0 {
+		return "", fmt.Errorf("unable to find mount point for %s", path)
+	}
+
+	return fstype, nil
+}
+
 // ------------------------------------------------------------------
 
 // Depth returns the integer number of directories that
-// path is below root. If root is not a prefix of path, it
-// returns -1. If root equals path, returns 0.
+// path is below root. If path is not within root, as checked
+// by IsWithin, it returns -1. If root equals path, returns 0.
 // If path is a file, the depth is calculated with
 // respect to the parent directory of the file.
+// PathDepth is the lexical variant, for paths that may not exist.
 func Depth(root, path string) (int, error) {
-	removeTrailingSlash := func(s string) string {
-		if strings.HasSuffix(s, "/") {
-			s = s[:len(s)-1]
-		}
-
-		s, _ = filepath.Abs(s)
-		return s
+	given, _ := filepath.Abs(path)
+	root, path, ok, err := within(root, path)
+	if err != nil {
+		return 0, err
 	}
 
-	root = removeTrailingSlash(root)
-	path = removeTrailingSlash(path)
-
 	if root == path {
 		return 0, nil
 	}
 
-	if !strings.HasPrefix(path, root) {
+	if !ok {
 		return -1, nil
 	}
 
 	info, err := os.Stat(path)
 	if os.IsNotExist(err) {
-		return 0, InexistantError{path}
+		return 0, InexistantError{given}
 	}
 
 	if err != nil {
@@ -128,6 +178,12 @@ func Depth(root, path string) (int, error) {
 // matching entries in the excludeDirs list are not traversed.
 // The grand total in bytes is returned.
 func TreeSize(root string, excludeDirs []string) (int64, error) {
+	return TreeSizeContext(context.Background(), root, excludeDirs)
+}
+
+// TreeSizeContext is like TreeSize, but stops the walk and
+// returns the context error as soon as ctx is done.
+func TreeSizeContext(ctx context.Context, root string, excludeDirs []string) (int64, error) {
 	totSize := int64(0)
 	err := filepath.Walk(
 		root,
@@ -136,6 +192,10 @@ func TreeSize(root string, excludeDirs []string) (int64, error) {
 				return err
 			}
 
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+
 			if pathInfo.IsDir() {
 				for _, e := range excludeDirs {
 					if pathInfo.Name() == e {
@@ -158,6 +218,20 @@ func TreeSize(root string, excludeDirs []string) (int64, error) {
 // the walk will truncate this many levels below root dir.
 // Directories in the excludeDirs slice will be ignored.
 func WalkTree(root string, excludeDirs []string, maxdepth int) ([]string, []string, error) {
+	return WalkTreeContext(context.Background(), root, excludeDirs, maxdepth)
+}
+
+// WalkTreeContext is like WalkTree, but stops the walk and
+// returns the context error as soon as ctx is done.
+func WalkTreeContext(ctx context.Context, root string, excludeDirs []string, maxdepth int) ([]string, []string, error) {
+	return walkTree(ctx, root, excludeDirs, maxdepth, false)
+}
+
+// walkTree implements WalkTreeContext. If bestEffort is set, entries
+// that cannot be read are skipped rather than stopping the walk, and
+// their errors are returned together as a MultiError.
+func walkTree(ctx context.Context, root string, excludeDirs []string, maxdepth int, bestEffort bool) ([]string, []string, error) {
+	var errs MultiError
 	dirs := []string{}
 	files := []string{}
 
@@ -170,6 +244,14 @@ func WalkTree(root string, excludeDirs []string, maxdepth int) ([]string, []stri
 		root,
 		func(path string, pathInfo os.FileInfo, err error) error {
 			if err != nil {
+				if bestEffort && path != root {
+					errs = append(errs, asPathError("walk", path, err))
+					return nil
+				}
+				return err
+			}
+
+			if err := ctx.Err(); err != nil {
 				return err
 			}
 
@@ -193,32 +275,86 @@ func WalkTree(root string, excludeDirs []string, maxdepth int) ([]string, []stri
 		},
 	)
 
+	if err == nil {
+		err = errs.errOrNil()
+	}
+
 	return dirs, files, err
 }
 
+// asPathError returns err as an *os.PathError on the given path
+func asPathError(op, path string, err error) error {
+	var pe *os.PathError
+	if errors.As(err, &pe) {
+		return pe
+	}
+
+	return &os.PathError{Op: op, Path: path, Err: err}
+}
+
 // CopyFile copies the src file to the dst directory, giving the
 // destination file the same file mode permissions as the source.
-// If the src file or dst directory do not exist, an InexistantError is returned.
+// If the src file or dst directory do not exist, an InexistantError is returned,
+// unless the WithCreateDest option is given to create the directory.
 // If the src file already exists in the dst directory, it will be overwritten,
 // unless the dst directory is the directory in which the src file already
 // exists. In this case, nothing happens.
-func CopyFile(src, dst string) error {
+func CopyFile(src, dst string, opts ...CopyOption) error {
+	return CopyFileContext(context.Background(), src, dst, opts...)
+}
+
+// CopyFileContext is like CopyFile, but abandons the copy and
+// returns the context error as soon as ctx is done.
+func CopyFileContext(ctx context.Context, src, dst string, opts ...CopyOption) error {
+	return copyFile(ctx, OSFilesystem{}, src, dst, newCopyConfig(opts))
+}
+
+// copyFile implements CopyFileContext on the given file system
+func copyFile(ctx context.Context, sys Filesystem, src, dst string, cfg *copyConfig) error {
 	// Not copying file to itself or to an empty dest dir
 	if filepath.Dir(src) == dst || dst == "" {
 		return nil
 	}
 
-	for _, path := range []string{src, dst} {
-		ok, err := Exists(path)
+	paths := []string{src, dst}
+	if cfg.createDest {
+		// The dst dir is created by the copy
+		paths = paths[:1]
+	}
+
+	for _, path := range paths {
+		_, err := sys.Stat(path)
+		if errors.Is(err, os.ErrNotExist) {
+			return InexistantError{path}
+		}
+
 		if err != nil {
 			return err
 		}
-		if !ok {
-			return InexistantError{path}
-		}
 	}
 
-	source, err := os.Open(src)
+	return copyPath(ctx, sys, src, filepath.Join(dst, filepath.Base(src)), cfg)
+}
+
+// copyPath copies the src file to the dst file path, on the given file
+// system, giving the destination file the mode permissions of the source
+func copyPath(ctx context.Context, sys Filesystem, src, dst string, cfg *copyConfig) error {
+	return copyBetween(ctx, sys, src, sys, dst, cfg)
+}
+
+// copyBetween is copyPath from a file on srcSys to a path on dstSys
+func copyBetween(ctx context.Context, srcSys Filesystem, src string, dstSys Filesystem, dst string, cfg *copyConfig) (err error) {
+	// The source and destination, and one more to hash
+	// the destination when checking if it is identical
+	fds := 2
+	if cfg.skipIdentical {
+		fds = 3
+	}
+
+	openFiles.acquire(fds)
+	defer openFiles.release(fds)
+
+	source, err := srcSys.Open(src)
 	if err != nil {
 		return fmt.Errorf("unable to open input file %s for reading (%w)", src, err)
 	}
@@ -231,20 +367,156 @@ func CopyFile(src, dst string) error {
 	}
 
 	srcMode := sourceFI.Mode()
+	if cfg.total == 0 && cfg.progress != nil {
+		cfg.total = sourceFI.Size()
+	}
+
+	if cfg.skipIdentical {
+		same, err := identicalCopy(srcSys, src, sourceFI, dstSys, dst)
+		if err != nil {
+			return err
+		}
+
+		if same {
+			return nil
+		}
+	}
+
+	if dryRunPlan(ctx) != nil {
+		if _, err := dstSys.Lstat(dst); err == nil && dryRunAction(ctx, ActionOverwrite, dst) {
+			return nil
+		}
+	}
+
+	cfg.setCopied()
+	defer func() { journaled(err, "copy", src, dst) }()
+
+	if cfg.createDest {
+		if err := mkdirAll(dstSys, filepath.Dir(dst), dirPerm(0)); err != nil {
+			return fmt.Errorf("unable to create destination dir of %s (%w)", dst, err)
+		}
+	}
+
+	if cfg.hardlink {
+		if linked, err := hardlink(srcSys, src, sourceFI, dstSys, dst); linked || err != nil {
+			if err == nil {
+				cfg.report(sourceFI.Size())
+			}
+			return err
+		}
+	}
 
-	fname := filepath.Join(dst, filepath.Base(src))
-	dest, err := os.Create(fname)
+	dest, err := dstSys.OpenFile(dst, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0666)
 	if err != nil {
 		return err
 	}
 
-	defer dest.Close()
-	_, err = io.Copy(dest, source)
+	start := time.Now()
+	cloned := false
+	if cfg.reflink {
+		cloned, err = cloneFile(ctx, dest, source, sourceFI.Size(), cfg)
+	}
+
+	if !cloned {
+		_, err = copyBuffer(cfg.writer(ctx, dest), cfg.reader(ctx, source))
+	}
+
+	if err == nil && cfg.fsync {
+		err = syncHandle(dest)
+	}
+
+	if cerr := dest.Close(); err == nil {
+		// Some file systems only store the content once closed
+		err = cerr
+	}
+
 	if err != nil {
 		return err
 	}
 
-	return os.Chmod(fname, srcMode)
+	cfg.fileCopied(time.Since(start))
+	if err := dstSys.Chmod(dst, srcMode); err != nil {
+		return err
+	}
+
+	return preserveAttrs(srcSys, src, sourceFI, dstSys, dst, cfg)
+}
+
+// identicalCopy checks if dst is a regular file of the same size and
+// content as the src file, of the given info
+func identicalCopy(srcSys Filesystem, src string, info os.FileInfo, dstSys Filesystem, dst string) (bool, error) {
+	dinfo, err := dstSys.Lstat(dst)
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	}
+
+	if err != nil {
+		return false, err
+	}
+
+	if !dinfo.Mode().IsRegular() || dinfo.Size() != info.Size() {
+		return false, nil
+	}
+
+	srcHash, err := hashContent(srcSys, src, SHA256)
+	if err != nil {
+		return false, err
+	}
+
+	dstHash, err := hashContent(dstSys, dst, SHA256)
+	return srcHash == dstHash, err
+}
+
+// hardlink links dst to src, both on the OS file system, replacing
+// dst. It returns false if they cannot be linked, and must be copied.
+func hardlink(srcSys Filesystem, src string, info os.FileInfo, dstSys Filesystem, dst string) (bool, error) {
+	_, srcOS := srcSys.(OSFilesystem)
+	_, dstOS := dstSys.(OSFilesystem)
+	if !srcOS || !dstOS {
+		return false, nil
+	}
+
+	// Link the file rather than any symlink to it
+	src, err := filepath.EvalSymlinks(src)
+	if err != nil {
+		return false, err
+	}
+
+	dinfo, err := os.Lstat(dst)
+	if err == nil && os.SameFile(info, dinfo) {
+		// Already linked, or copying the file onto itself
+		return true, nil
+	}
+
+	// Link to a temp name and rename over dst, so that dst is only
+	// replaced if the link can be made
+	tmp := filepath.Join(filepath.Dir(dst), "."+filepath.Base(dst)+".link")
+	os.Remove(tmp)
+	if err := os.Link(src, tmp); err != nil {
+		return false, nil
+	}
+
+	if err := os.Rename(tmp, dst); err != nil {
+		os.Remove(tmp)
+		return false, err
+	}
+
+	return true, nil
+}
+
+// ctxReader is a reader that fails with the context
+// error once the context is done
+type ctxReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (cr *ctxReader) Read(p []byte) (int, error) {
+	if err := cr.ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	return cr.r.Read(p)
 }
 
 // ------------------------------------------------------------------
@@ -254,6 +526,7 @@ func CopyFile(src, dst string) error {
 type entries struct {
 	dir    string
 	values []os.FileInfo
+	fsys   Filesystem
 }
 
 func (e *entries) dirs() (*Directories, error) {
@@ -261,7 +534,7 @@ func (e *entries) dirs() (*Directories, error) {
 	for _, entry := range e.values {
 		if entry.IsDir() {
 			fullpath := filepath.Join(e.dir, entry.Name())
-			dirs = append(dirs, &Directory{Path: fullpath})
+			dirs = append(dirs, &Directory{Path: fullpath, fsys: e.fsys})
 		}
 	}
 
@@ -275,19 +548,13 @@ func (e *entries) files(includeSymLinks bool) (*Files, error) {
 			continue
 		}
 
+		// Entries are listed with Lstat, so carry the symlink mode bit
 		fullpath := filepath.Join(e.dir, entry.Name())
-		if !includeSymLinks {
-			isSym, err := IsSymLink(fullpath)
-			if err != nil {
-				return nil, fmt.Errorf("unable to check if file is symlink %s (%w)", fullpath, err)
-			}
-
-			if isSym {
-				continue
-			}
+		if !includeSymLinks && entry.Mode()&os.ModeSymlink != 0 {
+			continue
 		}
 
-		files = append(files, NewFile(fullpath))
+		files = append(files, &File{Path: fullpath, fsys: e.fsys})
 	}
 
 	return &files, nil
@@ -300,14 +567,9 @@ func (e *entries) symlinks() (*Files, error) {
 			continue
 		}
 
-		fullpath := filepath.Join(e.dir, entry.Name())
-		isSym, err := IsSymLink(fullpath)
-		if err != nil {
-			return nil, fmt.Errorf("unable to check if file is symlink %s (%w)", fullpath, err)
-		}
-
-		if isSym {
-			files = append(files, NewFile(fullpath))
+		if entry.Mode()&os.ModeSymlink != 0 {
+			fullpath := filepath.Join(e.dir, entry.Name())
+			files = append(files, &File{Path: fullpath, fsys: e.fsys})
 		}
 	}
 
@@ -371,13 +633,88 @@ func filesMatcher(files *Files, shouldFind bool, patterns ...string) (*Files, er
 	return &matches, nil
 }
 
-func dirLister(dir string) (*entries, error) {
-	entriesList, err := ioutil.ReadDir(dir)
+// compileRegexps compiles the regular expressions
+func compileRegexps(patterns []string) ([]*regexp.Regexp, error) {
+	res := make([]*regexp.Regexp, len(patterns))
+	for i, patt := range patterns {
+		re, err := regexp.Compile(patt)
+		if err != nil {
+			return nil, fmt.Errorf("invalid regular expression %q (%w)", patt, err)
+		}
+		res[i] = re
+	}
+
+	return res, nil
+}
+
+// matchRegexps checks if any of the regular expressions matches name
+func matchRegexps(name string, res []*regexp.Regexp) bool {
+	for _, re := range res {
+		if re.MatchString(name) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// dirsRegexpMatcher is dirsMatcher with regular expressions
+func dirsRegexpMatcher(dirs *Directories, shouldFind bool, patterns ...string) (*Directories, error) {
+	if len(patterns) == 0 {
+		if shouldFind {
+			return dirs, nil
+		}
+
+		return nil, nil
+	}
+
+	res, err := compileRegexps(patterns)
+	if err != nil {
+		return nil, err
+	}
+
+	var matches Directories
+	for _, dir := range *dirs {
+		if matchRegexps(dir.Name(), res) == shouldFind {
+			matches = append(matches, dir)
+		}
+	}
+
+	return &matches, nil
+}
+
+// filesRegexpMatcher is filesMatcher with regular expressions
+func filesRegexpMatcher(files *Files, shouldFind bool, patterns ...string) (*Files, error) {
+	if len(patterns) == 0 {
+		if shouldFind {
+			return files, nil
+		}
+
+		return nil, nil
+	}
+
+	res, err := compileRegexps(patterns)
+	if err != nil {
+		return nil, err
+	}
+
+	var matches Files
+	for _, file := range *files {
+		if matchRegexps(file.Name(), res) == shouldFind {
+			matches = append(matches, file)
+		}
+	}
+
+	return &matches, nil
+}
+
+func dirLister(d *Directory) (*entries, error) {
+	entriesList, err := d.sys().ReadDir(d.Path)
 	if err != nil {
 		return nil, err
 	}
 
-	return &entries{dir: dir, values: entriesList}, nil
+	return &entries{dir: d.Path, values: entriesList, fsys: d.fsys}, nil
 }
 
 // ------------------------------------------------------------------
@@ -1,6 +1,8 @@
 package fs_test
 
 import (
+	"context"
+	"errors"
 	"os"
 	"path/filepath"
 	"testing"
@@ -170,3 +172,133 @@ func TestPathExists(t *testing.T) {
 		t.Errorf("%s: should exist, but was marked as inexistant", fpath)
 	}
 }
+
+func TestExistsNoFollow(t *testing.T) {
+	link, clean := newSymLink()
+	defer clean()
+
+	target, _ := link.Resolve()
+	tests := []struct {
+		name       string
+		removeTgt  bool
+		exists     bool
+		noFollow   bool
+		existsLink bool
+	}{
+		{"valid symlink", false, true, true, true},
+		{"broken symlink", true, false, true, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.removeTgt {
+				if err := os.Remove(target); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			exists, _ := fs.Exists(link.Path)
+			noFollow, _ := fs.ExistsNoFollow(link.Path)
+			existsLink, _ := link.ExistsAsLink()
+
+			if exists != tt.exists || noFollow != tt.noFollow || existsLink != tt.existsLink {
+				t.Errorf(
+					"expected Exists/ExistsNoFollow/ExistsAsLink %t/%t/%t, got %t/%t/%t",
+					tt.exists, tt.noFollow, tt.existsLink,
+					exists, noFollow, existsLink,
+				)
+			}
+		})
+	}
+
+	if ok, err := fs.ExistsNoFollow("/inexistant/path"); ok || err != nil {
+		t.Errorf("inexistant path: expected false, nil, got %t, %v", ok, err)
+	}
+
+	if ok, _ := fs.NewFile(target + ".other").ExistsAsLink(); ok {
+		t.Errorf("inexistant path reported as a symlink")
+	}
+}
+
+func TestFSType(t *testing.T) {
+	d, clean := tempDir()
+	defer clean()
+
+	fstype, err := fs.FSType(d)
+	if err != nil {
+		t.Fatalf("unable to get file system type of %s: %v", d, err)
+	}
+
+	if fstype == "" {
+		t.Errorf("%s: expected a file system type, got none", d)
+	}
+}
+
+func TestContextCancelled(t *testing.T) {
+	f, clean := newFile()
+	defer clean()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	dstDir := filepath.Join(f.DirPath(), "subdir")
+	if err := os.MkdirAll(dstDir, 0777); err != nil {
+		t.Fatalf("unable to create dst subdir for copying: %v", err)
+	}
+
+	tests := []struct {
+		name string
+		fn   func() error
+	}{
+		{"WalkTreeContext", func() error {
+			_, _, err := fs.WalkTreeContext(ctx, f.DirPath(), nil, 0)
+			return err
+		}},
+		{"TreeSizeContext", func() error {
+			_, err := fs.TreeSizeContext(ctx, f.DirPath(), nil)
+			return err
+		}},
+		{"FindFilesContext", func() error {
+			_, err := fs.FindFilesContext(ctx, f.DirPath(), "*", 0, nil)
+			return err
+		}},
+		{"CopyFileContext", func() error {
+			return fs.CopyFileContext(ctx, f.Path, dstDir)
+		}},
+		{"CopyToContext", func() error {
+			return newDir(t, f.DirPath()).CopyToContext(ctx, filepath.Join(dstDir, "copy"))
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.fn(); !errors.Is(err, context.Canceled) {
+				t.Errorf("expected context cancelled error, got %v", err)
+			}
+		})
+	}
+}
+
+func TestCopyFileCreateDest(t *testing.T) {
+	f, clean := newFile()
+	defer clean()
+
+	dstDir := filepath.Join(f.DirPath(), "missing", "subdir")
+	if err := fs.CopyFile(f.Path, dstDir); err != (fs.InexistantError{dstDir}) {
+		t.Errorf("expected InexistantError without WithCreateDest, got %v", err)
+	}
+
+	if err := fs.CopyFile(f.Path, dstDir, fs.WithCreateDest()); err != nil {
+		t.Fatalf("unable to copy to missing dir: %v", err)
+	}
+
+	if ok, _ := fs.IsFile(filepath.Join(dstDir, f.Name())); !ok {
+		t.Errorf("expected file copied into created dir")
+	}
+
+	// Also for file exports
+	export := filepath.Join(f.DirPath(), "other", "export.txt")
+	if err := f.ExportTo(export, fs.WithCreateDest()); err != nil {
+		t.Fatalf("unable to export to missing dir: %v", err)
+	}
+}
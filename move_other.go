@@ -0,0 +1,14 @@
+//go:build !windows
+
+package fs
+
+import (
+	"errors"
+	"syscall"
+)
+
+// crossDevice checks if the rename error is due to
+// the paths being on different devices
+func crossDevice(err error) bool {
+	return errors.Is(err, syscall.EXDEV)
+}
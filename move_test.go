@@ -0,0 +1,211 @@
+package fs_test
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/brinick/fs"
+)
+
+// crossDeviceFS is the OS file system, failing renames
+// as across mount points
+type crossDeviceFS struct {
+	fs.OSFilesystem
+}
+
+func (crossDeviceFS) Rename(oldname, newname string) error {
+	return &os.LinkError{Op: "rename", Old: oldname, New: newname, Err: syscall.EXDEV}
+}
+
+func TestMoveTo(t *testing.T) {
+	mtime := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	tests := []struct {
+		name string
+		sys  fs.Filesystem
+	}{
+		{"rename", fs.OSFilesystem{}},
+		{"across devices", crossDeviceFS{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root := newTree(t, map[string]int{"a": 10, "sub/b": 20})
+			src := filepath.Join(root, "src")
+			if err := os.Chtimes(filepath.Join(src, "a"), mtime, mtime); err != nil {
+				t.Fatal(err)
+			}
+
+			dstDir := filepath.Join(root, "dst")
+			if err := os.Mkdir(dstDir, 0755); err != nil {
+				t.Fatal(err)
+			}
+
+			f := fs.NewFileOn(tt.sys, filepath.Join(src, "a"))
+			if err := f.MoveTo(dstDir); err != nil {
+				t.Fatalf("unable to move file: %v", err)
+			}
+
+			if f.Path != filepath.Join(dstDir, "a") {
+				t.Errorf("expected the file path updated, got %s", f.Path)
+			}
+
+			if info, err := os.Stat(f.Path); err != nil || info.Size() != 10 || !info.ModTime().Equal(mtime) {
+				t.Errorf("expected the moved file with its mtime, got %v", err)
+			}
+
+			if _, err := os.Stat(filepath.Join(src, "a")); !os.IsNotExist(err) {
+				t.Errorf("expected the source file removed, got %v", err)
+			}
+
+			d := fs.NewDirOn(tt.sys, src)
+			if err := d.MoveTo(dstDir); err == nil {
+				t.Errorf("expected an error moving to an existing destination")
+			}
+
+			moved := filepath.Join(root, "moved")
+			if err := d.MoveTo(moved); err != nil {
+				t.Fatalf("unable to move dir: %v", err)
+			}
+
+			if content, err := ioutil.ReadFile(filepath.Join(moved, "sub", "b")); err != nil || len(content) != 20 {
+				t.Errorf("expected the tree moved, got %v", err)
+			}
+
+			if d.Path != moved {
+				t.Errorf("expected the dir path updated, got %s", d.Path)
+			}
+
+			if _, err := os.Stat(src); !os.IsNotExist(err) {
+				t.Errorf("expected the source tree removed, got %v", err)
+			}
+		})
+	}
+}
+
+// failMoveFS is the OS file system, failing renames with err, and
+// the opening for writing of the files named failWrite
+type failMoveFS struct {
+	fs.OSFilesystem
+	err       error
+	failWrite string
+}
+
+func (f failMoveFS) Rename(oldname, newname string) error {
+	return &os.LinkError{Op: "rename", Old: oldname, New: newname, Err: f.err}
+}
+
+func (f failMoveFS) OpenFile(name string, flag int, perm os.FileMode) (fs.FileHandle, error) {
+	if filepath.Base(name) == f.failWrite {
+		return nil, &os.PathError{Op: "open", Path: name, Err: syscall.ENOSPC}
+	}
+
+	return f.OSFilesystem.OpenFile(name, flag, perm)
+}
+
+func TestMoveToErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		sys     fs.Filesystem
+		dst     string
+		wantErr error
+	}{
+		{"into itself", crossDeviceFS{}, "src/sub/moved", nil},
+		{"rename error", failMoveFS{err: syscall.EACCES}, "moved", syscall.EACCES},
+		{"copy error", failMoveFS{err: syscall.EXDEV, failWrite: "b"}, "moved", syscall.ENOSPC},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root := newTree(t, map[string]int{"a": 10, "sub/b": 20})
+			src := filepath.Join(root, "src")
+			dst := filepath.Join(root, tt.dst)
+
+			err := fs.NewDirOn(tt.sys, src).MoveTo(dst)
+			if err == nil || tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+				t.Errorf("expected error %v, got %v", tt.wantErr, err)
+			}
+
+			if _, err := os.Stat(dst); !os.IsNotExist(err) {
+				t.Errorf("expected nothing left at the destination, got %v", err)
+			}
+
+			if _, err := os.Stat(filepath.Join(src, "sub", "b")); err != nil {
+				t.Errorf("expected the source tree kept, got %v", err)
+			}
+		})
+	}
+}
+
+// corruptFS is the OS file system, corrupting the content written
+type corruptFS struct {
+	fs.OSFilesystem
+}
+
+func (c corruptFS) OpenFile(name string, flag int, perm os.FileMode) (fs.FileHandle, error) {
+	fh, err := c.OSFilesystem.OpenFile(name, flag, perm)
+	if err != nil {
+		return nil, err
+	}
+
+	return corruptHandle{fh}, nil
+}
+
+type corruptHandle struct {
+	fs.FileHandle
+}
+
+func (h corruptHandle) Write(p []byte) (int, error) {
+	return h.FileHandle.Write(bytes.ToUpper(p))
+}
+
+func TestMoveVerified(t *testing.T) {
+	root := newTree(t, map[string]int{"a": 1000})
+	src := filepath.Join(root, "src", "a")
+	want, err := fs.NewFile(src).Hash(fs.SHA256)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dst := filepath.Join(root, "dst")
+	f := fs.NewFileOn(corruptFS{}, src)
+	if _, _, err := f.MoveVerified(dst); !errors.As(err, &fs.ChecksumError{}) {
+		t.Errorf("expected a checksum error for a corrupted copy, got %v", err)
+	}
+
+	if _, err := os.Stat(src); err != nil {
+		t.Errorf("expected the source kept, got %v", err)
+	}
+
+	if _, err := os.Stat(dst); !os.IsNotExist(err) {
+		t.Errorf("expected the corrupted copy removed, got %v", err)
+	}
+
+	f = fs.NewFile(src)
+	digest, n, err := f.MoveVerified(dst)
+	if err != nil {
+		t.Fatalf("unable to move file: %v", err)
+	}
+
+	if digest != want || n != 1000 {
+		t.Errorf("expected digest %s of 1000 bytes, got %s of %d", want, digest, n)
+	}
+
+	if f.Path != dst {
+		t.Errorf("expected the file path updated, got %s", f.Path)
+	}
+
+	if got, err := f.Hash(fs.SHA256); err != nil || got != want {
+		t.Errorf("expected the moved content, got %s (%v)", got, err)
+	}
+
+	if _, err := os.Stat(src); !os.IsNotExist(err) {
+		t.Errorf("expected the source file removed, got %v", err)
+	}
+}
@@ -0,0 +1,15 @@
+//go:build windows
+
+package fs
+
+import (
+	"errors"
+
+	"golang.org/x/sys/windows"
+)
+
+// crossDevice checks if the rename error is due to
+// the paths being on different volumes
+func crossDevice(err error) bool {
+	return errors.Is(err, windows.ERROR_NOT_SAME_DEVICE)
+}
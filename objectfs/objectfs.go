@@ -0,0 +1,596 @@
+// Package objectfs provides a fs.Filesystem over an object store such
+// as an S3 bucket, so that trees can be mirrored to and read from it
+// with the same API as on disk:
+//
+//	mirror := objectfs.New(bucket, "mirror")
+//	err := local.CopyToDir(fs.NewDirOn(mirror, "releases/x.y.z"))
+//
+// where bucket is a Store, typically wrapping the object store's SDK
+// client. Paths are mapped to keys below the prefix. Directories are
+// the key prefixes ending in "/", MkdirAll storing an empty "dir/"
+// marker object so that empty ones exist. Written files are uploaded
+// when closed, or in parts as they are written once larger than the
+// part size if the store is a MultipartStore. Objects have no modes,
+// times that can be set or symlinks: Chmod and Chtimes do nothing.
+package objectfs
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	iofs "io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/brinick/fs"
+)
+
+// DefaultPartSize is the default size of multipart upload parts
+const DefaultPartSize = 8 << 20
+
+var (
+	errNotDir      = errors.New("not a directory")
+	errIsDir       = errors.New("is a directory")
+	errNotEmpty    = errors.New("directory not empty")
+	errNoSymlinks  = errors.New("symlinks not supported")
+	errNotReadable = errors.New("file not opened for reading")
+	errNotWritable = errors.New("file not opened for writing")
+)
+
+// FS is a fs.Filesystem on an object Store
+type FS struct {
+	store  Store
+	prefix string
+
+	// PartSize is the size of the parts in which large files are
+	// uploaded to a MultipartStore, DefaultPartSize if <= 0
+	PartSize int64
+}
+
+var _ fs.Filesystem = (*FS)(nil)
+
+// New returns the Filesystem of the objects of store below the
+// given key prefix, which may be empty for the whole store
+func New(store Store, prefix string) *FS {
+	return &FS{store: store, prefix: strings.Trim(prefix, "/")}
+}
+
+// Store returns the underlying object store
+func (o *FS) Store() Store {
+	return o.store
+}
+
+func (o *FS) partSize() int64 {
+	if o.PartSize <= 0 {
+		return DefaultPartSize
+	}
+
+	return o.PartSize
+}
+
+// key returns the object key of the named path, "" for the store root
+func (o *FS) key(name string) string {
+	name = path.Clean("/" + filepath.ToSlash(name))
+	return strings.TrimPrefix(path.Join(o.prefix, name), "/")
+}
+
+// dirPrefix returns the key prefix of the objects in the directory key
+func dirPrefix(key string) string {
+	if key == "" {
+		return ""
+	}
+
+	return key + "/"
+}
+
+func pathError(op, name string, err error) error {
+	return &os.PathError{Op: op, Path: name, Err: err}
+}
+
+// isDir checks if there are objects below the directory key
+func (o *FS) isDir(key string) (bool, error) {
+	if key == "" && o.prefix == "" {
+		return true, nil
+	}
+
+	objects, prefixes, err := o.store.List(dirPrefix(key), "/")
+	if err != nil {
+		return false, err
+	}
+
+	return len(objects)+len(prefixes) > 0, nil
+}
+
+// stat returns the info of the object or directory key
+func (o *FS) stat(op, name, key string) (*fileInfo, error) {
+	if key != "" {
+		obj, err := o.store.Head(key)
+		if err == nil {
+			return &fileInfo{name: path.Base(key), size: obj.Size, modTime: obj.ModTime}, nil
+		}
+
+		if !errors.Is(err, os.ErrNotExist) {
+			return nil, err
+		}
+	}
+
+	dir, err := o.isDir(key)
+	if err != nil {
+		return nil, err
+	}
+
+	if !dir {
+		return nil, pathError(op, name, os.ErrNotExist)
+	}
+
+	return &fileInfo{name: path.Base("/" + key), dir: true}, nil
+}
+
+// Open opens the named file or directory for reading
+func (o *FS) Open(name string) (iofs.File, error) {
+	return o.open(name)
+}
+
+func (o *FS) open(name string) (fs.FileHandle, error) {
+	key := o.key(name)
+	info, err := o.stat("open", name, key)
+	if err != nil {
+		return nil, err
+	}
+
+	if info.dir {
+		return &dirHandle{fs: o, name: name, info: info}, nil
+	}
+
+	rc, err := o.store.Get(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return &reader{ReadCloser: rc, name: name, info: info}, nil
+}
+
+// OpenFile opens the named file with the given os.O_* flags. Files
+// opened for writing are write only, and stored when closed.
+func (o *FS) OpenFile(name string, flag int, perm os.FileMode) (fs.FileHandle, error) {
+	if flag&(os.O_WRONLY|os.O_RDWR|os.O_CREATE|os.O_TRUNC|os.O_APPEND) == 0 {
+		return o.open(name)
+	}
+
+	key := o.key(name)
+	info, err := o.stat("open", name, key)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+
+	exists := err == nil
+	switch {
+	case exists && info.dir:
+		return nil, pathError("open", name, errIsDir)
+	case exists && flag&os.O_CREATE != 0 && flag&os.O_EXCL != 0:
+		return nil, pathError("open", name, os.ErrExist)
+	case !exists && flag&os.O_CREATE == 0:
+		return nil, pathError("open", name, os.ErrNotExist)
+	}
+
+	w := &writer{fs: o, name: name, key: key}
+	if exists && flag&os.O_APPEND != 0 && flag&os.O_TRUNC == 0 {
+		// Objects cannot be appended to, so rewrite the content
+		rc, err := o.store.Get(key)
+		if err != nil {
+			return nil, err
+		}
+		_, err = io.Copy(w, rc)
+		rc.Close()
+		if err != nil {
+			w.abort()
+			return nil, err
+		}
+	}
+
+	return w, nil
+}
+
+// Stat returns the info of the named file or directory
+func (o *FS) Stat(name string) (os.FileInfo, error) {
+	info, err := o.stat("stat", name, o.key(name))
+	if err != nil {
+		return nil, err
+	}
+
+	return info, nil
+}
+
+// Lstat is the same as Stat, there being no symlinks
+func (o *FS) Lstat(name string) (os.FileInfo, error) {
+	info, err := o.stat("lstat", name, o.key(name))
+	if err != nil {
+		return nil, err
+	}
+
+	return info, nil
+}
+
+// ReadDir returns the entries of the named directory, sorted by name
+func (o *FS) ReadDir(name string) ([]os.FileInfo, error) {
+	key := o.key(name)
+	info, err := o.stat("readdir", name, key)
+	if err != nil {
+		return nil, err
+	}
+
+	if !info.dir {
+		return nil, pathError("readdir", name, errNotDir)
+	}
+
+	prefix := dirPrefix(key)
+	objects, prefixes, err := o.store.List(prefix, "/")
+	if err != nil {
+		return nil, err
+	}
+
+	var infos []os.FileInfo
+	for _, obj := range objects {
+		if obj.Key == prefix {
+			// The directory marker
+			continue
+		}
+
+		infos = append(infos, &fileInfo{
+			name:    obj.Key[len(prefix):],
+			size:    obj.Size,
+			modTime: obj.ModTime,
+		})
+	}
+
+	for _, p := range prefixes {
+		infos = append(infos, &fileInfo{
+			name: strings.TrimSuffix(p[len(prefix):], "/"),
+			dir:  true,
+		})
+	}
+
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].Name() < infos[j].Name()
+	})
+
+	return infos, nil
+}
+
+// Readlink always fails, there being no symlinks
+func (o *FS) Readlink(name string) (string, error) {
+	return "", pathError("readlink", name, errNoSymlinks)
+}
+
+// MkdirAll creates the named directory, by storing a marker object
+// for it if it does not exist. Parents need not be created, being
+// implied by the key.
+func (o *FS) MkdirAll(name string, perm os.FileMode) error {
+	key := o.key(name)
+	info, err := o.stat("mkdir", name, key)
+	if err == nil {
+		if !info.dir {
+			return pathError("mkdir", name, errNotDir)
+		}
+		return nil
+	}
+
+	if !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	return o.store.Put(dirPrefix(key), bytes.NewReader(nil), 0)
+}
+
+// Rename moves oldname, file or directory, to newname by copying
+// then deleting its objects. It is not atomic.
+func (o *FS) Rename(oldname, newname string) error {
+	oldKey, newKey := o.key(oldname), o.key(newname)
+	info, err := o.stat("rename", oldname, oldKey)
+	if err != nil {
+		return err
+	}
+
+	if !info.dir {
+		return o.move(oldKey, newKey)
+	}
+
+	oldPrefix, newPrefix := dirPrefix(oldKey), dirPrefix(newKey)
+	objects, _, err := o.store.List(oldPrefix, "")
+	if err != nil {
+		return err
+	}
+
+	for _, obj := range objects {
+		if err := o.move(obj.Key, newPrefix+obj.Key[len(oldPrefix):]); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// move copies the object to the new key, then deletes it
+func (o *FS) move(oldKey, newKey string) error {
+	obj, err := o.store.Head(oldKey)
+	if err != nil {
+		return err
+	}
+
+	rc, err := o.store.Get(oldKey)
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+
+	if err := o.store.Put(newKey, rc, obj.Size); err != nil {
+		return err
+	}
+
+	return o.store.Delete(oldKey)
+}
+
+// Remove removes the named file or empty directory
+func (o *FS) Remove(name string) error {
+	key := o.key(name)
+	info, err := o.stat("remove", name, key)
+	if err != nil {
+		return err
+	}
+
+	if !info.dir {
+		return o.store.Delete(key)
+	}
+
+	prefix := dirPrefix(key)
+	objects, prefixes, err := o.store.List(prefix, "/")
+	if err != nil {
+		return err
+	}
+
+	if len(prefixes) > 0 || len(objects) > 1 || (len(objects) == 1 && objects[0].Key != prefix) {
+		return pathError("remove", name, errNotEmpty)
+	}
+
+	return o.store.Delete(prefix)
+}
+
+// RemoveAll removes the named path and all objects below it.
+// It is not an error if the path does not exist.
+func (o *FS) RemoveAll(name string) error {
+	key := o.key(name)
+	if key != "" {
+		if err := o.store.Delete(key); err != nil {
+			return err
+		}
+	}
+
+	objects, _, err := o.store.List(dirPrefix(key), "")
+	if err != nil {
+		return err
+	}
+
+	for _, obj := range objects {
+		if err := o.store.Delete(obj.Key); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Chmod does nothing, objects having no mode
+func (o *FS) Chmod(name string, mode os.FileMode) error {
+	return nil
+}
+
+// Chtimes does nothing, object times being set by the store
+func (o *FS) Chtimes(name string, atime, mtime time.Time) error {
+	return nil
+}
+
+// ------------------------------------------------------------------
+
+// fileInfo is the info of an object or directory
+type fileInfo struct {
+	name    string
+	size    int64
+	modTime time.Time
+	dir     bool
+}
+
+func (i *fileInfo) Name() string       { return i.name }
+func (i *fileInfo) Size() int64        { return i.size }
+func (i *fileInfo) ModTime() time.Time { return i.modTime }
+func (i *fileInfo) IsDir() bool        { return i.dir }
+func (i *fileInfo) Sys() interface{}   { return nil }
+
+func (i *fileInfo) Mode() os.FileMode {
+	if i.dir {
+		return os.ModeDir | 0755
+	}
+
+	return 0644
+}
+
+// reader is an object opened for reading
+type reader struct {
+	io.ReadCloser
+	name string
+	info *fileInfo
+}
+
+func (r *reader) Stat() (os.FileInfo, error) {
+	return r.info, nil
+}
+
+func (r *reader) Write(p []byte) (int, error) {
+	return 0, pathError("write", r.name, errNotWritable)
+}
+
+// dirHandle is an opened directory
+type dirHandle struct {
+	fs      *FS
+	name    string
+	info    *fileInfo
+	entries []iofs.DirEntry
+	read    bool
+}
+
+func (d *dirHandle) Stat() (os.FileInfo, error) {
+	return d.info, nil
+}
+
+func (d *dirHandle) Read(p []byte) (int, error) {
+	return 0, pathError("read", d.name, errIsDir)
+}
+
+func (d *dirHandle) Write(p []byte) (int, error) {
+	return 0, pathError("write", d.name, errIsDir)
+}
+
+func (d *dirHandle) Close() error {
+	return nil
+}
+
+// ReadDir returns the next n directory entries, or all remaining
+// ones if n <= 0, as for os.File.ReadDir
+func (d *dirHandle) ReadDir(n int) ([]iofs.DirEntry, error) {
+	if !d.read {
+		infos, err := d.fs.ReadDir(d.name)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, info := range infos {
+			d.entries = append(d.entries, iofs.FileInfoToDirEntry(info))
+		}
+		d.read = true
+	}
+
+	if n <= 0 {
+		entries := d.entries
+		d.entries = nil
+		return entries, nil
+	}
+
+	if len(d.entries) == 0 {
+		return nil, io.EOF
+	}
+
+	if n > len(d.entries) {
+		n = len(d.entries)
+	}
+
+	entries := d.entries[:n]
+	d.entries = d.entries[n:]
+	return entries, nil
+}
+
+// writer is an object opened for writing. The content is buffered and
+// stored when closed, or, with a MultipartStore, uploaded in parts once
+// a part size worth has been written.
+type writer struct {
+	fs   *FS
+	name string
+	key  string
+
+	buf      bytes.Buffer
+	size     int64
+	uploadID string
+	parts    []Part
+	closed   bool
+}
+
+func (w *writer) Stat() (os.FileInfo, error) {
+	return &fileInfo{name: path.Base(w.key), size: w.size, modTime: time.Now()}, nil
+}
+
+func (w *writer) Read(p []byte) (int, error) {
+	return 0, pathError("read", w.name, errNotReadable)
+}
+
+func (w *writer) Write(p []byte) (int, error) {
+	if w.closed {
+		return 0, pathError("write", w.name, os.ErrClosed)
+	}
+
+	n, _ := w.buf.Write(p)
+	w.size += int64(n)
+
+	store, ok := w.fs.store.(MultipartStore)
+	if !ok {
+		return n, nil
+	}
+
+	partSize := w.fs.partSize()
+	for int64(w.buf.Len()) >= partSize {
+		if err := w.upload(store, partSize); err != nil {
+			w.abort()
+			return n, err
+		}
+	}
+
+	return n, nil
+}
+
+// upload uploads the next size bytes of the buffer as a part
+func (w *writer) upload(store MultipartStore, size int64) error {
+	if w.uploadID == "" {
+		id, err := store.CreateMultipart(w.key)
+		if err != nil {
+			return err
+		}
+		w.uploadID = id
+	}
+
+	chunk := w.buf.Next(int(size))
+	part, err := store.UploadPart(w.key, w.uploadID, len(w.parts)+1, bytes.NewReader(chunk), size)
+	if err != nil {
+		return err
+	}
+
+	w.parts = append(w.parts, part)
+	return nil
+}
+
+// abort abandons the write, discarding any uploaded parts
+func (w *writer) abort() {
+	w.closed = true
+	w.buf.Reset()
+	if w.uploadID != "" {
+		w.fs.store.(MultipartStore).AbortMultipart(w.key, w.uploadID)
+	}
+}
+
+// Close stores the written content
+func (w *writer) Close() error {
+	if w.closed {
+		return pathError("close", w.name, os.ErrClosed)
+	}
+
+	if w.uploadID == "" {
+		w.closed = true
+		return w.fs.store.Put(w.key, &w.buf, int64(w.buf.Len()))
+	}
+
+	store := w.fs.store.(MultipartStore)
+	if w.buf.Len() > 0 {
+		if err := w.upload(store, int64(w.buf.Len())); err != nil {
+			w.abort()
+			return err
+		}
+	}
+
+	if err := store.CompleteMultipart(w.key, w.uploadID, w.parts); err != nil {
+		w.abort()
+		return err
+	}
+
+	w.closed = true
+	return nil
+}
@@ -0,0 +1,141 @@
+package objectfs_test
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/brinick/fs"
+	"github.com/brinick/fs/objectfs"
+)
+
+// countingStore counts the uploaded parts
+type countingStore struct {
+	*objectfs.MemStore
+	parts int
+}
+
+func (c *countingStore) UploadPart(key, id string, n int, r io.Reader, size int64) (objectfs.Part, error) {
+	c.parts++
+	return c.MemStore.UploadPart(key, id, n, r, size)
+}
+
+func TestMirrorTree(t *testing.T) {
+	root, err := ioutil.TempDir("", "objectfs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	large := strings.Repeat("x", 2500)
+	src := filepath.Join(root, "src")
+	for name, content := range map[string]string{"a.txt": "a", "sub/b.txt": "b", "sub/large": large} {
+		path := filepath.Join(src, name)
+		os.MkdirAll(filepath.Dir(path), 0755)
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	os.Mkdir(filepath.Join(src, "empty"), 0755)
+
+	store := &countingStore{MemStore: objectfs.NewMemStore()}
+	ofs := objectfs.New(store, "mirror")
+	ofs.PartSize = 1000
+	mirror := fs.NewDirOn(ofs, "releases", "1.0")
+
+	if err := fs.NewDirOn(nil, src).CopyToDir(mirror); err != nil {
+		t.Fatalf("unable to mirror tree: %v", err)
+	}
+
+	if store.parts != 3 {
+		t.Errorf("expected large file uploaded in 3 parts, got %d", store.parts)
+	}
+
+	if _, err := store.Head("mirror/releases/1.0/sub/large"); err != nil {
+		t.Errorf("expected object below the prefix: %v", err)
+	}
+
+	files, err := mirror.FilesRecursive(0)
+	if err != nil {
+		t.Fatalf("unable to list mirrored tree: %v", err)
+	}
+
+	want := map[string]string{"a.txt": "a", "b.txt": "b", "large": large}
+	if len(*files) != len(want) {
+		t.Fatalf("expected %d files, got %v", len(want), files.Paths())
+	}
+
+	for _, f := range *files {
+		if text, err := f.Text(); err != nil || text != want[f.Name()] {
+			t.Errorf("%s: unexpected content %.10q (%v)", f.Path, text, err)
+		}
+	}
+
+	dirs, err := mirror.SubDirs()
+	if err != nil {
+		t.Fatalf("unable to list sub dirs: %v", err)
+	}
+
+	if names := strings.Join(dirs.Names(), ","); names != "empty,sub" {
+		t.Errorf("expected sub dirs empty,sub, got %s", names)
+	}
+
+	// Files can be read back to disk
+	back := filepath.Join(root, "back")
+	if err := mirror.CopyToDir(fs.NewDirOn(nil, back)); err != nil {
+		t.Fatalf("unable to copy back tree: %v", err)
+	}
+
+	if data, _ := ioutil.ReadFile(filepath.Join(back, "sub", "large")); !bytes.Equal(data, []byte(large)) {
+		t.Errorf("large file not copied back")
+	}
+
+	if err := fs.NewDirOn(ofs, "releases").Remove(); err != nil {
+		t.Fatalf("unable to remove mirrored tree: %v", err)
+	}
+
+	if objects, _, _ := store.List("", ""); len(objects) != 0 {
+		t.Errorf("expected no objects left, got %v", objects)
+	}
+}
+
+func TestObjectFiles(t *testing.T) {
+	ofs := objectfs.New(objectfs.NewMemStore(), "")
+	f := fs.NewFileOn(ofs, "dir/file.txt")
+
+	if err := f.WriteAtomic([]byte("one\n")); err != nil {
+		t.Fatalf("unable to write file: %v", err)
+	}
+
+	if err := f.Append([]byte("two\n")); err != nil {
+		t.Fatalf("unable to append to file: %v", err)
+	}
+
+	if text, err := f.Text(); err != nil || text != "one\ntwo" {
+		t.Errorf("expected appended content, got %q (%v)", text, err)
+	}
+
+	if err := ofs.Remove("dir"); err == nil {
+		t.Errorf("expected error removing non empty dir")
+	}
+
+	if err := ofs.Rename("dir", "moved"); err != nil {
+		t.Fatalf("unable to rename dir: %v", err)
+	}
+
+	if ok, _ := fs.NewFileOn(ofs, "moved/file.txt").Exists(); !ok {
+		t.Errorf("expected file in renamed dir")
+	}
+
+	if ok, _ := f.Exists(); ok {
+		t.Errorf("expected file gone from old dir")
+	}
+
+	if _, err := ofs.OpenFile("moved/file.txt", os.O_RDWR|os.O_CREATE|os.O_EXCL, 0600); !os.IsExist(err) {
+		t.Errorf("expected exclusive create to fail, got %v", err)
+	}
+}
@@ -0,0 +1,250 @@
+package objectfs
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Object describes a stored object
+type Object struct {
+	Key     string
+	Size    int64
+	ModTime time.Time
+}
+
+// Store is a flat key/value object store, such as an S3 bucket.
+// Keys are slash separated; errors for missing keys must wrap
+// os.ErrNotExist.
+type Store interface {
+	// Get returns a reader of the object content
+	Get(key string) (io.ReadCloser, error)
+
+	// Head returns the description of the object
+	Head(key string) (Object, error)
+
+	// Put stores the size bytes read from r as the object content
+	Put(key string, r io.Reader, size int64) error
+
+	// Delete removes the object. It is not an error if it does not exist.
+	Delete(key string) error
+
+	// List returns the objects whose key starts with prefix, sorted by
+	// key. If delimiter is not empty, keys containing it after the prefix
+	// are rolled up into the returned common prefixes, up to and
+	// including the delimiter, as in S3 listings.
+	List(prefix, delimiter string) ([]Object, []string, error)
+}
+
+// Part is an uploaded part of a multipart upload
+type Part struct {
+	Number int
+	ETag   string
+}
+
+// MultipartStore is a Store supporting uploads in parts, used for
+// objects larger than the part size, so that they are sent as they
+// are written rather than held in memory
+type MultipartStore interface {
+	Store
+
+	// CreateMultipart starts a multipart upload to key, returning its id
+	CreateMultipart(key string) (string, error)
+
+	// UploadPart uploads the numbered part, numbers starting at 1
+	UploadPart(key, uploadID string, number int, r io.Reader, size int64) (Part, error)
+
+	// CompleteMultipart assembles the parts into the object
+	CompleteMultipart(key, uploadID string, parts []Part) error
+
+	// AbortMultipart abandons the upload, discarding its parts
+	AbortMultipart(key, uploadID string) error
+}
+
+// ------------------------------------------------------------------
+
+// MemStore is an in memory MultipartStore, e.g. for tests
+type MemStore struct {
+	mu      sync.Mutex
+	objects map[string]memObject
+	uploads map[string]map[int][]byte
+	nextID  int
+}
+
+type memObject struct {
+	data    []byte
+	modTime time.Time
+}
+
+var _ MultipartStore = (*MemStore)(nil)
+
+// NewMemStore returns a new empty in memory store
+func NewMemStore() *MemStore {
+	return &MemStore{
+		objects: map[string]memObject{},
+		uploads: map[string]map[int][]byte{},
+	}
+}
+
+func notExist(op, key string) error {
+	return &os.PathError{Op: op, Path: key, Err: os.ErrNotExist}
+}
+
+// Get returns a reader of the object content
+func (m *MemStore) Get(key string) (io.ReadCloser, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	obj, ok := m.objects[key]
+	if !ok {
+		return nil, notExist("get", key)
+	}
+
+	return ioutil.NopCloser(bytes.NewReader(obj.data)), nil
+}
+
+// Head returns the description of the object
+func (m *MemStore) Head(key string) (Object, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	obj, ok := m.objects[key]
+	if !ok {
+		return Object{}, notExist("head", key)
+	}
+
+	return Object{Key: key, Size: int64(len(obj.data)), ModTime: obj.modTime}, nil
+}
+
+// Put stores the content read from r as the object
+func (m *MemStore) Put(key string, r io.Reader, size int64) error {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+
+	if int64(len(data)) != size {
+		return fmt.Errorf("put %s: read %d bytes, expected %d", key, len(data), size)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.objects[key] = memObject{data: data, modTime: time.Now()}
+	return nil
+}
+
+// Delete removes the object
+func (m *MemStore) Delete(key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.objects, key)
+	return nil
+}
+
+// List returns the objects and common prefixes under prefix
+func (m *MemStore) List(prefix, delimiter string) ([]Object, []string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var (
+		objects  []Object
+		prefixes []string
+		seen     = map[string]bool{}
+	)
+
+	for key, obj := range m.objects {
+		if !strings.HasPrefix(key, prefix) {
+			continue
+		}
+
+		if delimiter != "" {
+			rest := key[len(prefix):]
+			if i := strings.Index(rest, delimiter); i >= 0 {
+				common := prefix + rest[:i+len(delimiter)]
+				if !seen[common] {
+					seen[common] = true
+					prefixes = append(prefixes, common)
+				}
+				continue
+			}
+		}
+
+		objects = append(objects, Object{
+			Key:     key,
+			Size:    int64(len(obj.data)),
+			ModTime: obj.modTime,
+		})
+	}
+
+	sort.Slice(objects, func(i, j int) bool { return objects[i].Key < objects[j].Key })
+	sort.Strings(prefixes)
+	return objects, prefixes, nil
+}
+
+// CreateMultipart starts a multipart upload
+func (m *MemStore) CreateMultipart(key string) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.nextID++
+	id := fmt.Sprintf("%s#%d", key, m.nextID)
+	m.uploads[id] = map[int][]byte{}
+	return id, nil
+}
+
+// UploadPart stores a part of the upload
+func (m *MemStore) UploadPart(key, uploadID string, number int, r io.Reader, size int64) (Part, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return Part{}, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	parts, ok := m.uploads[uploadID]
+	if !ok {
+		return Part{}, fmt.Errorf("no such upload %s", uploadID)
+	}
+
+	parts[number] = data
+	return Part{Number: number, ETag: fmt.Sprintf("%d-%d", number, len(data))}, nil
+}
+
+// CompleteMultipart assembles the listed parts into the object
+func (m *MemStore) CompleteMultipart(key, uploadID string, parts []Part) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	uploaded, ok := m.uploads[uploadID]
+	if !ok {
+		return fmt.Errorf("no such upload %s", uploadID)
+	}
+
+	var data []byte
+	for _, p := range parts {
+		chunk, ok := uploaded[p.Number]
+		if !ok {
+			return fmt.Errorf("upload %s: missing part %d", uploadID, p.Number)
+		}
+		data = append(data, chunk...)
+	}
+
+	delete(m.uploads, uploadID)
+	m.objects[key] = memObject{data: data, modTime: time.Now()}
+	return nil
+}
+
+// AbortMultipart discards the upload
+func (m *MemStore) AbortMultipart(key, uploadID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.uploads, uploadID)
+	return nil
+}
@@ -0,0 +1,93 @@
+package fs
+
+import (
+	"errors"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strconv"
+)
+
+// ErrOwnershipUnsupported is returned when file ownership
+// cannot be read on the current platform
+var ErrOwnershipUnsupported = errors.New("file ownership is not supported on this platform")
+
+// ownerIDs returns the uid and gid owning the path, without following symlinks
+func ownerIDs(path string) (int, int, error) {
+	info, err := os.Lstat(path)
+	if err != nil {
+		return -1, -1, err
+	}
+
+	uid, gid, ok := infoOwner(info)
+	if !ok {
+		return -1, -1, ErrOwnershipUnsupported
+	}
+
+	return uid, gid, nil
+}
+
+func lookupOwner(path string) (*user.User, error) {
+	uid, _, err := ownerIDs(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return user.LookupId(strconv.Itoa(uid))
+}
+
+func lookupGroup(path string) (*user.Group, error) {
+	_, gid, err := ownerIDs(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return user.LookupGroupId(strconv.Itoa(gid))
+}
+
+// Owner returns the user owning the file
+func (f *File) Owner() (*user.User, error) {
+	return lookupOwner(f.Path)
+}
+
+// Group returns the group owning the file
+func (f *File) Group() (*user.Group, error) {
+	return lookupGroup(f.Path)
+}
+
+// SetOwner changes the numeric uid and gid owning the file.
+// A uid or gid of -1 leaves that value unchanged.
+// For a symlink, the ownership of the link itself is changed.
+func (f *File) SetOwner(uid, gid int) error {
+	return os.Lchown(f.Path, uid, gid)
+}
+
+// Owner returns the user owning the directory
+func (d *Directory) Owner() (*user.User, error) {
+	return lookupOwner(d.Path)
+}
+
+// Group returns the group owning the directory
+func (d *Directory) Group() (*user.Group, error) {
+	return lookupGroup(d.Path)
+}
+
+// SetOwner changes the numeric uid and gid owning the directory, and if
+// recursive is set, of all the entries below it, symlinks not followed.
+// A uid or gid of -1 leaves that value unchanged.
+func (d *Directory) SetOwner(uid, gid int, recursive bool) error {
+	if !recursive {
+		return os.Lchown(d.Path, uid, gid)
+	}
+
+	return filepath.Walk(
+		d.Path,
+		func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+
+			return os.Lchown(path, uid, gid)
+		},
+	)
+}
@@ -0,0 +1,39 @@
+package fs_test
+
+import (
+	"os"
+	"strconv"
+	"testing"
+)
+
+func TestFileOwner(t *testing.T) {
+	f, clean := newFile()
+	defer clean()
+
+	owner, err := f.Owner()
+	if err != nil {
+		t.Fatalf("unable to get file owner: %v", err)
+	}
+
+	if owner.Uid != strconv.Itoa(os.Getuid()) {
+		t.Errorf("expected file owned by uid %d, got %s", os.Getuid(), owner.Uid)
+	}
+
+	group, err := f.Group()
+	if err != nil {
+		t.Fatalf("unable to get file group: %v", err)
+	}
+
+	if group.Gid != strconv.Itoa(os.Getgid()) {
+		t.Errorf("expected file owned by gid %d, got %s", os.Getgid(), group.Gid)
+	}
+
+	// Changing to the current owner is always permitted
+	if err := f.SetOwner(os.Getuid(), -1); err != nil {
+		t.Errorf("unable to set file owner: %v", err)
+	}
+
+	if err := newDir(t, f.DirPath()).SetOwner(-1, os.Getgid(), true); err != nil {
+		t.Errorf("unable to recursively set dir owner: %v", err)
+	}
+}
@@ -0,0 +1,114 @@
+package fs
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// DirIterator lists a directory's entries in batches, in directory
+// order, without ever holding the whole listing in memory
+type DirIterator struct {
+	dir  *Directory
+	fd   fs.ReadDirFile
+	size int
+}
+
+// Iter returns a DirIterator over the directory's entries, listed
+// batchSize at a time (100 if batchSize <= 0). The iterator must be closed.
+func (d *Directory) Iter(batchSize int) (*DirIterator, error) {
+	if batchSize <= 0 {
+		batchSize = 100
+	}
+
+	f, err := d.sys().Open(d.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	fd, ok := f.(fs.ReadDirFile)
+	if !ok {
+		f.Close()
+		return nil, &os.PathError{Op: "readdir", Path: d.Path, Err: errors.New("not a directory")}
+	}
+
+	return &DirIterator{dir: d, fd: fd, size: batchSize}, nil
+}
+
+// Next returns the next batch of entries. Once all entries
+// have been listed, it returns io.EOF.
+func (it *DirIterator) Next() ([]Entry, error) {
+	dirEntries, err := it.fd.ReadDir(it.size)
+	if len(dirEntries) == 0 {
+		if err == nil {
+			err = io.EOF
+		}
+		return nil, err
+	}
+
+	entries := make([]Entry, 0, len(dirEntries))
+	for _, de := range dirEntries {
+		info, err := de.Info()
+		if err != nil {
+			return nil, err
+		}
+
+		entry := newEntry(filepath.Join(it.dir.Path, info.Name()), info, 1)
+		entry.fsys = it.dir.fsys
+		entries = append(entries, entry)
+	}
+
+	return entries, nil
+}
+
+// Close releases the iterator
+func (it *DirIterator) Close() error {
+	return it.fd.Close()
+}
+
+// FilesPaged returns at most limit files, excluding symlinks, of the
+// directory, skipping the first offset files. Files are in directory
+// order, which is stable as long as the directory is not modified,
+// so that consecutive pages can be requested without listing the
+// whole directory. An empty Files is returned past the last page.
+func (d *Directory) FilesPaged(offset, limit int) (*Files, error) {
+	files := Files{}
+	if limit <= 0 {
+		return &files, nil
+	}
+
+	it, err := d.Iter(0)
+	if err != nil {
+		return nil, err
+	}
+	defer it.Close()
+
+	for {
+		entries, err := it.Next()
+		if err == io.EOF {
+			return &files, nil
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		for _, e := range entries {
+			if e.Type != FileEntry {
+				continue
+			}
+
+			if offset > 0 {
+				offset--
+				continue
+			}
+
+			files = append(files, e.File())
+			if len(files) == limit {
+				return &files, nil
+			}
+		}
+	}
+}
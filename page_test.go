@@ -0,0 +1,69 @@
+package fs_test
+
+import (
+	"fmt"
+	"io"
+	"testing"
+)
+
+func TestFilesPaged(t *testing.T) {
+	root, clean := tempDir()
+	defer clean()
+
+	tree := map[string]string{"subdir/x": "x"}
+	for i := 0; i < 250; i++ {
+		tree[fmt.Sprintf("f%03d", i)] = "x"
+	}
+	makeTree(t, root, tree)
+
+	d := newDir(t, root)
+	seen := map[string]bool{}
+	for offset := 0; ; offset += 100 {
+		page, err := d.FilesPaged(offset, 100)
+		if err != nil {
+			t.Fatalf("unable to get page at offset %d: %v", offset, err)
+		}
+
+		if len(*page) == 0 {
+			break
+		}
+
+		for _, f := range *page {
+			if seen[f.Path] {
+				t.Errorf("%s: returned in more than one page", f.Path)
+			}
+			seen[f.Path] = true
+		}
+	}
+
+	if len(seen) != 250 {
+		t.Errorf("expected 250 paged files, got %d", len(seen))
+	}
+
+	it, err := d.Iter(64)
+	if err != nil {
+		t.Fatalf("unable to iterate dir: %v", err)
+	}
+	defer it.Close()
+
+	total := 0
+	for {
+		batch, err := it.Next()
+		if err == io.EOF {
+			break
+		}
+
+		if err != nil {
+			t.Fatalf("unable to get batch: %v", err)
+		}
+
+		if len(batch) > 64 {
+			t.Errorf("batch larger than requested: %d", len(batch))
+		}
+		total += len(batch)
+	}
+
+	if total != 251 {
+		t.Errorf("expected 251 entries, got %d", total)
+	}
+}
@@ -0,0 +1,249 @@
+package fs
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ErrNotMounted is the error returned when translating a path
+// below none of the mount points
+var ErrNotMounted = errors.New("path is not below any mount point")
+
+// ErrNotWithin is the error returned when a path is not
+// within the root it is taken relative to
+var ErrNotWithin = errors.New("path is not within root")
+
+// TranslatePath rewrites the path from one view of a storage to
+// another, given the mounts mapping mount points of the path's view to
+// where they are in the other, e.g. "/cvmfs/repo" to the release
+// manager's "/var/spool/cvmfs/repo/rdonly". The deepest mount point
+// containing the path is used. Paths are compared whole components
+// at a time, once cleaned.
+func TranslatePath(path string, mounts map[string]string) (string, error) {
+	var (
+		best   string
+		bestTo string
+		rel    string
+		found  bool
+	)
+
+	for from, to := range mounts {
+		r, ok := relBelow(from, path)
+		if ok && (!found || len(filepath.Clean(from)) > len(best)) {
+			best, bestTo, rel, found = filepath.Clean(from), to, r, true
+		}
+	}
+
+	if !found {
+		return "", fmt.Errorf("%w: %s", ErrNotMounted, path)
+	}
+
+	return filepath.Join(bestTo, rel), nil
+}
+
+// Rebase returns the directory at the same path below newRoot as this
+// directory is below oldRoot, e.g. to go from a directory seen through
+// one mount of a storage to the same directory through another
+func (d *Directory) Rebase(oldRoot, newRoot string) (*Directory, error) {
+	rel, ok := relBelow(oldRoot, d.Path)
+	if !ok {
+		return nil, fmt.Errorf("directory %s is not below %s", d.Path, oldRoot)
+	}
+
+	return &Directory{Path: filepath.Join(newRoot, rel), fsys: d.fsys}, nil
+}
+
+// relBelow returns the path relative to root, if it is root
+// or below it, comparing cleaned paths
+func relBelow(root, path string) (string, bool) {
+	rel, err := filepath.Rel(root, path)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", false
+	}
+
+	return rel, true
+}
+
+// PathDepth returns the number of components path is below root, 0 if
+// they are the same, or -1 if path is not within root. Unlike Depth,
+// it is purely lexical, the paths being cleaned and, if only one is
+// absolute, both made absolute, so it works for paths yet to be created.
+// Files are not told apart, root/a/b.txt being 2 below root.
+func PathDepth(root, path string) int {
+	rel, err := RelTo(root, path)
+	if err != nil {
+		return -1
+	}
+
+	if rel == "." {
+		return 0
+	}
+
+	return len(strings.Split(rel, string(filepath.Separator)))
+}
+
+// RelTo returns path relative to root, lexically as for PathDepth, or
+// an error wrapping ErrNotWithin if path is not within root
+func RelTo(root, path string) (string, error) {
+	if filepath.IsAbs(root) != filepath.IsAbs(path) {
+		var err error
+		if root, err = filepath.Abs(root); err != nil {
+			return "", err
+		}
+
+		if path, err = filepath.Abs(path); err != nil {
+			return "", err
+		}
+	}
+
+	rel, ok := relBelow(root, path)
+	if !ok {
+		return "", fmt.Errorf("%w: %s is not within %s", ErrNotWithin, path, root)
+	}
+
+	return rel, nil
+}
+
+// CommonRoot returns the deepest directory all the paths are within,
+// comparing cleaned paths a component at a time. It is "" if there
+// are no paths, or if they have nothing in common, e.g. relative
+// paths starting differently.
+func CommonRoot(paths ...string) string {
+	if len(paths) == 0 {
+		return ""
+	}
+
+	sep := string(filepath.Separator)
+	common := strings.Split(filepath.Clean(paths[0]), sep)
+	for _, path := range paths[1:] {
+		parts := strings.Split(filepath.Clean(path), sep)
+
+		n := 0
+		for n < len(common) && n < len(parts) && common[n] == parts[n] {
+			n++
+		}
+		common = common[:n]
+	}
+
+	switch {
+	case len(common) == 0:
+		return ""
+	case len(common) == 1 && common[0] == "":
+		// Only the root of absolute paths
+		return sep
+	}
+
+	return strings.Join(common, sep)
+}
+
+// IsWithin reports if path is root, or below it, once both are made
+// absolute and their symlinks and ".." components resolved, as the OS
+// would, so that links or ".." cannot be used to escape root. Missing
+// components, e.g. of paths to be created, are resolved lexically.
+func IsWithin(root, path string) (bool, error) {
+	_, _, ok, err := within(root, path)
+	return ok, err
+}
+
+// within is IsWithin, also returning the resolved root and path
+func within(root, path string) (string, string, bool, error) {
+	root, err := resolvePath(root)
+	if err != nil {
+		return "", "", false, err
+	}
+
+	path, err = resolvePath(path)
+	if err != nil {
+		return "", "", false, err
+	}
+
+	_, ok := relBelow(root, path)
+	return root, path, ok, nil
+}
+
+// maxLinks is the number of symlinks followed resolving
+// a path before giving up, as for a loop
+const maxLinks = 255
+
+// resolvePath returns the absolute path, with its symlinks and ".."
+// components resolved one component at a time. Components below a
+// missing one are resolved lexically.
+func resolvePath(path string) (string, error) {
+	return resolveOn(OSFilesystem{}, path)
+}
+
+// resolveOn is resolvePath on the given file system, which
+// must use OS paths, relative ones being to the current dir
+func resolveOn(sys Filesystem, path string) (string, error) {
+	if !filepath.IsAbs(path) {
+		wd, err := os.Getwd()
+		if err != nil {
+			return "", err
+		}
+
+		// Not Join, which would clean ".." lexically
+		path = wd + string(filepath.Separator) + path
+	}
+
+	vol := filepath.VolumeName(path)
+	resolved := vol + string(filepath.Separator)
+	parts := strings.Split(filepath.ToSlash(path[len(vol):]), "/")
+
+	links, missing := 0, false
+	for len(parts) > 0 {
+		part := parts[0]
+		parts = parts[1:]
+
+		switch part {
+		case "", ".":
+			continue
+		case "..":
+			resolved = filepath.Dir(resolved)
+			continue
+		}
+
+		next := filepath.Join(resolved, part)
+		if missing {
+			resolved = next
+			continue
+		}
+
+		info, err := sys.Lstat(next)
+		if errors.Is(err, os.ErrNotExist) {
+			missing = true
+			resolved = next
+			continue
+		}
+
+		if err != nil {
+			return "", err
+		}
+
+		if info.Mode()&os.ModeSymlink == 0 {
+			resolved = next
+			continue
+		}
+
+		if links++; links > maxLinks {
+			return "", &os.PathError{Op: "resolve", Path: path, Err: errors.New("too many links")}
+		}
+
+		target, err := sys.Readlink(next)
+		if err != nil {
+			return "", err
+		}
+
+		if filepath.IsAbs(target) {
+			vol = filepath.VolumeName(target)
+			resolved = vol + string(filepath.Separator)
+			target = target[len(vol):]
+		}
+
+		parts = append(strings.Split(filepath.ToSlash(target), "/"), parts...)
+	}
+
+	return resolved, nil
+}
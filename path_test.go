@@ -0,0 +1,186 @@
+package fs_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/brinick/fs"
+)
+
+func TestTranslatePath(t *testing.T) {
+	mounts := map[string]string{
+		"/cvmfs/repo.cern.ch":     "/var/spool/cvmfs/repo.cern.ch/rdonly",
+		"/cvmfs/repo.cern.ch/sw/": "/srv/sw",
+		"/":                       "/host",
+	}
+
+	tests := []struct {
+		name    string
+		path    string
+		want    string
+		wantErr error
+	}{
+		{"mount point", "/cvmfs/repo.cern.ch", "/var/spool/cvmfs/repo.cern.ch/rdonly", nil},
+		{"below mount", "/cvmfs/repo.cern.ch/x86_64/lib", "/var/spool/cvmfs/repo.cern.ch/rdonly/x86_64/lib", nil},
+		{"deepest mount", "/cvmfs/repo.cern.ch/sw/gcc/", "/srv/sw/gcc", nil},
+		{"whole components", "/cvmfs/repo.cern.ch.bak/x", "/host/cvmfs/repo.cern.ch.bak/x", nil},
+		{"root mount", "/etc/cvmfs", "/host/etc/cvmfs", nil},
+		{"not mounted", "relative/path", "", fs.ErrNotMounted},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := fs.TranslatePath(tt.path, mounts)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("expected error %v, got %v", tt.wantErr, err)
+			}
+
+			if got != tt.want {
+				t.Errorf("expected %q, got %q", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestDirectoryRebase(t *testing.T) {
+	d := fs.NewDirOn(nil, "/cvmfs/repo.cern.ch/sw/gcc")
+
+	rebased, err := d.Rebase("/cvmfs/repo.cern.ch", "/var/spool/cvmfs/repo.cern.ch/rdonly")
+	if err != nil {
+		t.Fatalf("unable to rebase: %v", err)
+	}
+
+	if rebased.Path != "/var/spool/cvmfs/repo.cern.ch/rdonly/sw/gcc" {
+		t.Errorf("unexpected rebased path %s", rebased.Path)
+	}
+
+	if _, err := d.Rebase("/cvmfs/other.cern.ch", "/tmp"); err == nil {
+		t.Errorf("expected error rebasing from a root the directory is not below")
+	}
+
+	rebased, err = fs.NewDirOn(nil, "sw/gcc").Rebase(".", "/opt")
+	if err != nil || rebased.Path != "/opt/sw/gcc" {
+		t.Errorf("expected the directory rebased from the current dir, got %v (%v)", rebased, err)
+	}
+}
+
+func TestIsWithin(t *testing.T) {
+	root, clean := tempDir()
+	defer clean()
+
+	makeTree(t, root, map[string]string{"area/sub/a": "a", "outside/b": "b"})
+	area := filepath.Join(root, "area")
+	for link, target := range map[string]string{
+		"area/escape":   "../outside",
+		"area/abs":      filepath.Join(root, "outside"),
+		"area/internal": "sub",
+		"area/loop":     "loop",
+	} {
+		if err := os.Symlink(target, filepath.Join(root, link)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name   string
+		path   string
+		within bool
+		err    bool
+	}{
+		{"root", area, true, false},
+		{"file", filepath.Join(area, "sub", "a"), true, false},
+		{"missing", filepath.Join(area, "new", "file"), true, false},
+		{"dotdot", filepath.Join(area, "sub") + "/../../outside/b", false, false},
+		{"dotdot inside", area + "/sub/../sub/a", true, false},
+		{"prefix", area + "2", false, false},
+		{"relative link out", filepath.Join(area, "escape", "b"), false, false},
+		{"absolute link out", filepath.Join(area, "abs", "new"), false, false},
+		{"link in", filepath.Join(area, "internal", "a"), true, false},
+		{"dotdot through link", area + "/internal/../sub/a", true, false},
+		{"dotdot after link out", area + "/escape/../area/sub", true, false},
+		{"loop", filepath.Join(area, "loop", "x"), false, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ok, err := fs.IsWithin(area, tt.path)
+			if (err != nil) != tt.err {
+				t.Fatalf("expected error %v, got %v", tt.err, err)
+			}
+
+			if ok != tt.within {
+				t.Errorf("expected within %v, got %v", tt.within, ok)
+			}
+		})
+	}
+
+	if depth, err := fs.Depth(area, filepath.Join(area, "escape", "b")); err != nil || depth != -1 {
+		t.Errorf("expected depth -1 for a path escaping through a link, got %d (%v)", depth, err)
+	}
+}
+
+func TestPathDepth(t *testing.T) {
+	tests := []struct {
+		name  string
+		root  string
+		path  string
+		depth int
+		rel   string
+	}{
+		{"same", "/sw/release", "/sw/release/", 0, "."},
+		{"planned file", "/sw/release", "/sw/release/22.0/x86_64/setup.sh", 3, "22.0/x86_64/setup.sh"},
+		{"prefix", "/sw/release", "/sw/releases/22.0", -1, ""},
+		{"outside", "/sw/release", "/sw/release/../other", -1, ""},
+		{"relative", "release", "release/22.0", 1, "22.0"},
+		{"current dir", ".", "release/22.0", 2, "release/22.0"},
+		{"current dir itself", ".", "./", 0, "."},
+		{"above current dir", ".", "../release", -1, ""},
+		{"dotted name", "/sw", "/sw/..release", 1, "..release"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if depth := fs.PathDepth(tt.root, tt.path); depth != tt.depth {
+				t.Errorf("expected depth %d, got %d", tt.depth, depth)
+			}
+
+			rel, err := fs.RelTo(tt.root, tt.path)
+			if tt.depth < 0 {
+				if !errors.Is(err, fs.ErrNotWithin) {
+					t.Errorf("expected ErrNotWithin, got %v", err)
+				}
+				return
+			}
+
+			if err != nil || rel != tt.rel {
+				t.Errorf("expected %s relative to root, got %s (%v)", tt.rel, rel, err)
+			}
+		})
+	}
+}
+
+func TestCommonRoot(t *testing.T) {
+	tests := []struct {
+		name   string
+		paths  []string
+		expect string
+	}{
+		{"none", nil, ""},
+		{"single", []string{"/sw/release/"}, "/sw/release"},
+		{"shared", []string{"/sw/release/22.0/a", "/sw/release/22.1", "/sw/release/22.0/b"}, "/sw/release"},
+		{"component prefix", []string{"/sw/release", "/sw/releases"}, "/sw"},
+		{"only root", []string{"/sw", "/opt"}, "/"},
+		{"relative", []string{"a/b/c", "a/b/d"}, "a/b"},
+		{"unrelated", []string{"a/b", "c/d"}, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := fs.CommonRoot(tt.paths...); got != tt.expect {
+				t.Errorf("expected %q, got %q", tt.expect, got)
+			}
+		})
+	}
+}
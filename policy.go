@@ -0,0 +1,135 @@
+package fs
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// ModePolicy is the site convention for the files and directories
+// created by the package. Its modes are those of what is created
+// without one, modes passed by callers being kept, while its group
+// and setgid conventions apply to all the directories it creates, and
+// to the files created with Create, CreateWithPerm and CreateWithParents.
+type ModePolicy struct {
+	// FileMode is the mode of the files created without one,
+	// 0666 less the umask if 0
+	FileMode os.FileMode
+
+	// DirMode is the mode of the parent directories created
+	// on demand, 0755 if 0
+	DirMode os.FileMode
+
+	// Group is the gid given to the files and directories
+	// created, if ForceGroup is set
+	Group      int
+	ForceGroup bool
+
+	// SetgidDirs sets the setgid bit of the directories created,
+	// so that what is created in them inherits their group
+	SetgidDirs bool
+}
+
+// modePolicy is the policy set with SetModePolicy
+var modePolicy struct {
+	mu sync.Mutex
+	p  ModePolicy
+}
+
+// SetModePolicy sets the policy followed when creating files, with
+// Create, CreateWithPerm and CreateWithParents, and directories, with
+// Directory.Create, Workspace.Mkdir, Scaffold, Extract, Sync and when
+// copying trees, and when creating missing parents, e.g. with the
+// EnsureDir option. Nil resets it to the default, which has no group
+// and setgid conventions. Groups are only set on the OS file system.
+func SetModePolicy(p *ModePolicy) {
+	modePolicy.mu.Lock()
+	defer modePolicy.mu.Unlock()
+
+	modePolicy.p = ModePolicy{}
+	if p != nil {
+		modePolicy.p = *p
+	}
+}
+
+// policy returns the current mode policy
+func policy() ModePolicy {
+	modePolicy.mu.Lock()
+	defer modePolicy.mu.Unlock()
+
+	return modePolicy.p
+}
+
+// dirPerm returns perm, else the policy mode of
+// directories created on demand
+func dirPerm(perm os.FileMode) os.FileMode {
+	if perm != 0 {
+		return perm
+	}
+
+	if p := policy(); p.DirMode != 0 {
+		return p.DirMode
+	}
+
+	return defaultDirPerm
+}
+
+// mkdirAll creates the directory path, and its missing parents, on
+// sys with the given mode, then applies the mode policy to those created
+func mkdirAll(sys Filesystem, path string, perm os.FileMode) error {
+	p := policy()
+	if !p.ForceGroup && !p.SetgidDirs {
+		return sys.MkdirAll(path, perm)
+	}
+
+	var created []string
+	for dir := filepath.Clean(path); ; dir = filepath.Dir(dir) {
+		if _, err := sys.Lstat(dir); err == nil {
+			break
+		} else if !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+
+		created = append(created, dir)
+		if filepath.Dir(dir) == dir {
+			break
+		}
+	}
+
+	if err := sys.MkdirAll(path, perm); err != nil {
+		return err
+	}
+
+	// Parents first, for their group to be inherited
+	for i := len(created) - 1; i >= 0; i-- {
+		if err := applyPolicy(sys, created[i], p); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// applyPolicy gives the file or directory at path, just
+// created on sys, the group and setgid bit of the policy
+func applyPolicy(sys Filesystem, path string, p ModePolicy) error {
+	if p.ForceGroup {
+		if _, ok := sys.(OSFilesystem); ok {
+			if err := os.Lchown(path, -1, p.Group); err != nil {
+				return err
+			}
+		}
+	}
+
+	if !p.SetgidDirs {
+		return nil
+	}
+
+	info, err := sys.Lstat(path)
+	if err != nil || !info.IsDir() {
+		return err
+	}
+
+	return sys.Chmod(path, info.Mode().Perm()|os.ModeSetgid)
+}
@@ -0,0 +1,154 @@
+package fs_test
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/brinick/fs"
+)
+
+func TestModePolicy(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("modes are not supported on windows")
+	}
+
+	root, clean := tempDir()
+	defer clean()
+
+	policy := &fs.ModePolicy{FileMode: 0600, DirMode: 0750, SetgidDirs: true}
+	if os.Geteuid() == 0 {
+		policy.Group, policy.ForceGroup = 2, true
+	}
+
+	fs.SetModePolicy(policy)
+	defer fs.SetModePolicy(nil)
+
+	f := fs.NewFile(filepath.Join(root, "a", "b", "file"))
+	if err := f.Write([]byte("x"), fs.EnsureDir(0)); err != nil {
+		t.Fatalf("unable to write: %v", err)
+	}
+
+	explicit := fs.NewFile(filepath.Join(root, "a", "explicit"))
+	if err := explicit.CreateWithPerm(0640); err != nil {
+		t.Fatalf("unable to create: %v", err)
+	}
+
+	tests := []struct {
+		path string
+		mode os.FileMode
+	}{
+		{"a", os.ModeDir | os.ModeSetgid | 0750},
+		{"a/b", os.ModeDir | os.ModeSetgid | 0750},
+		{"a/b/file", 0600},
+		{"a/explicit", 0640},
+	}
+
+	for _, tt := range tests {
+		path := filepath.Join(root, tt.path)
+		info, err := os.Stat(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if info.Mode() != tt.mode {
+			t.Errorf("%s: expected mode %v, got %v", tt.path, tt.mode, info.Mode())
+		}
+
+		if !policy.ForceGroup {
+			continue
+		}
+
+		group, err := fs.NewFile(path).Group()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if group.Gid != "2" {
+			t.Errorf("%s: expected group 2, got %s", tt.path, group.Gid)
+		}
+	}
+
+	// Explicit modes are kept
+	dir, _ := fs.NewDir(root, "c")
+	if err := dir.Create(0700); err != nil {
+		t.Fatal(err)
+	}
+	if info, _ := os.Stat(dir.Path); info.Mode().Perm() != 0700 {
+		t.Errorf("expected the explicit dir mode kept, got %v", info.Mode())
+	}
+}
+
+func TestModePolicyCreators(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("modes are not supported on windows")
+	}
+
+	root, clean := tempDir()
+	defer clean()
+
+	src := filepath.Join(root, "src")
+	makeTree(t, src, map[string]string{"sub/a": "a"})
+
+	archive := filepath.Join(root, "src.tar")
+	if err := fs.CreateArchive(src, archive, fs.ArchiveOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	fs.SetModePolicy(&fs.ModePolicy{SetgidDirs: true})
+	defer fs.SetModePolicy(nil)
+
+	w := fs.NewWorkspace()
+	defer w.Close()
+
+	if _, err := w.Mkdir(filepath.Join(root, "workspace", "dir"), 0750); err != nil {
+		t.Fatalf("unable to create the workspace dir: %v", err)
+	}
+
+	spec := fs.ScaffoldSpec{Entries: []fs.ScaffoldEntry{{Path: "dir/", Mode: 0700}}}
+	if err := fs.Scaffold(filepath.Join(root, "scaffold"), spec); err != nil {
+		t.Fatalf("unable to scaffold: %v", err)
+	}
+
+	if _, err := fs.Sync(src, filepath.Join(root, "synced"), fs.SyncOptions{}); err != nil {
+		t.Fatalf("unable to sync: %v", err)
+	}
+
+	if err := fs.Extract(archive, filepath.Join(root, "extracted"), fs.ExtractOptions{}); err != nil {
+		t.Fatalf("unable to extract: %v", err)
+	}
+
+	dir, _ := fs.NewDir(src)
+	if err := dir.CopyTo(filepath.Join(root, "copied")); err != nil {
+		t.Fatalf("unable to copy: %v", err)
+	}
+
+	// Explicit modes are kept, with the setgid bit
+	tests := []struct {
+		path string
+		perm os.FileMode
+	}{
+		{"workspace", 0750},
+		{"workspace/dir", 0750},
+		{"scaffold", 0755},
+		{"scaffold/dir", 0700},
+		{"synced/sub", 0},
+		{"extracted/sub", 0},
+		{"copied/sub", 0},
+	}
+
+	for _, tt := range tests {
+		info, err := os.Stat(filepath.Join(root, tt.path))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if info.Mode()&os.ModeSetgid == 0 {
+			t.Errorf("%s: expected the setgid bit, got %v", tt.path, info.Mode())
+		}
+
+		if tt.perm != 0 && info.Mode().Perm() != tt.perm {
+			t.Errorf("%s: expected mode %v, got %v", tt.path, tt.perm, info.Mode().Perm())
+		}
+	}
+}
@@ -0,0 +1,136 @@
+package fs
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// Preserve lists the attributes of the source that a copy gives the
+// destination, in addition to the mode permissions which it always does
+type Preserve int
+
+const (
+	// PreserveTimes preserves the modification and access times
+	PreserveTimes Preserve = 1 << iota
+
+	// PreserveOwner preserves the owning uid and gid, when running
+	// as root and copying between OS file systems
+	PreserveOwner
+
+	// PreserveXattrs preserves the extended attributes, where the
+	// platform and file systems support them
+	PreserveXattrs
+
+	// PreserveAll preserves all of the above
+	PreserveAll = PreserveTimes | PreserveOwner | PreserveXattrs
+)
+
+// WithPreserve makes a copy preserve the given attributes of the
+// copied files and, for directory copies, of the directories
+func WithPreserve(p Preserve) CopyOption {
+	return func(c *copyConfig) {
+		c.preserve |= p
+	}
+}
+
+// OwnerMap maps the uids and gids owning copied source entries to
+// those given to their copies, e.g. from a build account to that
+// owning a repository. Ids not in the maps are left as they would be.
+type OwnerMap struct {
+	UIDs map[int]int
+	GIDs map[int]int
+}
+
+// WithOwnerMap makes a copy between OS file systems give the copied
+// entries the owners the map gives those of the source entries. Used
+// with PreserveOwner, unmapped ids are preserved. Changing owners
+// usually requires running as root.
+func WithOwnerMap(m OwnerMap) CopyOption {
+	return func(c *copyConfig) {
+		c.owners = &m
+	}
+}
+
+// owner returns the uid and gid to give the copy of the entry of
+// info, -1 for those to leave as they are, or false if neither changes
+func (c *copyConfig) owner(info os.FileInfo) (int, int, bool) {
+	uid, gid, ok := infoOwner(info)
+	if !ok {
+		return -1, -1, false
+	}
+
+	newUID, newGID := -1, -1
+	if c.preserve&PreserveOwner != 0 && os.Geteuid() == 0 {
+		newUID, newGID = uid, gid
+	}
+
+	if c.owners != nil {
+		if to, ok := c.owners.UIDs[uid]; ok {
+			newUID = to
+		}
+
+		if to, ok := c.owners.GIDs[gid]; ok {
+			newGID = to
+		}
+	}
+
+	return newUID, newGID, newUID != -1 || newGID != -1
+}
+
+// chown gives the OS path dst the owner selected for the copy of
+// the entry of info, restoring any setuid and setgid bits cleared
+func (c *copyConfig) chown(info os.FileInfo, dst string) error {
+	uid, gid, ok := c.owner(info)
+	if !ok {
+		return nil
+	}
+
+	if err := os.Lchown(dst, uid, gid); err != nil {
+		return err
+	}
+
+	if info.Mode()&(os.ModeSetuid|os.ModeSetgid) != 0 {
+		return OSFilesystem{}.Chmod(dst, info.Mode())
+	}
+
+	return nil
+}
+
+// preserveAttrs gives dst the attributes of src, of info, selected
+// by the copy config
+func preserveAttrs(srcSys Filesystem, src string, info os.FileInfo, dstSys Filesystem, dst string, cfg *copyConfig) error {
+	if cfg.preserve == 0 && cfg.owners == nil {
+		return nil
+	}
+
+	_, srcOS := srcSys.(OSFilesystem)
+	_, dstOS := dstSys.(OSFilesystem)
+	native := srcOS && dstOS
+
+	// Extended attributes are dropped where unsupported
+	if cfg.preserve&PreserveXattrs != 0 && native && cfg.destCapabilities(filepath.Dir(dst)).Has(CapXattr) {
+		if err := copyXattrs(src, dst); err != nil {
+			return fmt.Errorf("unable to copy extended attributes of %s (%w)", src, err)
+		}
+	}
+
+	if native {
+		if err := cfg.chown(info, dst); err != nil {
+			return err
+		}
+	}
+
+	if cfg.preserve&PreserveTimes != 0 {
+		atime, ok := infoAtime(info)
+		if !ok {
+			atime = info.ModTime()
+		}
+
+		if err := dstSys.Chtimes(dst, atime, info.ModTime()); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,112 @@
+//go:build linux
+
+package fs
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"syscall"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// infoAtime returns the access time from the file info, if available
+func infoAtime(info os.FileInfo) (time.Time, bool) {
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return time.Time{}, false
+	}
+
+	return time.Unix(st.Atim.Sec, st.Atim.Nsec), true
+}
+
+// copyXattrs copies the extended attributes of src to dst. It is not
+// an error if the source file system does not support them.
+func copyXattrs(src, dst string) error {
+	attrs, err := readXattrs(src)
+	if err != nil {
+		return err
+	}
+
+	for name, value := range attrs {
+		if err := writeXattr(dst, name, value); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// readXattrs returns the extended attributes of path, not following
+// symlinks, none if its file system does not support them
+func readXattrs(path string) (map[string][]byte, error) {
+	names, err := xattrGet(func(buf []byte) (int, error) {
+		return unix.Llistxattr(path, buf)
+	})
+	if errors.Is(err, unix.ENOTSUP) {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	attrs := map[string][]byte{}
+	for _, name := range bytes.Split(names, []byte{0}) {
+		if len(name) == 0 {
+			continue
+		}
+
+		attr := string(name)
+		value, err := xattrGet(func(buf []byte) (int, error) {
+			return unix.Lgetxattr(path, attr, buf)
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		attrs[attr] = value
+	}
+
+	return attrs, nil
+}
+
+// writeXattr sets the extended attribute of path, not following symlinks
+func writeXattr(path, name string, value []byte) error {
+	if err := unix.Lsetxattr(path, name, value, 0); err != nil {
+		return &os.PathError{Op: "setxattr " + name, Path: path, Err: err}
+	}
+
+	return nil
+}
+
+// xattrGet calls get, which is an xattr syscall, first for the size
+// of the data, then to fill a buffer of that size, retrying if the
+// data grew in between
+func xattrGet(get func([]byte) (int, error)) ([]byte, error) {
+	for {
+		size, err := get(nil)
+		if err != nil || size == 0 {
+			return nil, err
+		}
+
+		buf := make([]byte, size)
+		n, err := get(buf)
+		if errors.Is(err, unix.ERANGE) {
+			continue
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		return buf[:n], nil
+	}
+}
+
+// probeXattr checks if a user extended attribute can be set on path
+func probeXattr(path string) bool {
+	return unix.Lsetxattr(path, "user.fs.probe", []byte{1}, 0) == nil
+}
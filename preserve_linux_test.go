@@ -0,0 +1,237 @@
+//go:build linux
+
+package fs_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/brinick/fs"
+	"golang.org/x/sys/unix"
+)
+
+func TestCopyPreserve(t *testing.T) {
+	root := newTree(t, map[string]int{"a": 10, "sub/b": 20})
+	src := filepath.Join(root, "src")
+
+	mtime := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	atime := mtime.Add(time.Hour)
+	for _, name := range []string{"a", "sub/b", "sub", "."} {
+		if err := os.Chtimes(filepath.Join(src, name), atime, mtime); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	xattrs := true
+	err := unix.Lsetxattr(filepath.Join(src, "a"), "user.origin", []byte("nightly"), 0)
+	if errors.Is(err, unix.ENOTSUP) {
+		xattrs = false
+	} else if err != nil {
+		t.Fatal(err)
+	}
+
+	root0 := os.Geteuid() == 0
+	if root0 {
+		if err := os.Lchown(filepath.Join(src, "sub", "b"), 1234, 4321); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	d, _ := fs.NewDir(src)
+	dst := filepath.Join(root, "dst")
+	if err := d.CopyTo(dst, fs.WithPreserve(fs.PreserveAll)); err != nil {
+		t.Fatalf("unable to copy: %v", err)
+	}
+
+	for _, name := range []string{"a", "sub/b", "sub", "."} {
+		info, err := os.Stat(filepath.Join(dst, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !info.ModTime().Equal(mtime) {
+			t.Errorf("%s: expected mtime %v, got %v", name, mtime, info.ModTime())
+		}
+
+		st := info.Sys().(*syscall.Stat_t)
+		if got := time.Unix(st.Atim.Sec, st.Atim.Nsec); !got.Equal(atime) {
+			t.Errorf("%s: expected atime %v, got %v", name, atime, got)
+		}
+	}
+
+	if xattrs {
+		buf := make([]byte, 64)
+		n, err := unix.Lgetxattr(filepath.Join(dst, "a"), "user.origin", buf)
+		if err != nil || string(buf[:n]) != "nightly" {
+			t.Errorf("expected xattr copied, got %q (%v)", buf[:n], err)
+		}
+	}
+
+	if root0 {
+		info, _ := os.Lstat(filepath.Join(dst, "sub", "b"))
+		if st := info.Sys().(*syscall.Stat_t); st.Uid != 1234 || st.Gid != 4321 {
+			t.Errorf("expected owner 1234:4321, got %d:%d", st.Uid, st.Gid)
+		}
+	}
+
+	// Without the option, the copy is new
+	if err := fs.CopyFile(filepath.Join(src, "a"), root); err != nil {
+		t.Fatal(err)
+	}
+
+	if info, _ := os.Stat(filepath.Join(root, "a")); info.ModTime().Equal(mtime) {
+		t.Errorf("expected mtime not preserved by default")
+	}
+}
+
+func TestCopyOwnerMap(t *testing.T) {
+	if os.Geteuid() != 0 {
+		t.Skip("changing owners requires root")
+	}
+
+	root := newTree(t, map[string]int{"a": 10, "sub/b": 20, "c": 5})
+	src := filepath.Join(root, "src")
+
+	for name, id := range map[string]int{"a": 1000, "sub/b": 1000, "sub": 1000, "c": 2000} {
+		if err := os.Lchown(filepath.Join(src, name), id, id); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	owners := fs.OwnerMap{UIDs: map[int]int{1000: 500}, GIDs: map[int]int{1000: 600}}
+	tests := []struct {
+		name string
+		copy func(dst string) error
+		want map[string][2]uint32
+	}{
+		{"copy", func(dst string) error {
+			d, _ := fs.NewDir(src)
+			return d.CopyTo(dst, fs.WithOwnerMap(owners))
+		}, map[string][2]uint32{"a": {500, 600}, "sub/b": {500, 600}, "sub": {500, 600}, "c": {0, 0}}},
+		{"copy preserving", func(dst string) error {
+			d, _ := fs.NewDir(src)
+			return d.CopyTo(dst, fs.WithOwnerMap(owners), fs.WithPreserve(fs.PreserveOwner))
+		}, map[string][2]uint32{"a": {500, 600}, "sub": {500, 600}, "c": {2000, 2000}}},
+		{"sync", func(dst string) error {
+			_, err := fs.Sync(src, dst, fs.SyncOptions{}, fs.WithOwnerMap(owners))
+			return err
+		}, map[string][2]uint32{"a": {500, 600}, "sub/b": {500, 600}, "sub": {500, 600}, "c": {0, 0}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dst := filepath.Join(root, tt.name)
+			if err := tt.copy(dst); err != nil {
+				t.Fatalf("unable to copy: %v", err)
+			}
+
+			for name, want := range tt.want {
+				info, err := os.Lstat(filepath.Join(dst, name))
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if st := info.Sys().(*syscall.Stat_t); st.Uid != want[0] || st.Gid != want[1] {
+					t.Errorf("%s: expected owner %d:%d, got %d:%d", name, want[0], want[1], st.Uid, st.Gid)
+				}
+			}
+		})
+	}
+}
+
+func TestArchivePreserve(t *testing.T) {
+	root := newTree(t, map[string]int{"a": 10, "sub/b": 20})
+	src := filepath.Join(root, "src")
+
+	mtime := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	for _, name := range []string{"a", "sub/b", "sub"} {
+		if err := os.Chtimes(filepath.Join(src, name), mtime, mtime); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	xattrs := true
+	err := unix.Lsetxattr(filepath.Join(src, "a"), "user.origin", []byte("nightly"), 0)
+	if errors.Is(err, unix.ENOTSUP) {
+		xattrs = false
+	} else if err != nil {
+		t.Fatal(err)
+	}
+
+	root0 := os.Geteuid() == 0
+	if root0 {
+		if err := os.Lchown(filepath.Join(src, "sub", "b"), 1234, 4321); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := os.Chmod(filepath.Join(src, "sub", "b"), 0755|os.ModeSetgid); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	archive := filepath.Join(root, "src.tar.gz")
+	if err := fs.CreateArchive(src, archive, fs.ArchiveOptions{Xattrs: true}); err != nil {
+		t.Fatalf("unable to archive: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		preserve fs.Preserve
+	}{
+		{"preserved", fs.PreserveAll},
+		{"not preserved", 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dst := filepath.Join(root, tt.name)
+			opts := fs.ExtractOptions{Preserve: tt.preserve, StrictPreserve: root0}
+			if err := fs.Extract(archive, dst, opts); err != nil {
+				t.Fatalf("unable to extract: %v", err)
+			}
+
+			preserved := tt.preserve != 0
+			for _, name := range []string{"a", "sub/b", "sub"} {
+				info, err := os.Stat(filepath.Join(dst, name))
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if info.ModTime().Equal(mtime) != preserved {
+					t.Errorf("%s: expected mtime preserved %v, got %v", name, preserved, info.ModTime())
+				}
+			}
+
+			if xattrs {
+				buf := make([]byte, 64)
+				n, err := unix.Lgetxattr(filepath.Join(dst, "a"), "user.origin", buf)
+				if got := err == nil && string(buf[:n]) == "nightly"; got != preserved {
+					t.Errorf("expected xattr restored %v, got %q (%v)", preserved, buf[:n], err)
+				}
+			}
+
+			if root0 {
+				info, _ := os.Lstat(filepath.Join(dst, "sub", "b"))
+				st := info.Sys().(*syscall.Stat_t)
+				if got := st.Uid == 1234 && st.Gid == 4321; got != preserved {
+					t.Errorf("expected owner restored %v, got %d:%d", preserved, st.Uid, st.Gid)
+				}
+
+				if preserved && info.Mode()&os.ModeSetgid == 0 {
+					t.Errorf("expected the setgid bit restored, got %v", info.Mode())
+				}
+			}
+		})
+	}
+
+	if !root0 {
+		opts := fs.ExtractOptions{Preserve: fs.PreserveOwner, StrictPreserve: true}
+		if err := fs.Extract(archive, filepath.Join(root, "strict"), opts); !errors.Is(err, fs.ErrNotPrivileged) {
+			t.Errorf("expected ErrNotPrivileged, got %v", err)
+		}
+	}
+}
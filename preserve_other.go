@@ -0,0 +1,33 @@
+//go:build !linux
+
+package fs
+
+import (
+	"os"
+	"time"
+)
+
+// infoAtime returns the access time from the file info, if available
+func infoAtime(info os.FileInfo) (time.Time, bool) {
+	return time.Time{}, false
+}
+
+// copyXattrs does nothing, extended attributes not being supported
+func copyXattrs(src, dst string) error {
+	return nil
+}
+
+// readXattrs returns no extended attributes, those not being supported
+func readXattrs(path string) (map[string][]byte, error) {
+	return nil, nil
+}
+
+// writeXattr does nothing, extended attributes not being supported
+func writeXattr(path, name string, value []byte) error {
+	return nil
+}
+
+// probeXattr returns false, extended attributes not being supported
+func probeXattr(path string) bool {
+	return false
+}
@@ -0,0 +1,136 @@
+package fs
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// ChangeSet lists the changes made below a recorded directory
+// between two snapshots of its tree
+type ChangeSet struct {
+	From time.Time
+	To   time.Time
+
+	// Changes are the created, written, removed and chmod-ed paths,
+	// ordered by path
+	Changes []Event
+}
+
+// ChangeSink receives the change sets of a ChangeRecorder
+type ChangeSink func(ChangeSet) error
+
+// RecordOptions configures Directory.RecordChanges
+type RecordOptions struct {
+	// Interval, if > 0, is the time between the snapshots emitting
+	// the changes made since the previous one, before the final one
+	Interval time.Duration
+
+	// Hash also compares file content hashes, to catch changes
+	// leaving size and modification time as they were
+	Hash bool
+}
+
+// ChangeRecorder records the changes made below a directory,
+// as returned by Directory.RecordChanges
+type ChangeRecorder struct {
+	root string
+	opts RecordOptions
+	sink ChangeSink
+
+	prev  map[string]fileState
+	since time.Time
+	err   error
+
+	stop chan struct{}
+	done chan struct{}
+	once sync.Once
+}
+
+// RecordChanges snapshots the directory tree, and returns a recorder
+// which, once stopped, or ctx done, snapshots the tree again and sends
+// the changes made in between to sink. If opts.Interval is set, the
+// changes are also sent periodically, each change set then covering
+// the time since the previous one. Periodic sets with no changes are
+// not sent, the final one always is. It is meant to be wrapped around
+// tools whose effects on the tree must be audited.
+func (d *Directory) RecordChanges(ctx context.Context, sink ChangeSink, opts RecordOptions) (*ChangeRecorder, error) {
+	since := time.Now()
+	state, err := snapshotTree(d.Path, opts.Hash)
+	if err != nil {
+		return nil, err
+	}
+
+	r := &ChangeRecorder{
+		root:  d.Path,
+		opts:  opts,
+		sink:  sink,
+		prev:  state,
+		since: since,
+		stop:  make(chan struct{}),
+		done:  make(chan struct{}),
+	}
+
+	go r.run(ctx)
+	return r, nil
+}
+
+// Stop takes the final snapshot and sends its changes to the sink.
+// It returns the first error taking a snapshot or from the sink.
+func (r *ChangeRecorder) Stop() error {
+	r.once.Do(func() { close(r.stop) })
+	<-r.done
+	return r.err
+}
+
+func (r *ChangeRecorder) run(ctx context.Context) {
+	defer close(r.done)
+
+	var tick <-chan time.Time
+	if r.opts.Interval > 0 {
+		ticker := time.NewTicker(r.opts.Interval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+
+	for {
+		select {
+		case <-tick:
+			r.record(false)
+		case <-r.stop:
+			r.record(true)
+			return
+		case <-ctx.Done():
+			r.record(true)
+			return
+		}
+	}
+}
+
+// record snapshots the tree and sends the changes since the previous
+// snapshot, if any or if final, keeping the first error
+func (r *ChangeRecorder) record(final bool) {
+	now := time.Now()
+	curr, err := snapshotTree(r.root, r.opts.Hash)
+	if err != nil {
+		r.setErr(err)
+		return
+	}
+
+	changes := diffStates(r.prev, curr)
+	r.prev = curr
+
+	if len(changes) == 0 && !final {
+		return
+	}
+
+	set := ChangeSet{From: r.since, To: now, Changes: changes}
+	r.since = now
+	r.setErr(r.sink(set))
+}
+
+func (r *ChangeRecorder) setErr(err error) {
+	if r.err == nil {
+		r.err = err
+	}
+}
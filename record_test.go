@@ -0,0 +1,107 @@
+package fs_test
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/brinick/fs"
+)
+
+func TestRecordChanges(t *testing.T) {
+	root, clean := tempDir()
+	defer clean()
+
+	keep := filepath.Join(root, "keep")
+	gone := filepath.Join(root, "gone")
+	edit := filepath.Join(root, "edit")
+	for _, path := range []string{keep, gone, edit} {
+		if err := ioutil.WriteFile(path, []byte("v1"), 0644); err != nil {
+			t.Fatalf("unable to write %s: %v", path, err)
+		}
+	}
+
+	var sets []fs.ChangeSet
+	rec, err := fs.NewDirOn(nil, root).RecordChanges(context.Background(), func(cs fs.ChangeSet) error {
+		sets = append(sets, cs)
+		return nil
+	}, fs.RecordOptions{Hash: true})
+	if err != nil {
+		t.Fatalf("unable to record changes: %v", err)
+	}
+
+	os.Remove(gone)
+	ioutil.WriteFile(edit, []byte("v2"), 0644)
+	ioutil.WriteFile(filepath.Join(root, "new"), nil, 0644)
+	os.Chmod(keep, 0600)
+
+	if err := rec.Stop(); err != nil {
+		t.Fatalf("unable to stop recording: %v", err)
+	}
+
+	if len(sets) != 1 {
+		t.Fatalf("expected a single change set, got %d", len(sets))
+	}
+
+	want := []fs.Event{
+		{Path: edit, Op: fs.OpWrite},
+		{Path: gone, Op: fs.OpRemove},
+		{Path: keep, Op: fs.OpChmod},
+		{Path: filepath.Join(root, "new"), Op: fs.OpCreate},
+	}
+
+	got := sets[0].Changes
+	if len(got) != len(want) {
+		t.Fatalf("expected changes %v, got %v", want, got)
+	}
+
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("expected change %v, got %v", want[i], got[i])
+		}
+	}
+}
+
+func TestRecordChangesPeriodic(t *testing.T) {
+	root, clean := tempDir()
+	defer clean()
+
+	var (
+		mu   sync.Mutex
+		sets []fs.ChangeSet
+	)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	rec, err := fs.NewDirOn(nil, root).RecordChanges(ctx, func(cs fs.ChangeSet) error {
+		mu.Lock()
+		defer mu.Unlock()
+		sets = append(sets, cs)
+		return nil
+	}, fs.RecordOptions{Interval: 10 * time.Millisecond})
+	if err != nil {
+		t.Fatalf("unable to record changes: %v", err)
+	}
+
+	ioutil.WriteFile(filepath.Join(root, "a"), nil, 0644)
+	time.Sleep(50 * time.Millisecond)
+
+	cancel()
+	if err := rec.Stop(); err != nil {
+		t.Fatalf("unable to stop recording: %v", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	if len(sets) != 2 || len(sets[0].Changes) != 1 || len(sets[1].Changes) != 0 {
+		t.Fatalf("expected a periodic and an empty final change set, got %+v", sets)
+	}
+
+	if !sets[1].From.Equal(sets[0].To) {
+		t.Errorf("expected consecutive change sets")
+	}
+}
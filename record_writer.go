@@ -0,0 +1,96 @@
+package fs
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+)
+
+// MaxRecordSize is the largest record a MultiWriterFile writes. Appends
+// of at most this many bytes, PIPE_BUF on Linux, are written whole by a
+// single write, so they are not interleaved with those of other writers.
+const MaxRecordSize = 4096
+
+// ErrRecordTooLarge is the error returned when writing a record
+// of more than MaxRecordSize bytes
+var ErrRecordTooLarge = errors.New("record too large to be appended atomically")
+
+// MultiWriterFile appends records to a file shared with other writers,
+// threads or processes, such that records are never interleaved: each
+// is appended by a single write to the file opened with O_APPEND. It
+// suits shared logs and state journals on local file systems; NFS does
+// not honour O_APPEND across hosts. It is safe for concurrent use.
+type MultiWriterFile struct {
+	path string
+	fd   FileHandle
+	mu   sync.Mutex
+}
+
+// OpenMultiWriter opens the file for record appends, creating it with
+// mode 0644 if it does not exist, and its parent dirs if EnsureDir is given
+func (f *File) OpenMultiWriter(opts ...WriteOption) (*MultiWriterFile, error) {
+	if err := f.prepare(opts, false); err != nil {
+		return nil, err
+	}
+
+	fd, err := f.sys().OpenFile(f.Path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("unable to open %s for appending (%w)", f.Path, err)
+	}
+
+	return &MultiWriterFile{path: f.Path, fd: fd}, nil
+}
+
+// WriteRecord appends the record with a single write. Records of more
+// than MaxRecordSize bytes are refused with ErrRecordTooLarge.
+func (m *MultiWriterFile) WriteRecord(record []byte) error {
+	_, err := m.Write(record)
+	return err
+}
+
+// WriteLine appends the line, followed by a newline, as a record
+func (m *MultiWriterFile) WriteLine(line string) error {
+	return m.WriteRecord([]byte(line + "\n"))
+}
+
+// Write appends p as a record, so that a MultiWriterFile can be the
+// output of writers, like log.Logger, writing a record per call
+func (m *MultiWriterFile) Write(p []byte) (int, error) {
+	if len(p) > MaxRecordSize {
+		return 0, fmt.Errorf("%w: %d bytes to %s", ErrRecordTooLarge, len(p), m.path)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	// A short write cannot be completed without risking interleaving
+	n, err := m.fd.Write(p)
+	if err == nil && n < len(p) {
+		err = io.ErrShortWrite
+	}
+
+	return n, err
+}
+
+// Close closes the file
+func (m *MultiWriterFile) Close() error {
+	return m.fd.Close()
+}
+
+// AppendRecord appends the record to the file, as a MultiWriterFile
+// does, opening and closing the file around the write
+func (f *File) AppendRecord(record []byte, opts ...WriteOption) error {
+	m, err := f.OpenMultiWriter(opts...)
+	if err != nil {
+		return err
+	}
+
+	if err := m.WriteRecord(record); err != nil {
+		m.Close()
+		return err
+	}
+
+	return m.Close()
+}
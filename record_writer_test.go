@@ -0,0 +1,65 @@
+package fs_test
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/brinick/fs"
+)
+
+func TestMultiWriterFile(t *testing.T) {
+	root, clean := tempDir()
+	defer clean()
+
+	f := fs.NewFile(filepath.Join(root, "logs", "shared.log"))
+
+	const writers, records = 8, 200
+	var wg sync.WaitGroup
+	for w := 0; w < writers; w++ {
+		m, err := f.OpenMultiWriter(fs.EnsureDir(0))
+		if err != nil {
+			t.Fatalf("unable to open multi writer: %v", err)
+		}
+
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			defer m.Close()
+
+			// Records long enough to be split by buffered writes
+			pad := strings.Repeat(fmt.Sprint(w), 1000)
+			for i := 0; i < records; i++ {
+				if err := m.WriteLine(fmt.Sprintf("%d %d %s", w, i, pad)); err != nil {
+					t.Errorf("unable to write record: %v", err)
+					return
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+
+	lines, err := f.Lines()
+	if err != nil {
+		t.Fatalf("unable to read records: %v", err)
+	}
+
+	if len(lines) != writers*records {
+		t.Fatalf("expected %d records, got %d", writers*records, len(lines))
+	}
+
+	for _, line := range lines {
+		var w, i int
+		var pad string
+		if _, err := fmt.Sscanf(line, "%d %d %s", &w, &i, &pad); err != nil || pad != strings.Repeat(fmt.Sprint(w), 1000) {
+			t.Fatalf("corrupted record %.40q...", line)
+		}
+	}
+
+	if err := f.AppendRecord(make([]byte, fs.MaxRecordSize+1)); !errors.Is(err, fs.ErrRecordTooLarge) {
+		t.Errorf("expected record too large error, got %v", err)
+	}
+}
@@ -0,0 +1,210 @@
+package fs
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrRenameCollision is the error returned when renames would give
+// several files the same name, or overwrite a file not being renamed
+var ErrRenameCollision = errors.New("rename collision")
+
+// Rename is a file rename planned or done by Files.RenameAll
+type Rename struct {
+	From string
+	To   string
+}
+
+// RenameOption configures Files.RenameAll
+type RenameOption func(*renameConfig)
+
+type renameConfig struct {
+	dryRun bool
+	now    time.Time
+}
+
+// RenameDryRun makes RenameAll only return the renames it would do
+func RenameDryRun() RenameOption {
+	return func(c *renameConfig) {
+		c.dryRun = true
+	}
+}
+
+// RenameAll renames the files whose name matches the regular expression
+// pattern, within their directory, replacing the matches in the name,
+// as regexp.ReplaceAllString does, with the replacement. It may refer
+// to the pattern's capture groups, as $1 or ${group}, and contain the
+// placeholders:
+//
+//	{name}   the name without its extension
+//	{ext}    the extension, without its dot
+//	{date}   today's date, as 2006-01-02
+//	{mtime}  the file's modification date, as 2006-01-02
+//	{index}  the position of the file among those renamed, from 1
+//
+// A pattern of "^.*$" thus renames to the replacement as a whole, e.g.
+// "{name}-{date}.{ext}". Files not matching, or whose name does not
+// change, are left alone.
+// All renames are checked before any is done: if two files would get
+// the same name, or a file would replace one not itself renamed, an
+// ErrRenameCollision is returned. The renames are returned, and the
+// paths of the renamed files updated.
+func (f *Files) RenameAll(pattern, replacement string, opts ...RenameOption) ([]Rename, error) {
+	cfg := &renameConfig{now: time.Now()}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("invalid rename pattern %q (%w)", pattern, err)
+	}
+
+	var (
+		renames []Rename
+		files   []*File
+	)
+
+	for _, file := range *f {
+		name := file.Name()
+		if !re.MatchString(name) {
+			continue
+		}
+
+		newName, err := renameTemplate(file, len(renames)+1, cfg.now, re.ReplaceAllString(name, replacement))
+		if err != nil {
+			return nil, err
+		}
+
+		if newName == name {
+			continue
+		}
+
+		if newName == "" || strings.ContainsAny(newName, `/\`) {
+			return nil, fmt.Errorf("invalid new name %q for %s", newName, file.Path)
+		}
+
+		renames = append(renames, Rename{From: file.Path, To: filepath.Join(file.DirPath(), newName)})
+		files = append(files, file)
+	}
+
+	if err := checkRenames(files, renames); err != nil {
+		return nil, err
+	}
+
+	if cfg.dryRun {
+		return renames, nil
+	}
+
+	return renames, doRenames(files, renames)
+}
+
+// renameTemplate replaces the placeholders of the new name of the file
+func renameTemplate(file *File, index int, now time.Time, name string) (string, error) {
+	if !strings.Contains(name, "{") {
+		return name, nil
+	}
+
+	base, ext := file.NameExt()
+	mtime := ""
+	if strings.Contains(name, "{mtime}") {
+		t, err := file.ModTime()
+		if err != nil {
+			return "", err
+		}
+		mtime = t.Format("2006-01-02")
+	}
+
+	return strings.NewReplacer(
+		"{name}", base,
+		"{ext}", ext,
+		"{date}", now.Format("2006-01-02"),
+		"{mtime}", mtime,
+		"{index}", strconv.Itoa(index),
+	).Replace(name), nil
+}
+
+// checkRenames checks that no two files are renamed to the same path,
+// and that no file is renamed over one that is not renamed
+func checkRenames(files []*File, renames []Rename) error {
+	from := map[string]bool{}
+	for _, r := range renames {
+		from[r.From] = true
+	}
+
+	to := map[string]string{}
+	for i, r := range renames {
+		if other, ok := to[r.To]; ok {
+			return fmt.Errorf("%w: %s and %s both renamed to %s", ErrRenameCollision, other, r.From, r.To)
+		}
+		to[r.To] = r.From
+
+		if from[r.To] {
+			continue
+		}
+
+		_, err := files[i].sys().Lstat(r.To)
+		if err == nil {
+			return fmt.Errorf("%w: %s renamed over existing %s", ErrRenameCollision, r.From, r.To)
+		}
+
+		if !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// doRenames renames the files, first to temporary names, so that
+// files can take the names of others renamed too. The temporary names
+// are created exclusively, so as not to replace other files, and if a
+// rename fails, those done are undone.
+func doRenames(files []*File, renames []Rename) error {
+	tmps := make([]string, 0, len(renames))
+	undo := func(done int) {
+		for j := done - 1; j >= 0; j-- {
+			files[j].sys().Rename(renames[j].To, tmps[j])
+		}
+
+		for j := len(tmps) - 1; j >= 0; j-- {
+			files[j].sys().Rename(tmps[j], renames[j].From)
+		}
+	}
+
+	for i, r := range renames {
+		sys := files[i].sys()
+		fd, tmp, err := createTemp(sys, filepath.Dir(r.From), filepath.Base(r.From)+".renaming-")
+		if err == nil {
+			fd.Close()
+			if err = sys.Rename(r.From, tmp); err != nil {
+				sys.Remove(tmp)
+			}
+		}
+
+		if err != nil {
+			undo(0)
+			return fmt.Errorf("unable to rename %s (%w)", r.From, err)
+		}
+		tmps = append(tmps, tmp)
+	}
+
+	for i, r := range renames {
+		if err := files[i].sys().Rename(tmps[i], r.To); err != nil {
+			undo(i)
+			return fmt.Errorf("unable to rename %s to %s (%w)", r.From, r.To, err)
+		}
+	}
+
+	for i, r := range renames {
+		files[i].Path = r.To
+	}
+
+	return nil
+}
@@ -0,0 +1,141 @@
+package fs_test
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/brinick/fs"
+)
+
+func TestRenameAll(t *testing.T) {
+	today := time.Now().Format("2006-01-02")
+
+	tests := []struct {
+		name        string
+		files       []string
+		pattern     string
+		replacement string
+		want        []string
+		wantErr     error
+	}{
+		{"capture groups", []string{"lib-1.2.tar", "lib-1.3.tar", "notes.txt"}, `^lib-(\d+)\.(\d+)\.tar$`, "lib_v${1}_${2}.tar",
+			[]string{"lib_v1_2.tar", "lib_v1_3.tar", "notes.txt"}, nil},
+		{"named groups", []string{"run-42.log"}, `^run-(?P<id>\d+)`, "job-${id}", []string{"job-42.log"}, nil},
+		{"template", []string{"build.tar.gz", "image.iso"}, `^.*$`, "{name}-{date}.{ext}",
+			[]string{"build.tar-" + today + ".gz", "image-" + today + ".iso"}, nil},
+		{"index and mtime", []string{"a.log", "b.log"}, `\.log$`, "-{index}-{mtime}.log",
+			[]string{"a-1-2020-05-04.log", "b-2-2020-05-04.log"}, nil},
+		{"swap names", []string{"f2", "f1"}, `^f\d$`, "f{index}", []string{"f1", "f2"}, nil},
+		{"same target", []string{"a.1.log", "a.2.log"}, `\.\d\.log$`, ".log", nil, fs.ErrRenameCollision},
+		{"existing target", []string{"a.log", "b.log", "c.log"}, `^a`, "b", nil, fs.ErrRenameCollision},
+	}
+
+	mtime := time.Date(2020, 5, 4, 12, 0, 0, 0, time.Local)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root, clean := tempDir()
+			defer clean()
+
+			var files fs.Files
+			for _, name := range tt.files {
+				path := filepath.Join(root, name)
+				makeTree(t, root, map[string]string{name: name})
+				os.Chtimes(path, mtime, mtime)
+				files = append(files, fs.NewFile(path))
+			}
+
+			// Only the files of the test are renamed, the last is a bystander
+			renamed := files
+			if tt.name == "existing target" {
+				renamed = files[:1]
+			}
+
+			preview, err := renamed.RenameAll(tt.pattern, tt.replacement, fs.RenameDryRun())
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("expected error %v, got %v", tt.wantErr, err)
+			}
+
+			if err != nil {
+				return
+			}
+
+			renames, err := renamed.RenameAll(tt.pattern, tt.replacement)
+			if err != nil {
+				t.Fatalf("unable to rename: %v", err)
+			}
+
+			if len(renames) != len(preview) {
+				t.Errorf("expected preview %v to match renames %v", preview, renames)
+			}
+
+			entries, _ := os.ReadDir(root)
+			var got []string
+			for _, e := range entries {
+				got = append(got, e.Name())
+			}
+
+			want := append([]string{}, tt.want...)
+			sort.Strings(want)
+			if strings.Join(got, ",") != strings.Join(want, ",") {
+				t.Errorf("expected %v, got %v", want, got)
+			}
+
+			for i, f := range renamed {
+				if text, err := f.Text(); err != nil || text != tt.files[i] {
+					t.Errorf("expected file path updated, %s has %q (%v)", f.Path, text, err)
+				}
+			}
+		})
+	}
+}
+
+// failRenameFS fails the renames to the given name
+type failRenameFS struct {
+	fs.OSFilesystem
+	name string
+}
+
+func (f failRenameFS) Rename(oldname, newname string) error {
+	if filepath.Base(newname) == f.name {
+		return errors.New("rename failed")
+	}
+
+	return f.OSFilesystem.Rename(oldname, newname)
+}
+
+func TestRenameAllUndo(t *testing.T) {
+	root, clean := tempDir()
+	defer clean()
+
+	// Not replaced by the temporary names
+	makeTree(t, root, map[string]string{"a1": "a1", "b1": "b1", "a1.renaming-0": "other"})
+
+	sys := failRenameFS{name: "b2"}
+	files := fs.Files{fs.NewFileOn(sys, filepath.Join(root, "a1")), fs.NewFileOn(sys, filepath.Join(root, "b1"))}
+	if _, err := files.RenameAll(`1$`, "2"); err == nil {
+		t.Fatalf("expected the rename to b2 to fail")
+	}
+
+	got := map[string]string{}
+	entries, _ := os.ReadDir(root)
+	for _, e := range entries {
+		data, _ := ioutil.ReadFile(filepath.Join(root, e.Name()))
+		got[e.Name()] = string(data)
+	}
+
+	want := map[string]string{"a1": "a1", "b1": "b1", "a1.renaming-0": "other"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expected the renames undone, leaving %v, got %v", want, got)
+	}
+
+	if files[0].Name() != "a1" {
+		t.Errorf("expected the file path unchanged, got %s", files[0].Path)
+	}
+}
@@ -0,0 +1,188 @@
+package fs
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+)
+
+// ScaffoldEntry is a directory, file or symlink created by Scaffold
+type ScaffoldEntry struct {
+	// Path is relative to the scaffold root. Paths ending
+	// with a slash are directories.
+	Path string `json:"path" yaml:"path" toml:"path"`
+
+	// Mode is the entry's mode permissions, the spec's default if 0
+	Mode os.FileMode `json:"mode,omitempty" yaml:"mode,omitempty" toml:"mode,omitempty"`
+
+	// Content is the file content, a text/template executed with the
+	// spec's Data
+	Content string `json:"content,omitempty" yaml:"content,omitempty" toml:"content,omitempty"`
+
+	// Link, if set, makes the entry a symlink to it
+	Link string `json:"link,omitempty" yaml:"link,omitempty" toml:"link,omitempty"`
+}
+
+// ScaffoldSpec declares a directory skeleton. It can be read from a
+// JSON, YAML or TOML file with File.ReadInto.
+type ScaffoldSpec struct {
+	Entries []ScaffoldEntry `json:"entries" yaml:"entries" toml:"entries"`
+
+	// DirMode and FileMode are the default modes of directories,
+	// 0755 if 0, and files, 0644 if 0
+	DirMode  os.FileMode `json:"dir_mode,omitempty" yaml:"dir_mode,omitempty" toml:"dir_mode,omitempty"`
+	FileMode os.FileMode `json:"file_mode,omitempty" yaml:"file_mode,omitempty" toml:"file_mode,omitempty"`
+
+	// Overwrite replaces existing files and symlinks, which are
+	// otherwise an error. Existing directories are always reused.
+	Overwrite bool `json:"overwrite,omitempty" yaml:"overwrite,omitempty" toml:"overwrite,omitempty"`
+
+	// Data is passed to the file content templates
+	Data interface{} `json:"-" yaml:"-" toml:"-"`
+}
+
+// Scaffold creates the skeleton declared by spec below dst, creating
+// dst too if needed, in the order of the entries. Missing parent
+// directories of entries get the default directory mode. The spec is
+// checked, and its templates parsed, before anything is created. An
+// entry that links of earlier entries would lead out of dst is not
+// created, and an UnsafePathError is returned.
+func Scaffold(dst string, spec ScaffoldSpec) error {
+	dirMode, fileMode := spec.DirMode, spec.FileMode
+	if dirMode == 0 {
+		dirMode = defaultDirPerm
+	}
+
+	if fileMode == 0 {
+		fileMode = 0644
+	}
+
+	templates := make([]*template.Template, len(spec.Entries))
+	for i, e := range spec.Entries {
+		if filepath.IsAbs(e.Path) {
+			return fmt.Errorf("scaffold path %s is not relative", e.Path)
+		}
+
+		if _, ok := relBelow(dst, filepath.Join(dst, e.Path)); !ok {
+			return fmt.Errorf("scaffold path %s is not below %s", e.Path, dst)
+		}
+
+		tmpl, err := template.New(e.Path).Option("missingkey=error").Parse(e.Content)
+		if err != nil {
+			return fmt.Errorf("invalid content template for %s (%w)", e.Path, err)
+		}
+		templates[i] = tmpl
+	}
+
+	if err := mkdirAll(OSFilesystem{}, dst, dirMode); err != nil {
+		return err
+	}
+
+	for i, e := range spec.Entries {
+		path := filepath.Join(dst, e.Path)
+		isDir := strings.HasSuffix(e.Path, "/")
+
+		mode := e.Mode
+		if mode == 0 {
+			mode = fileMode
+			if isDir {
+				mode = dirMode
+			}
+		}
+
+		// Links of earlier entries must not lead the entry out of dst
+		parent := filepath.Dir(path)
+		if isDir {
+			parent = path
+		}
+
+		ok, err := IsWithin(dst, parent)
+		if err != nil {
+			return err
+		}
+
+		if !ok {
+			return UnsafePathError{e.Path}
+		}
+
+		switch {
+		case isDir:
+			err = scaffoldDir(path, dirMode, mode)
+		case e.Link != "":
+			err = scaffoldLink(path, e.Link, dirMode, spec.Overwrite)
+		default:
+			err = scaffoldFile(path, templates[i], spec.Data, dirMode, mode, spec.Overwrite)
+		}
+
+		if err != nil {
+			return fmt.Errorf("unable to scaffold %s (%w)", path, err)
+		}
+	}
+
+	return nil
+}
+
+func scaffoldDir(path string, dirMode, mode os.FileMode) error {
+	if err := mkdirAll(OSFilesystem{}, path, dirMode); err != nil {
+		return err
+	}
+
+	if policy().SetgidDirs {
+		mode |= os.ModeSetgid
+	}
+
+	return os.Chmod(path, mode)
+}
+
+func scaffoldLink(path, target string, dirMode os.FileMode, overwrite bool) error {
+	if err := mkdirAll(OSFilesystem{}, filepath.Dir(path), dirMode); err != nil {
+		return err
+	}
+
+	if err := scaffoldClear(path, overwrite); err != nil {
+		return err
+	}
+
+	return os.Symlink(target, path)
+}
+
+func scaffoldFile(path string, tmpl *template.Template, data interface{}, dirMode, mode os.FileMode, overwrite bool) error {
+	var content bytes.Buffer
+	if err := tmpl.Execute(&content, data); err != nil {
+		return err
+	}
+
+	if err := scaffoldClear(path, overwrite); err != nil {
+		return err
+	}
+
+	f := NewFile(path)
+	if err := f.WriteAtomic(content.Bytes(), EnsureDir(dirMode)); err != nil {
+		return err
+	}
+
+	return f.SetFileMode(mode)
+}
+
+// scaffoldClear removes any file or symlink at path, if overwrite is
+// set, else fails if there is one
+func scaffoldClear(path string, overwrite bool) error {
+	info, err := os.Lstat(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if !overwrite || info.IsDir() {
+		return fmt.Errorf("%s already exists", path)
+	}
+
+	return os.Remove(path)
+}
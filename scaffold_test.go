@@ -0,0 +1,139 @@
+package fs_test
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/brinick/fs"
+)
+
+func TestScaffold(t *testing.T) {
+	dir, clean := tempDir()
+	defer clean()
+
+	spec := fs.ScaffoldSpec{
+		Entries: []fs.ScaffoldEntry{
+			{Path: "bin/"},
+			{Path: "private/", Mode: 0700},
+			{Path: "etc/release.cfg", Content: "release={{.Release}}\n"},
+			{Path: "bin/run.sh", Mode: 0755, Content: "#!/bin/sh\n"},
+			{Path: "latest", Link: "etc"},
+		},
+		Data: map[string]string{"Release": "22.0.1"},
+	}
+
+	dst := filepath.Join(dir, "area")
+	if err := fs.Scaffold(dst, spec); err != nil {
+		t.Fatalf("unable to scaffold: %v", err)
+	}
+
+	modes := map[string]os.FileMode{
+		"bin":             os.ModeDir | 0755,
+		"private":         os.ModeDir | 0700,
+		"etc":             os.ModeDir | 0755,
+		"etc/release.cfg": 0644,
+		"bin/run.sh":      0755,
+	}
+
+	for name, want := range modes {
+		info, err := os.Stat(filepath.Join(dst, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if info.Mode() != want {
+			t.Errorf("%s: expected mode %v, got %v", name, want, info.Mode())
+		}
+	}
+
+	content, _ := ioutil.ReadFile(filepath.Join(dst, "etc", "release.cfg"))
+	if string(content) != "release=22.0.1\n" {
+		t.Errorf("unexpected content %q", content)
+	}
+
+	if target, err := os.Readlink(filepath.Join(dst, "latest")); err != nil || target != "etc" {
+		t.Errorf("expected link to etc, got %q (%v)", target, err)
+	}
+
+	// Existing files fail unless overwritten
+	if err := fs.Scaffold(dst, spec); err == nil {
+		t.Errorf("expected existing files to fail")
+	}
+
+	spec.Overwrite = true
+	spec.Data = map[string]string{"Release": "22.0.2"}
+	if err := fs.Scaffold(dst, spec); err != nil {
+		t.Fatalf("unable to overwrite: %v", err)
+	}
+
+	content, _ = ioutil.ReadFile(filepath.Join(dst, "etc", "release.cfg"))
+	if string(content) != "release=22.0.2\n" {
+		t.Errorf("unexpected overwritten content %q", content)
+	}
+}
+
+func TestScaffoldInvalid(t *testing.T) {
+	tests := []struct {
+		name  string
+		entry fs.ScaffoldEntry
+	}{
+		{"absolute", fs.ScaffoldEntry{Path: "/etc/passwd"}},
+		{"escaping", fs.ScaffoldEntry{Path: "../outside"}},
+		{"bad template", fs.ScaffoldEntry{Path: "a", Content: "{{.Missing"}},
+		{"missing key", fs.ScaffoldEntry{Path: "a", Content: "{{.Missing}}"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir, clean := tempDir()
+			defer clean()
+
+			spec := fs.ScaffoldSpec{
+				Entries: []fs.ScaffoldEntry{tt.entry},
+				Data:    map[string]string{},
+			}
+
+			if err := fs.Scaffold(filepath.Join(dir, "area"), spec); err == nil {
+				t.Errorf("expected an error")
+			}
+
+			if _, err := os.Stat(filepath.Join(dir, "outside")); err == nil {
+				t.Errorf("expected nothing created outside")
+			}
+		})
+	}
+}
+
+func TestScaffoldLinkEscape(t *testing.T) {
+	tests := []struct {
+		name  string
+		entry fs.ScaffoldEntry
+	}{
+		{"file", fs.ScaffoldEntry{Path: "out/pwned", Content: "x"}},
+		{"dir", fs.ScaffoldEntry{Path: "out/pwned/"}},
+		{"link", fs.ScaffoldEntry{Path: "out/pwned", Link: "/etc/passwd"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir, clean := tempDir()
+			defer clean()
+
+			spec := fs.ScaffoldSpec{
+				Entries: []fs.ScaffoldEntry{{Path: "out", Link: ".."}, tt.entry},
+			}
+
+			err := fs.Scaffold(filepath.Join(dir, "area"), spec)
+			if want := (fs.UnsafePathError{Path: tt.entry.Path}); !errors.Is(err, want) {
+				t.Errorf("expected %v, got %v", want, err)
+			}
+
+			if _, err := os.Lstat(filepath.Join(dir, "pwned")); err == nil {
+				t.Errorf("expected nothing created outside")
+			}
+		})
+	}
+}
@@ -0,0 +1,125 @@
+package fs
+
+import (
+	"context"
+	"os"
+	"sort"
+	"sync"
+)
+
+// CopyPriority returns the priority of copying the file at path, of the
+// given info. Files of higher priority are copied first.
+type CopyPriority func(path string, info os.FileInfo) int64
+
+// LargestFirst is the CopyPriority copying the largest files first,
+// which usually shortens the total time of concurrent copies
+func LargestFirst(path string, info os.FileInfo) int64 {
+	return info.Size()
+}
+
+// SmallestFirst is the CopyPriority copying the smallest files first,
+// so that most files are usable as soon as possible
+func SmallestFirst(path string, info os.FileInfo) int64 {
+	return -info.Size()
+}
+
+// WithConcurrency makes directory copies and syncs copy up to n files
+// at once. Directories are created, and files scheduled, first, then
+// the files are copied. A concurrency <= 1 copies one file at a time.
+func WithConcurrency(n int) CopyOption {
+	return func(c *copyConfig) {
+		c.workers = n
+	}
+}
+
+// WithPriority makes directory copies and syncs schedule the copy of
+// their files in order of priority, rather than in walk order, which is
+// kept for files of equal priority. With WithConcurrency, it is the
+// order in which the copies are started.
+func WithPriority(priority CopyPriority) CopyOption {
+	return func(c *copyConfig) {
+		c.priority = priority
+	}
+}
+
+// copyJob is a scheduled file copy
+type copyJob struct {
+	path string
+	info os.FileInfo
+	prio int64
+	run  func(context.Context) error
+}
+
+// scheduled reports if the file copies of directory copies and syncs
+// are to be scheduled, rather than done as the tree is walked
+func (c *copyConfig) scheduled() bool {
+	return c.workers > 1 || c.priority != nil
+}
+
+// schedule adds the job to those run by runJobs
+func (c *copyConfig) schedule(path string, info os.FileInfo, run func(context.Context) error) {
+	c.jobs = append(c.jobs, copyJob{path: path, info: info, run: run})
+}
+
+// runJobs runs the scheduled jobs, by priority, from a pool of
+// workers. At the first failure, jobs not yet started are abandoned,
+// those running are cancelled, and its error is returned.
+func (c *copyConfig) runJobs(ctx context.Context) error {
+	jobs := c.jobs
+	c.jobs = nil
+
+	if c.priority != nil {
+		for i := range jobs {
+			jobs[i].prio = c.priority(jobs[i].path, jobs[i].info)
+		}
+
+		sort.SliceStable(jobs, func(i, j int) bool { return jobs[i].prio > jobs[j].prio })
+	}
+
+	workers := c.workers
+	if workers < 1 {
+		workers = 1
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		wg       sync.WaitGroup
+		once     sync.Once
+		firstErr error
+		queue    = make(chan copyJob)
+	)
+
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for job := range queue {
+				if err := job.run(ctx); err != nil {
+					once.Do(func() {
+						firstErr = err
+						cancel()
+					})
+				}
+			}
+		}()
+	}
+
+	for _, job := range jobs {
+		if ctx.Err() != nil {
+			break
+		}
+		queue <- job
+	}
+
+	close(queue)
+	wg.Wait()
+
+	if firstErr == nil {
+		// Cancelled before any job failed
+		firstErr = ctx.Err()
+	}
+
+	return firstErr
+}
@@ -0,0 +1,134 @@
+package fs_test
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/brinick/fs"
+)
+
+func TestCopyPriority(t *testing.T) {
+	root := newTree(t, map[string]int{"a": 1, "b": 300, "sub/c": 20})
+	d, _ := fs.NewDir(root, "src")
+
+	byName := func(path string, info os.FileInfo) int64 {
+		if info.Name() == "c" {
+			return 1
+		}
+		return 0
+	}
+
+	tests := []struct {
+		name     string
+		priority fs.CopyPriority
+		expect   []int64
+	}{
+		{"largest", fs.LargestFirst, []int64{300, 20, 1}},
+		{"smallest", fs.SmallestFirst, []int64{1, 20, 300}},
+		{"custom", byName, []int64{20, 1, 300}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var (
+				last  int64
+				sizes []int64
+			)
+
+			progress := fs.WithProgress(func(n, total int64) {
+				sizes = append(sizes, n-last)
+				last = n
+			})
+
+			dst := filepath.Join(root, tt.name)
+			if err := d.CopyTo(dst, fs.WithPriority(tt.priority), progress); err != nil {
+				t.Fatalf("unable to copy: %v", err)
+			}
+
+			if fmt.Sprint(sizes) != fmt.Sprint(tt.expect) {
+				t.Errorf("expected files copied in order %v, got %v", tt.expect, sizes)
+			}
+
+			for _, name := range []string{"a", "b", "sub/c"} {
+				if _, err := os.Stat(filepath.Join(dst, name)); err != nil {
+					t.Errorf("%s not copied: %v", name, err)
+				}
+			}
+		})
+	}
+}
+
+func TestCopyConcurrency(t *testing.T) {
+	sizes := map[string]int{}
+	for i := 0; i < 40; i++ {
+		sizes[fmt.Sprintf("d%d/f%02d", i%4, i)] = 1000 * (i + 1)
+	}
+
+	root := newTree(t, sizes)
+	src := filepath.Join(root, "src")
+
+	mtime := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	if err := os.Chtimes(filepath.Join(src, "d1"), mtime, mtime); err != nil {
+		t.Fatal(err)
+	}
+
+	var (
+		mu     sync.Mutex
+		copied int64
+	)
+
+	opts := []fs.CopyOption{
+		fs.WithConcurrency(4),
+		fs.WithPriority(fs.LargestFirst),
+		fs.WithPreserve(fs.PreserveTimes),
+		fs.WithProgress(func(n, total int64) {
+			mu.Lock()
+			copied = n
+			mu.Unlock()
+		}),
+	}
+
+	d, _ := fs.NewDir(src)
+	dst := filepath.Join(root, "dst")
+	if err := d.CopyTo(dst, opts...); err != nil {
+		t.Fatalf("unable to copy: %v", err)
+	}
+
+	var total int64
+	for name, size := range sizes {
+		content, err := ioutil.ReadFile(filepath.Join(dst, name))
+		if err != nil || !bytes.Equal(content, bytes.Repeat([]byte("x"), size)) {
+			t.Errorf("%s not copied (%v)", name, err)
+		}
+		total += int64(size)
+	}
+
+	if copied != total {
+		t.Errorf("expected %d bytes reported, got %d", total, copied)
+	}
+
+	if info, err := os.Stat(filepath.Join(dst, "d1")); err != nil || !info.ModTime().Equal(mtime) {
+		t.Errorf("expected directory times kept once its files are copied, got %v", err)
+	}
+
+	summary, err := fs.Sync(src, filepath.Join(root, "sync"), fs.SyncOptions{}, fs.WithConcurrency(3), fs.WithPriority(fs.SmallestFirst))
+	if err != nil {
+		t.Fatalf("unable to sync: %v", err)
+	}
+
+	if summary.Bytes != total || len(summary.Created) != len(sizes) {
+		t.Errorf("expected %d files and %d bytes synced, got %d and %d", len(sizes), total, len(summary.Created), summary.Bytes)
+	}
+
+	first := filepath.Join(root, "sync", "d0", "f00")
+	if summary.Created[0] != first || !strings.HasSuffix(summary.Created[len(sizes)-1], "f39") {
+		t.Errorf("expected created files in walk order, got %v", summary.Created)
+	}
+}
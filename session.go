@@ -0,0 +1,317 @@
+package fs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Session is a Filesystem recording how to undo the mutations made
+// through it, so that they can be rolled back, e.g. when a publish to
+// a target without transactions of its own fails half way through.
+// Files are backed up before they are first written to, and removals
+// are moves to the backup directory. Renames, and mode and time
+// changes, are undone by their inverse. Files and directories created
+// are removed on rollback.
+//
+// Only the mutations made through the session are undone, by files
+// and directories created on it with NewFileOn and NewDirOn.
+type Session struct {
+	Filesystem
+
+	// backups is the directory of the backups
+	backups string
+
+	mu sync.Mutex
+
+	// undo are the inverse operations, applied in reverse order
+	undo []func() error
+
+	// saved are the paths whose state, before the session
+	// touched them, is restored by an undo operation
+	saved map[string]bool
+
+	// n numbers the backups
+	n int
+}
+
+// NewSession returns a session on fsys, the OS file system if nil,
+// keeping its backups in the backups directory of fsys, created if
+// missing, which should be on the same device as the files changed
+// so that they can be moved rather than copied
+func NewSession(fsys Filesystem, backups string) (*Session, error) {
+	if fsys == nil {
+		fsys = OSFilesystem{}
+	}
+
+	if err := fsys.MkdirAll(backups, 0700); err != nil {
+		return nil, fmt.Errorf("unable to create the session backups dir (%w)", err)
+	}
+
+	return &Session{
+		Filesystem: fsys,
+		backups:    backups,
+		saved:      map[string]bool{},
+	}, nil
+}
+
+// OpenFile opens the named file, backing it up first if opened
+// for writing, the first time it is
+func (s *Session) OpenFile(name string, flag int, perm os.FileMode) (FileHandle, error) {
+	if openOp(flag) != "" {
+		if err := s.save(name, false); err != nil {
+			return nil, err
+		}
+	}
+
+	return s.Filesystem.OpenFile(name, flag, perm)
+}
+
+// MkdirAll creates the named directory and any missing parents,
+// which are removed on rollback
+func (s *Session) MkdirAll(name string, perm os.FileMode) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// The topmost missing directory
+	var missing string
+	for dir := filepath.Clean(name); ; dir = filepath.Dir(dir) {
+		if _, err := s.Filesystem.Lstat(dir); err == nil {
+			break
+		} else if !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+
+		missing = dir
+		if parent := filepath.Dir(dir); parent == dir {
+			break
+		}
+	}
+
+	if err := s.Filesystem.MkdirAll(name, perm); err != nil {
+		return err
+	}
+
+	if missing != "" {
+		s.undo = append(s.undo, func() error {
+			return s.Filesystem.RemoveAll(missing)
+		})
+	}
+
+	return nil
+}
+
+// Rename renames oldname to newname, backing up any newname replaced,
+// and renames it back on rollback
+func (s *Session) Rename(oldname, newname string) error {
+	if err := s.save(newname, false); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.Filesystem.Rename(oldname, newname); err != nil {
+		return err
+	}
+
+	s.undo = append(s.undo, func() error {
+		return s.Filesystem.Rename(newname, oldname)
+	})
+
+	// Further changes to either tree are undone before renaming back
+	s.forget(oldname)
+	s.forget(newname)
+
+	return nil
+}
+
+// Remove removes the named file or empty directory, by moving it to
+// the backups the first time it is changed
+func (s *Session) Remove(name string) error {
+	// Leave the underlying file system to fail on missing
+	// paths and directories that are not empty
+	info, err := s.Filesystem.Lstat(name)
+	if err != nil {
+		return s.Filesystem.Remove(name)
+	}
+
+	if info.IsDir() {
+		if infos, err := s.Filesystem.ReadDir(name); err != nil || len(infos) > 0 {
+			return s.Filesystem.Remove(name)
+		}
+	}
+
+	if err := s.save(name, true); err != nil {
+		return err
+	}
+
+	return s.Filesystem.RemoveAll(name)
+}
+
+// RemoveAll removes the named path and its content, by moving it to
+// the backups the first time it is changed
+func (s *Session) RemoveAll(name string) error {
+	if err := s.save(name, true); err != nil {
+		return err
+	}
+
+	return s.Filesystem.RemoveAll(name)
+}
+
+// Chmod changes the mode of the named file, and back on rollback
+func (s *Session) Chmod(name string, mode os.FileMode) error {
+	info, err := s.Filesystem.Stat(name)
+	if err != nil {
+		return err
+	}
+
+	return s.inverse(s.Filesystem.Chmod(name, mode), func() error {
+		return s.Filesystem.Chmod(name, info.Mode())
+	})
+}
+
+// Chtimes changes the times of the named file, and back on rollback
+func (s *Session) Chtimes(name string, atime, mtime time.Time) error {
+	info, err := s.Filesystem.Stat(name)
+	if err != nil {
+		return err
+	}
+
+	prevAtime, ok := infoAtime(info)
+	if !ok {
+		prevAtime = info.ModTime()
+	}
+
+	return s.inverse(s.Filesystem.Chtimes(name, atime, mtime), func() error {
+		return s.Filesystem.Chtimes(name, prevAtime, info.ModTime())
+	})
+}
+
+// Rollback undoes the mutations made through the session, in reverse
+// order, and removes the backups. All of the undo operations are tried,
+// and those failing are returned together in a MultiError. The session
+// is then empty, and can be used afresh.
+func (s *Session) Rollback() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var errs MultiError
+	for i := len(s.undo) - 1; i >= 0; i-- {
+		if err := s.undo[i](); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	if err := s.reset(); err != nil {
+		errs = append(errs, err)
+	}
+
+	return errs.errOrNil()
+}
+
+// Commit keeps the mutations made through the session, and removes
+// the backups. The session is then empty, and can be used afresh.
+func (s *Session) Commit() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.reset()
+}
+
+// reset empties the session and its backups
+func (s *Session) reset() error {
+	s.undo = nil
+	s.saved = map[string]bool{}
+
+	if err := s.Filesystem.RemoveAll(s.backups); err != nil {
+		return err
+	}
+
+	return s.Filesystem.MkdirAll(s.backups, 0700)
+}
+
+// inverse records undo, if err is nil, and returns err
+func (s *Session) inverse(err error, undo func() error) error {
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	s.undo = append(s.undo, undo)
+	s.mu.Unlock()
+
+	return nil
+}
+
+// save records how to restore the state of path the first time it is
+// changed: by restoring a backup of it if it exists, else by removing
+// it. The backup is a copy, unless move is set, as path is to be removed.
+func (s *Session) save(path string, move bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	path = filepath.Clean(path)
+	if s.saved[path] {
+		return nil
+	}
+
+	info, err := s.Filesystem.Lstat(path)
+	if errors.Is(err, os.ErrNotExist) {
+		s.saved[path] = true
+		s.undo = append(s.undo, func() error {
+			return s.Filesystem.RemoveAll(path)
+		})
+		return nil
+	}
+
+	if err != nil {
+		return err
+	}
+
+	s.n++
+	backup := filepath.Join(s.backups, strconv.Itoa(s.n))
+
+	switch {
+	case move:
+		err = movePath(s.Filesystem, path, backup)
+	case info.Mode().IsRegular():
+		cfg := &copyConfig{preserve: PreserveAll}
+		err = copyBetween(context.Background(), s.Filesystem, path, s.Filesystem, backup, cfg)
+	default:
+		// Only files are written to, and others cannot be opened for
+		// writing, so there is nothing to restore
+		return nil
+	}
+
+	if err != nil {
+		return fmt.Errorf("unable to back up %s (%w)", path, err)
+	}
+
+	s.saved[path] = true
+	s.undo = append(s.undo, func() error {
+		if err := s.Filesystem.RemoveAll(path); err != nil {
+			return err
+		}
+		return movePath(s.Filesystem, backup, path)
+	})
+
+	return nil
+}
+
+// forget drops the saved state of path, and of the paths below it
+func (s *Session) forget(path string) {
+	path = filepath.Clean(path)
+	prefix := path + string(filepath.Separator)
+	for p := range s.saved {
+		if p == path || strings.HasPrefix(p, prefix) {
+			delete(s.saved, p)
+		}
+	}
+}
@@ -0,0 +1,115 @@
+package fs_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/brinick/fs"
+)
+
+// mutate changes the tree at root through sys
+func mutate(t *testing.T, sys fs.Filesystem, root string) {
+	t.Helper()
+
+	if err := fs.NewFileOn(sys, filepath.Join(root, "a")).WriteAtomic([]byte("changed")); err != nil {
+		t.Fatalf("unable to write: %v", err)
+	}
+
+	if err := fs.NewFileOn(sys, filepath.Join(root, "new", "dir", "c")).Write([]byte("new"), fs.EnsureDir(0)); err != nil {
+		t.Fatalf("unable to create: %v", err)
+	}
+
+	if err := fs.NewDirOn(sys, root, "sub").Remove(); err != nil {
+		t.Fatalf("unable to remove: %v", err)
+	}
+
+	b := fs.NewFileOn(sys, filepath.Join(root, "b"))
+	if err := b.SetFileMode(0600); err != nil {
+		t.Fatalf("unable to chmod: %v", err)
+	}
+
+	if err := b.RenameTo(filepath.Join(root, "renamed")); err != nil {
+		t.Fatalf("unable to rename: %v", err)
+	}
+
+	if err := b.Write([]byte("renamed")); err != nil {
+		t.Fatalf("unable to write the renamed file: %v", err)
+	}
+}
+
+func TestSessionRollback(t *testing.T) {
+	root, clean := tempDir()
+	defer clean()
+
+	tree := filepath.Join(root, "tree")
+	makeTree(t, tree, map[string]string{"a": "a", "b": "b", "sub/x": "x", "sub/deep/y": "y"})
+
+	d, _ := fs.NewDir(tree)
+	before, err := d.Hash(fs.HashOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := fs.NewSession(nil, filepath.Join(root, "backups"))
+	if err != nil {
+		t.Fatalf("unable to start session: %v", err)
+	}
+
+	mutate(t, s, tree)
+
+	if err := s.Rollback(); err != nil {
+		t.Fatalf("unable to roll back: %v", err)
+	}
+
+	after, err := d.Hash(fs.HashOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if after != before {
+		entries, _ := d.Entries()
+		t.Errorf("expected the tree restored, got %v", entries)
+	}
+
+	if infos, _ := ioutil.ReadDir(filepath.Join(root, "backups")); len(infos) != 0 {
+		t.Errorf("expected no backups left, got %d", len(infos))
+	}
+}
+
+func TestSessionCommit(t *testing.T) {
+	root, clean := tempDir()
+	defer clean()
+
+	tree := filepath.Join(root, "tree")
+	makeTree(t, tree, map[string]string{"a": "a", "b": "b", "sub/x": "x"})
+
+	s, err := fs.NewSession(nil, filepath.Join(root, "backups"))
+	if err != nil {
+		t.Fatalf("unable to start session: %v", err)
+	}
+
+	mutate(t, s, tree)
+
+	if err := s.Commit(); err != nil {
+		t.Fatalf("unable to commit: %v", err)
+	}
+
+	// Nothing left to undo
+	if err := s.Rollback(); err != nil {
+		t.Fatalf("unable to roll back: %v", err)
+	}
+
+	for path, want := range map[string]string{"a": "changed", "renamed": "renamed", "new/dir/c": "new"} {
+		if data, _ := ioutil.ReadFile(filepath.Join(tree, path)); string(data) != want {
+			t.Errorf("%s: expected %q, got %q", path, want, data)
+		}
+	}
+
+	for _, path := range []string{"b", "sub"} {
+		if _, err := os.Lstat(filepath.Join(tree, path)); !os.IsNotExist(err) {
+			t.Errorf("expected %s removed, got %v", path, err)
+		}
+	}
+}
@@ -0,0 +1,151 @@
+package fs
+
+import "path/filepath"
+
+// pathKey returns the absolute, cleaned path by which set
+// operations identify files and directories
+func pathKey(path string) string {
+	if abs, err := filepath.Abs(path); err == nil {
+		return abs
+	}
+
+	return filepath.Clean(path)
+}
+
+// pathSet returns the set of keys of the paths
+func pathSet(paths []string) map[string]bool {
+	set := make(map[string]bool, len(paths))
+	for _, path := range paths {
+		set[pathKey(path)] = true
+	}
+
+	return set
+}
+
+// Union returns the files in this or any of the other collections,
+// without duplicates, in the order they are first found
+func (f *Files) Union(others ...*Files) *Files {
+	all := append(Files{}, *f...)
+	for _, other := range others {
+		all = append(all, *other...)
+	}
+
+	return all.Dedupe()
+}
+
+// Intersect returns the files also in the other collection,
+// without duplicates
+func (f *Files) Intersect(other *Files) *Files {
+	in := pathSet(other.Paths())
+	return f.Dedupe().keep(func(path string) bool { return in[pathKey(path)] })
+}
+
+// Difference returns the files not in the other collection,
+// without duplicates
+func (f *Files) Difference(other *Files) *Files {
+	return f.Subtract(other)
+}
+
+// Subtract returns the files in none of the other collections,
+// without duplicates, e.g. to leave out the results of several finds
+func (f *Files) Subtract(others ...*Files) *Files {
+	var paths []string
+	for _, other := range others {
+		paths = append(paths, other.Paths()...)
+	}
+
+	in := pathSet(paths)
+	return f.Dedupe().keep(func(path string) bool { return !in[pathKey(path)] })
+}
+
+// Dedupe returns the files without those with the same absolute
+// path as a file before them
+func (f *Files) Dedupe() *Files {
+	seen := map[string]bool{}
+	return f.keep(func(path string) bool {
+		key := pathKey(path)
+		if seen[key] {
+			return false
+		}
+
+		seen[key] = true
+		return true
+	})
+}
+
+// keep returns the files whose path is accepted
+func (f *Files) keep(accept func(string) bool) *Files {
+	var kept Files
+	for _, file := range *f {
+		if accept(file.Path) {
+			kept = append(kept, file)
+		}
+	}
+
+	return &kept
+}
+
+// ------------------------------------------------------------------
+
+// Union returns the directories in this or any of the other
+// collections, without duplicates, in the order they are first found
+func (d *Directories) Union(others ...*Directories) *Directories {
+	all := append(Directories{}, *d...)
+	for _, other := range others {
+		all = append(all, *other...)
+	}
+
+	return all.Dedupe()
+}
+
+// Intersect returns the directories also in the other collection,
+// without duplicates
+func (d *Directories) Intersect(other *Directories) *Directories {
+	in := pathSet(other.Paths())
+	return d.Dedupe().keep(func(path string) bool { return in[pathKey(path)] })
+}
+
+// Difference returns the directories not in the other collection,
+// without duplicates
+func (d *Directories) Difference(other *Directories) *Directories {
+	return d.Subtract(other)
+}
+
+// Subtract returns the directories in none of the other collections,
+// without duplicates, e.g. to leave out the results of several finds
+func (d *Directories) Subtract(others ...*Directories) *Directories {
+	var paths []string
+	for _, other := range others {
+		paths = append(paths, other.Paths()...)
+	}
+
+	in := pathSet(paths)
+	return d.Dedupe().keep(func(path string) bool { return !in[pathKey(path)] })
+}
+
+// Dedupe returns the directories without those with the same
+// absolute path as a directory before them
+func (d *Directories) Dedupe() *Directories {
+	seen := map[string]bool{}
+	return d.keep(func(path string) bool {
+		key := pathKey(path)
+		if seen[key] {
+			return false
+		}
+
+		seen[key] = true
+		return true
+	})
+}
+
+// keep returns the directories whose path is accepted
+func (d *Directories) keep(accept func(string) bool) *Directories {
+	var kept Directories
+	for _, dd := range *d {
+		if accept(dd.Path) {
+			kept = append(kept, dd)
+		}
+	}
+
+	return &kept
+}
@@ -0,0 +1,68 @@
+package fs_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/brinick/fs"
+)
+
+func files(paths ...string) *fs.Files {
+	var ff fs.Files
+	for _, path := range paths {
+		ff = append(ff, fs.NewFile(path))
+	}
+
+	return &ff
+}
+
+func TestFilesSetOperations(t *testing.T) {
+	a := files("/x/a", "/x/b", "/x/./b", "/x/c")
+	b := files("/x/c", "/x/d", "/x/sub/../a")
+
+	tests := []struct {
+		name string
+		got  *fs.Files
+		want []string
+	}{
+		{"dedupe", a.Dedupe(), []string{"/x/a", "/x/b", "/x/c"}},
+		{"union", a.Union(b, files("/x/e")), []string{"/x/a", "/x/b", "/x/c", "/x/d", "/x/e"}},
+		{"intersect", a.Intersect(b), []string{"/x/a", "/x/c"}},
+		{"difference", a.Difference(b), []string{"/x/b"}},
+		{"empty", a.Difference(a), nil},
+		{"subtract", a.Union(b).Subtract(files("/x/b"), files("/x/./d")), []string{"/x/a", "/x/c"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := strings.Join(tt.got.Paths(), ","); got != strings.Join(tt.want, ",") {
+				t.Errorf("expected %v, got %s", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestDirectoriesSetOperations(t *testing.T) {
+	a := fs.Dirs("/x/a", "/x/b", "/x/b/")
+	b := fs.Dirs("/x/b", "/x/c")
+
+	tests := []struct {
+		name string
+		got  *fs.Directories
+		want []string
+	}{
+		{"dedupe", a.Dedupe(), []string{"/x/a", "/x/b"}},
+		{"union", a.Union(b), []string{"/x/a", "/x/b", "/x/c"}},
+		{"intersect", a.Intersect(b), []string{"/x/b"}},
+		{"difference", b.Difference(a), []string{"/x/c"}},
+		{"subtract", a.Union(b).Subtract(b), []string{"/x/a"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := strings.Join(tt.got.Paths(), ","); got != strings.Join(tt.want, ",") {
+				t.Errorf("expected %v, got %s", tt.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,256 @@
+// Package sftpfs provides a fs.Filesystem over an SFTP connection, so
+// that files and directories on remote hosts can be used, and local
+// ones pushed to them, with the same API as local ones:
+//
+//	client, err := sftpfs.Dial("relmgr:22", sshConfig)
+//	...
+//	defer client.Close()
+//	remote := fs.NewDirOn(client, "/releases/x.y.z")
+//	err = local.CopyToDir(remote)
+package sftpfs
+
+import (
+	"errors"
+	"fmt"
+	iofs "io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/brinick/fs"
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+)
+
+// FS is a fs.Filesystem on an SFTP server. Paths are slash separated,
+// relative ones being relative to the login directory.
+type FS struct {
+	client *sftp.Client
+
+	// conn is the SSH connection, if opened by Dial
+	conn *ssh.Client
+}
+
+var _ fs.Filesystem = (*FS)(nil)
+
+// New returns the Filesystem of the given SFTP client
+func New(client *sftp.Client) *FS {
+	return &FS{client: client}
+}
+
+// Dial opens an SSH connection to addr (host:port) and returns the
+// Filesystem of an SFTP session on it. It must be closed once done.
+func Dial(addr string, config *ssh.ClientConfig) (*FS, error) {
+	conn, err := ssh.Dial("tcp", addr, config)
+	if err != nil {
+		return nil, fmt.Errorf("unable to connect to %s (%w)", addr, err)
+	}
+
+	client, err := sftp.NewClient(conn)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("unable to start sftp session on %s (%w)", addr, err)
+	}
+
+	return &FS{client: client, conn: conn}, nil
+}
+
+// Close ends the SFTP session, and the SSH connection if opened by Dial
+func (s *FS) Close() error {
+	err := s.client.Close()
+	if s.conn != nil {
+		if cerr := s.conn.Close(); err == nil {
+			err = cerr
+		}
+	}
+
+	return err
+}
+
+// Client returns the underlying SFTP client
+func (s *FS) Client() *sftp.Client {
+	return s.client
+}
+
+// remote converts a local path to the slash separated remote form
+func remote(name string) string {
+	return filepath.ToSlash(name)
+}
+
+// Open opens the named file for reading
+func (s *FS) Open(name string) (iofs.File, error) {
+	fd, err := s.client.Open(remote(name))
+	if err != nil {
+		return nil, err
+	}
+
+	return &handle{File: fd, fs: s}, nil
+}
+
+// OpenFile opens the named file with the given os.O_* flags, setting
+// mode perm on the file if it is created
+func (s *FS) OpenFile(name string, flag int, perm os.FileMode) (fs.FileHandle, error) {
+	name = remote(name)
+
+	created := false
+	if flag&os.O_CREATE != 0 {
+		_, err := s.client.Lstat(name)
+		created = errors.Is(err, os.ErrNotExist)
+	}
+
+	fd, err := s.client.OpenFile(name, flag)
+	if err != nil {
+		return nil, err
+	}
+
+	if created {
+		if err := fd.Chmod(perm); err != nil {
+			fd.Close()
+			return nil, err
+		}
+	}
+
+	return &handle{File: fd, fs: s}, nil
+}
+
+// Stat returns the info of the named file, following symlinks
+func (s *FS) Stat(name string) (os.FileInfo, error) {
+	return s.client.Stat(remote(name))
+}
+
+// Lstat returns the info of the named file, not following symlinks
+func (s *FS) Lstat(name string) (os.FileInfo, error) {
+	return s.client.Lstat(remote(name))
+}
+
+// ReadDir returns the entries of the named directory, sorted by name
+func (s *FS) ReadDir(name string) ([]os.FileInfo, error) {
+	infos, err := s.client.ReadDir(remote(name))
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].Name() < infos[j].Name()
+	})
+
+	return infos, nil
+}
+
+// Readlink returns the target of the named symlink
+func (s *FS) Readlink(name string) (string, error) {
+	return s.client.ReadLink(remote(name))
+}
+
+// MkdirAll creates the named directory and any missing parents,
+// giving those created the mode perm
+func (s *FS) MkdirAll(name string, perm os.FileMode) error {
+	name = remote(name)
+
+	var missing []string
+	for dir := name; ; dir = path.Dir(dir) {
+		info, err := s.client.Stat(dir)
+		if err == nil {
+			if !info.IsDir() {
+				return &os.PathError{Op: "mkdir", Path: dir, Err: errors.New("not a directory")}
+			}
+			break
+		}
+
+		if !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+
+		missing = append(missing, dir)
+		if parent := path.Dir(dir); parent == dir {
+			break
+		}
+	}
+
+	for i := len(missing) - 1; i >= 0; i-- {
+		if err := s.client.Mkdir(missing[i]); err != nil {
+			return err
+		}
+
+		if err := s.client.Chmod(missing[i], perm.Perm()); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Rename renames oldname to newname, replacing newname if it exists
+// and the server supports POSIX renames
+func (s *FS) Rename(oldname, newname string) error {
+	oldname, newname = remote(oldname), remote(newname)
+	if _, ok := s.client.HasExtension("posix-rename@openssh.com"); ok {
+		return s.client.PosixRename(oldname, newname)
+	}
+
+	return s.client.Rename(oldname, newname)
+}
+
+// Remove removes the named file or empty directory
+func (s *FS) Remove(name string) error {
+	return s.client.Remove(remote(name))
+}
+
+// RemoveAll removes the named path and its content.
+// It is not an error if the path does not exist.
+func (s *FS) RemoveAll(name string) error {
+	name = remote(name)
+
+	info, err := s.client.Lstat(name)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if info.IsDir() {
+		infos, err := s.client.ReadDir(name)
+		if err != nil {
+			return err
+		}
+
+		for _, info := range infos {
+			if err := s.RemoveAll(path.Join(name, info.Name())); err != nil {
+				return err
+			}
+		}
+
+		return s.client.RemoveDirectory(name)
+	}
+
+	return s.client.Remove(name)
+}
+
+// Chmod changes the mode of the named file
+func (s *FS) Chmod(name string, mode os.FileMode) error {
+	return s.client.Chmod(remote(name), mode)
+}
+
+// Chtimes changes the access and modification times of the named file
+func (s *FS) Chtimes(name string, atime, mtime time.Time) error {
+	return s.client.Chtimes(remote(name), atime, mtime)
+}
+
+// handle is a remote open file
+type handle struct {
+	*sftp.File
+	fs *FS
+}
+
+// Sync commits the file content to storage, if the server supports it
+func (h *handle) Sync() error {
+	if _, ok := h.fs.client.HasExtension("fsync@openssh.com"); !ok {
+		return nil
+	}
+
+	return h.File.Sync()
+}
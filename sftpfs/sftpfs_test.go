@@ -0,0 +1,188 @@
+package sftpfs_test
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/brinick/fs"
+	"github.com/brinick/fs/sftpfs"
+	"github.com/pkg/sftp"
+)
+
+// newFS returns a Filesystem on an in process SFTP server,
+// serving the local file system
+func newFS(t *testing.T) *sftpfs.FS {
+	cr, sw := io.Pipe()
+	sr, cw := io.Pipe()
+
+	server, err := sftp.NewServer(struct {
+		io.Reader
+		io.WriteCloser
+	}{sr, sw})
+	if err != nil {
+		t.Fatal(err)
+	}
+	go server.Serve()
+
+	client, err := sftp.NewClientPipe(cr, cw)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sfs := sftpfs.New(client)
+	t.Cleanup(func() {
+		// Closing the server first ends the client's receive loop
+		server.Close()
+		sfs.Close()
+	})
+
+	return sfs
+}
+
+func TestPushTree(t *testing.T) {
+	root, err := ioutil.TempDir("", "sftpfs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	src := filepath.Join(root, "src")
+	for name, content := range map[string]string{"a.txt": "a", "sub/b.sh": "b"} {
+		path := filepath.Join(src, name)
+		os.MkdirAll(filepath.Dir(path), 0755)
+		if err := ioutil.WriteFile(path, []byte(content), 0750); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	sfs := newFS(t)
+	remote := fs.NewDirOn(sfs, root, "remote")
+
+	if err := fs.NewDirOn(nil, src).CopyToDir(remote); err != nil {
+		t.Fatalf("unable to push tree: %v", err)
+	}
+
+	files, err := remote.FilesRecursive(0)
+	if err != nil {
+		t.Fatalf("unable to list remote tree: %v", err)
+	}
+
+	if len(*files) != 2 {
+		t.Fatalf("expected 2 remote files, got %v", files.Paths())
+	}
+
+	b := (*files)[1]
+	if text, err := b.Text(); err != nil || text != "b" {
+		t.Errorf("%s: expected content b, got %q (%v)", b.Path, text, err)
+	}
+
+	if mode, _ := b.FileMode(); mode.Perm() != 0750 {
+		t.Errorf("%s: expected mode 0750, got %v", b.Path, mode)
+	}
+
+	// Atomic writes go through a temp file and rename
+	if err := b.WriteAtomic([]byte("new")); err != nil {
+		t.Fatalf("unable to write remote file: %v", err)
+	}
+
+	data, _ := ioutil.ReadFile(filepath.Join(root, "remote", "sub", "b.sh"))
+	if string(data) != "new" {
+		t.Errorf("expected new content, got %q", data)
+	}
+
+	if err := remote.Remove(); err != nil {
+		t.Fatalf("unable to remove remote tree: %v", err)
+	}
+
+	if ok, _ := remote.Exists(); ok {
+		t.Errorf("remote tree not removed")
+	}
+}
+
+func TestSyncTree(t *testing.T) {
+	root, err := ioutil.TempDir("", "sftpfs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	src := filepath.Join(root, "src")
+	for name, content := range map[string]string{"a.txt": "a", "sub/b.sh": "b"} {
+		path := filepath.Join(src, name)
+		os.MkdirAll(filepath.Dir(path), 0755)
+		if err := ioutil.WriteFile(path, []byte(content), 0750); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := os.Symlink("a.txt", filepath.Join(src, "link")); err != nil {
+		t.Fatal(err)
+	}
+
+	sfs := newFS(t)
+	remote := fs.NewDirOn(sfs, root, "remote")
+	opts := fs.SyncOptions{Delete: true}
+
+	// Pushed, the link content is copied
+	summary, err := fs.NewDirOn(nil, src).SyncToDir(remote, opts)
+	if err != nil {
+		t.Fatalf("unable to push tree: %v", err)
+	}
+
+	if len(summary.Created) != 3 {
+		t.Errorf("expected 3 remote files created, got %v", summary.Created)
+	}
+
+	data, _ := ioutil.ReadFile(filepath.Join(root, "remote", "link"))
+	if string(data) != "a" {
+		t.Errorf("expected the link target content pushed, got %q", data)
+	}
+
+	summary, err = fs.NewDirOn(nil, src).SyncToDir(remote, opts)
+	if err != nil || summary.Unchanged != 3 || len(summary.Created)+len(summary.Updated) != 0 {
+		t.Errorf("expected nothing to push again, got %+v (%v)", summary, err)
+	}
+
+	// Pulled, with the remote side the source
+	os.Remove(filepath.Join(root, "remote", "a.txt"))
+	local := fs.NewDirOn(nil, root, "local")
+	if _, err := remote.SyncToDir(local, opts); err != nil {
+		t.Fatalf("unable to pull tree: %v", err)
+	}
+
+	files, err := local.FilesRecursive(0)
+	if err != nil {
+		t.Fatalf("unable to list pulled tree: %v", err)
+	}
+
+	if len(*files) != 2 {
+		t.Fatalf("expected 2 pulled files, got %v", files.Paths())
+	}
+
+	if mode, _ := (*files)[1].FileMode(); mode.Perm() != 0750 {
+		t.Errorf("%s: expected mode 0750, got %v", (*files)[1].Path, mode)
+	}
+
+	// Synced within the remote file system, deleting the extra file
+	mirror := filepath.Join(root, "mirror")
+	extra := filepath.Join(mirror, "extra")
+	os.MkdirAll(mirror, 0755)
+	ioutil.WriteFile(extra, nil, 0644)
+
+	summary, err = remote.SyncTo(mirror, opts)
+	if err != nil {
+		t.Fatalf("unable to sync remote tree: %v", err)
+	}
+
+	if len(summary.Deleted) != 1 || summary.Deleted[0] != extra {
+		t.Errorf("expected %s deleted, got %v", extra, summary.Deleted)
+	}
+
+	opts.Whiteout = &fs.OCIWhiteout
+	if _, err := fs.NewDirOn(nil, src).SyncToDir(remote, opts); err == nil {
+		t.Errorf("expected an error syncing with whiteouts to a remote tree")
+	}
+}
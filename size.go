@@ -0,0 +1,181 @@
+package fs
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Size returns the total size in bytes of the files, including hidden
+// ones, within and below the directory, as TreeSize does for OS trees.
+// Entries whose base name matches one of the exclude glob patterns are
+// not counted, nor is the content of excluded directories.
+func (d *Directory) Size(excludeGlobs ...string) (int64, error) {
+	var total int64
+	err := d.Walk(func(e Entry) error {
+		if !e.IsDir() {
+			total += e.Size
+		}
+		return nil
+	}, WalkIncludeHidden(), WalkExclude(excludeGlobs...))
+
+	return total, err
+}
+
+// DirSize is the total size of the files below a directory
+type DirSize struct {
+	Dir  *Directory
+	Size int64
+}
+
+// SizeBreakdown returns the size of each sub directory of the directory,
+// as Size does, largest first, e.g. for du style reports. The files
+// directly in the directory are not part of any of them.
+func (d *Directory) SizeBreakdown(excludeGlobs ...string) ([]DirSize, error) {
+	var sizes []DirSize
+	index := map[string]int{}
+
+	err := d.Walk(func(e Entry) error {
+		if e.Depth == 1 {
+			if e.IsDir() {
+				index[e.Name] = len(sizes)
+				sizes = append(sizes, DirSize{Dir: e.Dir()})
+			}
+			return nil
+		}
+
+		if e.IsDir() {
+			return nil
+		}
+
+		rel, err := filepath.Rel(d.Path, e.Path)
+		if err != nil {
+			return err
+		}
+
+		top := strings.SplitN(filepath.ToSlash(rel), "/", 2)[0]
+		sizes[index[top]].Size += e.Size
+		return nil
+	}, WalkIncludeHidden(), WalkExclude(excludeGlobs...))
+
+	if err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(sizes, func(i, j int) bool {
+		return sizes[i].Size > sizes[j].Size
+	})
+
+	return sizes, nil
+}
+
+// HumanSize formats a size in bytes in binary units, to one
+// decimal place, e.g. "4.2 GiB", or "512 B" under 1 KiB
+func HumanSize(size int64) string {
+	const units = "KMGTPE"
+
+	sign := ""
+	if size < 0 {
+		sign, size = "-", -size
+	}
+
+	if size < 1024 {
+		return fmt.Sprintf("%s%d B", sign, size)
+	}
+
+	value, unit := float64(size)/1024, 0
+	for value >= 1024 && unit < len(units)-1 {
+		value /= 1024
+		unit++
+	}
+
+	return fmt.Sprintf("%s%.1f %ciB", sign, value, units[unit])
+}
+
+// ------------------------------------------------------------------
+
+// SizeEvent reports a change of the size of a watched tree
+type SizeEvent struct {
+	Time time.Time
+
+	// Size is the current size of the tree, in bytes
+	Size int64
+
+	// Delta is the change since the previous event, or the start
+	// of the watch, negative if the tree shrank
+	Delta int64
+
+	// Err is the error computing the size, if any, in which
+	// case Size and Delta are not set
+	Err error
+}
+
+// WatchSize computes the size of the tree, as TreeSize does, every
+// interval, 2s if not > 0, and sends an event each time it has grown
+// or shrunk by threshold bytes or more since the previous event, or
+// the start, e.g. to warn early of a publish nearing the quota, or
+// each time it changed if threshold is not > 0. Errors computing the
+// size are sent too. The channel is closed once ctx is done.
+func (d *Directory) WatchSize(ctx context.Context, interval time.Duration, threshold int64) <-chan SizeEvent {
+	if interval <= 0 {
+		interval = 2 * time.Second
+	}
+
+	events := make(chan SizeEvent)
+
+	// The start size is that of the tree when the watch is set up
+	last, err := TreeSizeContext(ctx, d.Path, nil)
+
+	go func() {
+		defer close(events)
+
+		send := func(ev SizeEvent) bool {
+			select {
+			case events <- ev:
+				return true
+			case <-ctx.Done():
+				return false
+			}
+		}
+
+		if err != nil && !send(SizeEvent{Time: time.Now(), Err: err}) {
+			return
+		}
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+
+			size, err := TreeSizeContext(ctx, d.Path, nil)
+			if ctx.Err() != nil {
+				return
+			}
+
+			ev := SizeEvent{Time: time.Now(), Err: err}
+			if err == nil {
+				delta := size - last
+				if delta == 0 || delta < threshold && -delta < threshold {
+					continue
+				}
+
+				ev.Size, ev.Delta = size, delta
+				last = size
+			}
+
+			if !send(ev) {
+				return
+			}
+		}
+	}()
+
+	return events
+}
@@ -0,0 +1,166 @@
+package fs_test
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/brinick/fs"
+)
+
+func TestDirectorySize(t *testing.T) {
+	root := newTree(t, map[string]int{
+		"top":         10,
+		"a/x":         100,
+		"a/deep/y":    200,
+		"b/z":         1000,
+		"b/.hidden":   5,
+		"b/skip.log":  7,
+		"empty/.keep": 0,
+	})
+	d, _ := fs.NewDir(root, "src")
+
+	tests := []struct {
+		name    string
+		exclude []string
+		want    int64
+	}{
+		{"all", nil, 1322},
+		{"excluded files", []string{"*.log"}, 1315},
+		{"excluded dir", []string{"a"}, 1022},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := d.Size(tt.exclude...)
+			if err != nil || got != tt.want {
+				t.Errorf("expected size %d, got %d (%v)", tt.want, got, err)
+			}
+		})
+	}
+
+	sizes, err := d.SizeBreakdown("*.log")
+	if err != nil {
+		t.Fatalf("unable to get size breakdown: %v", err)
+	}
+
+	want := []struct {
+		name string
+		size int64
+	}{{"b", 1005}, {"a", 300}, {"empty", 0}}
+
+	if len(sizes) != len(want) {
+		t.Fatalf("expected %d sub dirs, got %+v", len(want), sizes)
+	}
+
+	for i, w := range want {
+		if sizes[i].Dir.Path != filepath.Join(d.Path, w.name) || sizes[i].Size != w.size {
+			t.Errorf("expected %s of size %d, got %s of %d", w.name, w.size, sizes[i].Dir.Path, sizes[i].Size)
+		}
+	}
+}
+
+func TestHumanSize(t *testing.T) {
+	tests := []struct {
+		size int64
+		want string
+	}{
+		{0, "0 B"},
+		{1023, "1023 B"},
+		{1024, "1.0 KiB"},
+		{1536, "1.5 KiB"},
+		{4509715660, "4.2 GiB"},
+		{-2048, "-2.0 KiB"},
+		{1 << 62, "4.0 EiB"},
+	}
+
+	for _, tt := range tests {
+		if got := fs.HumanSize(tt.size); got != tt.want {
+			t.Errorf("HumanSize(%d): expected %s, got %s", tt.size, tt.want, got)
+		}
+	}
+}
+
+func TestWatchSize(t *testing.T) {
+	root := newTree(t, map[string]int{"a": 100})
+	src := filepath.Join(root, "src")
+	d, _ := fs.NewDir(src)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	events := d.WatchSize(ctx, 5*time.Millisecond, 1000)
+
+	write := func(name string, size int) {
+		if err := ioutil.WriteFile(filepath.Join(src, name), make([]byte, size), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	next := func() fs.SizeEvent {
+		select {
+		case ev := <-events:
+			return ev
+		case <-time.After(5 * time.Second):
+			t.Fatal("no size event")
+		}
+		return fs.SizeEvent{}
+	}
+
+	// Below the threshold, growth only adds up
+	write("b", 600)
+	time.Sleep(20 * time.Millisecond)
+	write("c", 600)
+
+	if ev := next(); ev.Err != nil || ev.Size != 1300 || ev.Delta != 1200 {
+		t.Errorf("expected growth event, got %+v", ev)
+	}
+
+	os.Remove(filepath.Join(src, "b"))
+	os.Remove(filepath.Join(src, "c"))
+	if ev := next(); ev.Size != 100 || ev.Delta != -1200 {
+		t.Errorf("expected shrink event, got %+v", ev)
+	}
+
+	cancel()
+	for range events {
+	}
+}
+
+func TestWatchSizeAnyChange(t *testing.T) {
+	root := newTree(t, map[string]int{"a": 100})
+	src := filepath.Join(root, "src")
+	d, _ := fs.NewDir(src)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// Without a threshold, only changes are sent
+	events := d.WatchSize(ctx, 5*time.Millisecond, 0)
+	select {
+	case ev := <-events:
+		t.Fatalf("expected no event without a change, got %+v", ev)
+	case <-time.After(30 * time.Millisecond):
+	}
+
+	if err := ioutil.WriteFile(filepath.Join(src, "b"), make([]byte, 1), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case ev := <-events:
+		if ev.Size != 101 || ev.Delta != 1 {
+			t.Errorf("expected a growth of 1 byte, got %+v", ev)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no size event")
+	}
+
+	// The default interval, rather than a panic
+	cancel()
+	for range d.WatchSize(ctx, 0, 0) {
+	}
+}
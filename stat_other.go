@@ -0,0 +1,15 @@
+//go:build !(aix || darwin || dragonfly || freebsd || linux || netbsd || openbsd || solaris)
+
+package fs
+
+import "os"
+
+// infoOwner returns the uid and gid from the file info, if available
+func infoOwner(info os.FileInfo) (int, int, bool) {
+	return -1, -1, false
+}
+
+// infoAllocated returns false, the allocated bytes not being available
+func infoAllocated(info os.FileInfo) (int64, bool) {
+	return 0, false
+}
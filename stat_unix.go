@@ -0,0 +1,29 @@
+//go:build aix || darwin || dragonfly || freebsd || linux || netbsd || openbsd || solaris
+
+package fs
+
+import (
+	"os"
+	"syscall"
+)
+
+// infoOwner returns the uid and gid from the file info, if available
+func infoOwner(info os.FileInfo) (int, int, bool) {
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return -1, -1, false
+	}
+
+	return int(st.Uid), int(st.Gid), true
+}
+
+// infoAllocated returns the bytes allocated to the file
+// from the file info, if available
+func infoAllocated(info os.FileInfo) (int64, bool) {
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0, false
+	}
+
+	return int64(st.Blocks) * 512, true
+}
@@ -0,0 +1,729 @@
+package fs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// SyncOptions configures the synchronisation of a destination tree
+// with a source tree
+type SyncOptions struct {
+	// Checksum compares files by content hash rather than
+	// by size and modification time
+	Checksum bool
+
+	// Delete removes destination entries absent from the source
+	Delete bool
+
+	// Exclude lists glob patterns matched against entry base names.
+	// Matching source entries are not copied, and matching destination
+	// entries are never deleted.
+	Exclude []string
+
+	// Whiteout, if set with Delete, marks the destination entries absent
+	// from the source with whiteout markers of the convention, rather
+	// than remove them, e.g. to build an incremental layer. Markers are
+	// removed as their entries are synced again.
+	Whiteout *Whiteout
+}
+
+// SyncSummary reports the actions taken by a sync.
+// Paths are those of the destination entries.
+type SyncSummary struct {
+	Created   []string
+	Updated   []string
+	Deleted   []string
+	Unchanged int
+
+	// WhitedOut are the entries marked with whiteouts
+	WhitedOut []string
+
+	// Bytes is the total number of bytes copied
+	Bytes int64
+}
+
+// Sync makes the dst directory tree mirror the src tree: files that are
+// new or have changed are copied, unchanged files are left alone and,
+// if opts.Delete is set, destination entries absent from the source
+// are removed. The dst directory is created if inexistant.
+// Copied files are given the mode and modification time of their source.
+func Sync(src, dst string, opts SyncOptions, copyOpts ...CopyOption) (*SyncSummary, error) {
+	return SyncContext(context.Background(), src, dst, opts, copyOpts...)
+}
+
+// SyncContext is like Sync, but stops and returns the
+// context error as soon as ctx is done.
+func SyncContext(ctx context.Context, src, dst string, opts SyncOptions, copyOpts ...CopyOption) (*SyncSummary, error) {
+	return syncTrees(ctx, OSFilesystem{}, src, OSFilesystem{}, dst, opts, copyOpts)
+}
+
+// SyncTo makes the dst directory tree, on the file system of the
+// directory, mirror this directory. See Sync.
+func (d *Directory) SyncTo(dst string, opts SyncOptions, copyOpts ...CopyOption) (*SyncSummary, error) {
+	return d.SyncToDir(&Directory{Path: dst, fsys: d.fsys}, opts, copyOpts...)
+}
+
+// SyncToDir is like SyncTo, but syncs the given directory, which may be
+// on another file system, e.g. to push a local tree to a remote host or
+// pull a remote one. Symlinks are only synced as such to the OS file
+// system, the content of their targets being copied otherwise, and
+// whiteouts can only mark deletions on the OS file system.
+func (d *Directory) SyncToDir(dst *Directory, opts SyncOptions, copyOpts ...CopyOption) (*SyncSummary, error) {
+	return syncTrees(context.Background(), d.sys(), d.Path, dst.sys(), dst.Path, opts, copyOpts)
+}
+
+// syncTrees implements the syncs, from src on srcSys to dst on dstSys
+func syncTrees(ctx context.Context, srcSys Filesystem, src string, dstSys Filesystem, dst string, opts SyncOptions, copyOpts []CopyOption) (*SyncSummary, error) {
+	s := newSyncer(ctx, srcSys, src, dstSys, dst, opts, newCopyConfig(copyOpts))
+
+	// What is to be copied is only known while walking the tree
+	s.cfg.total = -1
+	if err := s.cfg.setRoots(src, dst); err != nil {
+		return nil, err
+	}
+
+	if err := s.check(); err != nil {
+		return nil, err
+	}
+
+	if err := walkOn(srcSys, src, s.copy); err != nil {
+		return s.summary, err
+	}
+
+	if err := s.runScheduled(); err != nil {
+		return s.summary, err
+	}
+
+	if opts.Delete {
+		if err := walkOn(dstSys, dst, s.prune); err != nil {
+			return s.summary, err
+		}
+	}
+
+	return s.summary, nil
+}
+
+// ------------------------------------------------------------------
+
+// SyncActionType is the type of action planned by a sync
+type SyncActionType int
+
+// The actions of a sync
+const (
+	SyncCreate SyncActionType = iota
+	SyncUpdate
+	SyncDelete
+	SyncWhiteout
+)
+
+func (t SyncActionType) String() string {
+	switch t {
+	case SyncCreate:
+		return "create"
+	case SyncUpdate:
+		return "update"
+	case SyncWhiteout:
+		return "whiteout"
+	}
+
+	return "delete"
+}
+
+// SyncAction is an action a sync would take on a destination entry
+type SyncAction struct {
+	Type SyncActionType
+
+	// Path is that of the destination entry
+	Path string
+
+	// Reason tells why the action is needed
+	Reason string
+
+	// Bytes is the number of bytes copied, or for deletions,
+	// the size of the deleted file or tree
+	Bytes int64
+}
+
+func (a SyncAction) String() string {
+	return fmt.Sprintf("%s %s (%s, %d bytes)", a.Type, a.Path, a.Reason, a.Bytes)
+}
+
+// SyncPlan lists the actions a sync would take, in the order it would
+// take them. Destination entries whose type changed are deleted then
+// created afresh.
+type SyncPlan struct {
+	Actions   []SyncAction
+	Unchanged int
+
+	// CopyBytes is the total number of bytes to copy
+	CopyBytes int64
+
+	// DeleteBytes is the total size of the entries to delete
+	DeleteBytes int64
+}
+
+// Deletions returns the planned deletions
+func (p *SyncPlan) Deletions() []SyncAction {
+	var dels []SyncAction
+	for _, a := range p.Actions {
+		if a.Type == SyncDelete {
+			dels = append(dels, a)
+		}
+	}
+
+	return dels
+}
+
+// PlanSync returns the actions Sync would take with the same arguments,
+// without taking them, e.g. for large deletions to be approved before
+// the sync is run
+func PlanSync(src, dst string, opts SyncOptions) (*SyncPlan, error) {
+	return PlanSyncContext(context.Background(), src, dst, opts)
+}
+
+// PlanSyncContext is like PlanSync, but stops and returns the
+// context error as soon as ctx is done.
+func PlanSyncContext(ctx context.Context, src, dst string, opts SyncOptions) (*SyncPlan, error) {
+	return planTrees(ctx, OSFilesystem{}, src, OSFilesystem{}, dst, opts)
+}
+
+// PlanSyncTo returns the actions SyncTo would take. See PlanSync.
+func (d *Directory) PlanSyncTo(dst string, opts SyncOptions) (*SyncPlan, error) {
+	return d.PlanSyncToDir(&Directory{Path: dst, fsys: d.fsys}, opts)
+}
+
+// PlanSyncToDir returns the actions SyncToDir would take. See PlanSync.
+func (d *Directory) PlanSyncToDir(dst *Directory, opts SyncOptions) (*SyncPlan, error) {
+	return planTrees(context.Background(), d.sys(), d.Path, dst.sys(), dst.Path, opts)
+}
+
+// planTrees implements the plans, from src on srcSys to dst on dstSys
+func planTrees(ctx context.Context, srcSys Filesystem, src string, dstSys Filesystem, dst string, opts SyncOptions) (*SyncPlan, error) {
+	s := newSyncer(ctx, srcSys, src, dstSys, dst, opts, newCopyConfig(nil))
+	s.plan = &SyncPlan{}
+
+	if err := s.check(); err != nil {
+		return nil, err
+	}
+
+	if err := walkOn(srcSys, src, s.copy); err != nil {
+		return nil, err
+	}
+
+	// A missing dst has nothing to delete
+	_, err := dstSys.Lstat(dst)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+
+	if err == nil && opts.Delete {
+		if err := walkOn(dstSys, dst, s.prune); err != nil {
+			return nil, err
+		}
+	}
+
+	s.plan.Unchanged = s.summary.Unchanged
+	return s.plan, nil
+}
+
+type syncer struct {
+	ctx     context.Context
+	src     string
+	dst     string
+	opts    SyncOptions
+	cfg     *copyConfig
+	summary *SyncSummary
+
+	// srcSys and dstSys are the file systems of the trees, links
+	// only being synced as such if dstSys is the OS file system
+	srcSys Filesystem
+	dstSys Filesystem
+	links  bool
+
+	// plan, if set, collects the actions rather than take them,
+	// gone being the destination entries planned to be replaced
+	plan *SyncPlan
+	gone []string
+
+	// scheduled are the copies scheduled with the copy options, and
+	// mu guards the summary while they run
+	scheduled []*syncedEntry
+	mu        sync.Mutex
+}
+
+func newSyncer(ctx context.Context, srcSys Filesystem, src string, dstSys Filesystem, dst string, opts SyncOptions, cfg *copyConfig) *syncer {
+	_, dstOS := dstSys.(OSFilesystem)
+	return &syncer{
+		ctx:     ctx,
+		src:     src,
+		dst:     dst,
+		opts:    opts,
+		cfg:     cfg,
+		summary: &SyncSummary{},
+		srcSys:  srcSys,
+		dstSys:  dstSys,
+		links:   dstOS,
+	}
+}
+
+// check checks that the source is a directory, and that
+// whiteouts, if any, can be made on the destination
+func (s *syncer) check() error {
+	info, err := s.srcSys.Stat(s.src)
+	if err != nil {
+		return err
+	}
+
+	if !info.IsDir() {
+		return fmt.Errorf("%s: not a directory", s.src)
+	}
+
+	if s.whiteout() != nil && !s.links {
+		return fmt.Errorf("unable to mark deletions in %s with whiteouts, not on the OS file system", s.dst)
+	}
+
+	return nil
+}
+
+// planned records the action in the plan
+func (s *syncer) planned(typ SyncActionType, path, reason string, bytes int64) {
+	s.plan.Actions = append(s.plan.Actions, SyncAction{Type: typ, Path: path, Reason: reason, Bytes: bytes})
+	if typ == SyncDelete {
+		s.plan.DeleteBytes += bytes
+	} else {
+		s.plan.CopyBytes += bytes
+	}
+}
+
+// excluded reports if the entry at path, below root, is excluded
+func (s *syncer) excluded(root, path string) (bool, error) {
+	if path == root {
+		return false, nil
+	}
+
+	return matchAny(filepath.Base(path), s.opts.Exclude)
+}
+
+// copy is the walk function over the source tree
+func (s *syncer) copy(path string, info os.FileInfo, err error) error {
+	if err != nil {
+		return err
+	}
+
+	if err := s.ctx.Err(); err != nil {
+		return err
+	}
+
+	if skip, err := s.excluded(s.src, path); err != nil || skip {
+		if err == nil && info.IsDir() {
+			err = filepath.SkipDir
+		}
+		return err
+	}
+
+	rel, err := filepath.Rel(s.src, path)
+	if err != nil {
+		return err
+	}
+
+	if info.Mode()&os.ModeSymlink != 0 && !s.links {
+		// The content of the link target is synced instead
+		if info, err = s.srcSys.Stat(path); err != nil {
+			return err
+		}
+
+		if info.IsDir() {
+			return fmt.Errorf("unable to sync %s, a link to a directory, where links are unsupported", path)
+		}
+	}
+
+	target := filepath.Join(s.dst, rel)
+	if s.plan != nil {
+		return s.planCopy(path, target, info)
+	}
+
+	if s.whiteout() != nil && path != s.src {
+		if err := s.whiteout().Unmark(target); err != nil {
+			return err
+		}
+	}
+
+	tinfo, err := s.dstSys.Lstat(target)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	exists := err == nil
+	if exists && tinfo.Mode().Type() != info.Mode().Type() {
+		// Type changed (e.g. file replaced by dir): start afresh
+		if dryRunAction(s.ctx, ActionRemove, target) {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		if err := s.dstSys.RemoveAll(target); err != nil {
+			return err
+		}
+		exists = false
+	}
+
+	if info.IsDir() {
+		if !exists {
+			if err := mkdirAll(s.dstSys, target, info.Mode().Perm()); err != nil {
+				return err
+			}
+
+			if !s.links {
+				return nil
+			}
+			return s.cfg.chown(info, target)
+		}
+		return nil
+	}
+
+	if exists {
+		same, err := s.same(path, target, info, tinfo)
+		if err != nil || same {
+			if same {
+				s.summary.Unchanged++
+			}
+			return err
+		}
+
+		if dryRunAction(s.ctx, ActionOverwrite, target) {
+			return nil
+		}
+	}
+
+	if s.cfg.scheduled() {
+		synced := &syncedEntry{target: target, exists: exists}
+		s.scheduled = append(s.scheduled, synced)
+		s.cfg.schedule(path, info, func(ctx context.Context) error {
+			err := s.copyEntry(ctx, path, target, info)
+			if err != nil {
+				return fmt.Errorf("unable to sync %s to %s (%w)", path, target, err)
+			}
+
+			s.mu.Lock()
+			synced.done = true
+			s.summary.Bytes += regularSize(info)
+			s.mu.Unlock()
+			return nil
+		})
+		return nil
+	}
+
+	if err := s.copyEntry(s.ctx, path, target, info); err != nil {
+		return fmt.Errorf("unable to sync %s to %s (%w)", path, target, err)
+	}
+
+	s.summary.Bytes += regularSize(info)
+	s.synced(target, exists)
+	return nil
+}
+
+// syncedEntry is a scheduled copy to target, done once copied
+type syncedEntry struct {
+	target string
+	exists bool
+	done   bool
+}
+
+// synced records the copy to target, which existed if updated
+func (s *syncer) synced(target string, exists bool) {
+	if exists {
+		s.summary.Updated = append(s.summary.Updated, target)
+	} else {
+		s.summary.Created = append(s.summary.Created, target)
+	}
+}
+
+// runScheduled runs the scheduled copies, recording those done
+// in walk order, as when not scheduled
+func (s *syncer) runScheduled() error {
+	if !s.cfg.scheduled() {
+		return nil
+	}
+
+	err := s.cfg.runJobs(s.ctx)
+	for _, e := range s.scheduled {
+		if e.done {
+			s.synced(e.target, e.exists)
+		}
+	}
+
+	return err
+}
+
+func (s *syncer) copyEntry(ctx context.Context, path, target string, info os.FileInfo) error {
+	if info.Mode()&os.ModeSymlink != 0 {
+		return copyLink(ctx, s.srcSys, path, info, target, s.cfg)
+	}
+
+	if err := copyBetween(ctx, s.srcSys, path, s.dstSys, target, s.cfg); err != nil {
+		return err
+	}
+
+	return s.dstSys.Chtimes(target, info.ModTime(), info.ModTime())
+}
+
+// planCopy plans the copy of the source entry at path to target,
+// mirroring the checks of copy. Entries of the wrong type at target
+// are planned for deletion, and recorded as gone.
+func (s *syncer) planCopy(path, target string, info os.FileInfo) error {
+	if s.isGone(target) {
+		if !info.IsDir() {
+			s.planned(SyncCreate, target, "new", regularSize(info))
+		}
+		return nil
+	}
+
+	tinfo, err := s.dstSys.Lstat(target)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	exists := err == nil
+	if exists && tinfo.Mode().Type() != info.Mode().Type() {
+		size, err := s.treeSize(target, tinfo)
+		if err != nil {
+			return err
+		}
+
+		s.planned(SyncDelete, target, "type changed", size)
+		s.gone = append(s.gone, target)
+		exists = false
+	}
+
+	if info.IsDir() {
+		return nil
+	}
+
+	if !exists {
+		s.planned(SyncCreate, target, "new", regularSize(info))
+		return nil
+	}
+
+	same, err := s.same(path, target, info, tinfo)
+	if err != nil {
+		return err
+	}
+
+	if same {
+		s.summary.Unchanged++
+		return nil
+	}
+
+	s.planned(SyncUpdate, target, changeReason(info, tinfo, s.opts.Checksum), regularSize(info))
+	return nil
+}
+
+// treeSize returns the size of the destination entry at path, of
+// info, that of the files below it for directories
+func (s *syncer) treeSize(path string, info os.FileInfo) (int64, error) {
+	if !info.IsDir() {
+		return info.Size(), nil
+	}
+
+	var size int64
+	err := walkOn(s.dstSys, path, func(path string, info os.FileInfo, err error) error {
+		if err == nil {
+			err = s.ctx.Err()
+		}
+
+		if err == nil && !info.IsDir() {
+			size += info.Size()
+		}
+		return err
+	})
+
+	return size, err
+}
+
+// isGone checks if the destination path is, or is below,
+// an entry planned for deletion
+func (s *syncer) isGone(path string) bool {
+	for _, gone := range s.gone {
+		if _, ok := relBelow(gone, path); ok {
+			return true
+		}
+	}
+
+	return false
+}
+
+// regularSize returns the size of regular files, 0 for other entries
+func regularSize(info os.FileInfo) int64 {
+	if info.Mode().IsRegular() {
+		return info.Size()
+	}
+
+	return 0
+}
+
+// changeReason tells why files found different by sameFile differ
+func changeReason(info, tinfo os.FileInfo, checksum bool) string {
+	switch {
+	case info.Mode()&os.ModeSymlink != 0:
+		return "symlink target changed"
+	case info.Size() != tinfo.Size():
+		return fmt.Sprintf("size changed from %d", tinfo.Size())
+	case checksum:
+		return "content changed"
+	}
+
+	return "modification time changed"
+}
+
+// prune is the walk function over the destination tree,
+// removing entries absent from the source tree
+func (s *syncer) prune(path string, info os.FileInfo, err error) error {
+	if err != nil {
+		return err
+	}
+
+	if err := s.ctx.Err(); err != nil {
+		return err
+	}
+
+	if skip, err := s.excluded(s.dst, path); err != nil || skip {
+		if err == nil && info.IsDir() {
+			err = filepath.SkipDir
+		}
+		return err
+	}
+
+	if w := s.whiteout(); w != nil && path != s.dst {
+		if _, ok := w.Target(info.Name()); ok {
+			return nil
+		}
+	}
+
+	if s.plan != nil && s.isGone(path) {
+		if info.IsDir() {
+			return filepath.SkipDir
+		}
+		return nil
+	}
+
+	rel, err := filepath.Rel(s.dst, path)
+	if err != nil {
+		return err
+	}
+
+	if _, err := s.srcSys.Lstat(filepath.Join(s.src, rel)); !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	if w := s.whiteout(); w != nil {
+		if err := s.markGone(w, path); err != nil {
+			return err
+		}
+	} else if s.plan != nil {
+		size, err := s.treeSize(path, info)
+		if err != nil {
+			return err
+		}
+
+		s.planned(SyncDelete, path, "not in source", size)
+	} else if !dryRunAction(s.ctx, ActionRemove, path) {
+		if err := s.dstSys.RemoveAll(path); err != nil {
+			return err
+		}
+
+		s.summary.Deleted = append(s.summary.Deleted, path)
+	}
+
+	if info.IsDir() {
+		return filepath.SkipDir
+	}
+
+	return nil
+}
+
+// whiteout returns the whiteout convention marking
+// the deletions, if any
+func (s *syncer) whiteout() *Whiteout {
+	if !s.opts.Delete {
+		return nil
+	}
+
+	return s.opts.Whiteout
+}
+
+// markGone marks the destination entry at path, absent from
+// the source, with a whiteout, unless already marked
+func (s *syncer) markGone(w *Whiteout, path string) error {
+	if _, err := os.Lstat(w.Marker(path)); err == nil {
+		return nil
+	}
+
+	if s.plan != nil {
+		s.planned(SyncWhiteout, path, "not in source", 0)
+		return nil
+	}
+
+	if err := w.Mark(path); err != nil {
+		return err
+	}
+
+	s.summary.WhitedOut = append(s.summary.WhitedOut, path)
+	return nil
+}
+
+// same reports if the source entry at path and the destination one
+// at target, with the given infos, are identical. See sameFile.
+func (s *syncer) same(path, target string, info, tinfo os.FileInfo) (bool, error) {
+	return sameEntry(s.srcSys, path, info, s.dstSys, target, tinfo, s.opts.Checksum)
+}
+
+// sameFile reports if the two files at paths a and b, with the given
+// infos, are identical by size and modification time, or by content
+// hash if checksum is set
+func sameFile(a, b string, ainfo, binfo os.FileInfo, checksum bool) (bool, error) {
+	return sameEntry(OSFilesystem{}, a, ainfo, OSFilesystem{}, b, binfo, checksum)
+}
+
+// sameEntry is sameFile for the file at a on aSys and that at b on bSys
+func sameEntry(aSys Filesystem, a string, ainfo os.FileInfo, bSys Filesystem, b string, binfo os.FileInfo, checksum bool) (bool, error) {
+	if ainfo.Mode()&os.ModeSymlink != 0 {
+		alink, err := aSys.Readlink(a)
+		if err != nil {
+			return false, err
+		}
+
+		blink, err := bSys.Readlink(b)
+		return alink == blink, err
+	}
+
+	if ainfo.Size() != binfo.Size() {
+		return false, nil
+	}
+
+	if !checksum {
+		atime, btime := ainfo.ModTime(), binfo.ModTime()
+		_, aOS := aSys.(OSFilesystem)
+		_, bOS := bSys.(OSFilesystem)
+		if !aOS || !bOS {
+			// Other file systems may only keep times to the second, as SFTP
+			atime, btime = atime.Truncate(time.Second), btime.Truncate(time.Second)
+		}
+
+		return atime.Equal(btime), nil
+	}
+
+	ahash, err := hashIn(aSys, a, SHA256)
+	if err != nil {
+		return false, err
+	}
+
+	bhash, err := hashIn(bSys, b, SHA256)
+	return ahash == bhash, err
+}
@@ -0,0 +1,160 @@
+package fs_test
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"github.com/brinick/fs"
+)
+
+func relPaths(t *testing.T, root string, paths []string) []string {
+	var rels []string
+	for _, p := range paths {
+		rel, err := filepath.Rel(root, p)
+		if err != nil {
+			t.Fatalf("unable to get relative path: %v", err)
+		}
+		rels = append(rels, rel)
+	}
+
+	sort.Strings(rels)
+	return rels
+}
+
+func checkPaths(t *testing.T, what string, expect, got []string) {
+	if len(expect) != len(got) {
+		t.Errorf("%s: expected %v, got %v", what, expect, got)
+		return
+	}
+
+	for i := range expect {
+		if expect[i] != got[i] {
+			t.Errorf("%s: expected %v, got %v", what, expect, got)
+			return
+		}
+	}
+}
+
+func TestSync(t *testing.T) {
+	dir, clean := tempDir()
+	defer clean()
+
+	src, dst := filepath.Join(dir, "src"), filepath.Join(dir, "dst")
+	makeTree(t, src, map[string]string{
+		"a.txt":     "a",
+		"sub/b.txt": "b",
+		"skip.o":    "o",
+	})
+
+	opts := fs.SyncOptions{Delete: true, Exclude: []string{"*.o"}}
+	summary, err := newDir(t, src).SyncTo(dst, opts)
+	if err != nil {
+		t.Fatalf("unable to sync: %v", err)
+	}
+
+	checkPaths(t, "initial created", []string{"a.txt", "sub/b.txt"}, relPaths(t, dst, summary.Created))
+
+	// Second sync is a no-op
+	summary, err = fs.Sync(src, dst, opts)
+	if err != nil {
+		t.Fatalf("unable to sync: %v", err)
+	}
+
+	if len(summary.Created)+len(summary.Updated)+len(summary.Deleted) != 0 || summary.Unchanged != 2 {
+		t.Errorf("expected nothing to do on second sync, got %+v", summary)
+	}
+
+	// Modify, add and remove in the source, and add an excluded file to dst
+	makeTree(t, src, map[string]string{"a.txt": "aa", "new.txt": "n"})
+	makeTree(t, dst, map[string]string{"keep.o": "o"})
+	if err := os.RemoveAll(filepath.Join(src, "sub")); err != nil {
+		t.Fatalf("unable to remove source subdir: %v", err)
+	}
+
+	summary, err = fs.Sync(src, dst, opts)
+	if err != nil {
+		t.Fatalf("unable to sync: %v", err)
+	}
+
+	checkPaths(t, "created", []string{"new.txt"}, relPaths(t, dst, summary.Created))
+	checkPaths(t, "updated", []string{"a.txt"}, relPaths(t, dst, summary.Updated))
+	checkPaths(t, "deleted", []string{"sub"}, relPaths(t, dst, summary.Deleted))
+
+	if ok, _ := fs.Exists(filepath.Join(dst, "keep.o")); !ok {
+		t.Error("excluded destination file was deleted")
+	}
+
+	h1, _ := newDir(t, src).Hash(fs.HashOptions{Exclude: []string{"*.o"}})
+	h2, _ := newDir(t, dst).Hash(fs.HashOptions{Exclude: []string{"*.o"}})
+	if h1 != h2 {
+		t.Error("synced trees differ")
+	}
+}
+
+func TestPlanSync(t *testing.T) {
+	dir, clean := tempDir()
+	defer clean()
+
+	src, dst := filepath.Join(dir, "src"), filepath.Join(dir, "dst")
+	makeTree(t, src, map[string]string{
+		"same.txt":       "same",
+		"grown.txt":      "grown",
+		"new.txt":        "new",
+		"was_dir":        "now a file",
+		"was_file/x.txt": "x",
+		"skip.o":         "o",
+	})
+
+	makeTree(t, dst, map[string]string{
+		"same.txt":      "same",
+		"grown.txt":     "g",
+		"was_dir/a.txt": "aaa",
+		"was_file":      "ff",
+		"old/b.txt":     "bbbb",
+		"old/c.txt":     "c",
+		"keep.o":        "o",
+	})
+
+	// Make the unchanged file identical by time too
+	info, _ := os.Stat(filepath.Join(src, "same.txt"))
+	os.Chtimes(filepath.Join(dst, "same.txt"), info.ModTime(), info.ModTime())
+
+	opts := fs.SyncOptions{Delete: true, Exclude: []string{"*.o"}}
+	plan, err := newDir(t, src).PlanSyncTo(dst, opts)
+	if err != nil {
+		t.Fatalf("unable to plan sync: %v", err)
+	}
+
+	var got []string
+	for _, a := range plan.Actions {
+		rel, _ := filepath.Rel(dst, a.Path)
+		got = append(got, fmt.Sprintf("%s %s %d", a.Type, rel, a.Bytes))
+	}
+
+	checkPaths(t, "actions", []string{
+		"update grown.txt 5",
+		"create new.txt 3",
+		"delete was_dir 3",
+		"create was_dir 10",
+		"delete was_file 2",
+		"create was_file/x.txt 1",
+		"delete old 5",
+	}, got)
+
+	if plan.Unchanged != 1 || plan.CopyBytes != 19 || plan.DeleteBytes != 10 || len(plan.Deletions()) != 3 {
+		t.Errorf("unexpected plan totals %+v", plan)
+	}
+
+	// Planning changes nothing
+	if ok, _ := fs.Exists(filepath.Join(dst, "old", "b.txt")); !ok {
+		t.Error("planning deleted a file")
+	}
+
+	plan, err = fs.PlanSync(src, filepath.Join(dir, "missing"), opts)
+	if err != nil || len(plan.Actions) != 5 || len(plan.Deletions()) != 0 {
+		t.Errorf("expected creations only to a missing dst, got %v (%v)", plan.Actions, err)
+	}
+}
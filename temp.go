@@ -0,0 +1,80 @@
+package fs
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+// EnsureExists creates the directory, and its parents, with the given
+// mode if missing, and checks that files can be created in it
+func (d *Directory) EnsureExists(mode os.FileMode) error {
+	if err := d.Create(mode); err != nil {
+		return err
+	}
+
+	probe := filepath.Join(d.Path, ".fs-probe-"+strconv.Itoa(os.Getpid()))
+	fd, err := d.sys().OpenFile(probe, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return fmt.Errorf("directory %s is not writable (%w)", d.Path, err)
+	}
+
+	fd.Close()
+	return d.sys().Remove(probe)
+}
+
+// TmpDir is a temporary directory, to be removed with Cleanup
+type TmpDir struct {
+	*Directory
+}
+
+// TempDir creates a new temporary directory, in the default directory
+// for temporary files, with a name starting with prefix
+func TempDir(prefix string) (*TmpDir, error) {
+	path, err := ioutil.TempDir("", prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	return &TmpDir{&Directory{Path: path}}, nil
+}
+
+// Cleanup removes the directory and its content. Removing it
+// more than once is not an error.
+func (t *TmpDir) Cleanup() error {
+	return t.sys().RemoveAll(t.Path)
+}
+
+// TmpFile is a temporary file, to be removed with Cleanup
+type TmpFile struct {
+	*File
+}
+
+// TempFile creates a new empty temporary file in dir, the default
+// directory for temporary files if empty. Its name is pattern, with
+// a random string replacing the last "*", else appended.
+func TempFile(dir, pattern string) (*TmpFile, error) {
+	fd, err := ioutil.TempFile(dir, pattern)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := fd.Close(); err != nil {
+		return nil, err
+	}
+
+	return &TmpFile{NewFile(fd.Name())}, nil
+}
+
+// Cleanup removes the file. Removing it more than once is not an error.
+func (t *TmpFile) Cleanup() error {
+	err := t.sys().Remove(t.Path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+
+	return err
+}
@@ -0,0 +1,100 @@
+package fs_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/brinick/fs"
+)
+
+func TestEnsureExists(t *testing.T) {
+	root, clean := tempDir()
+	defer clean()
+
+	makeTree(t, root, map[string]string{"file": "x", "readonly/.keep": ""})
+	if err := os.Chmod(filepath.Join(root, "readonly"), 0555); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		path string
+		err  bool
+	}{
+		{"missing", "a/b/c", false},
+		{"existing", "readonly/..", false},
+		{"below a file", "file/sub", true},
+		{"read only", "readonly", os.Geteuid() != 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := newDir(t, root, tt.path)
+			err := d.EnsureExists(0755)
+			if (err != nil) != tt.err {
+				t.Fatalf("expected error %v, got %v", tt.err, err)
+			}
+
+			if tt.err {
+				return
+			}
+
+			entries, _ := os.ReadDir(d.Path)
+			for _, e := range entries {
+				if strings.HasPrefix(e.Name(), ".fs-probe") {
+					t.Errorf("expected no probe file left, got %s", e.Name())
+				}
+			}
+		})
+	}
+}
+
+func TestTemp(t *testing.T) {
+	dir, err := fs.TempDir("fs-temp")
+	if err != nil {
+		t.Fatalf("unable to create temp dir: %v", err)
+	}
+
+	if !strings.HasPrefix(dir.Name(), "fs-temp") {
+		t.Errorf("unexpected temp dir name %s", dir.Name())
+	}
+
+	file, err := fs.TempFile(dir.Path, "data-*.json")
+	if err != nil {
+		t.Fatalf("unable to create temp file: %v", err)
+	}
+
+	if name := file.Name(); !strings.HasPrefix(name, "data-") || !strings.HasSuffix(name, ".json") {
+		t.Errorf("unexpected temp file name %s", name)
+	}
+
+	if ok, err := file.Exists(); err != nil || !ok {
+		t.Errorf("expected temp file to exist, got %v", err)
+	}
+
+	for i := 0; i < 2; i++ {
+		if err := file.Cleanup(); err != nil {
+			t.Errorf("unable to clean up file: %v", err)
+		}
+	}
+
+	if ok, _ := file.Exists(); ok {
+		t.Errorf("expected temp file removed")
+	}
+
+	if _, err := fs.TempFile(dir.Path, "other"); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 2; i++ {
+		if err := dir.Cleanup(); err != nil {
+			t.Errorf("unable to clean up dir: %v", err)
+		}
+	}
+
+	if ok, _ := dir.Exists(); ok {
+		t.Errorf("expected temp dir removed")
+	}
+}
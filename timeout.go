@@ -0,0 +1,144 @@
+package fs
+
+import (
+	"context"
+	"io/fs"
+	"os"
+	"time"
+)
+
+// WithTimeout returns fsys, the OS file system if nil, with its Stat,
+// Lstat, ReadDir, Readlink and Open operations failing if not done
+// within d, e.g. so that a hung NFS server does not block a walk
+// forever. Failures are *os.PathError for which os.IsTimeout is true.
+//
+// Operations are run in their own goroutine, which is left blocked
+// until the operation returns. Files opened after their timeout are
+// closed then. A d <= 0 returns fsys unchanged.
+func WithTimeout(fsys Filesystem, d time.Duration) Filesystem {
+	if fsys == nil {
+		fsys = OSFilesystem{}
+	}
+
+	if d <= 0 {
+		return fsys
+	}
+
+	return &timeoutFS{Filesystem: fsys, timeout: d}
+}
+
+// WalkTimeout makes the walk fail if listing a directory, or
+// following a symlink, takes longer than d. See WithTimeout.
+func WalkTimeout(d time.Duration) WalkOption {
+	return func(c *walkConfig) {
+		c.timeout = d
+	}
+}
+
+// timeoutFS is the Filesystem returned by WithTimeout
+type timeoutFS struct {
+	Filesystem
+	timeout time.Duration
+}
+
+// timedResult is that of an operation run by withTimeout
+type timedResult struct {
+	value interface{}
+	err   error
+}
+
+// withTimeout runs fn, returning its result, or a timeout error if it
+// is not done in time, in which case done is called with the result
+// once there is one
+func (t *timeoutFS) withTimeout(op, name string, fn func() (interface{}, error), done func(interface{})) (interface{}, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), t.timeout)
+	defer cancel()
+
+	results := make(chan timedResult, 1)
+	go func() {
+		value, err := fn()
+		results <- timedResult{value, err}
+	}()
+
+	select {
+	case r := <-results:
+		return r.value, r.err
+	case <-ctx.Done():
+		if done != nil {
+			go func() {
+				if r := <-results; r.err == nil {
+					done(r.value)
+				}
+			}()
+		}
+
+		return nil, &os.PathError{Op: op, Path: name, Err: ctx.Err()}
+	}
+}
+
+// Open opens the named file or directory for reading
+func (t *timeoutFS) Open(name string) (fs.File, error) {
+	f, err := t.withTimeout("open", name, func() (interface{}, error) {
+		return t.Filesystem.Open(name)
+	}, func(f interface{}) {
+		f.(fs.File).Close()
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return f.(fs.File), nil
+}
+
+// Stat returns the FileInfo of the named file
+func (t *timeoutFS) Stat(name string) (os.FileInfo, error) {
+	info, err := t.withTimeout("stat", name, func() (interface{}, error) {
+		return t.Filesystem.Stat(name)
+	}, nil)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return info.(os.FileInfo), nil
+}
+
+// Lstat returns the FileInfo of the named file, not following symlinks
+func (t *timeoutFS) Lstat(name string) (os.FileInfo, error) {
+	info, err := t.withTimeout("lstat", name, func() (interface{}, error) {
+		return t.Filesystem.Lstat(name)
+	}, nil)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return info.(os.FileInfo), nil
+}
+
+// ReadDir returns the entries of the named directory, sorted by name
+func (t *timeoutFS) ReadDir(name string) ([]os.FileInfo, error) {
+	infos, err := t.withTimeout("readdir", name, func() (interface{}, error) {
+		return t.Filesystem.ReadDir(name)
+	}, nil)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return infos.([]os.FileInfo), nil
+}
+
+// Readlink returns the target of the named symlink
+func (t *timeoutFS) Readlink(name string) (string, error) {
+	target, err := t.withTimeout("readlink", name, func() (interface{}, error) {
+		return t.Filesystem.Readlink(name)
+	}, nil)
+
+	if err != nil {
+		return "", err
+	}
+
+	return target.(string), nil
+}
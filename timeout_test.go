@@ -0,0 +1,131 @@
+package fs_test
+
+import (
+	iofs "io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/brinick/fs"
+)
+
+// hungFS is the OS file system, with operations on the hung
+// path blocking until released
+type hungFS struct {
+	fs.OSFilesystem
+	hung    string
+	release chan struct{}
+}
+
+func (h *hungFS) wait(name string) {
+	if name == h.hung {
+		<-h.release
+	}
+}
+
+func (h *hungFS) Open(name string) (iofs.File, error) {
+	h.wait(name)
+	return h.OSFilesystem.Open(name)
+}
+
+func (h *hungFS) Stat(name string) (os.FileInfo, error) {
+	h.wait(name)
+	return h.OSFilesystem.Stat(name)
+}
+
+func (h *hungFS) Lstat(name string) (os.FileInfo, error) {
+	h.wait(name)
+	return h.OSFilesystem.Lstat(name)
+}
+
+func (h *hungFS) ReadDir(name string) ([]os.FileInfo, error) {
+	h.wait(name)
+	return h.OSFilesystem.ReadDir(name)
+}
+
+func TestWithTimeout(t *testing.T) {
+	root, clean := tempDir()
+	defer clean()
+
+	makeTree(t, root, map[string]string{"a": "a", "hung/b": "b", "ok/c": "c"})
+
+	hung := filepath.Join(root, "hung")
+	sys := &hungFS{hung: hung, release: make(chan struct{})}
+	defer close(sys.release)
+
+	timed := fs.WithTimeout(sys, 50*time.Millisecond)
+
+	tests := []struct {
+		name string
+		op   func(path string) error
+	}{
+		{"stat", func(path string) error { _, err := timed.Stat(path); return err }},
+		{"readdir", func(path string) error { _, err := timed.ReadDir(path); return err }},
+		{"open", func(path string) error {
+			f, err := timed.Open(path)
+			if err == nil {
+				f.Close()
+			}
+			return err
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.op(filepath.Join(root, "ok")); err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+
+			start := time.Now()
+			err := tt.op(hung)
+			if !os.IsTimeout(err) {
+				t.Errorf("expected a timeout, got %v", err)
+			}
+
+			if elapsed := time.Since(start); elapsed > time.Second {
+				t.Errorf("expected the operation abandoned, took %v", elapsed)
+			}
+		})
+	}
+
+	var seen []string
+	err := fs.NewDirOn(sys, root).Walk(func(e fs.Entry) error {
+		seen = append(seen, e.Name)
+		return nil
+	}, fs.WalkTimeout(50*time.Millisecond))
+
+	if !os.IsTimeout(err) {
+		t.Errorf("expected the walk to time out, got %v after %v", err, seen)
+	}
+
+	if fs.WithTimeout(sys, 0) != fs.Filesystem(sys) {
+		t.Errorf("expected no timeout to leave the file system as is")
+	}
+}
+
+func TestWalkLinkTimeout(t *testing.T) {
+	root, clean := tempDir()
+	defer clean()
+
+	makeTree(t, root, map[string]string{"real/a": "a"})
+	if err := os.Symlink("real", filepath.Join(root, "link")); err != nil {
+		t.Fatal(err)
+	}
+
+	// Following the link, then resolving it to check it is not walked yet
+	for _, hung := range []string{"link", "real"} {
+		t.Run(hung, func(t *testing.T) {
+			sys := &hungFS{hung: filepath.Join(root, hung), release: make(chan struct{})}
+			defer close(sys.release)
+
+			err := fs.NewDirOn(sys, root).Walk(func(e fs.Entry) error {
+				return nil
+			}, fs.WalkFollowSymlinks(), fs.WalkTimeout(50*time.Millisecond))
+
+			if !os.IsTimeout(err) {
+				t.Errorf("expected the walk to time out, got %v", err)
+			}
+		})
+	}
+}
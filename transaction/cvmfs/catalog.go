@@ -0,0 +1,93 @@
+package cvmfs
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// RecommendedMaxEntries is the number of entries above which CVMFS
+// advises splitting a catalog with nested catalogs
+const RecommendedMaxEntries = 200000
+
+// CatalogStats describes a catalog of the repository
+type CatalogStats struct {
+	// Path is the repository path the catalog is rooted at
+	Path string
+
+	// Entries is the number of entries in the catalog
+	Entries int64
+
+	// Size is the size of the catalog file in bytes
+	Size int64
+}
+
+// Catalogs returns the statistics of the catalogs of the repository,
+// parsed from the machine readable output of cvmfs_server list-catalogs
+func (t *Transaction) Catalogs(ctx context.Context) ([]CatalogStats, error) {
+	out, err := t.runCmd(ctx, t.Repo, "list-catalogs", "-e", "-s", "-x")
+	if err != nil {
+		return nil, err
+	}
+
+	lines, _ := out.Lines()
+	return parseCatalogs(lines)
+}
+
+// parseCatalogs parses list-catalogs lines of the form
+// "<entries> <size> <path>", skipping empty ones
+func parseCatalogs(lines []string) ([]CatalogStats, error) {
+	var stats []CatalogStats
+	for _, line := range lines {
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+
+		if len(fields) < 3 {
+			return nil, fmt.Errorf("unexpected catalog line %q", line)
+		}
+
+		entries, err := strconv.ParseInt(fields[0], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("unexpected catalog entries in %q (%w)", line, err)
+		}
+
+		size, err := strconv.ParseInt(fields[1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("unexpected catalog size in %q (%w)", line, err)
+		}
+
+		stats = append(stats, CatalogStats{
+			Path:    strings.Join(fields[2:], " "),
+			Entries: entries,
+			Size:    size,
+		})
+	}
+
+	return stats, nil
+}
+
+// Oversized returns the catalogs with more than maxEntries entries,
+// RecommendedMaxEntries if <= 0, largest first. These are the ones
+// needing nested catalogs below them.
+func Oversized(stats []CatalogStats, maxEntries int64) []CatalogStats {
+	if maxEntries <= 0 {
+		maxEntries = RecommendedMaxEntries
+	}
+
+	var large []CatalogStats
+	for _, s := range stats {
+		if s.Entries > maxEntries {
+			large = append(large, s)
+		}
+	}
+
+	sort.Slice(large, func(i, j int) bool {
+		return large[i].Entries > large[j].Entries
+	})
+
+	return large
+}
@@ -0,0 +1,40 @@
+package cvmfs_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/brinick/fs/transaction"
+	"github.com/brinick/fs/transaction/cvmfs"
+)
+
+// outputExecutor returns the given stdout
+type outputExecutor struct {
+	stdout string
+}
+
+func (o outputExecutor) Run(ctx context.Context, cmd transaction.Command) (*transaction.Output, error) {
+	return &transaction.Output{Stdout: []byte(o.stdout)}, nil
+}
+
+func TestCatalogs(t *testing.T) {
+	exe := outputExecutor{"120 40960 /\n250000 9000000 /sw/x86_64\n\n300001 12000000 /sw/my dir\n"}
+
+	stats, err := newTransaction(exe, "").Catalogs(context.Background())
+	if err != nil {
+		t.Fatalf("unable to list catalogs: %v", err)
+	}
+
+	if len(stats) != 3 || stats[2].Path != "/sw/my dir" || stats[1].Size != 9000000 {
+		t.Fatalf("unexpected catalog stats %+v", stats)
+	}
+
+	large := cvmfs.Oversized(stats, 0)
+	if len(large) != 2 || large[0].Entries != 300001 {
+		t.Errorf("expected 2 oversized catalogs, largest first, got %+v", large)
+	}
+
+	if _, err := newTransaction(outputExecutor{"not a catalog\n"}, "").Catalogs(context.Background()); err == nil {
+		t.Errorf("expected error parsing unexpected output")
+	}
+}
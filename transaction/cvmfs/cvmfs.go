@@ -2,14 +2,13 @@ package cvmfs
 
 import (
 	"context"
-	"fmt"
-	"os/exec"
+	"errors"
 	"path/filepath"
+	"strings"
 
 	"github.com/brinick/fs"
 	"github.com/brinick/fs/transaction"
 	"github.com/brinick/logging"
-	"github.com/brinick/shell"
 )
 
 // Opts configures the CVMFS transaction
@@ -40,15 +39,10 @@ type Opts struct {
 	PublishAttemptsWait int `json:"publish_attempts_wait"`
 }
 
-func shellWithContext(ctx context.Context, cmd string, args ...string) error {
-	c := exec.CommandContext(ctx, cmd, args...)
-	return c.Run()
-}
-
 var (
-	// ErrTooManyAttempts is the error returned once the maximum number
-	// of allowed open transaction attempts is reached
-	ErrTooManyAttempts = fmt.Errorf("Too many attempts made to open transaction")
+	// ErrTooManyAttempts is matched by the error returned once the maximum
+	// number of allowed open transaction attempts is reached
+	ErrTooManyAttempts = transaction.ErrTooManyAttempts
 )
 
 // NewTransaction will create a transaction object and call
@@ -65,21 +59,35 @@ func NewTransaction(opts *Opts, log logging.Logger, nestedCatalogDirs ...string)
 		publishAttempts:     opts.MaxPublishAttempts,
 		publishAttemptsWait: opts.PublishAttemptsWait,
 		catalogDirs:         nestedCatalogDirs,
+		sudoUser:            opts.SudoUser,
+		log:                 log,
+		Exec:                transaction.ExecExecutor{},
 	}
 
 	t.Transaction.Starter = &t
 	t.Transaction.Stopper = &t
+	t.Transaction.Aborter = &t
 	return &t
 }
 
 // Transaction represents a CVMFS transaction
 type Transaction struct {
 	transaction.Transaction
-	Binary              string
-	Repo                string
-	Node                string
-	Root                string
+	Binary string
+	Repo   string
+	Node   string
+	Root   string
+
+	// Exec runs the cvmfs_server commands
+	Exec transaction.Executor
+
+	// Validate, if set, is called by Close on the published tree, as seen
+	// through the repository mount, rolling back to RollbackTag on failure
+	Validate    func(ctx context.Context, published *fs.Directory) error
+	RollbackTag string
+
 	log                 logging.Logger
+	sudoUser            string
 	openAttempts        int
 	publishAttempts     int
 	publishAttemptsWait int
@@ -101,49 +109,90 @@ func (t *Transaction) PublishAttemptsWait() int {
 	return t.publishAttemptsWait
 }
 
-// Start will open a new transaction. If one is already ongoing on
-// this node, it will return an error
+// Location returns the repository and root dir of the transaction
+func (t *Transaction) Location() (repo, root string) {
+	return t.Repo, t.Root
+}
+
+// Start will open a new transaction on the lease path. If one is
+// already ongoing on this node, or on an overlapping lease path in
+// this process, it will return an error, which is not retried
 func (t *Transaction) Start(ctx context.Context) error {
-	return transaction.OpenError{Err: t.execCmd(ctx, "transaction")}
+	path, err := t.LeasePath()
+	if err != nil {
+		return transaction.OpenError{Err: err}
+	}
+
+	if err := t.acquireLease(path); err != nil {
+		return transaction.OpenError{Err: transaction.FatalError{Err: err}}
+	}
+
+	err = t.execCmd(ctx, path, "transaction")
+	if err == nil {
+		return nil
+	}
+
+	t.releaseLease()
+
+	var cmdErr *transaction.CommandError
+	if errors.As(err, &cmdErr) && strings.Contains(cmdErr.Stderr(), "already in a transaction") {
+		err = transaction.FatalError{Err: err}
+	}
+
+	return transaction.OpenError{Err: err}
 }
 
 // Stop will exit the transaction after publishing
 func (t *Transaction) Stop(ctx context.Context) error {
 	// TODO: should we abort publish if we cannot create catalogs? Probably not.
 	createNestedCatalogs(t.catalogDirs...)
-	return transaction.CloseError{Err: t.execCmd(ctx, "publish")}
+	if err := t.execCmd(ctx, t.Repo, "publish"); err != nil {
+		return transaction.CloseError{Err: err}
+	}
+
+	t.releaseLease()
+	return nil
 }
 
 // Kill will halt the ongoing transaction forcefully
 // exiting without publishing
 func (t *Transaction) Kill(ctx context.Context) error {
-	return transaction.AbortError{Err: t.execCmd(ctx, "abort -f")}
+	if err := t.execCmd(ctx, t.Repo, "abort", "-f"); err != nil {
+		return transaction.AbortError{Err: err}
+	}
+
+	t.releaseLease()
+	return nil
 }
 
-func (t *Transaction) execCmd(ctx context.Context, cmd string) error {
-	path, err := t.relPath()
-	if err != nil {
-		return err
-	}
-	fullCmd := fmt.Sprintf("%s %s %s", t.Binary, cmd, path)
-	res := shell.Run(fullCmd, shell.Context(ctx))
-	t.log.InfoL(res.Stdout().Lines())
-	t.log.ErrorL(res.Stderr().Lines())
-	return res.Err()
+// execCmd runs the cvmfs_server subcommand with the given arguments on
+// the repository or lease path, as the sudo user if set, logging its output
+func (t *Transaction) execCmd(ctx context.Context, path string, args ...string) error {
+	_, err := t.runCmd(ctx, path, args...)
+	return err
 }
 
-// relPath returns the path below the repo root
-func (t *Transaction) relPath() (string, error) {
-	if t.Root == "" {
-		return t.Repo, nil
+// runCmd is execCmd, also returning the command output
+func (t *Transaction) runCmd(ctx context.Context, path string, args ...string) (*transaction.Output, error) {
+	cmd := transaction.Command{
+		Name: t.Binary,
+		Args: append(args, path),
+		User: t.sudoUser,
 	}
-	prefix := fmt.Sprintf("/cvmfs/%s/", t.Repo)
-	path, err := filepath.Rel(prefix, t.Root)
-	if err != nil {
-		err = fmt.Errorf("Unable to calculate root path: %v", err)
+
+	exe := t.Exec
+	if exe == nil {
+		exe = transaction.ExecExecutor{}
+	}
+
+	out, err := exe.Run(ctx, cmd)
+	if out != nil && t.log != nil {
+		stdout, stderr := out.Lines()
+		t.log.InfoL(stdout)
+		t.log.ErrorL(stderr)
 	}
 
-	return path, err
+	return out, err
 }
 
 func createNestedCatalogs(dirs ...string) error {
@@ -0,0 +1,85 @@
+package cvmfs
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/brinick/fs/transaction"
+)
+
+// ErrGCInTransaction is the error returned when garbage collecting
+// a repository while the transaction is open on it
+var ErrGCInTransaction = errors.New("cannot garbage collect during a transaction")
+
+// GCOpts configures the garbage collection of a repository.
+// Revisions matching either threshold are preserved.
+type GCOpts struct {
+	// KeepRevisions is the number of latest revisions preserved, if > 0
+	KeepRevisions int
+
+	// KeepSince preserves the revisions published since then, if not zero
+	KeepSince time.Time
+
+	// DryRun only reports what would be deleted
+	DryRun bool
+
+	// ListDeleted lists the deleted objects in the output
+	ListDeleted bool
+}
+
+// args returns the cvmfs_server gc arguments for the options
+func (o GCOpts) args() []string {
+	args := []string{"gc", "-f"}
+	if o.KeepRevisions > 0 {
+		args = append(args, "-r", strconv.Itoa(o.KeepRevisions))
+	}
+
+	if !o.KeepSince.IsZero() {
+		args = append(args, "-t", o.KeepSince.UTC().Format("2006-01-02 15:04:05 UTC"))
+	}
+
+	if o.DryRun {
+		args = append(args, "-d")
+	}
+
+	if o.ListDeleted {
+		args = append(args, "-l")
+	}
+
+	return args
+}
+
+// GC garbage collects the repository, deleting the objects only
+// referenced by revisions older than the thresholds, and returns the
+// output of cvmfs_server gc. It cannot run while the transaction is open.
+func (t *Transaction) GC(ctx context.Context, opts GCOpts) (*transaction.Output, error) {
+	if t.inTransaction() {
+		return nil, ErrGCInTransaction
+	}
+
+	return t.runCmd(ctx, t.Repo, opts.args()...)
+}
+
+// GCEvery garbage collects the repository every interval, first after
+// one interval, until ctx is done, calling done, if not nil, with the
+// outcome of each collection. Collections that would fall while the
+// transaction is open are skipped, with an ErrGCInTransaction outcome.
+// It returns the context error.
+func (t *Transaction) GCEvery(ctx context.Context, interval time.Duration, opts GCOpts, done func(*transaction.Output, error)) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+			out, err := t.GC(ctx, opts)
+			if done != nil {
+				done(out, err)
+			}
+		}
+	}
+}
@@ -0,0 +1,44 @@
+package cvmfs_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/brinick/fs/transaction/cvmfs"
+)
+
+func TestGC(t *testing.T) {
+	since := time.Date(2021, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name string
+		opts cvmfs.GCOpts
+		want string
+	}{
+		{"defaults", cvmfs.GCOpts{}, "cvmfs_server gc -f repo.cern.ch"},
+		{"revisions", cvmfs.GCOpts{KeepRevisions: 5, DryRun: true}, "cvmfs_server gc -f -r 5 -d repo.cern.ch"},
+		{"since", cvmfs.GCOpts{KeepSince: since, ListDeleted: true},
+			"cvmfs_server gc -f -t 2021-06-01 12:00:00 UTC -l repo.cern.ch"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			exe := &fakeExecutor{}
+			if _, err := newTransaction(exe, "").GC(context.Background(), tt.opts); err != nil {
+				t.Fatalf("unable to gc: %v", err)
+			}
+
+			if len(exe.cmds) != 1 || exe.cmds[0] != tt.want {
+				t.Errorf("expected command %q, got %q", tt.want, exe.cmds)
+			}
+		})
+	}
+
+	tr := newTransaction(&fakeExecutor{}, "/cvmfs/repo.cern.ch/gc")
+	tr.SetOngoing()
+	if _, err := tr.GC(context.Background(), cvmfs.GCOpts{}); !errors.Is(err, cvmfs.ErrGCInTransaction) {
+		t.Errorf("expected error collecting during transaction, got %v", err)
+	}
+}
@@ -0,0 +1,73 @@
+package cvmfs
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/brinick/fs"
+)
+
+// ErrLeaseConflict is the error returned when opening a transaction
+// on a path of a repository overlapping that of a transaction already
+// open in this process
+var ErrLeaseConflict = errors.New("lease path overlaps that of an open transaction")
+
+// leases are the lease paths of the transactions opened in this process
+var leases = struct {
+	sync.Mutex
+	held map[string]*Transaction
+}{held: map[string]*Transaction{}}
+
+// LeasePath returns the path on which the transaction is opened: the
+// repository name, followed by the path of RootDir below the
+// repository root, if set. With a gateway, transactions on disjoint
+// lease paths of a repository can be open at the same time.
+func (t *Transaction) LeasePath() (string, error) {
+	if t.Root == "" {
+		return t.Repo, nil
+	}
+
+	repoRoot := fmt.Sprintf("/cvmfs/%s", t.Repo)
+	path, err := fs.TranslatePath(t.Root, map[string]string{repoRoot: t.Repo})
+	if err != nil {
+		return "", fmt.Errorf("root dir %s is not below the repository root %s", t.Root, repoRoot)
+	}
+
+	return filepath.ToSlash(path), nil
+}
+
+// overlaps checks if one lease path is, or is below, the other
+func overlaps(a, b string) bool {
+	return a == b || strings.HasPrefix(a, b+"/") || strings.HasPrefix(b, a+"/")
+}
+
+// acquireLease registers the lease path of the transaction, failing
+// if it overlaps the lease of another transaction of the process
+func (t *Transaction) acquireLease(path string) error {
+	leases.Lock()
+	defer leases.Unlock()
+
+	for held, other := range leases.held {
+		if other != t && overlaps(path, held) {
+			return fmt.Errorf("%w: %s and %s", ErrLeaseConflict, path, held)
+		}
+	}
+
+	leases.held[path] = t
+	return nil
+}
+
+// releaseLease unregisters the lease path of the transaction
+func (t *Transaction) releaseLease() {
+	leases.Lock()
+	defer leases.Unlock()
+
+	for held, owner := range leases.held {
+		if owner == t {
+			delete(leases.held, held)
+		}
+	}
+}
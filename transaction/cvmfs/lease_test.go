@@ -0,0 +1,104 @@
+package cvmfs_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/brinick/fs/transaction"
+	"github.com/brinick/fs/transaction/cvmfs"
+)
+
+// fakeExecutor records the commands run, which all succeed
+type fakeExecutor struct {
+	cmds []string
+}
+
+func (f *fakeExecutor) Run(ctx context.Context, cmd transaction.Command) (*transaction.Output, error) {
+	f.cmds = append(f.cmds, cmd.String())
+	return &transaction.Output{}, nil
+}
+
+func newTransaction(exe transaction.Executor, root string) *cvmfs.Transaction {
+	t := cvmfs.NewTransaction(&cvmfs.Opts{
+		Binary:             "cvmfs_server",
+		NightlyRepo:        "repo.cern.ch",
+		RootDir:            root,
+		MaxOpenAttempts:    1,
+		MaxPublishAttempts: 1,
+	}, nil)
+	t.Exec = exe
+	return t
+}
+
+func TestLeases(t *testing.T) {
+	ctx := context.Background()
+	exe := &fakeExecutor{}
+
+	a := newTransaction(exe, "/cvmfs/repo.cern.ch/sw/a")
+	b := newTransaction(exe, "/cvmfs/repo.cern.ch/sw/b")
+	parent := newTransaction(exe, "/cvmfs/repo.cern.ch/sw")
+
+	if err := a.Open(ctx); err != nil {
+		t.Fatalf("unable to open transaction: %v", err)
+	}
+
+	if err := b.Open(ctx); err != nil {
+		t.Fatalf("unable to open transaction on disjoint path: %v", err)
+	}
+
+	if err := parent.Open(ctx); !errors.Is(err, cvmfs.ErrLeaseConflict) {
+		t.Errorf("expected lease conflict opening parent path, got %v", err)
+	}
+
+	for _, tr := range []*cvmfs.Transaction{a, b} {
+		if err := tr.Close(ctx); err != nil {
+			t.Fatalf("unable to close transaction: %v", err)
+		}
+	}
+
+	if err := parent.Open(ctx); err != nil {
+		t.Errorf("expected parent path free once closed, got %v", err)
+	}
+	parent.Abort(ctx)
+
+	want := []string{
+		"cvmfs_server transaction repo.cern.ch/sw/a",
+		"cvmfs_server transaction repo.cern.ch/sw/b",
+		"cvmfs_server publish repo.cern.ch",
+		"cvmfs_server publish repo.cern.ch",
+		"cvmfs_server transaction repo.cern.ch/sw",
+		"cvmfs_server abort -f repo.cern.ch",
+	}
+	if len(exe.cmds) != len(want) {
+		t.Fatalf("expected commands %q, got %q", want, exe.cmds)
+	}
+
+	for i := range want {
+		if exe.cmds[i] != want[i] {
+			t.Errorf("expected command %q, got %q", want[i], exe.cmds[i])
+		}
+	}
+}
+
+func TestLeasePath(t *testing.T) {
+	tests := []struct {
+		root string
+		want string
+		err  bool
+	}{
+		{"", "repo.cern.ch", false},
+		{"/cvmfs/repo.cern.ch", "repo.cern.ch", false},
+		{"/cvmfs/repo.cern.ch/sw/x", "repo.cern.ch/sw/x", false},
+		{"/cvmfs/other.cern.ch/sw", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.root, func(t *testing.T) {
+			got, err := newTransaction(nil, tt.root).LeasePath()
+			if (err != nil) != tt.err || got != tt.want {
+				t.Errorf("expected %q (error %v), got %q (%v)", tt.want, tt.err, got, err)
+			}
+		})
+	}
+}
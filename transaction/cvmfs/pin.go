@@ -0,0 +1,122 @@
+package cvmfs
+
+import (
+	"bytes"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/brinick/fs"
+)
+
+// PinSpec lists the repository paths, relative to the repository root
+// and starting with a slash, of the files that clients should preload
+// in their cache. It is written one path per line, e.g. for clients to
+// pin or preload the files deterministically.
+type PinSpec struct {
+	Paths []string
+}
+
+// NewPinSpec returns the pin spec of the files, given by their paths
+// below the repository mount point, e.g. /cvmfs/<repo>
+func NewPinSpec(repoRoot string, files *fs.Files) (*PinSpec, error) {
+	p := &PinSpec{}
+	for _, f := range *files {
+		rel, err := fs.RelTo(repoRoot, f.Path)
+		if err != nil {
+			return nil, fmt.Errorf("unable to pin %s (%w)", f.Path, err)
+		}
+
+		p.Add(rel)
+	}
+
+	return p, nil
+}
+
+// PinSpec returns the pin spec of the files, given by their paths
+// below the repository mount point /cvmfs/<repo>
+func (t *Transaction) PinSpec(files *fs.Files) (*PinSpec, error) {
+	return NewPinSpec("/cvmfs/"+t.Repo, files)
+}
+
+// ReadPinSpec reads the pin spec file. Empty lines and
+// comments, starting with #, are skipped.
+func ReadPinSpec(f *fs.File) (*PinSpec, error) {
+	lines, err := f.Lines()
+	if err != nil {
+		return nil, err
+	}
+
+	p := &PinSpec{}
+	for _, line := range lines {
+		if line = strings.TrimSpace(line); line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		p.Add(line)
+	}
+
+	return p, nil
+}
+
+// Add adds the repository paths to the spec, keeping it sorted and
+// without duplicates. Paths are cleaned and made to start with a slash.
+func (p *PinSpec) Add(paths ...string) {
+	for _, rel := range paths {
+		rel = path.Clean("/" + strings.ReplaceAll(rel, "\\", "/"))
+
+		i := sort.SearchStrings(p.Paths, rel)
+		if i < len(p.Paths) && p.Paths[i] == rel {
+			continue
+		}
+
+		p.Paths = append(p.Paths, "")
+		copy(p.Paths[i+1:], p.Paths[i:])
+		p.Paths[i] = rel
+	}
+}
+
+// Remove removes the repository paths, and those below them, from
+// the spec, e.g. when the files of a release are deleted
+func (p *PinSpec) Remove(paths ...string) {
+	kept := p.Paths[:0]
+	for _, pinned := range p.Paths {
+		removed := false
+		for _, rel := range paths {
+			rel = path.Clean("/" + rel)
+			if pinned == rel || strings.HasPrefix(pinned, strings.TrimSuffix(rel, "/")+"/") {
+				removed = true
+				break
+			}
+		}
+
+		if !removed {
+			kept = append(kept, pinned)
+		}
+	}
+
+	p.Paths = kept
+}
+
+// Merge adds the paths of the other spec
+func (p *PinSpec) Merge(other *PinSpec) {
+	p.Add(other.Paths...)
+}
+
+// Bytes returns the spec, one path per line
+func (p *PinSpec) Bytes() []byte {
+	var buf bytes.Buffer
+	for _, rel := range p.Paths {
+		buf.WriteString(rel)
+		buf.WriteByte('\n')
+	}
+
+	return buf.Bytes()
+}
+
+// Save atomically writes the spec to the file, creating
+// its directory if needed
+func (p *PinSpec) Save(f *fs.File) error {
+	return f.WriteAtomic(p.Bytes(), fs.EnsureDir(0))
+}
@@ -0,0 +1,71 @@
+package cvmfs_test
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/brinick/fs"
+	"github.com/brinick/fs/transaction/cvmfs"
+)
+
+func TestPinSpec(t *testing.T) {
+	files := fs.Files{
+		fs.NewFile("/cvmfs/repo.cern.ch/sw/22.0/lib/b.so"),
+		fs.NewFile("/cvmfs/repo.cern.ch/sw/22.0/lib/a.so"),
+		fs.NewFile("/cvmfs/repo.cern.ch/sw/22.0/lib/../lib/a.so"),
+		fs.NewFile("/cvmfs/repo.cern.ch/sw/21.0/bin/run"),
+	}
+
+	spec, err := newTransaction(outputExecutor{}, "").PinSpec(&files)
+	if err != nil {
+		t.Fatalf("unable to make pin spec: %v", err)
+	}
+
+	expect := "/sw/21.0/bin/run\n/sw/22.0/lib/a.so\n/sw/22.0/lib/b.so\n"
+	if got := string(spec.Bytes()); got != expect {
+		t.Errorf("expected spec %q, got %q", expect, got)
+	}
+
+	outside := fs.Files{fs.NewFile("/cvmfs/other.cern.ch/x")}
+	if _, err := cvmfs.NewPinSpec("/cvmfs/repo.cern.ch", &outside); !errors.Is(err, fs.ErrNotWithin) {
+		t.Errorf("expected ErrNotWithin, got %v", err)
+	}
+
+	dir, err := ioutil.TempDir("", "cvmfs-pin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	f := fs.NewFile(filepath.Join(dir, "pins", "repo.pin"))
+	if err := spec.Save(f); err != nil {
+		t.Fatalf("unable to save spec: %v", err)
+	}
+
+	extra := filepath.Join(dir, "extra.pin")
+	if err := ioutil.WriteFile(extra, []byte("# nightly\n\nsw/23.0/setup.sh\n/sw/22.0/lib/a.so\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	read, err := cvmfs.ReadPinSpec(f)
+	if err != nil {
+		t.Fatalf("unable to read spec: %v", err)
+	}
+
+	other, err := cvmfs.ReadPinSpec(fs.NewFile(extra))
+	if err != nil {
+		t.Fatalf("unable to read spec: %v", err)
+	}
+
+	read.Merge(other)
+	read.Remove("/sw/22.0/lib")
+
+	expect = "/sw/21.0/bin/run,/sw/23.0/setup.sh"
+	if got := strings.Join(read.Paths, ","); got != expect {
+		t.Errorf("expected paths %s, got %s", expect, got)
+	}
+}
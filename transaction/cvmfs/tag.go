@@ -0,0 +1,118 @@
+package cvmfs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/brinick/fs/transaction"
+)
+
+// ErrTagInTransaction is the error returned when changing the tags
+// of a repository while the transaction is open on it
+var ErrTagInTransaction = errors.New("cannot change tags during a transaction")
+
+// Tag is a named revision of the repository
+type Tag struct {
+	Name     string
+	Hash     string
+	Size     int64
+	Revision int64
+	Time     time.Time
+
+	// Description is the message given when creating the tag
+	Description string
+}
+
+// ListTags returns the tags of the repository, parsed from the machine
+// readable output of cvmfs_server tag
+func (t *Transaction) ListTags(ctx context.Context) ([]Tag, error) {
+	out, err := t.runCmd(ctx, t.Repo, "tag", "-l", "-x")
+	if err != nil {
+		return nil, err
+	}
+
+	lines, _ := out.Lines()
+	return parseTags(lines)
+}
+
+// parseTags parses tag lines of the form "<name> <hash> <size>
+// <revision> <timestamp> [<description>]", skipping empty ones
+func parseTags(lines []string) ([]Tag, error) {
+	var tags []Tag
+	for _, line := range lines {
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+
+		if len(fields) < 5 {
+			return nil, fmt.Errorf("unexpected tag line %q", line)
+		}
+
+		var nums [3]int64
+		for i, field := range fields[2:5] {
+			n, err := strconv.ParseInt(field, 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("unexpected tag field in %q (%w)", line, err)
+			}
+
+			nums[i] = n
+		}
+
+		tags = append(tags, Tag{
+			Name:        fields[0],
+			Hash:        fields[1],
+			Size:        nums[0],
+			Revision:    nums[1],
+			Time:        time.Unix(nums[2], 0),
+			Description: strings.Join(fields[5:], " "),
+		})
+	}
+
+	return tags, nil
+}
+
+// CreateTag tags the current revision of the repository with the name
+// and description. It cannot run while the transaction is open.
+func (t *Transaction) CreateTag(ctx context.Context, name, description string) error {
+	if t.inTransaction() {
+		return ErrTagInTransaction
+	}
+
+	args := []string{"tag", "-a", name}
+	if description != "" {
+		args = append(args, "-m", description)
+	}
+
+	return t.execCmd(ctx, t.Repo, args...)
+}
+
+// DeleteTag removes the named tag from the repository. It cannot
+// run while the transaction is open.
+func (t *Transaction) DeleteTag(ctx context.Context, name string) error {
+	if t.inTransaction() {
+		return ErrTagInTransaction
+	}
+
+	return t.execCmd(ctx, t.Repo, "tag", "-r", name, "-f")
+}
+
+// RollbackToTag reverts the repository to the named tag, publishing
+// it as a new revision. Unlike Rollback, the tag must be given.
+func (t *Transaction) RollbackToTag(ctx context.Context, name string) error {
+	if name == "" {
+		return fmt.Errorf("no tag to roll back to")
+	}
+
+	return t.Rollback(ctx, name)
+}
+
+// inTransaction checks if the transaction is open or being published
+func (t *Transaction) inTransaction() bool {
+	phase, _ := t.Phase()
+	return phase == transaction.Open || phase == transaction.Publishing
+}
@@ -0,0 +1,67 @@
+package cvmfs_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/brinick/fs/transaction/cvmfs"
+)
+
+func TestListTags(t *testing.T) {
+	exe := outputExecutor{"nightly-41 a1b2 4096 41 1622548800 first build\n\ntrunk c3d4 8192 42 1622635200\n"}
+
+	tags, err := newTransaction(exe, "").ListTags(context.Background())
+	if err != nil {
+		t.Fatalf("unable to list tags: %v", err)
+	}
+
+	if len(tags) != 2 || tags[0].Description != "first build" || tags[1].Revision != 42 || tags[1].Time.Unix() != 1622635200 {
+		t.Errorf("unexpected tags %+v", tags)
+	}
+
+	if _, err := newTransaction(outputExecutor{"trunk c3d4 size 42 1622635200\n"}, "").ListTags(context.Background()); err == nil {
+		t.Errorf("expected error parsing unexpected output")
+	}
+}
+
+func TestTagCommands(t *testing.T) {
+	tests := []struct {
+		name string
+		run  func(*cvmfs.Transaction) error
+		want string
+	}{
+		{"create", func(tr *cvmfs.Transaction) error {
+			return tr.CreateTag(context.Background(), "nightly-42", "before upgrade")
+		}, "cvmfs_server tag -a nightly-42 -m before upgrade repo.cern.ch"},
+		{"delete", func(tr *cvmfs.Transaction) error {
+			return tr.DeleteTag(context.Background(), "nightly-41")
+		}, "cvmfs_server tag -r nightly-41 -f repo.cern.ch"},
+		{"rollback", func(tr *cvmfs.Transaction) error {
+			return tr.RollbackToTag(context.Background(), "nightly-41")
+		}, "cvmfs_server rollback -f -t nightly-41 repo.cern.ch"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			exe := &fakeExecutor{}
+			if err := tt.run(newTransaction(exe, "")); err != nil {
+				t.Fatalf("unable to run: %v", err)
+			}
+
+			if len(exe.cmds) != 1 || exe.cmds[0] != tt.want {
+				t.Errorf("expected command %q, got %q", tt.want, exe.cmds)
+			}
+		})
+	}
+
+	tr := newTransaction(&fakeExecutor{}, "/cvmfs/repo.cern.ch/tag")
+	tr.SetOngoing()
+	if err := tr.CreateTag(context.Background(), "nightly-43", ""); !errors.Is(err, cvmfs.ErrTagInTransaction) {
+		t.Errorf("expected error tagging during transaction, got %v", err)
+	}
+
+	if err := newTransaction(&fakeExecutor{}, "").RollbackToTag(context.Background(), ""); err == nil {
+		t.Errorf("expected error rolling back to no tag")
+	}
+}
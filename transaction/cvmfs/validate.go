@@ -0,0 +1,77 @@
+package cvmfs
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/brinick/fs"
+	"github.com/brinick/fs/transaction"
+)
+
+// ValidationError is the error returned by Close when the published
+// tree fails validation
+type ValidationError struct {
+	// Err is the validation error
+	Err error
+
+	// RollbackErr is the error rolling back the repository, if it failed
+	RollbackErr error
+}
+
+func (e *ValidationError) Error() string {
+	msg := fmt.Sprintf("published tree failed validation: %v", e.Err)
+	if e.RollbackErr != nil {
+		msg += fmt.Sprintf(" (and unable to roll back: %v)", e.RollbackErr)
+	}
+
+	return msg
+}
+
+func (e *ValidationError) Unwrap() error {
+	return e.Err
+}
+
+// Close publishes the transaction. Then, if Validate is set, it is
+// called on the published tree, and should it fail, the repository
+// is rolled back to RollbackTag, the previous revision if empty, and
+// a *ValidationError is returned.
+func (t *Transaction) Close(ctx context.Context) error {
+	_, before := t.Phase()
+	if err := t.Transaction.Close(ctx); err != nil {
+		return err
+	}
+
+	// Only validate what this call published
+	phase, at := t.Phase()
+	if t.Validate == nil || phase != transaction.Published || at.Equal(before) {
+		return nil
+	}
+
+	path, err := t.LeasePath()
+	if err != nil {
+		return err
+	}
+
+	verr := t.Validate(ctx, fs.NewDirOn(nil, "/cvmfs", path))
+	if verr == nil {
+		return nil
+	}
+
+	return &ValidationError{Err: verr, RollbackErr: t.Rollback(ctx, t.RollbackTag)}
+}
+
+// Rollback reverts the repository to the given tag, or to the previous
+// revision if empty, publishing it as a new revision. It cannot run
+// while the transaction is open.
+func (t *Transaction) Rollback(ctx context.Context, tag string) error {
+	if t.inTransaction() {
+		return fmt.Errorf("cannot roll back during a transaction")
+	}
+
+	args := []string{"rollback", "-f"}
+	if tag != "" {
+		args = append(args, "-t", tag)
+	}
+
+	return t.execCmd(ctx, t.Repo, args...)
+}
@@ -0,0 +1,58 @@
+package cvmfs_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/brinick/fs"
+	"github.com/brinick/fs/transaction/cvmfs"
+)
+
+func TestValidate(t *testing.T) {
+	errInvalid := errors.New("missing setup script")
+
+	tests := []struct {
+		name     string
+		tag      string
+		validErr error
+		wantLast string
+	}{
+		{"valid", "", nil, "cvmfs_server publish repo.cern.ch"},
+		{"invalid", "", errInvalid, "cvmfs_server rollback -f repo.cern.ch"},
+		{"invalid to tag", "nightly-42", errInvalid, "cvmfs_server rollback -f -t nightly-42 repo.cern.ch"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			exe := &fakeExecutor{}
+			tr := newTransaction(exe, "/cvmfs/repo.cern.ch/sw/validate")
+			tr.RollbackTag = tt.tag
+
+			var validated string
+			tr.Validate = func(ctx context.Context, published *fs.Directory) error {
+				validated = published.Path
+				return tt.validErr
+			}
+
+			if err := tr.Open(ctx); err != nil {
+				t.Fatalf("unable to open: %v", err)
+			}
+
+			err := tr.Close(ctx)
+			var verr *cvmfs.ValidationError
+			if (tt.validErr != nil) != errors.As(err, &verr) || !errors.Is(err, tt.validErr) {
+				t.Errorf("expected validation error %v, got %v", tt.validErr, err)
+			}
+
+			if validated != "/cvmfs/repo.cern.ch/sw/validate" {
+				t.Errorf("expected published tree validated, got %q", validated)
+			}
+
+			if last := exe.cmds[len(exe.cmds)-1]; last != tt.wantLast {
+				t.Errorf("expected last command %q, got %q", tt.wantLast, last)
+			}
+		})
+	}
+}
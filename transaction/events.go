@@ -0,0 +1,79 @@
+package transaction
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/brinick/fs"
+)
+
+// Event types written to the event log
+const (
+	EventOpenAttempt    = "open_attempt"
+	EventOpen           = "open"
+	EventPublishAttempt = "publish_attempt"
+	EventPublish        = "publish"
+	EventAbort          = "abort"
+)
+
+// Event is an entry of the transaction event log. Attempt events are
+// logged for each try to open or publish, the others once done.
+type Event struct {
+	Time    time.Time `json:"time"`
+	Type    string    `json:"event"`
+	Attempt int       `json:"attempt,omitempty"`
+
+	// Duration is the time taken, in seconds
+	Duration float64 `json:"duration"`
+
+	// Error is the error of a failed step, if any
+	Error string `json:"error,omitempty"`
+}
+
+// logEvent appends the event of the step started at start, and ended
+// with err, to the event log, if any, as a JSON line. Failing to log
+// the event does not fail the transaction.
+func (t *Transaction) logEvent(typ string, attempt int, start time.Time, err error) {
+	if t.EventLog == nil {
+		return
+	}
+
+	e := Event{
+		Time:     time.Now(),
+		Type:     typ,
+		Attempt:  attempt,
+		Duration: time.Since(start).Seconds(),
+	}
+
+	if err != nil {
+		e.Error = err.Error()
+	}
+
+	line, jerr := json.Marshal(e)
+	if jerr != nil {
+		return
+	}
+
+	t.EventLog.Append(append(line, '\n'), fs.EnsureDir(0))
+}
+
+// logged runs the step fn and logs its event
+func (t *Transaction) logged(ctx context.Context, typ string, fn func(context.Context) error) error {
+	start := time.Now()
+	err := fn(ctx)
+	t.logEvent(typ, 0, start, err)
+	return err
+}
+
+// loggedAttempts returns fn, logging each call as a numbered attempt
+func (t *Transaction) loggedAttempts(typ string, fn func(context.Context) error) func(context.Context) error {
+	attempt := 0
+	return func(ctx context.Context) error {
+		attempt++
+		start := time.Now()
+		err := fn(ctx)
+		t.logEvent(typ, attempt, start, err)
+		return err
+	}
+}
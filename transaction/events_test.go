@@ -0,0 +1,100 @@
+package transaction_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/brinick/fs"
+	"github.com/brinick/fs/transaction"
+)
+
+// stubTransaction fails its starts with the errors listed
+type stubTransaction struct {
+	transaction.Transaction
+	startErrs []error
+}
+
+func (s *stubTransaction) Start(ctx context.Context) error {
+	if len(s.startErrs) == 0 {
+		return nil
+	}
+
+	err := s.startErrs[0]
+	s.startErrs = s.startErrs[1:]
+	return err
+}
+
+func (s *stubTransaction) Kill(ctx context.Context) error {
+	return nil
+}
+
+func newStub(startErrs ...error) *stubTransaction {
+	s := &stubTransaction{startErrs: startErrs}
+	s.Starter, s.Stopper, s.Aborter = s, s, s
+	return s
+}
+
+func TestEventLog(t *testing.T) {
+	dir, err := ioutil.TempDir("", "transaction")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	log := fs.NewFile(filepath.Join(dir, "logs", "events.jsonl"))
+	ctx := context.Background()
+
+	busy := newStub(transaction.FatalError{Err: errors.New("busy")})
+	busy.EventLog = log
+	if err := busy.Open(ctx); err == nil {
+		t.Fatalf("expected open error")
+	}
+
+	s := newStub()
+	s.EventLog = log
+	if err := s.Open(ctx); err != nil {
+		t.Fatalf("unable to open: %v", err)
+	}
+
+	if err := s.Close(ctx); err != nil {
+		t.Fatalf("unable to close: %v", err)
+	}
+
+	lines, err := log.Lines()
+	if err != nil {
+		t.Fatalf("unable to read event log: %v", err)
+	}
+
+	want := []struct {
+		typ     string
+		attempt int
+		failed  bool
+	}{
+		{transaction.EventOpenAttempt, 1, true},
+		{transaction.EventOpen, 0, true},
+		{transaction.EventOpenAttempt, 1, false},
+		{transaction.EventOpen, 0, false},
+		{transaction.EventPublishAttempt, 1, false},
+		{transaction.EventPublish, 0, false},
+	}
+
+	if len(lines) != len(want) {
+		t.Fatalf("expected %d events, got %d: %q", len(want), len(lines), lines)
+	}
+
+	for i, w := range want {
+		var e transaction.Event
+		if err := json.Unmarshal([]byte(lines[i]), &e); err != nil {
+			t.Fatalf("invalid event %q: %v", lines[i], err)
+		}
+
+		if e.Type != w.typ || e.Attempt != w.attempt || (e.Error != "") != w.failed {
+			t.Errorf("expected %s event (attempt %d, failed %v), got %+v", w.typ, w.attempt, w.failed, e)
+		}
+	}
+}
@@ -0,0 +1,131 @@
+package transaction
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// Command describes a command to execute
+type Command struct {
+	// Name is the program to run
+	Name string
+
+	// Args are the arguments passed to the program
+	Args []string
+
+	// Env lists KEY=value variables added to the current environment
+	Env []string
+
+	// User, if set, is the user as whom the command is run, using sudo
+	User string
+}
+
+func (c Command) String() string {
+	return strings.Join(c.argv(), " ")
+}
+
+// argv returns the full command line, wrapped with sudo if needed
+func (c Command) argv() []string {
+	argv := append([]string{c.Name}, c.Args...)
+	if c.User == "" {
+		return argv
+	}
+
+	// sudo resets the environment, so set it once user switched
+	wrapped := []string{"sudo", "-n", "-u", c.User, "--"}
+	if len(c.Env) > 0 {
+		wrapped = append(append(wrapped, "env"), c.Env...)
+	}
+
+	return append(wrapped, argv...)
+}
+
+// Output is the output captured from a command
+type Output struct {
+	Stdout []byte
+	Stderr []byte
+}
+
+// Lines returns the stdout and stderr lines
+func (o *Output) Lines() ([]string, []string) {
+	return splitLines(o.Stdout), splitLines(o.Stderr)
+}
+
+func splitLines(b []byte) []string {
+	s := strings.TrimRight(string(b), "\n")
+	if s == "" {
+		return nil
+	}
+
+	return strings.Split(s, "\n")
+}
+
+// CommandError is the error returned when a command fails,
+// with the output it produced
+type CommandError struct {
+	Cmd    Command
+	Output *Output
+	Err    error
+}
+
+func (e *CommandError) Error() string {
+	msg := fmt.Sprintf("command '%s' failed: %v", e.Cmd, e.Err)
+	if stderr := e.Stderr(); stderr != "" {
+		msg += ": " + stderr
+	}
+
+	return msg
+}
+
+// Stderr returns the trimmed stderr of the command,
+// empty if it has no output
+func (e *CommandError) Stderr() string {
+	if e.Output == nil {
+		return ""
+	}
+
+	return strings.TrimSpace(string(e.Output.Stderr))
+}
+
+func (e *CommandError) Unwrap() error {
+	return e.Err
+}
+
+// Executor runs commands on behalf of transactions. It can be replaced,
+// e.g. in tests, to check or fake the commands run.
+type Executor interface {
+	// Run runs the command to completion, returning its output.
+	// If the command fails, the error is a *CommandError.
+	Run(ctx context.Context, cmd Command) (*Output, error)
+}
+
+// ExecExecutor is the Executor running commands as local processes
+type ExecExecutor struct{}
+
+// Run runs the command as a local process, killed if ctx is done
+func (ExecExecutor) Run(ctx context.Context, cmd Command) (*Output, error) {
+	var stdout, stderr bytes.Buffer
+
+	argv := cmd.argv()
+	c := exec.CommandContext(ctx, argv[0], argv[1:]...)
+	c.Stdout = &stdout
+	c.Stderr = &stderr
+	if len(cmd.Env) > 0 && cmd.User == "" {
+		c.Env = append(os.Environ(), cmd.Env...)
+	}
+
+	err := c.Run()
+	out := &Output{Stdout: stdout.Bytes(), Stderr: stderr.Bytes()}
+	if err != nil {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			err = ctxErr
+		}
+		return out, &CommandError{Cmd: cmd, Output: out, Err: err}
+	}
+
+	return out, nil
+}
@@ -0,0 +1,62 @@
+package transaction_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/brinick/fs/transaction"
+)
+
+func TestCommandString(t *testing.T) {
+	tests := []struct {
+		name string
+		cmd  transaction.Command
+		want string
+	}{
+		{"plain", transaction.Command{Name: "ls", Args: []string{"-l"}}, "ls -l"},
+		{"env only", transaction.Command{Name: "ls", Env: []string{"A=1"}}, "ls"},
+		{"sudo", transaction.Command{Name: "ls", User: "cvmfs"}, "sudo -n -u cvmfs -- ls"},
+		{"sudo with env", transaction.Command{Name: "ls", Args: []string{"/"}, Env: []string{"A=1", "B=2"}, User: "cvmfs"},
+			"sudo -n -u cvmfs -- env A=1 B=2 ls /"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.cmd.String(); got != tt.want {
+				t.Errorf("expected %q, got %q", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestExecExecutor(t *testing.T) {
+	ctx := context.Background()
+	cmd := transaction.Command{Name: "sh", Args: []string{"-c", "echo $GREETING; echo oops >&2; exit 3"}, Env: []string{"GREETING=hello"}}
+
+	out, err := transaction.ExecExecutor{}.Run(ctx, cmd)
+	var cmdErr *transaction.CommandError
+	if !errors.As(err, &cmdErr) {
+		t.Fatalf("expected a command error, got %v", err)
+	}
+
+	if stdout, _ := out.Lines(); len(stdout) != 1 || stdout[0] != "hello" {
+		t.Errorf("expected the env passed to the command, got %q", stdout)
+	}
+
+	if cmdErr.Stderr() != "oops" || !strings.HasSuffix(err.Error(), ": oops") {
+		t.Errorf("expected the stderr in the error, got %v", err)
+	}
+}
+
+func TestCommandErrorNoOutput(t *testing.T) {
+	err := &transaction.CommandError{Cmd: transaction.Command{Name: "ls"}, Err: errors.New("not found")}
+	if got := err.Error(); got != "command 'ls' failed: not found" {
+		t.Errorf("unexpected error message %q", got)
+	}
+
+	if err.Stderr() != "" {
+		t.Errorf("expected no stderr, got %q", err.Stderr())
+	}
+}
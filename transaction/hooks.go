@@ -0,0 +1,161 @@
+package transaction
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// Hook is a function run around a phase of a transaction, e.g. to
+// generate catalogs, send notifications or record metrics. Hooks run
+// before a phase are given a nil error, and those run after it the
+// error, if any, with which it ended.
+type Hook func(ctx context.Context, err error) error
+
+// hookPoint is the point of the transaction life cycle a hook runs at
+type hookPoint int
+
+const (
+	beforeOpen hookPoint = iota
+	afterOpen
+	beforePublish
+	afterPublish
+	onAbort
+)
+
+var hookPointNames = map[hookPoint]string{
+	beforeOpen:    "before open",
+	afterOpen:     "after open",
+	beforePublish: "before publish",
+	afterPublish:  "after publish",
+	onAbort:       "abort",
+}
+
+// HookError is the error returned when a hook fails
+type HookError struct {
+	Point string
+	Err   error
+}
+
+func (e HookError) Error() string {
+	return fmt.Sprintf("Transaction %s hook error: %v", e.Point, e.Err)
+}
+
+func (e HookError) Unwrap() error {
+	return e.Err
+}
+
+// PhaseHookError is the error returned when a phase of the transaction
+// fails, and a hook run after it fails too. It wraps the error of the
+// phase, and matches the HookError with errors.Is.
+type PhaseHookError struct {
+	Err     error
+	HookErr HookError
+}
+
+func (e PhaseHookError) Error() string {
+	return fmt.Sprintf("%v (and %v)", e.Err, e.HookErr)
+}
+
+func (e PhaseHookError) Unwrap() error {
+	return e.Err
+}
+
+// Is reports if the hook error is target
+func (e PhaseHookError) Is(target error) bool {
+	return errors.Is(e.HookErr, target)
+}
+
+// openedHookError reports if err is that of an after open hook,
+// returned by Open once the transaction opened
+func openedHookError(err error) bool {
+	hookErr, ok := err.(HookError)
+	return ok && hookErr.Point == hookPointNames[afterOpen]
+}
+
+// OnBeforeOpen registers a hook run before opening the transaction.
+// If it fails, the transaction is not opened, and Open returns its
+// error in a HookError.
+func (t *Transaction) OnBeforeOpen(h Hook) {
+	t.addHook(beforeOpen, h)
+}
+
+// OnAfterOpen registers a hook run once opening the transaction
+// succeeded or failed. If it fails once the transaction is open, Open
+// returns its error in a HookError, the transaction being left open
+// for the caller to close or abort, as Run aborts it.
+func (t *Transaction) OnAfterOpen(h Hook) {
+	t.addHook(afterOpen, h)
+}
+
+// OnBeforePublish registers a hook run before publishing the
+// transaction. If it fails, the transaction is not published, and
+// Close returns its error in a HookError, the transaction still open.
+func (t *Transaction) OnBeforePublish(h Hook) {
+	t.addHook(beforePublish, h)
+}
+
+// OnAfterPublish registers a hook run once publishing the
+// transaction succeeded or failed
+func (t *Transaction) OnAfterPublish(h Hook) {
+	t.addHook(afterPublish, h)
+}
+
+// OnAbort registers a hook run once aborting the
+// transaction succeeded or failed
+func (t *Transaction) OnAbort(h Hook) {
+	t.addHook(onAbort, h)
+}
+
+// addHook registers h at the given point, after any already registered
+func (t *Transaction) addHook(point hookPoint, h Hook) {
+	t.hooksMu.Lock()
+	defer t.hooksMu.Unlock()
+
+	if t.hooks == nil {
+		t.hooks = map[hookPoint][]Hook{}
+	}
+
+	t.hooks[point] = append(t.hooks[point], h)
+}
+
+// before runs the hooks of the given point, in the order they were
+// registered, stopping at the first failing
+func (t *Transaction) before(ctx context.Context, point hookPoint) error {
+	for _, h := range t.hooksAt(point) {
+		if err := h(ctx, nil); err != nil {
+			return HookError{Point: hookPointNames[point], Err: err}
+		}
+	}
+
+	return nil
+}
+
+// after runs all of the hooks of the given point with err, the error
+// of the phase, and returns it, else the first of theirs, both in a
+// PhaseHookError if both failed
+func (t *Transaction) after(ctx context.Context, point hookPoint, err error) error {
+	var hookErr *HookError
+	for _, h := range t.hooksAt(point) {
+		if herr := h(ctx, err); herr != nil && hookErr == nil {
+			hookErr = &HookError{Point: hookPointNames[point], Err: herr}
+		}
+	}
+
+	switch {
+	case hookErr == nil:
+		return err
+	case err == nil:
+		return *hookErr
+	}
+
+	return PhaseHookError{Err: err, HookErr: *hookErr}
+}
+
+// hooksAt returns the hooks registered at the given point
+func (t *Transaction) hooksAt(point hookPoint) []Hook {
+	t.hooksMu.Lock()
+	defer t.hooksMu.Unlock()
+
+	return append([]Hook(nil), t.hooks[point]...)
+}
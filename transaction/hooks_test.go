@@ -0,0 +1,156 @@
+package transaction_test
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/brinick/fs/transaction"
+)
+
+func TestHooks(t *testing.T) {
+	ctx := context.Background()
+	errBusy := transaction.FatalError{Err: errors.New("busy")}
+	s := newStub(errBusy)
+
+	var calls []string
+	record := func(name string) transaction.Hook {
+		return func(ctx context.Context, err error) error {
+			call := name
+			if err != nil {
+				call += " failed"
+			}
+			calls = append(calls, call)
+			return nil
+		}
+	}
+
+	s.OnBeforeOpen(record("before open"))
+	s.OnAfterOpen(record("after open"))
+	s.OnBeforePublish(record("before publish"))
+	s.OnAfterPublish(record("after publish"))
+	s.OnAbort(record("abort"))
+
+	if err := s.Open(ctx); !errors.Is(err, errBusy.Err) {
+		t.Fatalf("expected the open error, got %v", err)
+	}
+
+	if err := s.Open(ctx); err != nil {
+		t.Fatalf("unable to open: %v", err)
+	}
+
+	if err := s.Close(ctx); err != nil {
+		t.Fatalf("unable to close: %v", err)
+	}
+
+	if err := s.Open(ctx); err != nil {
+		t.Fatalf("unable to open: %v", err)
+	}
+
+	if err := s.Abort(ctx); err != nil {
+		t.Fatalf("unable to abort: %v", err)
+	}
+
+	expect := []string{
+		"before open", "after open failed",
+		"before open", "after open",
+		"before publish", "after publish",
+		"before open", "after open",
+		"abort",
+	}
+
+	if !reflect.DeepEqual(calls, expect) {
+		t.Errorf("expected hook calls %v, got %v", expect, calls)
+	}
+}
+
+func TestHookErrors(t *testing.T) {
+	ctx := context.Background()
+	errVeto := errors.New("catalog generation failed")
+	s := newStub()
+
+	s.OnBeforePublish(func(ctx context.Context, err error) error {
+		return errVeto
+	})
+
+	var afterErr error
+	s.OnAfterPublish(func(ctx context.Context, err error) error {
+		afterErr = err
+		return nil
+	})
+
+	if err := s.Open(ctx); err != nil {
+		t.Fatalf("unable to open: %v", err)
+	}
+
+	var hookErr transaction.HookError
+	if err := s.Close(ctx); !errors.As(err, &hookErr) || !errors.Is(err, errVeto) {
+		t.Fatalf("expected the before publish hook error, got %v", err)
+	}
+
+	if !errors.Is(afterErr, errVeto) {
+		t.Errorf("expected the after publish hook given the error, got %v", afterErr)
+	}
+
+	if phase, _ := s.Phase(); phase != transaction.Open {
+		t.Errorf("expected the transaction still open, got %v", phase)
+	}
+
+	opened := newStub()
+	opened.OnAfterOpen(func(ctx context.Context, err error) error {
+		return errVeto
+	})
+
+	if err := opened.Open(ctx); !errors.As(err, &hookErr) || !errors.Is(err, errVeto) {
+		t.Errorf("expected the after open hook error, got %v", err)
+	}
+
+	if phase, _ := opened.Phase(); phase != transaction.Open {
+		t.Errorf("expected the transaction open, got %v", phase)
+	}
+
+	// Both the open and hook errors are returned
+	errBusy := errors.New("busy")
+	busy := newStub(transaction.FatalError{Err: errBusy})
+	busy.OnAfterOpen(func(ctx context.Context, err error) error {
+		return errVeto
+	})
+
+	var phaseErr transaction.PhaseHookError
+	if err := busy.Open(ctx); !errors.As(err, &phaseErr) || !errors.Is(err, errBusy) || !errors.Is(err, errVeto) {
+		t.Errorf("expected the open and after open hook errors, got %v", err)
+	}
+
+	// Run aborts the transaction opened
+	run := newStub()
+	run.OnAfterOpen(func(ctx context.Context, err error) error {
+		return errVeto
+	})
+
+	ran := false
+	err := transaction.Run(ctx, run, func(context.Context) error {
+		ran = true
+		return nil
+	})
+	if !errors.Is(err, errVeto) || ran {
+		t.Errorf("expected the run to fail before running, got %v", err)
+	}
+
+	if phase, _ := run.Phase(); phase != transaction.Aborted {
+		t.Errorf("expected the transaction aborted, got %v", phase)
+	}
+
+	errNotify := errors.New("notification failed")
+	s.OnAbort(func(ctx context.Context, err error) error {
+		return errNotify
+	})
+
+	if err := s.Abort(ctx); !errors.Is(err, errNotify) {
+		t.Errorf("expected the abort hook error, got %v", err)
+	}
+
+	if phase, _ := s.Phase(); phase != transaction.Aborted {
+		t.Errorf("expected the transaction aborted, got %v", phase)
+	}
+}
@@ -2,22 +2,44 @@ package localfs
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
 
+	"github.com/brinick/fs"
 	"github.com/brinick/fs/transaction"
 	"github.com/brinick/logging"
 )
 
+// ErrLocked is the error returned when opening a transaction
+// on a target with a transaction already open
+var ErrLocked = errors.New("target is locked by another transaction")
+
+// versionLayout is the layout of the version names, which sort in
+// the order they are created
+const versionLayout = "20060102T150405.000000000"
+
 // NewTransaction will create a transaction object and call
 // its open() method. The transaction Close() method should
 // be deferred immediately after calling this, assuming
 // no error was returned.
 func NewTransaction(opts *Opts, log logging.Logger) *Transaction {
 	t := Transaction{
+		Target:   opts.Target,
+		Keep:     opts.KeepVersions,
 		attempts: opts.MaxTransactionAttempts,
+		log:      log,
 	}
 
 	t.Transaction.Starter = &t
 	t.Transaction.Stopper = &t
+	t.Transaction.Aborter = &t
 	return &t
 }
 
@@ -28,16 +50,291 @@ type Opts struct {
 
 	// How many times we try to open our own localFS transaction
 	MaxTransactionAttempts int `json:"max_transaction_open_attempts"`
+
+	// Target is the path published, a symlink to the current version
+	Target string `json:"target"`
+
+	// KeepVersions is the number of published versions kept,
+	// including the current one, 0 keeping them all
+	KeepVersions int `json:"keep_versions"`
 }
 
-// Transaction represents a local filesystem transaction
+// Transaction represents a local filesystem transaction. The versions
+// of the target tree are kept in a versions directory next to it, the
+// target being a symlink to the current one. Opening the transaction
+// stages a copy of the current version, in which changes are made.
+// Publishing flips the symlink to the staged version, atomically, so
+// that readers see either the old or the new tree, never a mix of both.
 type Transaction struct {
 	transaction.Transaction
+
+	// Target is the path published
+	Target string
+
+	// Keep is the number of versions kept, 0 keeping them all
+	Keep int
+
+	log      logging.Logger
 	attempts int
+	lock     *fs.File
+	staging  string
+}
+
+// OpenAttempts provides the number of tries allowed for opening the transaction
+func (t *Transaction) OpenAttempts() int {
+	return t.attempts
+}
+
+// Location returns the target of the transaction, as its root
+func (t *Transaction) Location() (repo, root string) {
+	return "", t.Target
+}
+
+// VersionsDir returns the directory of the versions of the target
+func (t *Transaction) VersionsDir() string {
+	return filepath.Join(filepath.Dir(t.Target), "."+filepath.Base(t.Target)+".versions")
+}
+
+// Staging returns the directory in which the changes are
+// staged while the transaction is open, nil otherwise
+func (t *Transaction) Staging() *fs.Directory {
+	if t.staging == "" {
+		return nil
+	}
+
+	return fs.NewDirOn(nil, t.staging)
+}
+
+// Versions returns the names of the versions of the target, oldest first
+func (t *Transaction) Versions() ([]string, error) {
+	infos, err := ioutil.ReadDir(t.VersionsDir())
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	var versions []string
+	for _, info := range infos {
+		if info.IsDir() && !strings.HasPrefix(info.Name(), ".") {
+			versions = append(versions, info.Name())
+		}
+	}
+
+	sort.Strings(versions)
+	return versions, nil
+}
+
+// Start locks the target and stages a copy of its current version,
+// if any. If another transaction holds the lock, it returns an error
+// matching ErrLocked, which is not retried.
+func (t *Transaction) Start(ctx context.Context) error {
+	if t.Target == "" {
+		return transaction.OpenError{Err: transaction.FatalError{Err: errors.New("no target")}}
+	}
+
+	if err := t.checkTarget(); err != nil {
+		return transaction.OpenError{Err: transaction.FatalError{Err: err}}
+	}
+
+	versions := fs.NewDirOn(nil, t.VersionsDir())
+	if err := versions.EnsureExists(0755); err != nil {
+		return transaction.OpenError{Err: err}
+	}
+
+	lock := t.lockFile()
+	locked, err := lock.TryLock()
+	if err != nil {
+		return transaction.OpenError{Err: err}
+	}
+
+	if !locked {
+		return transaction.OpenError{Err: transaction.FatalError{Err: fmt.Errorf("%s: %w", t.Target, ErrLocked)}}
+	}
+
+	staging := filepath.Join(versions.Path, time.Now().UTC().Format(versionLayout))
+	if err := t.stage(ctx, staging); err != nil {
+		os.RemoveAll(staging)
+		lock.Unlock()
+		return transaction.OpenError{Err: err}
+	}
+
+	t.lock, t.staging = lock, staging
+	return nil
+}
+
+// Stop publishes the staged version by pointing the target to it,
+// then removes the versions beyond those kept
+func (t *Transaction) Stop(ctx context.Context) error {
+	if t.staging == "" {
+		return transaction.CloseError{Err: errors.New("no staged version to publish")}
+	}
+
+	// Symlink a temporary name, renamed over the target atomically.
+	// The link is relative, for the tree to be relocatable.
+	link := t.Target + ".publish"
+	target := filepath.Join(filepath.Base(t.VersionsDir()), filepath.Base(t.staging))
+	os.Remove(link)
+	if err := os.Symlink(target, link); err != nil {
+		return transaction.CloseError{Err: err}
+	}
+
+	if err := os.Rename(link, t.Target); err != nil {
+		os.Remove(link)
+		return transaction.CloseError{Err: err}
+	}
+
+	if err := t.prune(); err != nil && t.log != nil {
+		t.log.Error("unable to remove old versions", logging.F("err", err))
+	}
+
+	t.release()
+	return nil
 }
 
 // Kill will halt the ongoing transaction forcefully
 // exiting without publishing
 func (t *Transaction) Kill(ctx context.Context) error {
+	if t.staging != "" {
+		if err := os.RemoveAll(t.staging); err != nil {
+			return transaction.AbortError{Err: err}
+		}
+	}
+
+	t.release()
+	return nil
+}
+
+// resumeState is the state saved to resume the transaction
+type resumeState struct {
+	Staging string `json:"staging"`
+}
+
+// Suspend returns the state to resume the open transaction,
+// its staged version
+func (t *Transaction) Suspend() (json.RawMessage, error) {
+	if t.staging == "" {
+		return nil, errors.New("no staged version to resume")
+	}
+
+	return json.Marshal(resumeState{Staging: t.staging})
+}
+
+// Resume takes back the lock of the target, and the staged version,
+// of the transaction suspended. If another transaction holds the lock,
+// e.g. the one suspended, its process still running, it returns an
+// error matching ErrLocked.
+func (t *Transaction) Resume(data json.RawMessage) error {
+	var s resumeState
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+
+	if filepath.Dir(s.Staging) != t.VersionsDir() {
+		return fmt.Errorf("%s: not a version of %s", s.Staging, t.Target)
+	}
+
+	if _, err := os.Stat(s.Staging); err != nil {
+		return err
+	}
+
+	lock := t.lockFile()
+	locked, err := lock.TryLock()
+	if err != nil {
+		return err
+	}
+
+	if !locked {
+		return fmt.Errorf("%s: %w", t.Target, ErrLocked)
+	}
+
+	t.lock, t.staging = lock, s.Staging
+	return nil
+}
+
+// lockFile returns the file locked while the transaction is open
+func (t *Transaction) lockFile() *fs.File {
+	return fs.NewFile(filepath.Join(t.VersionsDir(), ".lock"))
+}
+
+// checkTarget checks that the target, if any, is a symlink, so that
+// it can be flipped rather than be replaced by the transaction
+func (t *Transaction) checkTarget() error {
+	info, err := os.Lstat(t.Target)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if info.Mode()&os.ModeSymlink == 0 {
+		return fmt.Errorf("%s: not a symlink to a version", t.Target)
+	}
+
 	return nil
 }
+
+// stage creates the staging directory, with a copy of the
+// current version of the target, if any
+func (t *Transaction) stage(ctx context.Context, staging string) error {
+	current, err := filepath.EvalSymlinks(t.Target)
+	if errors.Is(err, os.ErrNotExist) {
+		return os.Mkdir(staging, 0755)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	return fs.NewDirOn(nil, current).CopyToContext(
+		ctx,
+		staging,
+		fs.WithReflink(),
+		fs.WithPreserve(fs.PreserveAll),
+		fs.WithLinkRewrite(fs.RewriteLinksRelative),
+	)
+}
+
+// prune removes the oldest versions beyond those kept,
+// never the current one
+func (t *Transaction) prune() error {
+	if t.Keep <= 0 {
+		return nil
+	}
+
+	versions, err := t.Versions()
+	if err != nil {
+		return err
+	}
+
+	current := filepath.Base(t.staging)
+	var errs fs.MultiError
+	for i := 0; i < len(versions)-t.Keep; i++ {
+		if versions[i] == current {
+			continue
+		}
+
+		if err := os.RemoveAll(filepath.Join(t.VersionsDir(), versions[i])); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	if len(errs) == 0 {
+		return nil
+	}
+
+	return errs
+}
+
+// release ends the transaction, unlocking the target
+func (t *Transaction) release() {
+	if t.lock != nil {
+		t.lock.Unlock()
+	}
+
+	t.lock, t.staging = nil, ""
+}
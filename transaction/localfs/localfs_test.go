@@ -0,0 +1,164 @@
+package localfs_test
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/brinick/fs/transaction/localfs"
+)
+
+func newTransaction(target string) *localfs.Transaction {
+	return localfs.NewTransaction(&localfs.Opts{
+		Target:                 target,
+		KeepVersions:           2,
+		MaxTransactionAttempts: 1,
+	}, nil)
+}
+
+// publish runs a transaction writing the file name with content
+func publish(t *testing.T, target, name, content string) {
+	t.Helper()
+
+	ctx := context.Background()
+	tr := newTransaction(target)
+	if err := tr.Open(ctx); err != nil {
+		t.Fatalf("unable to open: %v", err)
+	}
+
+	if err := ioutil.WriteFile(filepath.Join(tr.Staging().Path, name), []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := tr.Close(ctx); err != nil {
+		t.Fatalf("unable to publish: %v", err)
+	}
+}
+
+func TestTransaction(t *testing.T) {
+	root, err := ioutil.TempDir("", "localfs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	target := filepath.Join(root, "sw")
+	publish(t, target, "a", "1")
+	publish(t, target, "b", "2")
+	publish(t, target, "a", "3")
+
+	for name, want := range map[string]string{"a": "3", "b": "2"} {
+		if data, _ := ioutil.ReadFile(filepath.Join(target, name)); string(data) != want {
+			t.Errorf("%s: expected %q published, got %q", name, want, data)
+		}
+	}
+
+	tr := newTransaction(target)
+	versions, err := tr.Versions()
+	if err != nil || len(versions) != 2 {
+		t.Fatalf("expected 2 versions kept, got %v (%v)", versions, err)
+	}
+
+	// Only one transaction at a time
+	ctx := context.Background()
+	if err := tr.Open(ctx); err != nil {
+		t.Fatalf("unable to open: %v", err)
+	}
+
+	if err := newTransaction(target).Open(ctx); !errors.Is(err, localfs.ErrLocked) {
+		t.Errorf("expected the target locked, got %v", err)
+	}
+
+	staging := tr.Staging().Path
+	if err := ioutil.WriteFile(filepath.Join(staging, "a"), []byte("aborted"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := tr.Abort(ctx); err != nil {
+		t.Fatalf("unable to abort: %v", err)
+	}
+
+	if _, err := os.Stat(staging); !os.IsNotExist(err) {
+		t.Errorf("expected the staging area discarded, got %v", err)
+	}
+
+	if data, _ := ioutil.ReadFile(filepath.Join(target, "a")); string(data) != "3" {
+		t.Errorf("expected the published version kept, got %q", data)
+	}
+
+	// The lock is released
+	publish(t, target, "c", "4")
+}
+
+func TestTransactionNotSymlink(t *testing.T) {
+	root, err := ioutil.TempDir("", "localfs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	if err := newTransaction(root).Open(context.Background()); err == nil {
+		t.Error("expected an error opening on a directory")
+	}
+}
+
+func TestLoadState(t *testing.T) {
+	// The process opening the transaction, which exits with it open
+	if path := os.Getenv("LOCALFS_STATE"); path != "" {
+		tr := newTransaction(os.Getenv("LOCALFS_TARGET"))
+		if err := tr.Open(context.Background()); err != nil {
+			os.Exit(1)
+		}
+
+		if err := ioutil.WriteFile(filepath.Join(tr.Staging().Path, "a"), []byte("2"), 0644); err != nil {
+			os.Exit(1)
+		}
+
+		if err := tr.SaveState(path); err != nil {
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+
+	root, err := ioutil.TempDir("", "localfs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	ctx := context.Background()
+	target := filepath.Join(root, "sw")
+	state := filepath.Join(root, "state.json")
+	publish(t, target, "a", "1")
+
+	cmd := exec.Command(os.Args[0], "-test.run=^TestLoadState$")
+	cmd.Env = append(os.Environ(), "LOCALFS_STATE="+state, "LOCALFS_TARGET="+target)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("unable to open the transaction: %v\n%s", err, out)
+	}
+
+	resumed := newTransaction(target)
+	if err := resumed.LoadState(state); err != nil {
+		t.Fatalf("unable to resume: %v", err)
+	}
+
+	// The lock is taken back
+	if err := newTransaction(target).LoadState(state); !errors.Is(err, localfs.ErrLocked) {
+		t.Errorf("expected the target locked, got %v", err)
+	}
+
+	if err := resumed.Close(ctx); err != nil {
+		t.Fatalf("unable to publish: %v", err)
+	}
+
+	if data, _ := ioutil.ReadFile(filepath.Join(target, "a")); string(data) != "2" {
+		t.Errorf("expected the resumed version published, got %q", data)
+	}
+
+	// The lock is released
+	publish(t, target, "b", "3")
+}
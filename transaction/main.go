@@ -2,9 +2,11 @@ package transaction
 
 import (
 	"context"
-	"errors"
 	"fmt"
+	"sync"
 	"time"
+
+	"github.com/brinick/fs"
 )
 
 // Transactioner defines the interface for file system transactions
@@ -46,6 +48,10 @@ func (t OpenError) Error() string {
 	return fmt.Sprintf("Transaction Open Error: %v", t.Err)
 }
 
+func (t OpenError) Unwrap() error {
+	return t.Err
+}
+
 type CloseError struct {
 	Err error
 }
@@ -54,6 +60,10 @@ func (t CloseError) Error() string {
 	return fmt.Sprintf("Transaction Close Error: %v", t.Err)
 }
 
+func (t CloseError) Unwrap() error {
+	return t.Err
+}
+
 type AbortError struct {
 	Err error
 }
@@ -62,6 +72,10 @@ func (t AbortError) Error() string {
 	return fmt.Sprintf("Transaction Abort Error: %v", t.Err)
 }
 
+func (t AbortError) Unwrap() error {
+	return t.Err
+}
+
 // Transaction is the base struct for transactions with specific
 // transaction handlers should embed
 type Transaction struct {
@@ -69,6 +83,37 @@ type Transaction struct {
 	Starter starter
 	Stopper stopper
 	Aborter aborter
+
+	// Classify classifies the errors of failed open and publish
+	// attempts, DefaultClassifier if nil. Only Retryable errors
+	// lead to further attempts.
+	Classify Classifier
+
+	// Retry, if set, is the policy of the open and publish attempts.
+	// Its Attempts, if 0, are those of the Starter and Stopper, and
+	// its Classify, if nil, is Classify. Its Wait, if 0, and the wait
+	// if no policy is set, is 10s between open attempts, and the
+	// Stopper wait between publish attempts. NoWait retries at once.
+	Retry *RetryPolicy
+
+	// OnPhase, if set, is called on each phase change, e.g. to display
+	// the progress of long publishes. It must not block.
+	OnPhase func(PhaseChange)
+
+	// EventLog, if set, is the file to which the open attempts,
+	// publishes and aborts are appended, as JSON lines of Event
+	EventLog *fs.File
+
+	// hooks are the hooks registered at each point, see OnBeforeOpen
+	hooksMu sync.Mutex
+	hooks   map[hookPoint][]Hook
+
+	// state is saved by SaveState, see State
+	state State
+
+	phaseMu   sync.Mutex
+	phase     Phase
+	phaseTime time.Time
 }
 
 // Open is the handler for opening a transaction
@@ -77,44 +122,72 @@ func (t *Transaction) Open(ctx context.Context) error {
 		return nil
 	}
 
-	var (
-		err      error
-		attempts = t.OpenAttempts()
-	)
-
-	for attempts > 0 {
-		err := t.Starter.Start(ctx)
-
-		// We break and return if no error returned (transaction opened ok),
-		// or the error is a context cancel/deadline related one. Any other
-		// error implies trying again to open the transaction.
-		if err == nil ||
-			errors.Is(err, context.Canceled) ||
-			errors.Is(err, context.DeadlineExceeded) {
-			// set ongoing true only if no error was returned
-			t.ongoing = (err == nil)
-			break
-		}
+	from, _ := t.Phase()
+	t.setPhase(Opening, nil)
+	err := t.before(ctx, beforeOpen)
+	if err == nil {
+		err = t.open(ctx)
+	}
 
-		attempts--
+	if t.ongoing {
+		t.setPhase(Open, nil)
+	} else {
+		t.setPhase(from, err)
+	}
 
-		// Wait 10 seconds (interruptible) between transaction attempts
-		select {
-		case <-time.After(time.Second * time.Duration(10)):
-		case <-ctx.Done():
-			return ctx.Err()
-		}
+	return t.after(ctx, afterOpen, err)
+}
+
+func (t *Transaction) open(ctx context.Context) error {
+	t.state = State{}
+	start := func(ctx context.Context) error {
+		t.state.OpenAttempts++
+		return t.Starter.Start(ctx)
+	}
+
+	err := t.logged(ctx, EventOpen, func(ctx context.Context) error {
+		return Retry(ctx, t.retryPolicy(t.Starter.OpenAttempts(), 10*time.Second),
+			t.loggedAttempts(EventOpenAttempt, start))
+	})
+
+	t.ongoing = (err == nil)
+	if t.ongoing {
+		t.state.Opened = time.Now()
 	}
 
 	return err
 }
 
+// retryPolicy returns the retry policy of the transaction, with
+// the given default attempts and wait, if not set by the policy
+func (t *Transaction) retryPolicy(attempts int, wait time.Duration) RetryPolicy {
+	p := RetryPolicy{Attempts: attempts, Wait: wait}
+	if t.Retry != nil {
+		p = *t.Retry
+		if p.Attempts == 0 {
+			p.Attempts = attempts
+		}
+
+		if p.Wait == 0 {
+			p.Wait = wait
+		}
+	}
+
+	if p.Classify == nil {
+		p.Classify = t.Classify
+	}
+
+	return p
+}
+
 // SetOngoing flips the ongoing flag to true.
 // This allows for a client script to open a transaction,
 // exit, then later re-create a new Transaction object and
-// call the transaction close.
+// call the transaction close. LoadState does so checking
+// the transaction is the one opened, from its saved state.
 func (t *Transaction) SetOngoing() {
 	t.ongoing = true
+	t.setPhase(Open, nil)
 }
 
 // Close will cleanly shut down the transaction
@@ -123,36 +196,36 @@ func (t *Transaction) Close(ctx context.Context) error {
 		return nil
 	}
 
-	var (
-		err      error
-		attempts = t.PublishAttempts()
-	)
-
-	for attempts > 0 {
-		err = t.Stopper.Stop(ctx)
-		// We break and return if no error returned (transaction opened ok),
-		// or the error is a context cancel/deadline related one. Any other
-		// error implies trying again to open the transaction.
-		if err == nil ||
-			errors.Is(err, context.Canceled) ||
-			errors.Is(err, context.DeadlineExceeded) {
-			// set ongoing false only if no error was returned
-			t.ongoing = (err != nil)
-			break
-		}
-
-		attempts--
-		// Wait 10 seconds (interruptible) between transaction attempts
-		select {
-		case <-time.After(time.Second * time.Duration(t.Stopper.PublishAttemptsWait())):
-		case <-ctx.Done():
-			return ctx.Err()
-		}
+	t.setPhase(Publishing, nil)
+	err := t.before(ctx, beforePublish)
+	if err == nil {
+		err = t.close(ctx)
 	}
 
 	if err != nil {
-		t.ongoing = false
+		t.setPhase(Open, err)
+	} else {
+		t.setPhase(Published, nil)
 	}
+
+	return t.after(ctx, afterPublish, err)
+}
+
+// close publishes the transaction. If it fails, the transaction
+// is still ongoing, and can be closed again or aborted.
+func (t *Transaction) close(ctx context.Context) error {
+	err := t.logged(ctx, EventPublish, func(ctx context.Context) error {
+		wait := time.Duration(t.Stopper.PublishAttemptsWait()) * time.Second
+		stop := func(ctx context.Context) error {
+			t.state.PublishAttempts++
+			return t.Stopper.Stop(ctx)
+		}
+
+		return Retry(ctx, t.retryPolicy(t.Stopper.PublishAttempts(), wait),
+			t.loggedAttempts(EventPublishAttempt, stop))
+	})
+
+	t.ongoing = (err != nil)
 	return err
 }
 
@@ -161,7 +234,18 @@ func (t *Transaction) Abort(ctx context.Context) error {
 	if !t.ongoing {
 		return nil
 	}
-	return t.Aborter.Kill(ctx)
+
+	from, _ := t.Phase()
+	t.setPhase(Aborting, nil)
+	err := t.logged(ctx, EventAbort, t.Aborter.Kill)
+	if err != nil {
+		t.setPhase(from, err)
+	} else {
+		t.ongoing = false
+		t.setPhase(Aborted, nil)
+	}
+
+	return t.after(ctx, onAbort, err)
 }
 
 // Start should be implemented by embedding transactions.
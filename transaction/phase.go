@@ -0,0 +1,69 @@
+package transaction
+
+import (
+	"time"
+)
+
+// Phase is the state of a transaction in its life cycle
+type Phase int
+
+const (
+	// Idle is the phase of a transaction never opened
+	Idle Phase = iota
+	Opening
+	Open
+	Publishing
+	Published
+	Aborting
+	Aborted
+)
+
+var phaseNames = map[Phase]string{
+	Idle:       "Idle",
+	Opening:    "Opening",
+	Open:       "Open",
+	Publishing: "Publishing",
+	Published:  "Published",
+	Aborting:   "Aborting",
+	Aborted:    "Aborted",
+}
+
+func (p Phase) String() string {
+	if name, ok := phaseNames[p]; ok {
+		return name
+	}
+
+	return "Unknown"
+}
+
+// PhaseChange reports the transition of a transaction from one phase
+// to another. If opening, publishing or aborting fails, the transaction
+// goes back to the phase it was in, and Err is the failure.
+type PhaseChange struct {
+	From Phase
+	To   Phase
+	Time time.Time
+	Err  error
+}
+
+// Phase returns the current phase of the transaction,
+// and the time at which it entered it
+func (t *Transaction) Phase() (Phase, time.Time) {
+	t.phaseMu.Lock()
+	defer t.phaseMu.Unlock()
+	return t.phase, t.phaseTime
+}
+
+// setPhase moves the transaction to the given phase,
+// reporting the change to the OnPhase callback if set
+func (t *Transaction) setPhase(p Phase, err error) {
+	t.phaseMu.Lock()
+	change := PhaseChange{From: t.phase, To: p, Time: time.Now(), Err: err}
+	t.phase, t.phaseTime = p, change.Time
+	onPhase := t.OnPhase
+	t.phaseMu.Unlock()
+
+	if onPhase != nil {
+		onPhase(change)
+	}
+}
@@ -0,0 +1,105 @@
+package transaction_test
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/brinick/fs/transaction"
+)
+
+// failingStub is a stubTransaction failing its first stop and kill
+type failingStub struct {
+	*stubTransaction
+	stopErr error
+	killErr error
+}
+
+func (f *failingStub) Stop(ctx context.Context) error {
+	err := f.stopErr
+	f.stopErr = nil
+	return err
+}
+
+func (f *failingStub) Kill(ctx context.Context) error {
+	err := f.killErr
+	f.killErr = nil
+	return err
+}
+
+func TestPhases(t *testing.T) {
+	ctx := context.Background()
+	errBusy := transaction.FatalError{Err: errors.New("busy")}
+	errPublish := transaction.FatalError{Err: errors.New("publish failed")}
+	errKill := errors.New("kill failed")
+
+	f := &failingStub{stubTransaction: newStub(errBusy), stopErr: errPublish, killErr: errKill}
+	f.Stopper, f.Aborter = f, f
+
+	var changes []transaction.PhaseChange
+	f.OnPhase = func(c transaction.PhaseChange) {
+		changes = append(changes, c)
+	}
+
+	if phase, _ := f.Phase(); phase != transaction.Idle {
+		t.Errorf("expected a new transaction idle, got %v", phase)
+	}
+
+	f.Open(ctx)
+	f.Open(ctx)
+	f.Close(ctx)
+	f.Abort(ctx)
+	f.Abort(ctx)
+
+	type step struct {
+		From, To transaction.Phase
+		Err      error
+	}
+
+	expect := []step{
+		{transaction.Idle, transaction.Opening, nil},
+		{transaction.Opening, transaction.Idle, errBusy.Err},
+		{transaction.Idle, transaction.Opening, nil},
+		{transaction.Opening, transaction.Open, nil},
+		{transaction.Open, transaction.Publishing, nil},
+		{transaction.Publishing, transaction.Open, errPublish.Err},
+		{transaction.Open, transaction.Aborting, nil},
+		{transaction.Aborting, transaction.Open, errKill},
+		{transaction.Open, transaction.Aborting, nil},
+		{transaction.Aborting, transaction.Aborted, nil},
+	}
+
+	var got []step
+	for i, c := range changes {
+		s := step{From: c.From, To: c.To, Err: c.Err}
+		if i < len(expect) && errors.Is(c.Err, expect[i].Err) {
+			// Wrapped by the transaction
+			s.Err = expect[i].Err
+		}
+
+		if i > 0 && c.Time.Before(changes[i-1].Time) {
+			t.Errorf("change %d: time went backwards", i)
+		}
+		got = append(got, s)
+	}
+
+	if !reflect.DeepEqual(got, expect) {
+		t.Errorf("expected phase changes %v, got %v", expect, got)
+	}
+
+	phase, at := f.Phase()
+	if phase != transaction.Aborted || !at.Equal(changes[len(changes)-1].Time) {
+		t.Errorf("expected the transaction aborted at the last change, got %v at %v", phase, at)
+	}
+}
+
+func TestPhaseString(t *testing.T) {
+	if got := transaction.Publishing.String(); got != "Publishing" {
+		t.Errorf("expected Publishing, got %q", got)
+	}
+
+	if got := transaction.Phase(42).String(); got != "Unknown" {
+		t.Errorf("expected Unknown, got %q", got)
+	}
+}
@@ -0,0 +1,177 @@
+package transaction
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"time"
+)
+
+// ErrTooManyAttempts is matched, with errors.Is, by the error
+// returned once all attempts of a retried operation failed
+var ErrTooManyAttempts = errors.New("too many attempts")
+
+// ErrorClass tells whether a failed attempt is worth retrying
+type ErrorClass int
+
+const (
+	// Retryable errors may go away on a later attempt
+	Retryable ErrorClass = iota
+
+	// Fatal errors would fail again, so end the retries
+	Fatal
+)
+
+// Classifier classifies the errors of failed attempts
+type Classifier func(error) ErrorClass
+
+// FatalError wraps an error to mark it as Fatal to DefaultClassifier,
+// e.g. a transaction already open, which retrying cannot fix
+type FatalError struct {
+	Err error
+}
+
+func (e FatalError) Error() string {
+	return e.Err.Error()
+}
+
+func (e FatalError) Unwrap() error {
+	return e.Err
+}
+
+// DefaultClassifier classifies context errors and FatalErrors
+// as Fatal, and all other errors as Retryable
+func DefaultClassifier(err error) ErrorClass {
+	var fatal FatalError
+	if errors.As(err, &fatal) ||
+		errors.Is(err, context.Canceled) ||
+		errors.Is(err, context.DeadlineExceeded) {
+		return Fatal
+	}
+
+	return Retryable
+}
+
+// AttemptsError is the error returned once all attempts failed
+type AttemptsError struct {
+	Attempts int
+
+	// Err is the error of the last attempt
+	Err error
+}
+
+func (e *AttemptsError) Error() string {
+	return fmt.Sprintf("%d attempts failed, last error: %v", e.Attempts, e.Err)
+}
+
+func (e *AttemptsError) Unwrap() error {
+	return e.Err
+}
+
+// Is matches ErrTooManyAttempts
+func (e *AttemptsError) Is(target error) bool {
+	return target == ErrTooManyAttempts
+}
+
+// NoWait is the Wait of the policies retrying at once, which
+// transactions tell from a Wait not set, given their default wait
+const NoWait time.Duration = -1
+
+// RetryPolicy configures Retry
+type RetryPolicy struct {
+	// Attempts is the maximum number of attempts, at least 1
+	Attempts int
+
+	// Wait is the time to wait between attempts, or before the
+	// second attempt if backing off. NoWait, or any negative
+	// wait, retries at once.
+	Wait time.Duration
+
+	// Backoff, if > 1, multiplies the wait after each attempt,
+	// up to MaxWait, if > 0, else the longest time.Duration
+	Backoff float64
+	MaxWait time.Duration
+
+	// Jitter randomly spreads each wait by up to this fraction of
+	// it, more or less, e.g. 0.1 for ±10%, so that the processes
+	// failing together do not retry in lockstep
+	Jitter float64
+
+	// MaxElapsed, if > 0, is the time after the first attempt
+	// past which no attempt is started
+	MaxElapsed time.Duration
+
+	// Classify classifies the errors, DefaultClassifier if nil
+	Classify Classifier
+}
+
+// wait returns the wait after the given attempt, starting at 1
+func (p RetryPolicy) wait(attempt int) time.Duration {
+	if p.Wait < 0 {
+		return 0
+	}
+
+	wait := float64(p.Wait)
+	if p.Backoff > 1 {
+		wait *= math.Pow(p.Backoff, float64(attempt-1))
+		if p.MaxWait > 0 && wait > float64(p.MaxWait) {
+			wait = float64(p.MaxWait)
+		}
+	}
+
+	if p.Jitter > 0 {
+		wait += wait * p.Jitter * (2*rand.Float64() - 1)
+	}
+
+	// Backing off long enough overflows
+	if wait >= math.MaxInt64 {
+		return math.MaxInt64
+	}
+
+	return time.Duration(wait)
+}
+
+// Retry calls fn until it succeeds, fails with a Fatal error, or has
+// been called the policy's number of attempts, or for its maximum
+// elapsed time, waiting between attempts. A Fatal error is returned
+// as is, running out of attempts or time returns an *AttemptsError.
+// If ctx is done while waiting, the context error is returned,
+// wrapping the last attempt error.
+func Retry(ctx context.Context, p RetryPolicy, fn func(context.Context) error) error {
+	classify := p.Classify
+	if classify == nil {
+		classify = DefaultClassifier
+	}
+
+	attempts := p.Attempts
+	if attempts < 1 {
+		attempts = 1
+	}
+
+	start := time.Now()
+	for attempt := 1; ; attempt++ {
+		err := fn(ctx)
+		if err == nil {
+			return nil
+		}
+
+		if classify(err) == Fatal {
+			return err
+		}
+
+		wait := p.wait(attempt)
+		if attempt >= attempts || p.MaxElapsed > 0 && wait > p.MaxElapsed-time.Since(start) {
+			return &AttemptsError{Attempts: attempt, Err: err}
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return fmt.Errorf("%w (last attempt: %v)", ctx.Err(), err)
+		}
+	}
+}
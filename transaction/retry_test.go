@@ -0,0 +1,162 @@
+package transaction_test
+
+import (
+	"context"
+	"errors"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/brinick/fs/transaction"
+)
+
+func TestRetry(t *testing.T) {
+	errFlaky := errors.New("flaky")
+	errOpen := transaction.FatalError{Err: errors.New("already in a transaction")}
+
+	tests := []struct {
+		name      string
+		errs      []error
+		classify  transaction.Classifier
+		wantCalls int
+		wantErr   error
+	}{
+		{"success", []error{nil}, nil, 1, nil},
+		{"success after retries", []error{errFlaky, errFlaky, nil}, nil, 3, nil},
+		{"out of attempts", []error{errFlaky, errFlaky, errFlaky}, nil, 3, transaction.ErrTooManyAttempts},
+		{"last error reported", []error{errOpen, errOpen, errFlaky}, func(error) transaction.ErrorClass {
+			return transaction.Retryable
+		}, 3, errFlaky},
+		{"fatal error", []error{errFlaky, transaction.OpenError{Err: errOpen}, nil}, nil, 2, errOpen},
+		{"custom classifier", []error{errFlaky, nil}, func(error) transaction.ErrorClass {
+			return transaction.Fatal
+		}, 1, errFlaky},
+		{"context error", []error{context.Canceled, nil}, nil, 1, context.Canceled},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls := 0
+			err := transaction.Retry(context.Background(), transaction.RetryPolicy{
+				Attempts: 3,
+				Wait:     time.Millisecond,
+				Classify: tt.classify,
+			}, func(context.Context) error {
+				calls++
+				return tt.errs[calls-1]
+			})
+
+			if calls != tt.wantCalls {
+				t.Errorf("expected %d calls, got %d", tt.wantCalls, calls)
+			}
+
+			if tt.wantErr == nil && err != nil || !errors.Is(err, tt.wantErr) {
+				t.Errorf("expected error %v, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestRetryCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	errFlaky := errors.New("flaky")
+
+	err := transaction.Retry(ctx, transaction.RetryPolicy{Attempts: 3, Wait: time.Hour}, func(context.Context) error {
+		cancel()
+		return errFlaky
+	})
+
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("expected cancelled error, got %v", err)
+	}
+}
+
+func TestRetryBackoff(t *testing.T) {
+	errFlaky := errors.New("flaky")
+
+	// Waits of 10, 20, then 40ms, which would go past the
+	// maximum elapsed time
+	calls := 0
+	start := time.Now()
+	err := transaction.Retry(context.Background(), transaction.RetryPolicy{
+		Attempts:   10,
+		Wait:       10 * time.Millisecond,
+		Backoff:    2,
+		Jitter:     0.1,
+		MaxElapsed: 50 * time.Millisecond,
+	}, func(context.Context) error {
+		calls++
+		return errFlaky
+	})
+
+	if calls != 3 {
+		t.Errorf("expected 3 calls, got %d", calls)
+	}
+
+	if !errors.Is(err, transaction.ErrTooManyAttempts) || !errors.Is(err, errFlaky) {
+		t.Errorf("expected too many attempts, got %v", err)
+	}
+
+	if elapsed := time.Since(start); elapsed < 27*time.Millisecond {
+		t.Errorf("expected backed off waits, took %v", elapsed)
+	}
+}
+
+func TestRetryBackoffOverflow(t *testing.T) {
+	errFlaky := errors.New("flaky")
+
+	// The second wait, longer than any time.Duration,
+	// goes past the maximum elapsed time
+	calls := 0
+	err := transaction.Retry(context.Background(), transaction.RetryPolicy{
+		Attempts:   3,
+		Wait:       time.Millisecond,
+		Backoff:    math.MaxFloat64,
+		MaxElapsed: time.Hour,
+	}, func(context.Context) error {
+		calls++
+		return errFlaky
+	})
+
+	if calls != 2 || !errors.Is(err, transaction.ErrTooManyAttempts) {
+		t.Errorf("expected too many attempts after 2 calls, got %d calls and %v", calls, err)
+	}
+}
+
+func TestTransactionRetry(t *testing.T) {
+	errFlaky := errors.New("flaky")
+	s := newStub(errFlaky, errFlaky, errFlaky, errFlaky)
+	s.Retry = &transaction.RetryPolicy{Wait: time.Millisecond}
+
+	// Attempts are those of the starter
+	if err := s.Open(context.Background()); !errors.Is(err, transaction.ErrTooManyAttempts) {
+		t.Fatalf("expected too many attempts, got %v", err)
+	}
+
+	s.Retry.Attempts = 4
+	if err := s.Open(context.Background()); err != nil {
+		t.Errorf("expected open once retried, got %v", err)
+	}
+}
+
+func TestTransactionRetryWait(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	// The policy without a wait waits the default 10s
+	s := newStub(errors.New("flaky"))
+	s.Retry = &transaction.RetryPolicy{Attempts: 2}
+	if err := s.Open(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected the open attempts to wait, got %v", err)
+	}
+
+	// Unless asked not to wait
+	ctx, cancel = context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	s = newStub(errors.New("flaky"))
+	s.Retry = &transaction.RetryPolicy{Attempts: 2, Wait: transaction.NoWait}
+	if err := s.Open(ctx); err != nil {
+		t.Errorf("expected the open retried at once, got %v", err)
+	}
+}
@@ -0,0 +1,401 @@
+package rsyncd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/brinick/fs"
+	"github.com/brinick/fs/transaction"
+	"github.com/brinick/logging"
+)
+
+// ErrLocked is the error returned when opening a transaction
+// on a target with a transaction already open
+var ErrLocked = errors.New("target is locked by another transaction")
+
+// lockName is the name of the lock file in the target directory
+const lockName = ".fs-transaction.lock"
+
+// Opts configures the rsync transaction
+type Opts struct {
+	// User with the necessary rights to install
+	SudoUser string `json:"sudo_user"`
+
+	// Host is the remote host, as user@host or host, to which changes
+	// are pushed. If empty, TargetDir is a local path, e.g. a network
+	// mount, to which changes are synced by the package itself.
+	Host string `json:"host"`
+
+	// TargetDir is the directory to which the changes are published
+	TargetDir string `json:"target_dir"`
+
+	// StagingDir is the local directory in which the changes are
+	// staged, a temporary directory if empty
+	StagingDir string `json:"staging_dir"`
+
+	// Paths to the rsync and ssh binaries, found in PATH if empty
+	RsyncBinary string `json:"rsync_binary"`
+	SSHBinary   string `json:"ssh_binary"`
+
+	// How many times we try to open the transaction before aborting
+	MaxOpenAttempts int `json:"max_open_attempts"`
+
+	// How many times we try to publish the transaction before aborting
+	MaxPublishAttempts int `json:"max_publish_attempts"`
+
+	// Seconds to wait between each attempt to publish
+	PublishAttemptsWait int `json:"publish_attempts_wait"`
+}
+
+// NewTransaction will create a transaction object and call
+// its open() method. The transaction Close() method should
+// be deferred immediately after calling this, assuming
+// no error was returned.
+func NewTransaction(opts *Opts, log logging.Logger) *Transaction {
+	t := Transaction{
+		Host:                opts.Host,
+		Target:              opts.TargetDir,
+		Rsync:               opts.RsyncBinary,
+		SSH:                 opts.SSHBinary,
+		stagingDir:          opts.StagingDir,
+		openAttempts:        opts.MaxOpenAttempts,
+		publishAttempts:     opts.MaxPublishAttempts,
+		publishAttemptsWait: opts.PublishAttemptsWait,
+		sudoUser:            opts.SudoUser,
+		log:                 log,
+		Exec:                transaction.ExecExecutor{},
+	}
+
+	if t.Rsync == "" {
+		t.Rsync = "rsync"
+	}
+
+	if t.SSH == "" {
+		t.SSH = "ssh"
+	}
+
+	t.Transaction.Starter = &t
+	t.Transaction.Stopper = &t
+	t.Transaction.Aborter = &t
+	return &t
+}
+
+// Transaction represents a transaction on a plain remote host. Changes
+// are staged in a local directory, and pushed with rsync on publish,
+// on top of the target content, which is otherwise left as is. While
+// open, the transaction holds a lock file in the target directory.
+type Transaction struct {
+	transaction.Transaction
+	Host   string
+	Target string
+	Rsync  string
+	SSH    string
+
+	// Exec runs the ssh and rsync commands
+	Exec transaction.Executor
+
+	log                 logging.Logger
+	sudoUser            string
+	stagingDir          string
+	staging             string
+	openAttempts        int
+	publishAttempts     int
+	publishAttemptsWait int
+}
+
+// OpenAttempts provides the number of tries allowed for opening the transaction
+func (t *Transaction) OpenAttempts() int {
+	return t.openAttempts
+}
+
+// PublishAttempts provides the number of tries allowed for publishing the transaction
+func (t *Transaction) PublishAttempts() int {
+	return t.publishAttempts
+}
+
+// PublishAttemptsWait provides the seconds to wait between publish attempts
+func (t *Transaction) PublishAttemptsWait() int {
+	return t.publishAttemptsWait
+}
+
+// Location returns the host and target dir of the transaction
+func (t *Transaction) Location() (repo, root string) {
+	return t.Host, t.Target
+}
+
+// Staging returns the directory in which the changes are
+// staged while the transaction is open, nil otherwise
+func (t *Transaction) Staging() *fs.Directory {
+	if t.staging == "" {
+		return nil
+	}
+
+	return fs.NewDirOn(nil, t.staging)
+}
+
+// LockPath returns the path of the lock file on the target
+func (t *Transaction) LockPath() string {
+	return filepath.ToSlash(filepath.Join(t.Target, lockName))
+}
+
+// Start acquires the lock file on the target, then creates the staging
+// directory. If another transaction holds the lock, it returns an error
+// matching ErrLocked, which is not retried.
+func (t *Transaction) Start(ctx context.Context) error {
+	if t.Target == "" {
+		return transaction.OpenError{Err: transaction.FatalError{Err: errors.New("no target dir")}}
+	}
+
+	if err := t.lock(ctx); err != nil {
+		return transaction.OpenError{Err: err}
+	}
+
+	staging, err := t.createStaging()
+	if err != nil {
+		t.unlock(ctx)
+		return transaction.OpenError{Err: err}
+	}
+
+	t.staging = staging
+	return nil
+}
+
+// Stop pushes the staged changes to the target, then releases
+// the lock and removes the staging directory
+func (t *Transaction) Stop(ctx context.Context) error {
+	if t.staging == "" {
+		return transaction.CloseError{Err: errors.New("no staged changes to publish")}
+	}
+
+	if err := t.push(ctx); err != nil {
+		return transaction.CloseError{Err: err}
+	}
+
+	t.release(ctx)
+	return nil
+}
+
+// Kill will halt the ongoing transaction forcefully
+// exiting without publishing
+func (t *Transaction) Kill(ctx context.Context) error {
+	if t.staging != "" {
+		if err := t.removeStaging(); err != nil {
+			return transaction.AbortError{Err: err}
+		}
+	}
+
+	if err := t.unlock(ctx); err != nil {
+		return transaction.AbortError{Err: err}
+	}
+
+	t.staging = ""
+	return nil
+}
+
+// resumeState is the state saved to resume the transaction
+type resumeState struct {
+	Staging string `json:"staging"`
+}
+
+// Suspend returns the state to resume the open transaction,
+// its staging directory, the lock file being left on the target
+func (t *Transaction) Suspend() (json.RawMessage, error) {
+	if t.staging == "" {
+		return nil, errors.New("no staged changes to resume")
+	}
+
+	return json.Marshal(resumeState{Staging: t.staging})
+}
+
+// Resume takes back the staging directory of the transaction suspended
+func (t *Transaction) Resume(data json.RawMessage) error {
+	var s resumeState
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+
+	if t.stagingDir != "" && filepath.Clean(s.Staging) != filepath.Clean(t.stagingDir) {
+		return fmt.Errorf("%s: not the staging dir %s", s.Staging, t.stagingDir)
+	}
+
+	info, err := os.Stat(s.Staging)
+	if err != nil {
+		return err
+	}
+
+	if !info.IsDir() {
+		return fmt.Errorf("%s: staging dir is not a directory", s.Staging)
+	}
+
+	t.staging = s.Staging
+	return nil
+}
+
+// lock creates the lock file on the target, failing if it exists
+func (t *Transaction) lock(ctx context.Context) error {
+	owner := lockOwner()
+	if t.Host == "" {
+		if err := os.MkdirAll(t.Target, 0755); err != nil {
+			return err
+		}
+
+		fd, err := os.OpenFile(t.LockPath(), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+		if errors.Is(err, os.ErrExist) {
+			return transaction.FatalError{Err: fmt.Errorf("%s: %w", t.Target, ErrLocked)}
+		}
+
+		if err != nil {
+			return err
+		}
+
+		_, err = fd.WriteString(owner + "\n")
+		if cerr := fd.Close(); err == nil {
+			err = cerr
+		}
+		return err
+	}
+
+	// The noclobber option makes the redirection fail if the file exists
+	script := fmt.Sprintf("mkdir -p %s && set -C && echo %s > %s",
+		shellQuote(t.Target), shellQuote(owner), shellQuote(t.LockPath()))
+
+	_, err := t.runCmd(ctx, t.SSH, t.Host, script)
+	var cmdErr *transaction.CommandError
+	if errors.As(err, &cmdErr) && strings.Contains(strings.ToLower(cmdErr.Stderr()), "exist") {
+		return transaction.FatalError{Err: fmt.Errorf("%s:%s: %w", t.Host, t.Target, ErrLocked)}
+	}
+
+	return err
+}
+
+// unlock removes the lock file from the target
+func (t *Transaction) unlock(ctx context.Context) error {
+	if t.Host == "" {
+		err := os.Remove(t.LockPath())
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+
+	_, err := t.runCmd(ctx, t.SSH, t.Host, "rm -f "+shellQuote(t.LockPath()))
+	return err
+}
+
+// push copies the staged changes to the target, with rsync, or
+// by syncing them without deletions if the target is local
+func (t *Transaction) push(ctx context.Context) error {
+	if t.Host == "" {
+		_, err := fs.SyncContext(ctx, t.staging, t.Target, fs.SyncOptions{Exclude: []string{lockName}})
+		return err
+	}
+
+	_, err := t.runCmd(ctx, t.Rsync,
+		"-a",
+		"--exclude="+lockName,
+		"-e", t.SSH,
+		t.staging+"/",
+		t.Host+":"+t.Target+"/",
+	)
+
+	return err
+}
+
+// release ends the transaction once published, on a best effort basis,
+// the changes being published whatever the outcome
+func (t *Transaction) release(ctx context.Context) {
+	if err := t.unlock(ctx); err != nil && t.log != nil {
+		t.log.Error("unable to release the transaction lock", logging.F("err", err))
+	}
+
+	if err := t.removeStaging(); err != nil && t.log != nil {
+		t.log.Error("unable to remove the staging dir", logging.F("err", err))
+	}
+
+	t.staging = ""
+}
+
+// createStaging creates the staging directory, which must be empty
+// if it exists, not to publish changes left by an earlier transaction
+func (t *Transaction) createStaging() (string, error) {
+	if t.stagingDir == "" {
+		return ioutil.TempDir("", "rsyncd-staging")
+	}
+
+	if err := os.MkdirAll(t.stagingDir, 0755); err != nil {
+		return "", err
+	}
+
+	infos, err := ioutil.ReadDir(t.stagingDir)
+	if err != nil {
+		return "", err
+	}
+
+	if len(infos) > 0 {
+		return "", transaction.FatalError{Err: fmt.Errorf("staging dir %s is not empty", t.stagingDir)}
+	}
+
+	return t.stagingDir, nil
+}
+
+// removeStaging removes the staging directory, or
+// only its content if it was configured
+func (t *Transaction) removeStaging() error {
+	if t.stagingDir == "" {
+		return os.RemoveAll(t.staging)
+	}
+
+	infos, err := ioutil.ReadDir(t.staging)
+	if err != nil {
+		return err
+	}
+
+	for _, info := range infos {
+		if err := os.RemoveAll(filepath.Join(t.staging, info.Name())); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// runCmd runs the command, as the sudo user if set, logging its output
+func (t *Transaction) runCmd(ctx context.Context, name string, args ...string) (*transaction.Output, error) {
+	cmd := transaction.Command{
+		Name: name,
+		Args: args,
+		User: t.sudoUser,
+	}
+
+	exe := t.Exec
+	if exe == nil {
+		exe = transaction.ExecExecutor{}
+	}
+
+	out, err := exe.Run(ctx, cmd)
+	if out != nil && t.log != nil {
+		stdout, stderr := out.Lines()
+		t.log.InfoL(stdout)
+		t.log.ErrorL(stderr)
+	}
+
+	return out, err
+}
+
+// lockOwner identifies the process holding the lock,
+// for stale locks to be traced back
+func lockOwner() string {
+	host, _ := os.Hostname()
+	return fmt.Sprintf("%s:%d", host, os.Getpid())
+}
+
+// shellQuote quotes s for the remote shell
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
@@ -0,0 +1,177 @@
+package rsyncd_test
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/brinick/fs/transaction"
+	"github.com/brinick/fs/transaction/rsyncd"
+)
+
+// fakeExecutor records the commands run, failing
+// those containing fail with its stderr
+type fakeExecutor struct {
+	cmds   []string
+	fail   string
+	stderr string
+}
+
+func (f *fakeExecutor) Run(ctx context.Context, cmd transaction.Command) (*transaction.Output, error) {
+	f.cmds = append(f.cmds, cmd.String())
+	out := &transaction.Output{}
+	if f.fail != "" && strings.Contains(cmd.String(), f.fail) {
+		out.Stderr = []byte(f.stderr)
+		return out, &transaction.CommandError{Cmd: cmd, Output: out, Err: errors.New("exit status 1")}
+	}
+
+	return out, nil
+}
+
+func newTransaction(host, target string, exe transaction.Executor) *rsyncd.Transaction {
+	t := rsyncd.NewTransaction(&rsyncd.Opts{
+		Host:               host,
+		TargetDir:          target,
+		MaxOpenAttempts:    1,
+		MaxPublishAttempts: 1,
+	}, nil)
+	t.Exec = exe
+	return t
+}
+
+func TestRemoteTransaction(t *testing.T) {
+	ctx := context.Background()
+	exe := &fakeExecutor{}
+	tr := newTransaction("user@host", "/sw", exe)
+
+	if err := tr.Open(ctx); err != nil {
+		t.Fatalf("unable to open: %v", err)
+	}
+
+	staging := tr.Staging().Path
+	if err := tr.Close(ctx); err != nil {
+		t.Fatalf("unable to publish: %v", err)
+	}
+
+	if _, err := os.Stat(staging); !os.IsNotExist(err) {
+		t.Errorf("expected the staging dir removed, got %v", err)
+	}
+
+	want := []string{
+		"ssh user@host mkdir -p '/sw' && set -C && echo",
+		"rsync -a --exclude=.fs-transaction.lock -e ssh " + staging + "/ user@host:/sw/",
+		"ssh user@host rm -f '/sw/.fs-transaction.lock'",
+	}
+
+	if len(exe.cmds) != len(want) {
+		t.Fatalf("expected %d commands, got %v", len(want), exe.cmds)
+	}
+
+	for i, cmd := range exe.cmds {
+		if !strings.HasPrefix(cmd, want[i]) {
+			t.Errorf("expected command %q, got %q", want[i], cmd)
+		}
+	}
+
+	locked := &fakeExecutor{fail: "set -C", stderr: "sh: /sw/.fs-transaction.lock: cannot overwrite existing file"}
+	if err := newTransaction("host", "/sw", locked).Open(ctx); !errors.Is(err, rsyncd.ErrLocked) {
+		t.Errorf("expected the target locked, got %v", err)
+	}
+}
+
+func TestLocalTransaction(t *testing.T) {
+	root, err := ioutil.TempDir("", "rsyncd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	ctx := context.Background()
+	target := filepath.Join(root, "sw")
+	tr := newTransaction("", target, nil)
+
+	if err := tr.Open(ctx); err != nil {
+		t.Fatalf("unable to open: %v", err)
+	}
+
+	if err := newTransaction("", target, nil).Open(ctx); !errors.Is(err, rsyncd.ErrLocked) {
+		t.Errorf("expected the target locked, got %v", err)
+	}
+
+	if err := ioutil.WriteFile(filepath.Join(tr.Staging().Path, "a"), []byte("a"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := tr.Close(ctx); err != nil {
+		t.Fatalf("unable to publish: %v", err)
+	}
+
+	infos, _ := ioutil.ReadDir(target)
+	if len(infos) != 1 || infos[0].Name() != "a" {
+		t.Errorf("expected only a published, got %d entries", len(infos))
+	}
+
+	// Aborted changes are discarded
+	if err := tr.Open(ctx); err != nil {
+		t.Fatalf("unable to open again: %v", err)
+	}
+
+	if err := ioutil.WriteFile(filepath.Join(tr.Staging().Path, "b"), []byte("b"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := tr.Abort(ctx); err != nil {
+		t.Fatalf("unable to abort: %v", err)
+	}
+
+	if _, err := os.Stat(filepath.Join(target, "b")); !os.IsNotExist(err) {
+		t.Errorf("expected b not published, got %v", err)
+	}
+}
+
+func TestLoadState(t *testing.T) {
+	root, err := ioutil.TempDir("", "rsyncd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	ctx := context.Background()
+	state := filepath.Join(root, "state.json")
+	tr := newTransaction("user@host", "/sw", &fakeExecutor{})
+	if err := tr.Open(ctx); err != nil {
+		t.Fatalf("unable to open: %v", err)
+	}
+
+	if err := tr.SaveState(state); err != nil {
+		t.Fatalf("unable to save the state: %v", err)
+	}
+
+	exe := &fakeExecutor{}
+	resumed := newTransaction("user@host", "/sw", exe)
+	if err := resumed.LoadState(state); err != nil {
+		t.Fatalf("unable to resume: %v", err)
+	}
+
+	staging := tr.Staging().Path
+	if got := resumed.Staging(); got == nil || got.Path != staging {
+		t.Fatalf("expected the staging dir %s resumed, got %v", staging, got)
+	}
+
+	if err := resumed.Close(ctx); err != nil {
+		t.Fatalf("unable to publish: %v", err)
+	}
+
+	if want := "rsync -a --exclude=.fs-transaction.lock -e ssh " + staging + "/ user@host:/sw/"; len(exe.cmds) == 0 || exe.cmds[0] != want {
+		t.Errorf("expected the resumed staging dir pushed, got %v", exe.cmds)
+	}
+
+	// The staging dir is gone
+	if err := newTransaction("user@host", "/sw", exe).LoadState(state); err == nil {
+		t.Errorf("expected an error resuming a published transaction")
+	}
+}
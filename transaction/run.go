@@ -0,0 +1,81 @@
+package transaction
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// Runner is a transaction that can be opened, then closed or aborted,
+// as are those embedding Transaction
+type Runner interface {
+	Open(context.Context) error
+	Close(context.Context) error
+	Abort(context.Context) error
+}
+
+// RunAbortError is the error returned by Run when aborting the
+// transaction, after fn or closing failed, fails too. It wraps the
+// error of the failed step, and matches the abort error with errors.Is.
+type RunAbortError struct {
+	Err      error
+	AbortErr error
+}
+
+func (e RunAbortError) Error() string {
+	return fmt.Sprintf("%v (and unable to abort transaction: %v)", e.Err, e.AbortErr)
+}
+
+func (e RunAbortError) Unwrap() error {
+	return e.Err
+}
+
+// Is reports if the abort error is target
+func (e RunAbortError) Is(target error) bool {
+	return errors.Is(e.AbortErr, target)
+}
+
+// Run opens the transaction, runs fn in it, then closes it if fn
+// succeeds, or aborts it if fn or closing fails, or fn panics, the
+// panic being raised again once aborted, or if an after open hook
+// fails. The error is that of the first step that failed, in a
+// RunAbortError if aborting failed too.
+func Run(ctx context.Context, t Runner, fn func(context.Context) error) error {
+	if err := t.Open(ctx); err != nil {
+		if !openedHookError(err) {
+			return err
+		}
+
+		if abortErr := abort(t); abortErr != nil {
+			return RunAbortError{Err: err, AbortErr: abortErr}
+		}
+
+		return err
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			abort(t)
+			panic(r)
+		}
+	}()
+
+	err := fn(ctx)
+	if err == nil {
+		if err = t.Close(ctx); err == nil {
+			return nil
+		}
+	}
+
+	if abortErr := abort(t); abortErr != nil {
+		return RunAbortError{Err: err, AbortErr: abortErr}
+	}
+
+	return err
+}
+
+// abort aborts the transaction, even if the context of the
+// run is done, which is often why it is being aborted
+func abort(t Runner) error {
+	return t.Abort(context.Background())
+}
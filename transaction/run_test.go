@@ -0,0 +1,94 @@
+package transaction_test
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/brinick/fs/transaction"
+)
+
+// runner records the steps run, failing those with an error
+type runner struct {
+	steps []string
+	errs  map[string]error
+}
+
+func (r *runner) step(name string) error {
+	r.steps = append(r.steps, name)
+	return r.errs[name]
+}
+
+func (r *runner) Open(context.Context) error  { return r.step("open") }
+func (r *runner) Close(context.Context) error { return r.step("close") }
+func (r *runner) Abort(context.Context) error { return r.step("abort") }
+
+func TestRun(t *testing.T) {
+	errFn := errors.New("build failed")
+	errOpen := errors.New("busy")
+	errClose := errors.New("publish failed")
+	errAbort := errors.New("abort failed")
+
+	tests := []struct {
+		name      string
+		errs      map[string]error
+		wantSteps []string
+		wantErrs  []error
+	}{
+		{"success", nil, []string{"open", "fn", "close"}, nil},
+		{"open error", map[string]error{"open": errOpen}, []string{"open"}, []error{errOpen}},
+		{"fn error", map[string]error{"fn": errFn}, []string{"open", "fn", "abort"}, []error{errFn}},
+		{"fn and abort errors", map[string]error{"fn": errFn, "abort": errAbort},
+			[]string{"open", "fn", "abort"}, []error{errFn, errAbort}},
+		{"close error", map[string]error{"close": errClose},
+			[]string{"open", "fn", "close", "abort"}, []error{errClose}},
+		{"close and abort errors", map[string]error{"close": errClose, "abort": errAbort},
+			[]string{"open", "fn", "close", "abort"}, []error{errClose, errAbort}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := &runner{errs: tt.errs}
+			err := transaction.Run(context.Background(), r, func(context.Context) error {
+				return r.step("fn")
+			})
+
+			if !reflect.DeepEqual(r.steps, tt.wantSteps) {
+				t.Errorf("expected steps %v, got %v", tt.wantSteps, r.steps)
+			}
+
+			if tt.wantErrs == nil && err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+
+			for _, want := range tt.wantErrs {
+				if !errors.Is(err, want) {
+					t.Errorf("expected error %v, got %v", want, err)
+				}
+			}
+
+			var abortErr transaction.RunAbortError
+			if errors.As(err, &abortErr) != (len(tt.wantErrs) == 2) {
+				t.Errorf("expected a RunAbortError only if aborting failed, got %v", err)
+			}
+		})
+	}
+}
+
+func TestRunPanic(t *testing.T) {
+	r := &runner{}
+	defer func() {
+		if p := recover(); p != "boom" {
+			t.Errorf("expected the panic raised again, got %v", p)
+		}
+
+		if want := []string{"open", "abort"}; !reflect.DeepEqual(r.steps, want) {
+			t.Errorf("expected steps %v, got %v", want, r.steps)
+		}
+	}()
+
+	transaction.Run(context.Background(), r, func(context.Context) error {
+		panic("boom")
+	})
+}
@@ -0,0 +1,122 @@
+package transaction
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/brinick/fs"
+)
+
+// State is the state of an open transaction, saved by SaveState for
+// a later process to resume it with LoadState, then close or abort it
+type State struct {
+	// Repo and Root are what the transaction is opened on,
+	// as told by its Locator, if any
+	Repo string `json:"repo,omitempty"`
+	Root string `json:"root,omitempty"`
+
+	// OpenAttempts is the number of attempts it took to open the
+	// transaction, and PublishAttempts the number made to publish it
+	OpenAttempts    int `json:"open_attempts"`
+	PublishAttempts int `json:"publish_attempts"`
+
+	// Opened is the time the transaction was opened
+	Opened time.Time `json:"opened"`
+
+	// Backend is the state of the transaction backend, e.g. its
+	// staging path, as saved by its Resumer, if any
+	Backend json.RawMessage `json:"backend,omitempty"`
+}
+
+// Locator is implemented by the transactions that can tell what they
+// are opened on, for LoadState to check that a saved state is theirs
+type Locator interface {
+	Location() (repo, root string)
+}
+
+// Resumer is implemented by the transactions with a state of their
+// own to resume them, saved by SaveState with Suspend, and restored by
+// LoadState with Resume, which must take back what the transaction
+// holds while open, e.g. its lock
+type Resumer interface {
+	Suspend() (json.RawMessage, error)
+	Resume(json.RawMessage) error
+}
+
+// State returns the state of the transaction
+func (t *Transaction) State() State {
+	s := t.state
+	if l, ok := t.Starter.(Locator); ok {
+		s.Repo, s.Root = l.Location()
+	}
+
+	return s
+}
+
+// SaveState saves the state of the open transaction, as JSON, to the
+// file at path, replaced atomically, and created with its parents if
+// missing
+func (t *Transaction) SaveState(path string) error {
+	if !t.ongoing {
+		return errors.New("unable to save the state of a transaction not open")
+	}
+
+	s := t.State()
+	if r, ok := t.Starter.(Resumer); ok {
+		backend, err := r.Suspend()
+		if err != nil {
+			return fmt.Errorf("unable to save the state of the transaction backend (%w)", err)
+		}
+		s.Backend = backend
+	}
+
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := fs.NewFile(path).WriteAtomic(append(data, '\n'), fs.EnsureDir(0)); err != nil {
+		return fmt.Errorf("unable to save the transaction state to %s (%w)", path, err)
+	}
+
+	return nil
+}
+
+// LoadState resumes the transaction of the state saved to the file at
+// path, which can then be closed or aborted. The transaction must be
+// created as the one saved, on the same repo and root, else an error
+// is returned, as it is if its Resumer, if any, fails to resume it,
+// e.g. the process that saved it still holding its lock.
+func (t *Transaction) LoadState(path string) error {
+	data, err := fs.NewFile(path).Bytes()
+	if err != nil {
+		return fmt.Errorf("unable to load the transaction state from %s (%w)", path, err)
+	}
+
+	var s State
+	if err := json.Unmarshal(data, &s); err != nil {
+		return fmt.Errorf("unable to decode the transaction state from %s (%w)", path, err)
+	}
+
+	if l, ok := t.Starter.(Locator); ok {
+		if repo, root := l.Location(); repo != s.Repo || root != s.Root {
+			return fmt.Errorf(
+				"transaction state of %s is that of repo %q, root %q, not repo %q, root %q",
+				path, s.Repo, s.Root, repo, root,
+			)
+		}
+	}
+
+	if r, ok := t.Starter.(Resumer); ok {
+		if err := r.Resume(s.Backend); err != nil {
+			return fmt.Errorf("unable to resume the transaction of the state saved to %s (%w)", path, err)
+		}
+	}
+
+	s.Backend = nil
+	t.state = s
+	t.SetOngoing()
+	return nil
+}
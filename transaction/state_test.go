@@ -0,0 +1,84 @@
+package transaction_test
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/brinick/fs/transaction"
+)
+
+// locatedStub is a stubTransaction opened on a repo
+type locatedStub struct {
+	*stubTransaction
+	repo string
+}
+
+func (l locatedStub) Location() (repo, root string) {
+	return l.repo, "/sw"
+}
+
+func newLocatedStub(repo string, startErrs ...error) *locatedStub {
+	l := &locatedStub{stubTransaction: newStub(startErrs...), repo: repo}
+	l.Starter = l
+	return l
+}
+
+func TestSaveState(t *testing.T) {
+	dir, err := ioutil.TempDir("", "transaction")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	ctx := context.Background()
+	path := filepath.Join(dir, "state", "transaction.json")
+
+	s := newLocatedStub("atlas.cern.ch", errors.New("flaky"))
+	s.Retry = &transaction.RetryPolicy{Wait: 1}
+	if err := s.SaveState(path); err == nil {
+		t.Errorf("expected an error saving the state of a transaction not open")
+	}
+
+	if err := s.Open(ctx); err != nil {
+		t.Fatalf("unable to open: %v", err)
+	}
+
+	if err := s.SaveState(path); err != nil {
+		t.Fatalf("unable to save the state: %v", err)
+	}
+
+	other := newLocatedStub("sft.cern.ch")
+	if err := other.LoadState(path); err == nil {
+		t.Errorf("expected an error loading the state of another repo")
+	}
+
+	if phase, _ := other.Phase(); phase != transaction.Idle {
+		t.Errorf("expected the other transaction not resumed, got %v", phase)
+	}
+
+	resumed := newLocatedStub("atlas.cern.ch")
+	if err := resumed.LoadState(path); err != nil {
+		t.Fatalf("unable to load the state: %v", err)
+	}
+
+	saved, got := s.State(), resumed.State()
+	if got.Repo != "atlas.cern.ch" || got.Root != "/sw" || got.OpenAttempts != 2 || !got.Opened.Equal(saved.Opened) {
+		t.Errorf("expected the saved state %+v, got %+v", saved, got)
+	}
+
+	if err := resumed.Close(ctx); err != nil {
+		t.Fatalf("unable to close the resumed transaction: %v", err)
+	}
+
+	if got := resumed.State(); got.PublishAttempts != 1 {
+		t.Errorf("expected a publish attempt, got %d", got.PublishAttempts)
+	}
+
+	if phase, _ := resumed.Phase(); phase != transaction.Published {
+		t.Errorf("expected the resumed transaction published, got %v", phase)
+	}
+}
@@ -0,0 +1,294 @@
+package fs
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// trashInfoExt is the extension of the trash info files
+const trashInfoExt = ".trashinfo"
+
+// trashDateLayout is the layout of the trash deletion dates
+const trashDateLayout = "2006-01-02T15:04:05"
+
+// trashDir is the trash directory set with SetTrashDir
+var trashDir struct {
+	mu   sync.Mutex
+	path string
+}
+
+// TrashItem is a file or directory moved to the trash
+type TrashItem struct {
+	// Name is the name of the item in the trash
+	Name string
+
+	// Path is the absolute path the item was trashed from
+	Path string
+
+	// Deleted is the time it was trashed
+	Deleted time.Time
+
+	trash string
+}
+
+// SetTrashDir sets the trash directory to which the files and
+// directories are moved when trashed, created if missing. By default,
+// or if dir is "", it is the XDG trash of the user's home, as used by
+// Linux desktops. The trash always has the XDG layout: the items are
+// in its files directory and their metadata in its info directory.
+func SetTrashDir(dir string) {
+	trashDir.mu.Lock()
+	trashDir.path = dir
+	trashDir.mu.Unlock()
+}
+
+// TrashDir returns the trash directory
+func TrashDir() (string, error) {
+	trashDir.mu.Lock()
+	dir := trashDir.path
+	trashDir.mu.Unlock()
+
+	if dir != "" {
+		return filepath.Abs(dir)
+	}
+
+	if data := os.Getenv("XDG_DATA_HOME"); filepath.IsAbs(data) {
+		return filepath.Join(data, "Trash"), nil
+	}
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("unable to locate the trash (%w)", err)
+	}
+
+	return filepath.Join(home, ".local", "share", "Trash"), nil
+}
+
+// Trash moves the file to the trash, from which it can be restored,
+// rather than remove it. Files on another device than the trash are
+// copied to it, then removed.
+func (f *File) Trash() (*TrashItem, error) {
+	return trashPath(f.sys(), f.Path)
+}
+
+// Trash moves the directory to the trash, from which it can be
+// restored, rather than remove it. Directories on another device than
+// the trash are copied to it, then removed.
+func (d *Directory) Trash() (*TrashItem, error) {
+	return trashPath(d.sys(), d.Path)
+}
+
+// Trashed returns the items in the trash, oldest first
+func Trashed() ([]*TrashItem, error) {
+	trash, err := TrashDir()
+	if err != nil {
+		return nil, err
+	}
+
+	infos, err := ioutil.ReadDir(filepath.Join(trash, "info"))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	var items []*TrashItem
+	for _, info := range infos {
+		name := strings.TrimSuffix(info.Name(), trashInfoExt)
+		if name == info.Name() {
+			continue
+		}
+
+		item, err := readTrashInfo(trash, name)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+
+	sort.SliceStable(items, func(i, j int) bool {
+		return items[i].Deleted.Before(items[j].Deleted)
+	})
+
+	return items, nil
+}
+
+// Restore moves the item back to its original path, creating its
+// missing parent directories. Nothing is restored over an existing path.
+func (t *TrashItem) Restore() error {
+	if _, err := os.Lstat(t.Path); err == nil {
+		return fmt.Errorf("cannot restore %s over an existing path", t.Path)
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(t.Path), defaultDirPerm); err != nil {
+		return err
+	}
+
+	if err := movePath(OSFilesystem{}, t.trashed(), t.Path); err != nil {
+		return fmt.Errorf("unable to restore %s (%w)", t.Path, err)
+	}
+
+	return os.Remove(t.info())
+}
+
+// Purge removes the item from the trash, for good
+func (t *TrashItem) Purge() error {
+	if err := os.RemoveAll(t.trashed()); err != nil {
+		return err
+	}
+
+	return os.Remove(t.info())
+}
+
+// trashed returns the path of the item in the trash
+func (t *TrashItem) trashed() string {
+	return filepath.Join(t.trash, "files", t.Name)
+}
+
+// info returns the path of the info file of the item
+func (t *TrashItem) info() string {
+	return filepath.Join(t.trash, "info", t.Name+trashInfoExt)
+}
+
+// trashPath moves path, on sys, to the trash
+func trashPath(sys Filesystem, path string) (*TrashItem, error) {
+	if _, ok := sys.(OSFilesystem); !ok {
+		return nil, fmt.Errorf("cannot trash %s: not on the OS file system", path)
+	}
+
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := os.Lstat(abs); err != nil {
+		return nil, err
+	}
+
+	trash, err := TrashDir()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, dir := range []string{"files", "info"} {
+		if err := os.MkdirAll(filepath.Join(trash, dir), 0700); err != nil {
+			return nil, err
+		}
+	}
+
+	item, err := newTrashInfo(trash, abs)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := movePath(sys, abs, item.trashed()); err != nil {
+		os.Remove(item.info())
+		return nil, fmt.Errorf("unable to trash %s (%w)", abs, err)
+	}
+
+	return item, nil
+}
+
+// newTrashInfo reserves a name in the trash for path, by creating its
+// info file, as trashing processes may share the trash
+func newTrashInfo(trash, path string) (*TrashItem, error) {
+	item := &TrashItem{
+		Path:    path,
+		Deleted: time.Now().Truncate(time.Second),
+		trash:   trash,
+	}
+
+	base := filepath.Base(path)
+	for i := 1; ; i++ {
+		item.Name = base
+		if i > 1 {
+			item.Name = base + "." + strconv.Itoa(i)
+		}
+
+		// Items may be in the trash without info, e.g. if left by
+		// a failed trashing
+		if _, err := os.Lstat(item.trashed()); err == nil {
+			continue
+		}
+
+		f, err := os.OpenFile(item.info(), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+		if errors.Is(err, os.ErrExist) {
+			continue
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		_, err = fmt.Fprintf(f, "[Trash Info]\nPath=%s\nDeletionDate=%s\n",
+			(&url.URL{Path: path}).EscapedPath(), item.Deleted.Format(trashDateLayout))
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+
+		if err != nil {
+			os.Remove(item.info())
+			return nil, err
+		}
+
+		return item, nil
+	}
+}
+
+// readTrashInfo reads the info file of the named item of the trash
+func readTrashInfo(trash, name string) (*TrashItem, error) {
+	item := &TrashItem{Name: name, trash: trash}
+
+	f, err := os.Open(item.info())
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		key, value, ok := strings.Cut(scanner.Text(), "=")
+		if !ok {
+			continue
+		}
+
+		switch key {
+		case "Path":
+			if item.Path, err = url.PathUnescape(value); err != nil {
+				return nil, fmt.Errorf("%s: bad path (%w)", item.info(), err)
+			}
+		case "DeletionDate":
+			if item.Deleted, err = time.ParseInLocation(trashDateLayout, value, time.Local); err != nil {
+				return nil, fmt.Errorf("%s: bad deletion date (%w)", item.info(), err)
+			}
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	if item.Path == "" {
+		return nil, fmt.Errorf("%s: no path", item.info())
+	}
+
+	if !filepath.IsAbs(item.Path) {
+		item.Path = filepath.Join(filepath.Dir(trash), item.Path)
+	}
+
+	return item, nil
+}
@@ -0,0 +1,92 @@
+package fs_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/brinick/fs"
+)
+
+func TestTrash(t *testing.T) {
+	root := newTree(t, map[string]int{"a": 10, "sub/b": 20, "other/a": 30})
+	src := filepath.Join(root, "src")
+
+	fs.SetTrashDir(filepath.Join(root, "trash"))
+	defer fs.SetTrashDir("")
+
+	f := fs.NewFile(filepath.Join(src, "a"))
+	d, _ := fs.NewDir(src, "sub")
+	other := fs.NewFile(filepath.Join(src, "other", "a"))
+
+	var items []*fs.TrashItem
+	for _, trash := range []func() (*fs.TrashItem, error){f.Trash, d.Trash, other.Trash} {
+		item, err := trash()
+		if err != nil {
+			t.Fatalf("unable to trash: %v", err)
+		}
+		items = append(items, item)
+	}
+
+	if items[0].Name != "a" || items[2].Name != "a.2" {
+		t.Errorf("expected unique names in the trash, got %s and %s", items[0].Name, items[2].Name)
+	}
+
+	if infos, _ := ioutil.ReadDir(src); len(infos) != 1 || infos[0].Name() != "other" {
+		t.Errorf("expected only the other directory left, got %d entries", len(infos))
+	}
+
+	trashed, err := fs.Trashed()
+	if err != nil {
+		t.Fatalf("unable to list the trash: %v", err)
+	}
+
+	if len(trashed) != 3 {
+		t.Fatalf("expected 3 trashed items, got %d", len(trashed))
+	}
+
+	for _, item := range trashed {
+		if item.Deleted.IsZero() {
+			t.Errorf("%s: expected a deletion date", item.Name)
+		}
+		if err := item.Restore(); err != nil {
+			t.Errorf("unable to restore %s: %v", item.Path, err)
+		}
+	}
+
+	for _, path := range []string{"a", "sub/b", "other/a"} {
+		if _, err := os.Stat(filepath.Join(src, path)); err != nil {
+			t.Errorf("expected %s restored: %v", path, err)
+		}
+	}
+
+	if data, _ := ioutil.ReadFile(filepath.Join(src, "other", "a")); len(data) != 30 {
+		t.Errorf("expected the other file restored, got %d bytes", len(data))
+	}
+
+	if trashed, _ := fs.Trashed(); len(trashed) != 0 {
+		t.Errorf("expected an empty trash, got %d items", len(trashed))
+	}
+
+	item, err := f.Trash()
+	if err != nil {
+		t.Fatalf("unable to trash: %v", err)
+	}
+
+	if err := ioutil.WriteFile(filepath.Join(src, "a"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := item.Restore(); err == nil {
+		t.Error("expected an error restoring over an existing file")
+	}
+
+	if err := item.Purge(); err != nil {
+		t.Errorf("unable to purge: %v", err)
+	}
+
+	if trashed, _ := fs.Trashed(); len(trashed) != 0 {
+		t.Errorf("expected the purged item gone, got %d items", len(trashed))
+	}
+}
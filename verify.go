@@ -0,0 +1,88 @@
+package fs
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"path/filepath"
+)
+
+// ChecksumError is the error returned when the content written
+// to a path does not have the digest of the content read
+type ChecksumError struct {
+	Path string
+	Want string
+	Got  string
+}
+
+func (e ChecksumError) Error() string {
+	return fmt.Sprintf("%s: checksum mismatch, expected %s, got %s", e.Path, e.Want, e.Got)
+}
+
+// MoveVerified moves the file to the dst path, and updates its path,
+// by copying it, with its attributes, while hashing the content read.
+// The copy is committed to storage, then hashed in turn, and the file
+// is only removed if both digests match, e.g. to migrate artefacts
+// between volumes. Else, the copy is removed and a ChecksumError is
+// returned. It returns the SHA256 hex digest and size of the content.
+func (f *File) MoveVerified(dst string) (string, int64, error) {
+	sys := f.sys()
+	if filepath.Clean(dst) == filepath.Clean(f.Path) {
+		return "", 0, fmt.Errorf("unable to move %s onto itself", f.Path)
+	}
+
+	info, err := sys.Lstat(f.Path)
+	if err != nil {
+		return "", 0, err
+	}
+
+	if !info.Mode().IsRegular() {
+		return "", 0, fmt.Errorf("unable to move %s with verification, not a regular file", f.Path)
+	}
+
+	h, err := SHA256.New()
+	if err != nil {
+		return "", 0, err
+	}
+
+	cfg := &copyConfig{preserve: PreserveAll, fsync: true, sum: h}
+	if err := copyBetween(context.Background(), sys, f.Path, sys, dst, cfg); err != nil {
+		sys.Remove(dst)
+		return "", 0, fmt.Errorf("unable to copy %s to %s (%w)", f.Path, dst, err)
+	}
+
+	want := hex.EncodeToString(h.Sum(nil))
+	got, err := hashIn(sys, dst, SHA256)
+	if err != nil {
+		return "", 0, err
+	}
+
+	if got != want {
+		sys.Remove(dst)
+		return "", 0, ChecksumError{Path: dst, Want: want, Got: got}
+	}
+
+	if err := sys.Remove(f.Path); err != nil {
+		return "", 0, fmt.Errorf("unable to remove %s once moved (%w)", f.Path, err)
+	}
+
+	f.Path = dst
+	return want, cfg.summed, nil
+}
+
+// sumReader hashes the content read through it
+type sumReader struct {
+	r io.Reader
+	c *copyConfig
+}
+
+func (sr *sumReader) Read(p []byte) (int, error) {
+	n, err := sr.r.Read(p)
+	if n > 0 {
+		sr.c.sum.Write(p[:n])
+		sr.c.summed += int64(n)
+	}
+
+	return n, err
+}
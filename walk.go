@@ -0,0 +1,343 @@
+package fs
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// EntryType is the type of a directory entry
+type EntryType int
+
+// The types of directory entries
+const (
+	FileEntry EntryType = iota
+	DirEntry
+	SymlinkEntry
+	OtherEntry
+)
+
+func (t EntryType) String() string {
+	switch t {
+	case FileEntry:
+		return "file"
+	case DirEntry:
+		return "dir"
+	case SymlinkEntry:
+		return "symlink"
+	}
+
+	return "other"
+}
+
+// Entry describes a directory entry found while walking or listing a tree
+type Entry struct {
+	Path    string
+	Name    string
+	Type    EntryType
+	Size    int64
+	Mode    os.FileMode
+	ModTime time.Time
+
+	// Depth is the number of directories below the walk root,
+	// 1 for entries directly in the root
+	Depth int
+
+	// LinkTarget is the target of a symlink, only read by
+	// Directory.Entries
+	LinkTarget string
+
+	// fsys is the file system of the walked directory
+	fsys Filesystem
+}
+
+func newEntry(path string, info os.FileInfo, depth int) Entry {
+	typ := OtherEntry
+	switch mode := info.Mode(); {
+	case mode.IsRegular():
+		typ = FileEntry
+	case mode.IsDir():
+		typ = DirEntry
+	case mode&os.ModeSymlink != 0:
+		typ = SymlinkEntry
+	}
+
+	return Entry{
+		Path:    path,
+		Name:    info.Name(),
+		Type:    typ,
+		Size:    info.Size(),
+		Mode:    info.Mode(),
+		ModTime: info.ModTime(),
+		Depth:   depth,
+	}
+}
+
+// IsDir reports if the entry is a directory
+func (e Entry) IsDir() bool {
+	return e.Type == DirEntry
+}
+
+// File returns the entry as a File
+func (e Entry) File() *File {
+	return &File{Path: e.Path, fsys: e.fsys}
+}
+
+// Dir returns the entry as a Directory
+func (e Entry) Dir() *Directory {
+	return &Directory{Path: e.Path, fsys: e.fsys}
+}
+
+// ------------------------------------------------------------------
+
+// WalkOption configures Directory.Walk
+type WalkOption func(*walkConfig)
+
+type walkConfig struct {
+	maxDepth       int
+	exclude        []string
+	excludeDirs    []string
+	followSymlinks bool
+	includeHidden  bool
+	timeout        time.Duration
+}
+
+// WalkMaxDepth stops the walk descending more than depth levels below
+// the root, such that depth 1 only visits the root's entries.
+// A depth <= 0 means no limit.
+func WalkMaxDepth(depth int) WalkOption {
+	return func(c *walkConfig) {
+		c.maxDepth = depth
+	}
+}
+
+// WalkExclude skips entries, and directories' content, whose
+// base name matches any of the given glob patterns
+func WalkExclude(patterns ...string) WalkOption {
+	return func(c *walkConfig) {
+		c.exclude = append(c.exclude, patterns...)
+	}
+}
+
+// walkExcludeDirs skips the content of directories named as any of
+// names, as WalkTree does with its excludeDirs
+func walkExcludeDirs(names []string) WalkOption {
+	return func(c *walkConfig) {
+		c.excludeDirs = append(c.excludeDirs, names...)
+	}
+}
+
+// WalkFollowSymlinks makes the walk descend into symlinked directories.
+// Entries for symlinks then describe their targets. Symlinks to
+// directories already walked are not followed, which also avoids loops.
+func WalkFollowSymlinks() WalkOption {
+	return func(c *walkConfig) {
+		c.followSymlinks = true
+	}
+}
+
+// WalkIncludeHidden makes the walk visit hidden entries (those whose
+// name starts with a dot), which are otherwise skipped
+func WalkIncludeHidden() WalkOption {
+	return func(c *walkConfig) {
+		c.includeHidden = true
+	}
+}
+
+func newWalkConfig(opts []WalkOption) *walkConfig {
+	c := &walkConfig{}
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	return c
+}
+
+// Walk walks the directory tree, in lexical order, calling fn for each
+// entry below the directory, with parent directories visited before
+// their content. If fn returns filepath.SkipDir for a directory, its
+// content is skipped, and for another entry, the remaining entries of
+// its directory are. Any other error stops the walk and is returned.
+func (d *Directory) Walk(fn func(entry Entry) error, opts ...WalkOption) error {
+	c := newWalkConfig(opts)
+	w := &walker{cfg: c, fn: fn, dir: d, sys: WithTimeout(d.sys(), c.timeout)}
+
+	if c.followSymlinks {
+		w.visited = map[string]bool{}
+	}
+
+	err := w.walk(d.Path, 1)
+	if err == filepath.SkipDir {
+		return nil
+	}
+
+	return err
+}
+
+type walker struct {
+	dir     *Directory
+	sys     Filesystem
+	cfg     *walkConfig
+	fn      func(Entry) error
+	visited map[string]bool
+}
+
+func (w *walker) walk(dir string, depth int) error {
+	if w.visited != nil {
+		real, err := resolveOn(w.sys, dir)
+		if err != nil {
+			return err
+		}
+		w.visited[real] = true
+	}
+
+	openFiles.acquire(1)
+	infos, err := w.sys.ReadDir(dir)
+	openFiles.release(1)
+	if err != nil {
+		return err
+	}
+
+	for _, info := range infos {
+		name := info.Name()
+		if !w.cfg.includeHidden && strings.HasPrefix(name, ".") {
+			continue
+		}
+
+		excluded, err := matchAny(name, w.cfg.exclude)
+		if err != nil {
+			return err
+		}
+
+		if excluded || info.IsDir() && containsString(w.cfg.excludeDirs, name) {
+			continue
+		}
+
+		path := filepath.Join(dir, name)
+		descend := info.IsDir()
+
+		if info.Mode()&os.ModeSymlink != 0 && w.cfg.followSymlinks {
+			// Broken links are visited as links, but timeouts fail the walk
+			tgt, err := w.sys.Stat(path)
+			if os.IsTimeout(err) {
+				return err
+			}
+
+			if err == nil {
+				info = namedInfo{tgt, name}
+				if descend = tgt.IsDir(); descend {
+					if descend, err = w.unseen(path); err != nil {
+						return err
+					}
+				}
+			}
+		}
+
+		entry := newEntry(path, info, depth)
+		entry.fsys = w.dir.fsys
+
+		err = w.fn(entry)
+		if err == filepath.SkipDir {
+			if descend {
+				continue
+			}
+
+			// As with filepath.Walk, the rest of the directory is skipped
+			return nil
+		}
+
+		if err != nil {
+			return err
+		}
+
+		if descend && (w.cfg.maxDepth <= 0 || depth < w.cfg.maxDepth) {
+			if err := w.walk(path, depth+1); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// unseen reports if the real path of the directory, resolved on the
+// walked file system, is yet to be walked, so that symlink loops are
+// not followed
+func (w *walker) unseen(path string) (bool, error) {
+	real, err := resolveOn(w.sys, path)
+	if err != nil {
+		return false, err
+	}
+
+	return !w.visited[real], nil
+}
+
+// namedInfo is a FileInfo reporting the name of the
+// symlink rather than that of its target
+type namedInfo struct {
+	os.FileInfo
+	name string
+}
+
+func (ni namedInfo) Name() string {
+	return ni.name
+}
+
+// ------------------------------------------------------------------
+
+// EntryCounts are the numbers of each type of entry in a tree
+type EntryCounts struct {
+	Files    int
+	Dirs     int
+	Symlinks int
+	Other    int
+}
+
+// Total returns the total number of entries
+func (c *EntryCounts) Total() int {
+	return c.Files + c.Dirs + c.Symlinks + c.Other
+}
+
+// CountEntries counts, in a single walk, the entries of each type within
+// the directory, including hidden ones, and below it if recursive is set.
+// Entries whose base name matches one of the exclude glob patterns are
+// not counted, nor is the content of excluded directories.
+func (d *Directory) CountEntries(recursive bool, exclude ...string) (*EntryCounts, error) {
+	opts := []WalkOption{WalkIncludeHidden(), WalkExclude(exclude...)}
+	if !recursive {
+		opts = append(opts, WalkMaxDepth(1))
+	}
+
+	var c EntryCounts
+	err := d.Walk(func(e Entry) error {
+		switch e.Type {
+		case FileEntry:
+			c.Files++
+		case DirEntry:
+			c.Dirs++
+		case SymlinkEntry:
+			c.Symlinks++
+		default:
+			c.Other++
+		}
+		return nil
+	}, opts...)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &c, nil
+}
+
+// containsString checks if s is one of the strings
+func containsString(strs []string, s string) bool {
+	for _, str := range strs {
+		if str == s {
+			return true
+		}
+	}
+
+	return false
+}
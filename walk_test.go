@@ -0,0 +1,162 @@
+package fs_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/brinick/fs"
+)
+
+func TestDirectoryWalk(t *testing.T) {
+	root, clean := tempDir()
+	defer clean()
+
+	makeTree(t, root, map[string]string{
+		"a.txt":         "a",
+		".hidden":       "h",
+		"sub/b.txt":     "b",
+		"sub/deep/c.o":  "c",
+		"skip/d.txt":    "d",
+		"other/e.txt":   "e",
+		"other/f/g.txt": "g",
+	})
+
+	if err := os.Symlink(filepath.Join(root, "other"), filepath.Join(root, "sub", "link")); err != nil {
+		t.Fatalf("unable to create symlink: %v", err)
+	}
+
+	// A symlink loop
+	if err := os.Symlink(root, filepath.Join(root, "other", "loop")); err != nil {
+		t.Fatalf("unable to create symlink: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		opts   []fs.WalkOption
+		expect []string
+	}{
+		{
+			"defaults",
+			nil,
+			[]string{"a.txt", "other", "other/e.txt", "other/f", "other/f/g.txt", "other/loop", "skip", "skip/d.txt", "sub", "sub/b.txt", "sub/deep", "sub/deep/c.o", "sub/link"},
+		},
+		{
+			"max depth and exclude",
+			[]fs.WalkOption{fs.WalkMaxDepth(2), fs.WalkExclude("skip", "other", "*.o")},
+			[]string{"a.txt", "sub", "sub/b.txt", "sub/deep", "sub/link"},
+		},
+		{
+			"hidden",
+			[]fs.WalkOption{fs.WalkMaxDepth(1), fs.WalkIncludeHidden()},
+			[]string{".hidden", "a.txt", "other", "skip", "sub"},
+		},
+		{
+			"follow symlinks into already walked dirs",
+			[]fs.WalkOption{fs.WalkFollowSymlinks(), fs.WalkExclude("skip", "deep", "f", "*.txt")},
+			[]string{"other", "other/loop", "sub", "sub/link"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var paths []string
+			err := newDir(t, root).Walk(func(e fs.Entry) error {
+				paths = append(paths, e.Path)
+				return nil
+			}, tt.opts...)
+
+			if err != nil {
+				t.Fatalf("unable to walk: %v", err)
+			}
+
+			checkPaths(t, tt.name, tt.expect, relPaths(t, root, paths))
+		})
+	}
+
+	// Following a link to a dir not otherwise walked
+	var paths []string
+	err := newDir(t, root, "sub").Walk(func(e fs.Entry) error {
+		paths = append(paths, e.Path)
+		return nil
+	}, fs.WalkFollowSymlinks(), fs.WalkExclude("deep", "loop"))
+
+	if err != nil {
+		t.Fatalf("unable to walk: %v", err)
+	}
+
+	checkPaths(t, "follow", []string{"b.txt", "link", "link/e.txt", "link/f", "link/f/g.txt"}, relPaths(t, filepath.Join(root, "sub"), paths))
+
+	// SkipDir skips a directory's content
+	var names []string
+	err = newDir(t, root).Walk(func(e fs.Entry) error {
+		names = append(names, e.Name)
+		if e.IsDir() {
+			return filepath.SkipDir
+		}
+		return nil
+	})
+
+	if err != nil {
+		t.Fatalf("unable to walk: %v", err)
+	}
+
+	checkPaths(t, "skipdir", []string{"a.txt", "other", "skip", "sub"}, names)
+
+	// SkipDir for a file skips the rest of its directory, as with filepath.Walk
+	paths = nil
+	err = newDir(t, root).Walk(func(e fs.Entry) error {
+		paths = append(paths, e.Path)
+		if e.Name == "e.txt" {
+			return filepath.SkipDir
+		}
+		return nil
+	})
+
+	if err != nil {
+		t.Fatalf("unable to walk: %v", err)
+	}
+
+	expect := []string{"a.txt", "other", "other/e.txt", "skip", "skip/d.txt", "sub", "sub/b.txt", "sub/deep", "sub/deep/c.o", "sub/link"}
+	checkPaths(t, "skipdir file", expect, relPaths(t, root, paths))
+}
+
+func TestCountEntries(t *testing.T) {
+	root, clean := tempDir()
+	defer clean()
+
+	makeTree(t, root, map[string]string{
+		"a.txt":        "a",
+		".hidden":      "h",
+		"sub/b.txt":    "b",
+		"sub/deep/c.o": "c",
+	})
+
+	if err := os.Symlink("a.txt", filepath.Join(root, "link")); err != nil {
+		t.Fatalf("unable to create symlink: %v", err)
+	}
+
+	tests := []struct {
+		name      string
+		recursive bool
+		exclude   []string
+		expect    fs.EntryCounts
+	}{
+		{"flat", false, nil, fs.EntryCounts{Files: 2, Dirs: 1, Symlinks: 1}},
+		{"recursive", true, nil, fs.EntryCounts{Files: 4, Dirs: 2, Symlinks: 1}},
+		{"recursive excluded", true, []string{"deep", "link"}, fs.EntryCounts{Files: 3, Dirs: 1}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			counts, err := newDir(t, root).CountEntries(tt.recursive, tt.exclude...)
+			if err != nil {
+				t.Fatalf("unable to count entries: %v", err)
+			}
+
+			if *counts != tt.expect {
+				t.Errorf("expected %+v, got %+v", tt.expect, *counts)
+			}
+		})
+	}
+}
@@ -0,0 +1,452 @@
+package fs
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// Op describes the kind of change reported in an Event
+type Op uint32
+
+// The changes a Watcher may report. These mirror the fsnotify operations
+// so that native and polling watchers are interchangeable.
+const (
+	OpCreate Op = 1 << iota
+	OpWrite
+	OpRemove
+	OpRename
+	OpChmod
+)
+
+func (op Op) String() string {
+	var names []string
+	for _, o := range []struct {
+		op   Op
+		name string
+	}{
+		{OpCreate, "CREATE"},
+		{OpWrite, "WRITE"},
+		{OpRemove, "REMOVE"},
+		{OpRename, "RENAME"},
+		{OpChmod, "CHMOD"},
+	} {
+		if op&o.op != 0 {
+			names = append(names, o.name)
+		}
+	}
+
+	return strings.Join(names, "|")
+}
+
+// Event is a single change on a path below a watched directory
+type Event struct {
+	Path string
+	Op   Op
+}
+
+func (e Event) String() string {
+	return fmt.Sprintf("%s: %s", e.Path, e.Op)
+}
+
+// Watcher reports changes below a watched directory tree.
+// Events and errors are delivered on the respective channels
+// until Close is called, at which point both are closed.
+type Watcher interface {
+	Events() <-chan Event
+	Errors() <-chan error
+	Close() error
+
+	// Mode tells how changes are detected
+	Mode() WatchMode
+}
+
+// WatchMode is the way a Watcher detects changes
+type WatchMode int
+
+// The watch modes
+const (
+	// WatchNative watchers are notified of changes by the OS
+	WatchNative WatchMode = iota
+
+	// WatchPoll watchers compare snapshots of the tree
+	WatchPoll
+)
+
+func (m WatchMode) String() string {
+	if m == WatchPoll {
+		return "poll"
+	}
+
+	return "native"
+}
+
+// pollFSTypes are the file system types on which inotify is known not
+// to report changes made by other hosts, and so must be polled
+var pollFSTypes = []string{"nfs", "nfs4", "cvmfs", "fuse", "afs", "cifs", "smbfs", "smb3"}
+
+// WatchOptions configures the watcher returned by NewWatcher
+type WatchOptions struct {
+	// Poll forces the use of the polling watcher whatever the file system
+	Poll bool
+
+	// Interval is the time between polls. Defaults to 2 seconds.
+	Interval time.Duration
+
+	// Hash makes the polling watcher compare file content hashes,
+	// rather than only size, modification time and mode.
+	Hash bool
+}
+
+// NewWatcher returns a Watcher on the tree rooted at root. A native
+// (inotify) watcher is used unless the file system type of root, as
+// given by FSType, is one on which inotify does not work, in which
+// case the polling watcher is returned. The polling watcher is also
+// the fallback if the native one cannot be set up, for instance once
+// the inotify watch limit is reached. The Mode of the watcher tells
+// which is used.
+func NewWatcher(root string, opts WatchOptions) (Watcher, error) {
+	if !opts.Poll {
+		fstype, err := FSType(root)
+		if err != nil {
+			return nil, err
+		}
+
+		opts.Poll = needsPolling(fstype)
+	}
+
+	if opts.Poll {
+		return NewPollWatcher(root, opts)
+	}
+
+	nw, err := newNativeWatcher(root)
+	if err != nil {
+		if pw, perr := NewPollWatcher(root, opts); perr == nil {
+			return pw, nil
+		}
+		return nil, err
+	}
+
+	return nw, nil
+}
+
+// newNativeWatcher creates the native watchers of NewWatcher
+var newNativeWatcher = NewNativeWatcher
+
+func needsPolling(fstype string) bool {
+	for _, t := range pollFSTypes {
+		if fstype == t || strings.HasPrefix(fstype, t+".") {
+			return true
+		}
+	}
+
+	return false
+}
+
+// ------------------------------------------------------------------
+
+// NativeWatcher is a Watcher built on the operating system's
+// file change notifications. Sub directories are watched recursively,
+// including those created after the watcher was started.
+type NativeWatcher struct {
+	w      *fsnotify.Watcher
+	events chan Event
+	errors chan error
+	done   chan struct{}
+	once   sync.Once
+}
+
+// NewNativeWatcher returns a native Watcher on the tree rooted at root
+func NewNativeWatcher(root string) (*NativeWatcher, error) {
+	w, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, fmt.Errorf("unable to create file system watcher (%w)", err)
+	}
+
+	nw := &NativeWatcher{
+		w:      w,
+		events: make(chan Event),
+		errors: make(chan error, 1),
+		done:   make(chan struct{}),
+	}
+
+	if err := nw.addTree(root); err != nil {
+		w.Close()
+		return nil, err
+	}
+
+	go nw.run()
+	return nw, nil
+}
+
+// Events returns the channel on which changes are reported
+func (nw *NativeWatcher) Events() <-chan Event {
+	return nw.events
+}
+
+// Errors returns the channel on which watch errors are reported
+func (nw *NativeWatcher) Errors() <-chan error {
+	return nw.errors
+}
+
+// Mode returns WatchNative
+func (nw *NativeWatcher) Mode() WatchMode {
+	return WatchNative
+}
+
+// Close stops the watcher
+func (nw *NativeWatcher) Close() error {
+	nw.once.Do(func() { close(nw.done) })
+	return nw.w.Close()
+}
+
+func (nw *NativeWatcher) addTree(root string) error {
+	return filepath.Walk(
+		root,
+		func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+
+			if info.IsDir() {
+				if err := nw.w.Add(path); err != nil {
+					return fmt.Errorf("unable to watch dir %s (%w)", path, err)
+				}
+			}
+
+			return nil
+		},
+	)
+}
+
+func (nw *NativeWatcher) run() {
+	defer close(nw.events)
+	defer close(nw.errors)
+
+	for {
+		select {
+		case ev, ok := <-nw.w.Events:
+			if !ok {
+				return
+			}
+
+			if ev.Op&fsnotify.Create != 0 {
+				// Newly created directories must be watched too
+				if ok, _ := IsDir(ev.Name); ok {
+					if err := nw.addTree(ev.Name); err != nil && !nw.sendErr(err) {
+						return
+					}
+				}
+			}
+
+			select {
+			case nw.events <- Event{Path: ev.Name, Op: Op(ev.Op)}:
+			case <-nw.done:
+				return
+			}
+
+		case err, ok := <-nw.w.Errors:
+			if !ok || !nw.sendErr(err) {
+				return
+			}
+		}
+	}
+}
+
+// sendErr reports the error, returning false if the watcher was closed
+func (nw *NativeWatcher) sendErr(err error) bool {
+	select {
+	case nw.errors <- err:
+		return true
+	case <-nw.done:
+		return false
+	}
+}
+
+// ------------------------------------------------------------------
+
+// PollWatcher is a Watcher that periodically walks the tree, comparing
+// the state (size, modification time, mode and optionally content hash)
+// of each entry with that of the previous walk. It is meant for file
+// systems, like NFS or CVMFS client mounts, where native notifications
+// do not work.
+type PollWatcher struct {
+	root     string
+	interval time.Duration
+	hash     bool
+	events   chan Event
+	errors   chan error
+	done     chan struct{}
+	once     sync.Once
+}
+
+// NewPollWatcher returns a polling Watcher on the tree rooted at root.
+// Only the Interval and Hash fields of opts are used.
+func NewPollWatcher(root string, opts WatchOptions) (*PollWatcher, error) {
+	interval := opts.Interval
+	if interval <= 0 {
+		interval = 2 * time.Second
+	}
+
+	pw := &PollWatcher{
+		root:     root,
+		interval: interval,
+		hash:     opts.Hash,
+		events:   make(chan Event),
+		errors:   make(chan error, 1),
+		done:     make(chan struct{}),
+	}
+
+	state, err := pw.snapshot()
+	if err != nil {
+		return nil, err
+	}
+
+	go pw.run(state)
+	return pw, nil
+}
+
+// Events returns the channel on which changes are reported
+func (pw *PollWatcher) Events() <-chan Event {
+	return pw.events
+}
+
+// Errors returns the channel on which watch errors are reported
+func (pw *PollWatcher) Errors() <-chan error {
+	return pw.errors
+}
+
+// Mode returns WatchPoll
+func (pw *PollWatcher) Mode() WatchMode {
+	return WatchPoll
+}
+
+// Close stops the watcher
+func (pw *PollWatcher) Close() error {
+	pw.once.Do(func() { close(pw.done) })
+	return nil
+}
+
+func (pw *PollWatcher) run(prev map[string]fileState) {
+	defer close(pw.events)
+	defer close(pw.errors)
+
+	ticker := time.NewTicker(pw.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-pw.done:
+			return
+		case <-ticker.C:
+		}
+
+		curr, err := pw.snapshot()
+		if err != nil {
+			select {
+			case pw.errors <- err:
+			case <-pw.done:
+				return
+			}
+			continue
+		}
+
+		for _, ev := range diffStates(prev, curr) {
+			select {
+			case pw.events <- ev:
+			case <-pw.done:
+				return
+			}
+		}
+
+		prev = curr
+	}
+}
+
+// fileState is the per path information compared between polls
+type fileState struct {
+	size    int64
+	modTime time.Time
+	mode    os.FileMode
+	hash    string
+}
+
+func (pw *PollWatcher) snapshot() (map[string]fileState, error) {
+	return snapshotTree(pw.root, pw.hash)
+}
+
+// snapshotTree returns the state of each entry below root, keyed by
+// path, including the content hash of files if hash is set
+func snapshotTree(root string, hash bool) (map[string]fileState, error) {
+	state := map[string]fileState{}
+	err := filepath.Walk(
+		root,
+		func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				// The entry may have been removed since its
+				// directory was listed, it will be reported next time
+				if os.IsNotExist(err) {
+					return nil
+				}
+				return err
+			}
+
+			if path == root {
+				return nil
+			}
+
+			st := fileState{
+				size:    info.Size(),
+				modTime: info.ModTime(),
+				mode:    info.Mode(),
+			}
+
+			if hash && info.Mode().IsRegular() {
+				if st.hash, err = hashFile(path, SHA256); err != nil {
+					if os.IsNotExist(err) {
+						return nil
+					}
+					return err
+				}
+			}
+
+			state[path] = st
+			return nil
+		},
+	)
+
+	return state, err
+}
+
+func diffStates(prev, curr map[string]fileState) []Event {
+	var events []Event
+	for path, c := range curr {
+		p, ok := prev[path]
+		switch {
+		case !ok:
+			events = append(events, Event{Path: path, Op: OpCreate})
+		case p.size != c.size || !p.modTime.Equal(c.modTime) || p.hash != c.hash:
+			events = append(events, Event{Path: path, Op: OpWrite})
+		case p.mode != c.mode:
+			events = append(events, Event{Path: path, Op: OpChmod})
+		}
+	}
+
+	for path := range prev {
+		if _, ok := curr[path]; !ok {
+			events = append(events, Event{Path: path, Op: OpRemove})
+		}
+	}
+
+	sort.Slice(events, func(i, j int) bool {
+		return events[i].Path < events[j].Path
+	})
+
+	return events
+}
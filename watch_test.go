@@ -0,0 +1,93 @@
+package fs_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/brinick/fs"
+)
+
+func nextEvent(t *testing.T, w fs.Watcher) fs.Event {
+	select {
+	case ev := <-w.Events():
+		return ev
+	case err := <-w.Errors():
+		t.Fatalf("unexpected watcher error: %v", err)
+	case <-time.After(2 * time.Second):
+		t.Fatalf("timed out waiting for watcher event")
+	}
+
+	return fs.Event{}
+}
+
+func TestPollWatcher(t *testing.T) {
+	dir, clean := tempDir()
+	defer clean()
+
+	w, err := fs.NewWatcher(dir, fs.WatchOptions{Poll: true, Interval: 20 * time.Millisecond, Hash: true})
+	if err != nil {
+		t.Fatalf("unable to create poll watcher: %v", err)
+	}
+	defer w.Close()
+
+	f := fs.NewFile(filepath.Join(dir, "watched.txt"))
+	if err := f.Touch(false); err != nil {
+		t.Fatalf("unable to create file: %v", err)
+	}
+
+	ev := nextEvent(t, w)
+	if ev.Path != f.Path || ev.Op != fs.OpCreate {
+		t.Errorf("expected create event on %s, got %s", f.Path, ev)
+	}
+
+	if err := f.Append([]byte("x")); err != nil {
+		t.Fatalf("unable to append to file: %v", err)
+	}
+
+	ev = nextEvent(t, w)
+	if ev.Path != f.Path || ev.Op != fs.OpWrite {
+		t.Errorf("expected write event on %s, got %s", f.Path, ev)
+	}
+
+	if err := os.Remove(f.Path); err != nil {
+		t.Fatalf("unable to remove file: %v", err)
+	}
+
+	ev = nextEvent(t, w)
+	if ev.Path != f.Path || ev.Op != fs.OpRemove {
+		t.Errorf("expected remove event on %s, got %s", f.Path, ev)
+	}
+}
+
+func TestWatcherFallback(t *testing.T) {
+	dir, clean := tempDir()
+	defer clean()
+
+	// The native watcher cannot be set up, e.g. out of inotify watches
+	restore := fs.SetNewNativeWatcher(func(string) (*fs.NativeWatcher, error) {
+		return nil, errors.New("no space left on device")
+	})
+	defer restore()
+
+	w, err := fs.NewWatcher(dir, fs.WatchOptions{Interval: 20 * time.Millisecond})
+	if err != nil {
+		t.Fatalf("unable to create fallback watcher: %v", err)
+	}
+	defer w.Close()
+
+	if w.Mode() != fs.WatchPoll {
+		t.Fatalf("expected the poll watcher as fallback, got %s", w.Mode())
+	}
+
+	f := fs.NewFile(filepath.Join(dir, "watched.txt"))
+	if err := f.Touch(false); err != nil {
+		t.Fatalf("unable to create file: %v", err)
+	}
+
+	if ev := nextEvent(t, w); ev.Path != f.Path || ev.Op != fs.OpCreate {
+		t.Errorf("expected create event on %s, got %s", f.Path, ev)
+	}
+}
@@ -0,0 +1,125 @@
+package fs
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Whiteout is a convention for marking entries deleted from a layer of
+// a layered tree, such as a container image layer, by empty marker
+// files named after them, when the entries cannot be deleted directly
+// as they are in a lower layer
+type Whiteout struct {
+	// Prefix and Suffix are added to the name of an entry
+	// to name its marker
+	Prefix string
+	Suffix string
+}
+
+// OCIWhiteout is the convention of the OCI image layers,
+// and AUFS, which prefix the markers with ".wh."
+var OCIWhiteout = Whiteout{Prefix: ".wh."}
+
+// Marker returns the path of the marker of the entry at path
+func (w Whiteout) Marker(path string) string {
+	return filepath.Join(filepath.Dir(path), w.Prefix+filepath.Base(path)+w.Suffix)
+}
+
+// Target returns the name of the entry marked by the marker of the
+// given name, and false if name is not that of a marker, or would
+// mark ".", ".." or a name with a path separator
+func (w Whiteout) Target(name string) (string, bool) {
+	if w.Prefix == "" && w.Suffix == "" {
+		return "", false
+	}
+
+	if len(name) <= len(w.Prefix)+len(w.Suffix) {
+		return "", false
+	}
+
+	if !strings.HasPrefix(name, w.Prefix) || !strings.HasSuffix(name, w.Suffix) {
+		return "", false
+	}
+
+	target := name[len(w.Prefix) : len(name)-len(w.Suffix)]
+	if target == "." || target == ".." || strings.ContainsAny(target, `/`+string(filepath.Separator)) {
+		return "", false
+	}
+
+	return target, true
+}
+
+// Mark creates the marker of the entry at path, which is left as is
+func (w Whiteout) Mark(path string) error {
+	marker := w.Marker(path)
+	fd, err := os.OpenFile(marker, os.O_WRONLY|os.O_CREATE, 0644)
+	if err != nil {
+		return fmt.Errorf("unable to white out %s (%w)", path, err)
+	}
+
+	return fd.Close()
+}
+
+// Unmark removes the marker of the entry at path, if any
+func (w Whiteout) Unmark(path string) error {
+	err := os.Remove(w.Marker(path))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+
+	return err
+}
+
+// ApplyWhiteouts removes, from the dir tree, the markers of the given
+// convention and the entries they mark, e.g. to flatten the layers of
+// a tree once merged, and returns the paths of the entries removed.
+// Entries that links would lead out of dir are not removed, and an
+// UnsafePathError is returned.
+func ApplyWhiteouts(dir string, w Whiteout) ([]string, error) {
+	var markers []string
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if _, ok := w.Target(info.Name()); ok && path != dir && info.Mode().IsRegular() {
+			markers = append(markers, path)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var removed []string
+	for _, marker := range markers {
+		name, _ := w.Target(filepath.Base(marker))
+		target := filepath.Join(filepath.Dir(marker), name)
+
+		ok, err := IsWithin(dir, filepath.Dir(target))
+		if err != nil {
+			return removed, err
+		}
+
+		if !ok {
+			return removed, UnsafePathError{target}
+		}
+
+		if _, err := os.Lstat(target); err == nil {
+			if err := (OSFilesystem{}).RemoveAll(target); err != nil {
+				return removed, err
+			}
+			removed = append(removed, target)
+		}
+
+		if err := (OSFilesystem{}).Remove(marker); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return removed, err
+		}
+	}
+
+	return removed, nil
+}
@@ -0,0 +1,135 @@
+package fs_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/brinick/fs"
+)
+
+func TestWhiteoutTarget(t *testing.T) {
+	suffixed := fs.Whiteout{Prefix: ".", Suffix: ".deleted"}
+
+	tests := []struct {
+		w      fs.Whiteout
+		name   string
+		target string
+		ok     bool
+	}{
+		{fs.OCIWhiteout, ".wh.a", "a", true},
+		{fs.OCIWhiteout, ".wh.", "", false},
+		{fs.OCIWhiteout, "a", "", false},
+		{fs.OCIWhiteout, ".wh..", "", false},
+		{fs.OCIWhiteout, ".wh...", "", false},
+		{fs.OCIWhiteout, ".wh.a/b", "", false},
+		{suffixed, ".a.deleted", "a", true},
+		{suffixed, ".deleted", "", false},
+		{fs.Whiteout{}, "a", "", false},
+	}
+
+	for _, tt := range tests {
+		target, ok := tt.w.Target(tt.name)
+		if target != tt.target || ok != tt.ok {
+			t.Errorf("%s: expected %q, %v, got %q, %v", tt.name, tt.target, tt.ok, target, ok)
+		}
+
+		if ok && filepath.Base(tt.w.Marker(filepath.Join("dir", target))) != tt.name {
+			t.Errorf("%s: expected the marker of %s, got %s", tt.name, target, tt.w.Marker(target))
+		}
+	}
+}
+
+func TestApplyWhiteoutsEscape(t *testing.T) {
+	root := newTree(t, map[string]int{"sub/a": 10, "sub/.wh..": 0, "sub/.wh...": 0})
+	src := filepath.Join(root, "src")
+
+	removed, err := fs.ApplyWhiteouts(filepath.Join(src, "sub"), fs.OCIWhiteout)
+	if err != nil {
+		t.Fatalf("unable to apply whiteouts: %v", err)
+	}
+
+	if len(removed) != 0 {
+		t.Errorf("expected nothing removed, got %v", removed)
+	}
+
+	for _, path := range []string{"sub/a", "sub/.wh..", "sub/.wh..."} {
+		if _, err := os.Lstat(filepath.Join(src, path)); err != nil {
+			t.Errorf("expected %s left: %v", path, err)
+		}
+	}
+}
+
+func TestSyncWhiteout(t *testing.T) {
+	root := newTree(t, map[string]int{"a": 10, "sub/b": 20, "c": 30})
+	src := filepath.Join(root, "src")
+	dst := filepath.Join(root, "dst")
+
+	opts := fs.SyncOptions{Delete: true, Whiteout: &fs.OCIWhiteout}
+	if _, err := fs.Sync(src, dst, opts); err != nil {
+		t.Fatal(err)
+	}
+
+	os.Remove(filepath.Join(src, "a"))
+	os.RemoveAll(filepath.Join(src, "sub"))
+
+	plan, err := fs.PlanSync(src, dst, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(plan.Actions) != 2 || plan.Actions[0].Type != fs.SyncWhiteout {
+		t.Errorf("expected 2 whiteouts planned, got %v", plan.Actions)
+	}
+
+	summary, err := fs.Sync(src, dst, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := strings.Join(relPaths(t, dst, summary.WhitedOut), ",")
+	if got != "a,sub" || len(summary.Deleted) != 0 {
+		t.Errorf("expected a and sub whited out, none deleted, got %s and %v", got, summary.Deleted)
+	}
+
+	for _, path := range []string{"a", ".wh.a", "sub/b", ".wh.sub"} {
+		if _, err := os.Lstat(filepath.Join(dst, path)); err != nil {
+			t.Errorf("expected %s in the destination: %v", path, err)
+		}
+	}
+
+	// Already whited out
+	if summary, _ := fs.Sync(src, dst, opts); len(summary.WhitedOut) != 0 {
+		t.Errorf("expected nothing more whited out, got %v", summary.WhitedOut)
+	}
+
+	// Back in the source
+	if err := ioutil.WriteFile(filepath.Join(src, "a"), []byte("again"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fs.Sync(src, dst, opts); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Lstat(filepath.Join(dst, ".wh.a")); !os.IsNotExist(err) {
+		t.Errorf("expected the whiteout of a removed, got %v", err)
+	}
+
+	removed, err := fs.ApplyWhiteouts(dst, fs.OCIWhiteout)
+	if err != nil {
+		t.Fatalf("unable to apply whiteouts: %v", err)
+	}
+
+	if got := strings.Join(relPaths(t, dst, removed), ","); got != "sub" {
+		t.Errorf("expected sub removed, got %s", got)
+	}
+
+	infos, _ := ioutil.ReadDir(dst)
+	var names []string
+	for _, info := range infos {
+		names = append(names, info.Name())
+	}
+	if strings.Join(names, ",") != "a,c" {
+		t.Errorf("expected a and c left, got %v", names)
+	}
+}
@@ -0,0 +1,122 @@
+package fs
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// Workspace tracks the temporary files and directories created through
+// it, e.g. to stage files before a transaction, and removes them all
+// once closed:
+//
+//	ws := fs.NewWorkspace()
+//	defer ws.Close()
+type Workspace struct {
+	// KeepOnError keeps the tracked entries on Close once Fail has
+	// been called, e.g. to inspect what was staged by a failed build
+	KeepOnError bool
+
+	mu     sync.Mutex
+	paths  []string
+	failed bool
+	closed bool
+}
+
+// NewWorkspace returns a new empty workspace
+func NewWorkspace() *Workspace {
+	return &Workspace{}
+}
+
+// TempDir creates a tracked temporary directory. See TempDir.
+func (w *Workspace) TempDir(prefix string) (*Directory, error) {
+	tmp, err := TempDir(prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	w.Track(tmp.Path)
+	return tmp.Directory, nil
+}
+
+// TempFile creates a tracked temporary file. See TempFile.
+func (w *Workspace) TempFile(dir, pattern string) (*File, error) {
+	tmp, err := TempFile(dir, pattern)
+	if err != nil {
+		return nil, err
+	}
+
+	w.Track(tmp.Path)
+	return tmp.File, nil
+}
+
+// Mkdir creates the tracked directory, and its missing parents, which
+// are not tracked, with the given mode. It is an error if it exists.
+func (w *Workspace) Mkdir(path string, mode os.FileMode) (*Directory, error) {
+	// An existing directory is not the workspace's to remove
+	if err := mkdirAll(OSFilesystem{}, filepath.Dir(path), mode); err != nil {
+		return nil, err
+	}
+
+	if err := os.Mkdir(path, mode); err != nil {
+		return nil, err
+	}
+
+	if err := applyPolicy(OSFilesystem{}, path, policy()); err != nil {
+		return nil, err
+	}
+
+	w.Track(path)
+	return &Directory{Path: path}, nil
+}
+
+// Track adds files or directories, created otherwise, to those
+// removed on Close
+func (w *Workspace) Track(paths ...string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.paths = append(w.paths, paths...)
+}
+
+// Paths returns the tracked paths, in the order they were tracked
+func (w *Workspace) Paths() []string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	return append([]string(nil), w.paths...)
+}
+
+// Fail marks the work done in the workspace as failed, so
+// that its entries are kept on Close if KeepOnError is set
+func (w *Workspace) Fail() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.failed = true
+}
+
+// Close removes the tracked entries, most recent first, unless kept on
+// error. All are tried, and the errors of those that could not be
+// removed are returned together in a MultiError of *os.PathError.
+// Closing a closed workspace does nothing.
+func (w *Workspace) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.closed || w.failed && w.KeepOnError {
+		w.closed = true
+		return nil
+	}
+
+	w.closed = true
+
+	var errs MultiError
+	for i := len(w.paths) - 1; i >= 0; i-- {
+		if err := os.RemoveAll(w.paths[i]); err != nil {
+			errs = append(errs, asPathError("remove", w.paths[i], err))
+		}
+	}
+
+	return errs.errOrNil()
+}
@@ -0,0 +1,78 @@
+package fs_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/brinick/fs"
+)
+
+func TestWorkspace(t *testing.T) {
+	root, clean := tempDir()
+	defer clean()
+
+	tests := []struct {
+		name string
+		keep bool
+		fail bool
+		kept bool
+	}{
+		{"removed", false, false, false},
+		{"failed removed", false, true, false},
+		{"kept on error", true, true, true},
+		{"not failed", true, false, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ws := fs.NewWorkspace()
+			ws.KeepOnError = tt.keep
+
+			stage, err := ws.Mkdir(filepath.Join(root, tt.name, "stage"), 0755)
+			if err != nil {
+				t.Fatalf("unable to create dir: %v", err)
+			}
+
+			if _, err := ws.Mkdir(stage.Path, 0755); err == nil {
+				t.Errorf("expected an error creating an existing dir")
+			}
+
+			tmp, err := ws.TempDir("fs-ws")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			f, err := ws.TempFile(root, "staged-*")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if paths := ws.Paths(); len(paths) != 3 {
+				t.Errorf("expected 3 tracked paths, got %v", paths)
+			}
+
+			if tt.fail {
+				ws.Fail()
+			}
+
+			for i := 0; i < 2; i++ {
+				if err := ws.Close(); err != nil {
+					t.Fatalf("unable to close: %v", err)
+				}
+			}
+
+			for _, path := range []string{stage.Path, tmp.Path, f.Path} {
+				if _, err := os.Stat(path); (err == nil) != tt.kept {
+					t.Errorf("%s: expected kept %v, got %v", path, tt.kept, err)
+				}
+				os.RemoveAll(path)
+			}
+
+			// Untracked parents are left
+			if _, err := os.Stat(filepath.Join(root, tt.name)); err != nil {
+				t.Errorf("expected the parent left, got %v", err)
+			}
+		})
+	}
+}